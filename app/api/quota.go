@@ -0,0 +1,32 @@
+package api
+
+// QuotaPeriod is the period over which token usage is counted.
+type QuotaPeriod string
+
+const (
+	// DailyPeriod counts usage since midnight UTC.
+	DailyPeriod QuotaPeriod = "daily"
+	// MonthlyPeriod counts usage since midnight UTC on the first of the month.
+	MonthlyPeriod QuotaPeriod = "monthly"
+)
+
+// QuotaPolicy limits the number of tokens principals can use.
+type QuotaPolicy struct {
+	// Quotas is a list of quotas. A principal can't generate responses if it has exceeded any of the quotas
+	// that apply to it.
+	Quotas []Quota `json:"quotas" yaml:"quotas"`
+}
+
+// Quota limits the number of tokens the members can use in a period.
+// For a member of kind user the limit applies to that user's usage. For a member of kind domain the limit applies
+// to the combined usage of all the users in the domain.
+type Quota struct {
+	// Members are the users and domains the quota applies to.
+	Members []Member `json:"members" yaml:"members"`
+
+	// Period is the period over which usage is counted; one of daily or monthly.
+	Period QuotaPeriod `json:"period" yaml:"period"`
+
+	// MaxTokens is the maximum number of tokens (input and output) that can be used in the period.
+	MaxTokens int64 `json:"maxTokens" yaml:"maxTokens"`
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jlewi/cloud-assistant/app/pkg/application"
+	"github.com/jlewi/cloud-assistant/app/pkg/feedback"
+	"github.com/jlewi/cloud-assistant/protos/gen/cassie"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func NewFeedbackCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "feedback",
+		Short: "Commands to work with the feedback users submit on responses",
+	}
+	cmd.AddCommand(NewFeedbackExportCmd())
+	return cmd
+}
+
+func NewFeedbackExportCmd() *cobra.Command {
+	var since string
+	var outDir string
+	cmd := cobra.Command{
+		Use:   "export",
+		Short: "Write negative feedback as EvalSample YAML skeletons for the eval dataset",
+		Long: "Write an EvalSample for each thumbs down into the output directory. Samples that already exist are " +
+			"skipped so edits to exported samples aren't overwritten.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			app := application.NewApp()
+			if err := app.LoadConfig(cmd); err != nil {
+				return err
+			}
+
+			cfg := app.Config.CloudAssistant
+			if cfg == nil || cfg.Feedback == nil || cfg.Feedback.Path == "" {
+				return errors.New("cloudAssistant.feedback.path must be set to export feedback")
+			}
+			if outDir == "" {
+				return errors.New("--out must be set")
+			}
+
+			start := time.Time{}
+			if since != "" {
+				var err error
+				start, err = time.Parse("2006-01-02", since)
+				if err != nil {
+					return errors.Wrapf(err, "--since must be a date in the form YYYY-MM-DD")
+				}
+			}
+
+			store, err := feedback.NewBoltStore(cfg.Feedback.Path)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+			all, err := store.List(cmd.Context(), start)
+			if err != nil {
+				return err
+			}
+			if err := os.MkdirAll(outDir, 0o755); err != nil {
+				return errors.Wrapf(err, "Failed to create directory %s", outDir)
+			}
+
+			written := 0
+			skipped := 0
+			for _, f := range all {
+				if f.GetRating() != cassie.Rating_RATING_THUMBS_DOWN {
+					continue
+				}
+				path := filepath.Join(outDir, "feedback-"+f.GetId()+".yaml")
+				if _, err := os.Stat(path); err == nil {
+					skipped++
+					continue
+				}
+				b, err := feedback.MarshalEvalSample(f)
+				if err != nil {
+					return err
+				}
+				if err := os.WriteFile(path, b, 0o644); err != nil {
+					return errors.Wrapf(err, "Failed to write %s", path)
+				}
+				written++
+			}
+			fmt.Fprintf(os.Stdout, "Wrote %d samples to %s; skipped %d that already exist\n", written, outDir, skipped)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&since, "since", "", "Only export feedback submitted on or after this date (YYYY-MM-DD, UTC).")
+	cmd.Flags().StringVar(&outDir, "out", "", "Directory to write the samples to e.g. the dataset of an experiment.")
+	return &cmd
+}
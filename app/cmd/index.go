@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/jlewi/cloud-assistant/app/pkg/application"
+	"github.com/jlewi/cloud-assistant/app/pkg/search"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func NewIndexCmd() *cobra.Command {
+	cmd := cobra.Command{
+		Use:   "index",
+		Short: "Rebuild the index of the local documentation",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			app := application.NewApp()
+			if err := app.LoadConfig(cmd); err != nil {
+				return err
+			}
+
+			cfg := app.Config.CloudAssistant
+			if cfg == nil || cfg.LocalDocs == nil || cfg.LocalDocs.Dir == "" || cfg.LocalDocs.IndexPath == "" {
+				return errors.New("cloudAssistant.localDocs.dir and cloudAssistant.localDocs.indexPath must be set to build the index")
+			}
+
+			index, err := search.BuildIndex(cfg.LocalDocs.Dir)
+			if err != nil {
+				return err
+			}
+			if err := index.Save(cfg.LocalDocs.IndexPath); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Indexed %d sections of %s in %s\n", len(index.Chunks), cfg.LocalDocs.Dir, cfg.LocalDocs.IndexPath)
+			return nil
+		},
+	}
+	return &cmd
+}
@@ -26,6 +26,9 @@ func NewRootCmd() *cobra.Command {
 	rootCmd.AddCommand(NewServeCmd())
 	rootCmd.AddCommand(NewEnvCmd())
 	rootCmd.AddCommand(NewEvalCmd())
+	rootCmd.AddCommand(NewUsageCmd())
+	rootCmd.AddCommand(NewFeedbackCmd())
+	rootCmd.AddCommand(NewIndexCmd())
 
 	return rootCmd
 }
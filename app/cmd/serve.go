@@ -5,9 +5,12 @@ import (
 
 	"github.com/jlewi/cloud-assistant/app/pkg/ai"
 	"github.com/jlewi/cloud-assistant/app/pkg/application"
+	"github.com/jlewi/cloud-assistant/app/pkg/runme"
 	"github.com/jlewi/cloud-assistant/app/pkg/server"
 	"github.com/jlewi/cloud-assistant/app/pkg/tlsbuilder"
+	"github.com/jlewi/cloud-assistant/app/pkg/usage"
 	"github.com/spf13/cobra"
+	"go.uber.org/zap"
 )
 
 func NewServeCmd() *cobra.Command {
@@ -34,13 +37,58 @@ func NewServeCmd() *cobra.Command {
 			if err := agentOptions.FromAssistantConfig(*app.Config.CloudAssistant); err != nil {
 				return err
 			}
+			agentOptions.ServerName = app.Config.Metadata.Name
+			agentOptions.Model = app.Config.GetModel()
 
-			client, err := ai.NewClient(*app.Config.OpenAI)
+			// The Chat Completions provider keeps its history in the conversation store so responses can be continued
+			// after a restart.
+			provider, err := ai.NewProvider(*app.Config, agentOptions.ConversationStore)
 			if err != nil {
 				return err
 			}
 
-			agentOptions.Client = client
+			agentOptions.Provider = provider
+
+			fallbacks, err := ai.NewFallbacks(*app.Config, agentOptions.ConversationStore)
+			if err != nil {
+				return err
+			}
+			agentOptions.Fallbacks = fallbacks
+
+			if len(app.Config.CloudAssistant.MCPServers) > 0 {
+				mcpClients, err := ai.ConnectMCPServers(cmd.Context(), app.Config.CloudAssistant.MCPServers)
+				if err != nil {
+					return err
+				}
+				defer mcpClients.Close()
+
+				mcpTools, err := mcpClients.Tools(cmd.Context())
+				if err != nil {
+					return err
+				}
+				agentOptions.Tools = append(agentOptions.Tools, mcpTools...)
+			}
+
+			if agentOptions.Autopilot {
+				// Autopilot gets its own runner so commands it runs don't share sessions with the user's terminals.
+				runner, err := runme.NewRunner(zap.L())
+				if err != nil {
+					return err
+				}
+				agentOptions.Runner = runner
+			}
+
+			if app.Config.QuotaPolicy != nil {
+				if agentOptions.UsageStore == nil {
+					// Quotas need somewhere to count usage; without a configured store counts reset on restart.
+					agentOptions.UsageStore = usage.NewMemoryStore()
+				}
+				quotas, err := usage.NewQuotaChecker(*app.Config.QuotaPolicy, agentOptions.UsageStore)
+				if err != nil {
+					return err
+				}
+				agentOptions.Quotas = quotas
+			}
 
 			agent, err := ai.NewAgent(*agentOptions)
 			if err != nil {
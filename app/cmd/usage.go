@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jlewi/cloud-assistant/app/pkg/application"
+	"github.com/jlewi/cloud-assistant/app/pkg/usage"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func NewUsageCmd() *cobra.Command {
+	var since string
+	var byDomain bool
+	cmd := cobra.Command{
+		Use:   "usage",
+		Short: "Report the tokens used by each user or domain",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			app := application.NewApp()
+			if err := app.LoadConfig(cmd); err != nil {
+				return err
+			}
+
+			cfg := app.Config.CloudAssistant
+			if cfg == nil || cfg.Usage == nil || cfg.Usage.Path == "" {
+				return errors.New("cloudAssistant.usage.path must be set to report usage")
+			}
+
+			start, err := time.Parse("2006-01-02", since)
+			if err != nil {
+				return errors.Wrapf(err, "--since must be a date in the form YYYY-MM-DD")
+			}
+
+			store, err := usage.NewBoltStore(cfg.Usage.Path, cfg.Usage.Retention)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+			records, err := store.List(cmd.Context(), start)
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "KEY\tRESPONSES\tINPUT\tCACHED INPUT\tOUTPUT\tTOTAL")
+			for _, s := range usage.Summarize(records, byDomain) {
+				key := s.Key
+				if key == "" {
+					key = "<unauthenticated>"
+				}
+				fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\n", key, s.Responses, s.InputTokens, s.CachedInputTokens, s.OutputTokens, s.TotalTokens)
+			}
+			return w.Flush()
+		},
+	}
+
+	firstOfMonth := time.Now().UTC().Format("2006-01") + "-01"
+	cmd.Flags().StringVar(&since, "since", firstOfMonth, "Report usage on or after this date (YYYY-MM-DD, UTC).")
+	cmd.Flags().BoolVar(&byDomain, "by-domain", false, "Total usage by the domain of each user rather than by user.")
+	return &cmd
+}
@@ -2,7 +2,8 @@ package ai
 
 import (
 	"context"
-	"encoding/json"
+	"fmt"
+	"time"
 
 	"github.com/openai/openai-go/option"
 
@@ -10,14 +11,19 @@ import (
 	"github.com/go-logr/logr"
 	"github.com/go-logr/zapr"
 	"github.com/google/uuid"
+	"github.com/jlewi/cloud-assistant/app/pkg/compact"
 	"github.com/jlewi/cloud-assistant/app/pkg/config"
+	"github.com/jlewi/cloud-assistant/app/pkg/feedback"
+	"github.com/jlewi/cloud-assistant/app/pkg/iam"
+	"github.com/jlewi/cloud-assistant/app/pkg/links"
 	"github.com/jlewi/cloud-assistant/app/pkg/logs"
+	"github.com/jlewi/cloud-assistant/app/pkg/redact"
+	"github.com/jlewi/cloud-assistant/app/pkg/risk"
+	"github.com/jlewi/cloud-assistant/app/pkg/usage"
 	"github.com/openai/openai-go"
 	"github.com/openai/openai-go/responses"
 	"go.uber.org/zap"
-	"google.golang.org/protobuf/proto"
 
-	lru "github.com/hashicorp/golang-lru/v2"
 	"github.com/jlewi/cloud-assistant/protos/gen/cassie"
 	"github.com/pkg/errors"
 	"go.opentelemetry.io/otel/trace"
@@ -44,29 +50,95 @@ Follow these rules
 	DefaultShellToolDescription = `The shell tool executes CLIs (e.g. kubectl, gh, yq, jq, git, az, bazel, curl, wget, etc...
 These CLIs can be used to act and observe on the cloud (Kubernetes, GitHub, Azure, etc...).
 The input is a short bash program that can be executed. Additional CLIs can be installed by running the appropriate
-commands.
-
-The output of the shell tool is a JSON object with the fields "stderr" and "stdout" containing the output of the
-command. If neither of these fields are set then the user hasn't executed the command yet.
+commands. Set language to run a program in another language instead of wrapping it in a bash heredoc e.g. python for
+short Python scripts, jq for jq programs and kubectl-apply for Kubernetes manifests to apply.
+
+The output of the shell tool is a JSON object with the fields "STDOUT" and "STDERR" containing the output of the
+command. Once the command has run it also has the fields
+  - "exit_code": the exit code of the command; it is missing if the command didn't finish
+  - "started_at" and "duration": when the command started and how long it ran
+  - "cancelled": true if the command was cancelled before it finished e.g. because it timed out
+  - "truncated": true if the output was too large and was compacted
+  - "runner": the runner that executed the command
+If none of these fields are set then the user hasn't executed the command yet.
 `
 
 	ShellToolName = "shell"
+
+	// DefaultMaxSteps is the default maximum number of requests the agent sends to the model in response to a single
+	// GenerateRequest when it executes tool calls on the server. It guards against the model calling tools in a loop.
+	DefaultMaxSteps = 10
+
+	// DefaultCommandTimeout is how long autopilot lets a command run before cancelling it.
+	DefaultCommandTimeout = 30 * time.Second
+
+	// DefaultMaxBlockOutputTokens is the default budget for the outputs of a single block sent to the model.
+	DefaultMaxBlockOutputTokens = 4000
 )
 
 // Agent implements the AI Service
 // https://buf.build/jlewi/foyle/file/main:foyle/v1alpha1/agent.proto#L44
 type Agent struct {
-	Client               *openai.Client
-	instructions         string
-	shellToolDescription string
-	vectorStoreIDs       []string
-	filenameToLink       func(string) string
-
-	// responseCache is a cache to store the mapping from the previous response ID to the block IDs for function calling
-	responseCache *lru.Cache[string, []string]
-
-	// blocksCache is a cache to store the mapping from blockID to block
-	blocksCache *lru.Cache[string, *cassie.Block]
+	provider       Provider
+	instructions   *promptTemplate
+	tools          *ToolRegistry
+	serverName     string
+	promptValues   map[string]string
+	vectorStoreIDs []string
+	fileToLink     func(fileID string, filename string) string
+
+	// defaultModel is the model to use when the request doesn't specify one.
+	defaultModel string
+	// models is the allow-list of models keyed by name.
+	models map[string]config.ModelConfig
+
+	// store records the responses and their tool calls so they can be filled in on subsequent requests.
+	store ConversationStore
+
+	// maxSteps is the maximum number of requests to the model per GenerateRequest.
+	maxSteps int
+	// autopilot indicates whether read-only shell commands are run on the server.
+	autopilot bool
+	// commandTimeout is how long autopilot lets a command run.
+	commandTimeout time.Duration
+	runner         CommandRunner
+	// classifier classifies the risk of shell commands.
+	classifier *risk.Classifier
+	// autorun are the commands autopilot may run.
+	autorun *risk.AllowList
+
+	// stateless indicates requests contain the whole conversation rather than referring to a previous response.
+	stateless bool
+	// maxInputTokens is the token budget for the conversation history in stateless mode.
+	maxInputTokens int
+
+	// usage records the token usage of each response. If nil usage is only logged.
+	usage usage.Store
+	// quotas limits the tokens principals can use. If nil there are no limits.
+	quotas *usage.QuotaChecker
+	// feedback stores the feedback submitted with SubmitFeedback. If nil feedback is only logged.
+	feedback feedback.Store
+
+	// redactor redacts secrets from the outputs of blocks before they are sent to the model. If nil redaction is
+	// disabled.
+	redactor *redact.Redactor
+	// maxBlockOutputChars is the budget for the outputs of each block; larger outputs are compacted. If zero
+	// compaction is disabled.
+	maxBlockOutputChars int
+	// media decides which images and files in blocks are sent to the model.
+	media *mediaPolicy
+
+	// generations are the Generate calls in flight so they can be cancelled with CancelGenerate.
+	generations *generations
+
+	// providerName is the name of the provider e.g. config.ProviderOpenAI.
+	providerName string
+	// fallbacks are the models to try when the model of a request is rate limited or unavailable.
+	fallbacks []Fallback
+	// maxAttempts is the maximum number of attempts on each model.
+	maxAttempts int
+	// retryBackoff is the delay before the first retry on a model.
+	retryBackoff time.Duration
 
 	useOAuth bool // Use OAuth for authorization; if true then the token must be provided in the GenerateRequest
 }
@@ -74,14 +146,106 @@ type Agent struct {
 // AgentOptions are options for creating a new Agent
 type AgentOptions struct {
 	VectorStores []string
-	Client       *openai.Client
-	// Instructions are the prompt to use when generating responses
+	// Provider is the LLM backend to use.
+	Provider Provider
+	// Client is an OpenAI client. It is only used if Provider is nil in which case the Responses API is used.
+	Client *openai.Client
+	// Instructions are the prompt to use when generating responses. It is a Go text/template; see PromptData.
 	Instructions string
-	// ShellToolDescription is the description of the shell tool.
+	// InstructionsFile is a file containing the instructions. If set it takes precedence over Instructions and
+	// it is reloaded when it changes.
+	InstructionsFile string
+	// ShellToolDescription is the description of the shell tool. It is a Go text/template; see PromptData.
 	ShellToolDescription string
-
-	// FilenameToLink is an optional function that converts a filename to a link to be displayed in the UI.
-	FilenameToLink func(string) string
+	// ShellToolDescriptionFile is a file containing the description of the shell tool. If set it takes precedence
+	// over ShellToolDescription and it is reloaded when it changes.
+	ShellToolDescriptionFile string
+
+	// Tools are additional tools to expose to the model alongside the shell tool.
+	Tools []Tool
+
+	// ServerName is the name of the server made available to the templates.
+	ServerName string
+	// PromptValues are custom key/values made available to the templates.
+	PromptValues map[string]string
+
+	// FileToLink is an optional function that converts a file returned by file search to a link to be displayed in
+	// the UI. If nil the filename is used.
+	FileToLink func(fileID string, filename string) string
+
+	// Model is the default model. If empty config.DefaultModel is used.
+	Model string
+	// Models is the allow-list of models requests may select. The default model is always allowed.
+	Models []config.ModelConfig
+
+	// MaxSteps is the maximum number of requests to the model per GenerateRequest. If zero DefaultMaxSteps is used.
+	MaxSteps int
+	// Autopilot enables running read-only shell commands on the server with Runner and sending the output back to
+	// the model without waiting for the user.
+	Autopilot bool
+	// AutopilotCommands are the commands autopilot may run; they are matched like risk rules. Commands must also be
+	// read-only. It is required if Autopilot is true.
+	AutopilotCommands []string
+	// Runner runs commands for autopilot. It is required if Autopilot is true.
+	Runner CommandRunner
+	// CommandTimeout is how long autopilot lets a command run before cancelling it and sending the partial output
+	// to the model. If zero DefaultCommandTimeout is used.
+	CommandTimeout time.Duration
+
+	// RiskRules are added to risk.DefaultRules to classify shell commands.
+	RiskRules []risk.Rule
+	// DefaultRiskLevel is the level of commands that don't match any rule. If empty risk.LevelMutating is used.
+	DefaultRiskLevel risk.Level
+
+	// ConversationStore records responses and their tool calls. If nil they are kept in memory.
+	ConversationStore ConversationStore
+
+	// Stateless enables stateless mode. Requests must contain all the blocks in the conversation; the history is
+	// rebuilt from them on every request rather than using previous_response_id, and responses aren't stored by
+	// the provider.
+	Stateless bool
+	// MaxInputTokens is the token budget for the history in stateless mode. If zero DefaultMaxInputTokens is used.
+	MaxInputTokens int
+
+	// UsageStore records the token usage of each response. If nil usage is only logged.
+	UsageStore usage.Store
+	// Quotas limits the tokens principals can use. Requests from principals that have exceeded a quota fail with
+	// ResourceExhausted.
+	Quotas *usage.QuotaChecker
+
+	// FeedbackStore stores the feedback submitted with SubmitFeedback. If nil feedback is only logged.
+	FeedbackStore feedback.Store
+
+	// RedactionRules are added to redact.DefaultRules to redact secrets from the outputs of blocks.
+	RedactionRules []redact.Rule
+	// DisableRedaction turns off redaction so outputs are sent to the model as is.
+	DisableRedaction bool
+
+	// MaxBlockOutputTokens is the budget for the outputs of each block sent to the model. Larger outputs are
+	// compacted. If zero DefaultMaxBlockOutputTokens is used.
+	MaxBlockOutputTokens int
+	// DisableCompaction turns off compaction so outputs are sent to the model in full.
+	DisableCompaction bool
+
+	// MaxMediaBytes is the maximum size of an image or file in a block that is sent to the model. If zero
+	// DefaultMaxMediaBytes is used.
+	MaxMediaBytes int
+	// MediaMimeTypes are the MIME types of the images and files sent to the model. If empty DefaultMediaMimeTypes
+	// is used.
+	MediaMimeTypes []string
+	// DisableMedia turns off sending images and files to the model; they are replaced with a note.
+	DisableMedia bool
+
+	// ProviderName is the name of Provider e.g. config.ProviderOpenAI. It is reported in GenerateResponse.attempt.
+	ProviderName string
+	// Fallbacks are the models to try in order when the model of a request is rate limited or unavailable.
+	Fallbacks []Fallback
+	// MaxAttempts is the maximum number of attempts on each model when generations fail with transient errors.
+	// If zero DefaultMaxAttempts is used.
+	MaxAttempts int
+	// RetryBackoff is the delay before the first retry; it doubles with each retry. If zero DefaultRetryBackoff is
+	// used.
+	RetryBackoff time.Duration
 
 	// UseOAuth indicates whether to use OAuth for authentication
 	// If true then the token must be provided in the GenerateRequest
@@ -91,69 +255,242 @@ type AgentOptions struct {
 // FromAssistantConfig overrides the AgentOptions based on the values from the AssistantConfig
 func (o *AgentOptions) FromAssistantConfig(cfg config.CloudAssistantConfig) error {
 	o.VectorStores = cfg.VectorStores
-
-	// TODO(jlewi): We should allow the user to specify the instructions in the config as a path to a file containing
-	// the instructions.
+	o.Model = cfg.GetModel()
+	o.Models = cfg.Models
+	o.InstructionsFile = cfg.InstructionsFile
+	o.ShellToolDescriptionFile = cfg.ShellToolDescriptionFile
+	o.PromptValues = cfg.PromptValues
+	o.ProviderName = cfg.GetProvider()
+	if cfg.Resilience != nil {
+		o.MaxAttempts = cfg.Resilience.MaxAttempts
+		o.RetryBackoff = cfg.Resilience.Backoff
+	}
+	if cfg.Autopilot != nil {
+		o.Autopilot = cfg.Autopilot.Enabled
+		o.AutopilotCommands = cfg.Autopilot.Commands
+		o.MaxSteps = cfg.Autopilot.MaxSteps
+		o.CommandTimeout = cfg.Autopilot.CommandTimeout
+	}
+	if cfg.Risk != nil {
+		o.RiskRules = cfg.Risk.Rules
+		o.DefaultRiskLevel = cfg.Risk.DefaultLevel
+	}
+	if cfg.Redaction != nil {
+		o.RedactionRules = cfg.Redaction.Rules
+		o.DisableRedaction = cfg.Redaction.Disabled
+	}
+	if cfg.Compaction != nil {
+		o.MaxBlockOutputTokens = cfg.Compaction.MaxBlockTokens
+		o.DisableCompaction = cfg.Compaction.Disabled
+	}
+	if cfg.Media != nil {
+		o.MaxMediaBytes = cfg.Media.MaxBytes
+		o.MediaMimeTypes = cfg.Media.AllowedMimeTypes
+		o.DisableMedia = cfg.Media.Disabled
+	}
+	if cfg.Stateless != nil {
+		o.Stateless = cfg.Stateless.Enabled
+		o.MaxInputTokens = cfg.Stateless.MaxInputTokens
+	}
+	if cfg.Usage != nil && cfg.Usage.Path != "" {
+		store, err := usage.NewBoltStore(cfg.Usage.Path, cfg.Usage.Retention)
+		if err != nil {
+			return err
+		}
+		o.UsageStore = store
+	}
+	if cfg.Feedback != nil && cfg.Feedback.Path != "" {
+		store, err := feedback.NewBoltStore(cfg.Feedback.Path)
+		if err != nil {
+			return err
+		}
+		o.FeedbackStore = store
+	}
+	if cfg.Links != nil {
+		resolver, err := links.NewResolver(*cfg.Links)
+		if err != nil {
+			return err
+		}
+		o.FileToLink = resolver.Link
+	}
+	if cfg.LocalDocs != nil {
+		tool, err := NewDocsSearchToolFromConfig(*cfg.LocalDocs, o.FileToLink)
+		if err != nil {
+			return err
+		}
+		o.Tools = append(o.Tools, tool)
+	}
+	if cfg.ConversationStore != nil {
+		if cfg.ConversationStore.Path != "" {
+			store, err := NewBoltConversationStore(cfg.ConversationStore.Path, cfg.ConversationStore.TTL)
+			if err != nil {
+				return err
+			}
+			o.ConversationStore = store
+		} else {
+			o.ConversationStore = NewMemoryConversationStore(defaultMemoryStoreSize, cfg.ConversationStore.TTL)
+		}
+	}
 	return nil
 }
 
 func NewAgent(opts AgentOptions) (*Agent, error) {
-	if opts.Client == nil {
-		return nil, errors.New("Client is nil")
+	if opts.Provider == nil {
+		if opts.Client == nil {
+			return nil, errors.New("Provider and Client are both nil; one of them must be set")
+		}
+		opts.Provider = NewResponsesProvider(opts.Client)
 	}
 	log := zapr.NewLogger(zap.L())
-	if opts.Instructions == "" {
+	if opts.Instructions == "" && opts.InstructionsFile == "" {
 		opts.Instructions = DefaultInstructions
 		log.Info("Using default system prompt")
 	}
 
-	if opts.ShellToolDescription == "" {
+	if opts.ShellToolDescription == "" && opts.ShellToolDescriptionFile == "" {
 		opts.ShellToolDescription = DefaultShellToolDescription
 		log.Info("Using default shell tool description")
 	}
 
-	// Create a cache to store the mapping from the previous response ID to the block IDs for function calling
-	// Should we use an expirable cache?
-	responseCache, err := lru.New[string, []string](10000)
+	var instructions *promptTemplate
+	var err error
+	if opts.InstructionsFile != "" {
+		log.Info("Loading instructions from file", "file", opts.InstructionsFile)
+		instructions, err = newPromptTemplateFromFile("instructions", opts.InstructionsFile)
+	} else {
+		instructions, err = newPromptTemplate("instructions", opts.Instructions)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var shellToolDescription *promptTemplate
+	if opts.ShellToolDescriptionFile != "" {
+		log.Info("Loading shell tool description from file", "file", opts.ShellToolDescriptionFile)
+		shellToolDescription, err = newPromptTemplateFromFile("shellToolDescription", opts.ShellToolDescriptionFile)
+	} else {
+		shellToolDescription, err = newPromptTemplate("shellToolDescription", opts.ShellToolDescription)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	classifier, err := risk.NewClassifier(opts.RiskRules, opts.DefaultRiskLevel)
 	if err != nil {
-		return nil, errors.Wrap(err, "Failed to create response cache")
+		return nil, err
+	}
+
+	var redactor *redact.Redactor
+	if !opts.DisableRedaction {
+		redactor, err = redact.NewRedactor(opts.RedactionRules)
+		if err != nil {
+			return nil, err
+		}
 	}
-	// Create a cache to store the mapping from blockID to block
-	blocksCache, err := lru.New[string, *cassie.Block](10000)
+
+	tools, err := NewToolRegistry(&ShellTool{description: shellToolDescription, classifier: classifier})
 	if err != nil {
-		return nil, errors.Wrap(err, "Failed to create blocks cache")
+		return nil, err
+	}
+	for _, t := range opts.Tools {
+		if err := tools.Register(t); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Model == "" {
+		opts.Model = config.DefaultModel
+	}
+
+	if opts.MaxSteps <= 0 {
+		opts.MaxSteps = DefaultMaxSteps
+	}
+
+	if opts.CommandTimeout <= 0 {
+		opts.CommandTimeout = DefaultCommandTimeout
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultMaxAttempts
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = DefaultRetryBackoff
+	}
+
+	if opts.MaxInputTokens <= 0 {
+		opts.MaxInputTokens = DefaultMaxInputTokens
+	}
+
+	if opts.MaxBlockOutputTokens <= 0 {
+		opts.MaxBlockOutputTokens = DefaultMaxBlockOutputTokens
+	}
+	maxBlockOutputChars := opts.MaxBlockOutputTokens * charsPerToken
+	if opts.DisableCompaction {
+		maxBlockOutputChars = 0
+	}
+
+	if opts.Autopilot && opts.Runner == nil {
+		return nil, errors.New("Runner must be set when autopilot is enabled")
+	}
+	if opts.Autopilot && len(opts.AutopilotCommands) == 0 {
+		return nil, errors.New("AutopilotCommands must be set when autopilot is enabled")
+	}
+	autorun, err := risk.NewAllowList(opts.AutopilotCommands)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid autopilot commands")
+	}
+
+	if opts.Quotas != nil && opts.UsageStore == nil {
+		return nil, errors.New("UsageStore must be set when quotas are enforced")
+	}
+
+	models := make(map[string]config.ModelConfig)
+	for _, m := range opts.Models {
+		models[m.Name] = m
+	}
+	if _, ok := models[opts.Model]; !ok {
+		models[opts.Model] = config.ModelConfig{Name: opts.Model}
+	}
+
+	if opts.ConversationStore == nil {
+		opts.ConversationStore = NewMemoryConversationStore(defaultMemoryStoreSize, DefaultConversationTTL)
 	}
 
 	log.Info("Creating Agent", "options", opts)
 
 	return &Agent{
-		Client:               opts.Client,
-		instructions:         opts.Instructions,
-		shellToolDescription: opts.ShellToolDescription,
-		filenameToLink:       opts.FilenameToLink,
-		vectorStoreIDs:       opts.VectorStores,
-		responseCache:        responseCache,
-		blocksCache:          blocksCache,
-		useOAuth:             opts.UseOAuth,
+		provider:            opts.Provider,
+		instructions:        instructions,
+		tools:               tools,
+		serverName:          opts.ServerName,
+		promptValues:        opts.PromptValues,
+		fileToLink:          opts.FileToLink,
+		vectorStoreIDs:      opts.VectorStores,
+		defaultModel:        opts.Model,
+		models:              models,
+		store:               opts.ConversationStore,
+		maxSteps:            opts.MaxSteps,
+		autopilot:           opts.Autopilot,
+		commandTimeout:      opts.CommandTimeout,
+		runner:              opts.Runner,
+		classifier:          classifier,
+		autorun:             autorun,
+		stateless:           opts.Stateless,
+		maxInputTokens:      opts.MaxInputTokens,
+		usage:               opts.UsageStore,
+		quotas:              opts.Quotas,
+		feedback:            opts.FeedbackStore,
+		redactor:            redactor,
+		maxBlockOutputChars: maxBlockOutputChars,
+		media:               newMediaPolicy(opts.MaxMediaBytes, opts.MediaMimeTypes, opts.DisableMedia),
+		generations:         newGenerations(),
+		providerName:        opts.ProviderName,
+		fallbacks:           opts.Fallbacks,
+		maxAttempts:         opts.MaxAttempts,
+		retryBackoff:        opts.RetryBackoff,
+		useOAuth:            opts.UseOAuth,
 	}, nil
 }
 
-var (
-	shellToolJSONSchema = map[string]any{
-		"$schema": "http://json-schema.org/draft-07/schema#",
-		"title":   "Shell Function Schema",
-		"type":    "object",
-		"properties": map[string]interface{}{
-			"shell": map[string]interface{}{
-				"type":        "string",
-				"description": "A short bash program to be executed by bash",
-			},
-		},
-		"required":             []string{"shell"},
-		"additionalProperties": false,
-	}
-)
-
 func (a *Agent) Generate(ctx context.Context, req *connect.Request[cassie.GenerateRequest], resp *connect.ServerStream[cassie.GenerateResponse]) error {
 	return a.ProcessWithOpenAI(ctx, req.Msg, resp.Send)
 }
@@ -164,10 +501,120 @@ func (a *Agent) ProcessWithOpenAI(ctx context.Context, req *cassie.GenerateReque
 	traceId := span.SpanContext().TraceID()
 	log = log.WithValues("traceId", traceId)
 	ctx = logr.NewContext(ctx, log)
-	log.Info("Agent.Generate")
+	log.Info("Agent.Generate", "requestId", req.GetRequestId())
+
+	if a.stateless {
+		// The server doesn't have the history of the previous response so it would be silently dropped.
+		if req.GetPreviousResponseId() != "" {
+			return connect.NewError(connect.CodeInvalidArgument, errors.New("previous_response_id must not be set when the server is stateless; send all the blocks in the conversation instead"))
+		}
+		sender = withStateless(sender)
+	}
+
+	ctx, gen, done := a.generations.start(ctx, req.GetRequestId())
+	defer done()
+
+	branch, err := a.resolveBranch(ctx, req)
+	if err != nil {
+		return err
+	}
+	if branch != nil {
+		sender = withBranchID(sender, branch.GetId())
+	}
 
+	for step := 0; ; step++ {
+		builder, err := a.createResponse(ctx, req, sender, gen)
+		a.recordTurn(ctx, branch, builder)
+		if isCancelled(ctx) {
+			return a.sendCancelled(ctx, req, builder, sender)
+		}
+		if err != nil {
+			return err
+		}
+
+		// On the last step there's no point running commands for the user since we can't send the output to the
+		// model. Tools that only the server can execute are still executed.
+		lastStep := step+1 >= a.maxSteps
+		executed, pending, err := a.executeToolCalls(ctx, builder, sender, !lastStep)
+		if isCancelled(ctx) {
+			return a.sendCancelled(ctx, req, builder, sender)
+		}
+		if err != nil {
+			return err
+		}
+
+		// If there are calls the user needs to execute we return; the outputs of the calls we executed are in the
+		// conversation store so they will be filled in when the client sends the outputs of its calls.
+		if len(executed) == 0 || pending {
+			return nil
+		}
+
+		if lastStep {
+			log.Info("Reached the maximum number of steps; returning to the user", "maxSteps", a.maxSteps)
+			return nil
+		}
+
+		// Send the outputs back to the model.
+		next := &cassie.GenerateRequest{
+			Model:             req.GetModel(),
+			OpenaiAccessToken: req.GetOpenaiAccessToken(),
+		}
+		if a.stateless {
+			// There's no previous response to refer to so send the whole conversation including the response.
+			generated := builder.orderedBlocks()
+			next.Blocks = make([]*cassie.Block, 0, len(req.Blocks)+len(generated))
+			next.Blocks = append(next.Blocks, req.Blocks...)
+			next.Blocks = append(next.Blocks, generated...)
+		} else {
+			next.Blocks = executed
+			next.PreviousResponseId = builder.responseID
+		}
+		req = next
+	}
+}
+
+// createResponse sends a single request to the model and streams the resulting blocks to the sender.
+// It returns the builder so the caller can inspect the blocks generated by the model.
+// gen is the generation the response is part of; the ID of the response is registered with it so the response can
+// be cancelled.
+func (a *Agent) createResponse(ctx context.Context, req *cassie.GenerateRequest, sender BlockSender, gen *generation) (*BlocksBuilder, error) {
+	log := logs.FromContext(ctx)
 	if (len(req.Blocks)) < 1 {
-		return connect.NewError(connect.CodeInvalidArgument, errors.New("Blocks must be non-empty"))
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("Blocks must be non-empty"))
+	}
+
+	if a.quotas != nil {
+		if err := a.quotas.Check(ctx, iam.GetPrincipal(ctx)); err != nil {
+			log.Info("Rejecting request because a quota was exceeded", "err", err)
+			return nil, connect.NewError(connect.CodeResourceExhausted, err)
+		}
+	}
+
+	modelCfg, err := a.getModel(req.GetModel())
+	if err != nil {
+		log.Info("Rejecting request for model", "model", req.GetModel())
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+	log = log.WithValues("model", modelCfg.Name)
+	ctx = logr.NewContext(ctx, log)
+
+	// Redact the blocks before they are used to build the input so secrets are neither sent to the model nor logged.
+	a.redactBlocks(ctx, req.Blocks)
+	a.compactBlocks(ctx, req.Blocks)
+	if !a.stateless {
+		a.storeOutputs(ctx, req.Blocks)
+	}
+
+	promptData := PromptData{
+		Principal:  iam.GetPrincipal(ctx),
+		ServerName: a.serverName,
+		Date:       time.Now().Format("2006-01-02"),
+		Values:     a.promptValues,
+	}
+
+	instructions, err := a.instructions.Render(promptData)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, err)
 	}
 
 	tools := make([]responses.ToolUnionParam, 0, 1)
@@ -183,44 +630,158 @@ func (a *Agent) ProcessWithOpenAI(ctx context.Context, req *cassie.GenerateReque
 		}
 		tools = append(tools, tool)
 	}
-	shellTool := &responses.FunctionToolParam{
-		Name:        ShellToolName,
-		Description: openai.Opt(a.shellToolDescription),
-		Parameters:  shellToolJSONSchema,
-		// N.B. I'm not sure what the point of strict would be since we have a single string argument.
-		Strict: openai.Opt(false),
+	for _, t := range a.tools.Tools() {
+		description, err := t.Description(promptData)
+		if err != nil {
+			return nil, connect.NewError(connect.CodeInternal, errors.Wrapf(err, "Failed to get description for tool %s", t.Name()))
+		}
+		tools = append(tools, responses.ToolUnionParam{
+			OfFunction: &responses.FunctionToolParam{
+				Name:        t.Name(),
+				Description: openai.Opt(description),
+				Parameters:  t.Parameters(),
+				// N.B. Strict mode requires every property to be required which doesn't work for optional arguments.
+				Strict: openai.Opt(false),
+			},
+		})
+	}
+	// TODO(jlewi): We should add websearch
+
+	toolChoice := responses.ResponseNewParamsToolChoiceUnion{
+		OfToolChoiceMode: openai.Opt(responses.ToolChoiceOptionsAuto),
 	}
 
-	tool := responses.ToolUnionParam{
-		OfFunction: shellTool,
+	var input responses.ResponseNewParamsInputUnion
+	if a.stateless {
+		input.OfInputItemList = buildHistory(req.Blocks, a.maxInputTokens, a.media, a.tools)
+	} else {
+		input, err = a.blocksToInput(ctx, req)
+		if err != nil {
+			return nil, err
+		}
 	}
-	tools = append(tools, tool)
-	// TODO(jlewi): We should add websearch
 
-	// If PreviousResponseId is not set then we need to check that the first block is user input.
-	if req.PreviousResponseId == "" {
-		if req.Blocks[0].Role != cassie.BlockRole_BLOCK_ROLE_USER {
-			return connect.NewError(connect.CodeInvalidArgument, errors.New("First block must be user input"))
+	createResponse := responses.ResponseNewParams{
+		Input:             input,
+		Instructions:      openai.Opt(instructions),
+		Model:             modelCfg.Name,
+		Tools:             tools,
+		ParallelToolCalls: openai.Bool(true),
+		ToolChoice:        toolChoice,
+		// We want it to return the file search results
+		Include: []responses.ResponseIncludable{responses.ResponseIncludableFileSearchCallResults},
+	}
+
+	if a.stateless {
+		// Don't let the provider store the response; the client sends the whole conversation on each request.
+		createResponse.Store = openai.Bool(false)
+	} else if req.PreviousResponseId != "" {
+		createResponse.PreviousResponseID = openai.Opt(req.PreviousResponseId)
+	}
+
+	opts := make([]option.RequestOption, 0, 1)
+
+	if a.useOAuth {
+		if req.GetOpenaiAccessToken() == "" {
+			log.Info("OpenAI access token is required when using OAuth")
+			return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("OpenAI access token is required when using OAuth"))
 		}
+		opts = append(opts, option.WithHeader("Authorization", "Bearer "+req.GetOpenaiAccessToken()))
 	}
 
-	toolChoice := responses.ResponseNewParamsToolChoiceUnion{
-		OfToolChoiceMode: openai.Opt(responses.ToolChoiceOptionsAuto),
+	return a.streamResponse(ctx, createResponse, opts, modelCfg, sender, gen)
+}
+
+// sendCancelled ends a generation that was cancelled with CancelGenerate by sending a block marking the turn as
+// cancelled. builder is the response that was being generated; it is nil if the generation was cancelled before
+// the request was sent to the model in which case the client continues from the previous response.
+func (a *Agent) sendCancelled(ctx context.Context, req *cassie.GenerateRequest, builder *BlocksBuilder, sender BlockSender) error {
+	log := logs.FromContext(ctx)
+	responseID := req.GetPreviousResponseId()
+	if builder != nil && builder.responseID != "" {
+		// The calls the model completed were recorded with the response so the next turn can refer to it.
+		responseID = builder.responseID
+	}
+	log.Info("Generation was cancelled", "responseId", responseID)
+	if err := sender(cancelledResponse(responseID)); err != nil {
+		log.Error(err, "Failed to send response")
+		return connect.NewError(connect.CodeInternal, errors.Wrapf(err, "Failed to send response to client"))
+	}
+	return nil
+}
+
+// recordUsage logs the token usage of the response and adds it to the usage store. Failing to record usage doesn't
+// fail the request since the response has already been streamed to the client.
+func (a *Agent) recordUsage(ctx context.Context, builder *BlocksBuilder) {
+	log := logs.FromContext(ctx)
+	if builder.usage == nil {
+		return
+	}
+	r := usage.Record{
+		Time:              time.Now(),
+		ResponseID:        builder.responseID,
+		Principal:         iam.GetPrincipal(ctx),
+		Model:             builder.model,
+		InputTokens:       builder.usage.GetInputTokens(),
+		CachedInputTokens: builder.usage.GetCachedInputTokens(),
+		OutputTokens:      builder.usage.GetOutputTokens(),
+		TotalTokens:       builder.usage.GetTotalTokens(),
+	}
+	log.Info("Usage", "responseId", r.ResponseID, "principal", r.Principal, "model", r.Model, "inputTokens", r.InputTokens, "cachedInputTokens", r.CachedInputTokens, "outputTokens", r.OutputTokens, "totalTokens", r.TotalTokens)
+	if a.usage == nil {
+		return
+	}
+	if err := a.usage.Add(ctx, r); err != nil {
+		log.Error(err, "Failed to record usage", "responseId", r.ResponseID)
 	}
+}
 
+// blocksToInput converts the blocks in the request into input for the model. The blocks are the new blocks since
+// the previous response; calls in the previous response that the client didn't send back are filled in from the
+// conversation store.
+func (a *Agent) blocksToInput(ctx context.Context, req *cassie.GenerateRequest) (responses.ResponseNewParamsInputUnion, error) {
+	log := logs.FromContext(ctx)
 	input := responses.ResponseNewParamsInputUnion{
 		// N.B. Input is a list of list. Is that a bug in the SDK
 		// ResponseInputParam is a type alias for a list. I find that very confusing.
 		OfInputItemList: make([]responses.ResponseInputItemUnionParam, 0, len(req.Blocks)),
 	}
 
-	if err := fillInToolcalls(ctx, a.responseCache, a.blocksCache, req); err != nil {
-		return connect.NewError(connect.CodeInternal, errors.Wrap(err, "Failed to fill in tool calls"))
+	// If PreviousResponseId is not set then we need to check that the first block is user input.
+	if req.PreviousResponseId == "" {
+		if req.Blocks[0].Role != cassie.BlockRole_BLOCK_ROLE_USER {
+			return input, connect.NewError(connect.CodeInvalidArgument, errors.New("First block must be user input"))
+		}
+	}
+
+	if err := fillInToolcalls(ctx, a.store, req); err != nil {
+		return input, connect.NewError(connect.CodeInternal, errors.Wrap(err, "Failed to fill in tool calls"))
+	}
+
+	// The calls the model made in the previous response are already part of the conversation along with the
+	// reasoning that led to them so only their outputs are sent. Repeating a call would separate it from its
+	// reasoning item which reasoning models rely on.
+	previousCalls := make(map[string]bool)
+	if req.PreviousResponseId != "" {
+		ids, _, err := a.store.GetResponse(ctx, req.PreviousResponseId)
+		if err != nil {
+			return input, connect.NewError(connect.CodeInternal, errors.Wrapf(err, "Failed to get response %s", req.PreviousResponseId))
+		}
+		for _, id := range ids {
+			previousCalls[id] = true
+		}
 	}
 
 	for _, b := range req.Blocks {
 		switch b.Kind {
+		case cassie.BlockKind_REASONING:
+			// The reasoning items are part of the previous response so the model already has them.
+			continue
 		case cassie.BlockKind_MARKUP:
+			if message, ok := a.media.mediaMessage(b.Contents, b.GetAttachments()); ok {
+				input.OfInputItemList = append(input.OfInputItemList, message)
+				continue
+			}
 			input.OfInputItemList = append(input.OfInputItemList, responses.ResponseInputItemUnionParam{
 				// N.B. What's the difference between EasyInputMessage and InputItemMessage
 				OfMessage: &responses.EasyInputMessageParam{
@@ -230,106 +791,181 @@ func (a *Agent) ProcessWithOpenAI(ctx context.Context, req *cassie.GenerateReque
 					},
 				},
 			})
-		case cassie.BlockKind_CODE:
-			dict := map[string]string{}
-
-			for _, o := range b.Outputs {
-				dict[o.Kind.String()] = ""
-				for _, item := range o.Items {
-					if item.TextData != "" {
-						dict[o.Kind.String()] += item.TextData
-					}
-				}
+		default:
+			tool, ok := a.tools.ForBlock(b)
+			if !ok {
+				err := errors.Errorf("Unsupported block kind %s", b.Kind)
+				log.Error(err, "Unsupported block kind", "block", b)
+				return input, connect.NewError(connect.CodeInvalidArgument, err)
 			}
 
-			output, err := json.Marshal(dict)
+			args, err := tool.BlockToCall(b)
 			if err != nil {
-				return connect.NewError(connect.CodeInternal, errors.Wrap(err, "Failed to marshal output"))
-			}
-
-			shellArgs := &ShellArgs{
-				Shell: b.Contents,
+				return input, connect.NewError(connect.CodeInternal, errors.Wrapf(err, "Failed to convert block to a call to tool %s", tool.Name()))
 			}
 
-			shellArgsJSON, err := json.Marshal(shellArgs)
+			output, err := tool.BlockToOutput(b)
 			if err != nil {
-				return connect.NewError(connect.CodeInternal, errors.Wrap(err, "Failed to marshal shell args"))
+				return input, connect.NewError(connect.CodeInternal, errors.Wrapf(err, "Failed to convert block to the output of tool %s", tool.Name()))
 			}
 
 			// The CallID will be blank if it wasn't generated by the model.
 			// This can happen if
 			// 1. The AI returned code blocks in markdown which we parsed out into code blocks
 			// 2. User manually added the cell
+			inPrevious := b.CallId != "" && previousCalls[b.Id]
 			if b.CallId == "" {
 				b.CallId = uuid.NewString()
 			}
 
-			// Add the function call to the input
-			input.OfInputItemList = append(input.OfInputItemList, responses.ResponseInputItemUnionParam{
-				OfFunctionCall: &responses.ResponseFunctionToolCallParam{
-					// TODO(jlewi): What if the model didn't tell us to call that function?
-					CallID:    b.CallId,
-					Name:      ShellToolName,
-					Arguments: string(shellArgsJSON),
-				},
-			})
+			// Add the function call to the input unless the model made it in the previous response.
+			if !inPrevious {
+				input.OfInputItemList = append(input.OfInputItemList, responses.ResponseInputItemUnionParam{
+					OfFunctionCall: &responses.ResponseFunctionToolCallParam{
+						CallID:    b.CallId,
+						Name:      tool.Name(),
+						Arguments: args,
+					},
+				})
+			}
 
 			input.OfInputItemList = append(input.OfInputItemList, responses.ResponseInputItemUnionParam{
 				OfFunctionCallOutput: &responses.ResponseInputItemFunctionCallOutputParam{
-					// TODO(jlewi): What if the model didn't tell us to call that function?
 					CallID: b.CallId,
-					Output: string(output),
+					Output: output,
 				},
 			})
-		default:
-			err := errors.Errorf("Unsupported block kind %s", b.Kind)
-			log.Error(err, "Unsupported block kind", "block", b)
-			return connect.NewError(connect.CodeInvalidArgument, err)
+
+			// The output of a call can only be text so images and files output by the call follow in a message.
+			if message, ok := a.media.mediaMessage(fmt.Sprintf("Images and files output by call %s:", b.CallId), mediaItems(b)); ok {
+				input.OfInputItemList = append(input.OfInputItemList, message)
+			}
 		}
 	}
+	return input, nil
+}
 
-	createResponse := responses.ResponseNewParams{
-		Input:             input,
-		Instructions:      openai.Opt(a.instructions),
-		Model:             openai.ChatModelGPT4_1,
-		Tools:             tools,
-		ParallelToolCalls: openai.Bool(true),
-		ToolChoice:        toolChoice,
-		// We want it to return the file search results
-		Include: []responses.ResponseIncludable{responses.ResponseIncludableFileSearchCallResults},
+// executeToolCalls executes the calls in the response to tools that are executed by the server and sends the
+// updated blocks to the sender. If autorun is true, read-only shell commands are also run when autopilot is
+// enabled. It returns the blocks that were executed and whether the response contains calls that the user has
+// to execute.
+func (a *Agent) executeToolCalls(ctx context.Context, builder *BlocksBuilder, sender BlockSender, autorun bool) ([]*cassie.Block, bool, error) {
+	log := logs.FromContext(ctx)
+	executed := make([]*cassie.Block, 0, 5)
+	pending := false
+	for _, b := range builder.callBlocks() {
+		tool, ok := a.tools.ForBlock(b)
+		if !ok {
+			pending = true
+			continue
+		}
+		var execute func(context.Context, *cassie.Block) error
+		if executable, ok := tool.(ExecutableTool); ok {
+			execute = executable.Execute
+		} else if autorun && a.canAutorun(tool, b) {
+			execute = a.runCommand
+		} else {
+			pending = true
+			continue
+		}
+
+		log.Info("Executing tool call", "tool", tool.Name(), "callId", b.CallId)
+		if err := execute(ctx, b); err != nil {
+			// Report the error to the model so it can decide what to do.
+			log.Error(err, "Failed to execute tool call", "tool", tool.Name(), "callId", b.CallId)
+			b.Outputs = []*cassie.BlockOutput{
+				{
+					Kind:  cassie.BlockOutputKind_STDERR,
+					Items: []*cassie.BlockOutputItem{{Mime: textMimeType, TextData: err.Error()}},
+				},
+			}
+		}
+		a.redactBlocks(ctx, []*cassie.Block{b})
+		executed = append(executed, b)
 	}
 
-	if req.PreviousResponseId != "" {
-		createResponse.PreviousResponseID = openai.Opt(req.PreviousResponseId)
+	if len(executed) == 0 {
+		return executed, pending, nil
 	}
 
-	opts := make([]option.RequestOption, 0, 1)
+	// Update the stored blocks so the outputs are filled in if the client doesn't send them back.
+	if err := a.store.PutBlocks(ctx, executed...); err != nil {
+		log.Error(err, "Failed to store executed blocks")
+		return nil, false, connect.NewError(connect.CodeInternal, errors.Wrapf(err, "Failed to store executed blocks"))
+	}
 
-	if a.useOAuth {
-		if req.GetOpenaiAccessToken() == "" {
-			log.Info("OpenAI access token is required when using OAuth")
-			return connect.NewError(connect.CodeInvalidArgument, errors.New("OpenAI access token is required when using OAuth"))
+	if err := sender(&cassie.GenerateResponse{
+		Blocks:     executed,
+		ResponseId: builder.responseID,
+		Model:      builder.model,
+	}); err != nil {
+		log.Error(err, "Failed to send response")
+		return nil, false, connect.NewError(connect.CodeInternal, errors.Wrapf(err, "Failed to send response to client"))
+	}
+	return executed, pending, nil
+}
+
+// redactBlocks redacts secrets from the contents and outputs of the blocks. What was redacted is recorded in the metadata of
+// the blocks.
+func (a *Agent) redactBlocks(ctx context.Context, blocks []*cassie.Block) {
+	if a.redactor == nil {
+		return
+	}
+	log := logs.FromContext(ctx)
+	for _, b := range blocks {
+		n, err := a.redactor.RedactBlock(b)
+		if err != nil {
+			log.Error(err, "Failed to record redactions", "blockId", b.GetId())
+		}
+		if n > 0 {
+			log.Info("Redacted secrets from block", "blockId", b.GetId(), "count", n, "rules", b.GetMetadata()[redact.MetadataKey])
 		}
-		opts = append(opts, option.WithHeader("Authorization", "Bearer "+req.GetOpenaiAccessToken()))
 	}
+}
 
-	log.Info("ResponseRequest", "request", createResponse)
-	eStream := a.Client.Responses.NewStreaming(ctx, createResponse, opts...)
-	builder := NewBlocksBuilder(a.filenameToLink, a.responseCache, a.blocksCache)
+// compactBlocks compacts the outputs of blocks that exceed the per block budget so a single huge output doesn't
+// fill the context window.
+func (a *Agent) compactBlocks(ctx context.Context, blocks []*cassie.Block) {
+	if a.maxBlockOutputChars <= 0 {
+		return
+	}
+	log := logs.FromContext(ctx)
+	for _, b := range blocks {
+		if compact.CompactBlock(b, a.maxBlockOutputChars) {
+			log.Info("Compacted block outputs", "blockId", b.GetId(), "maxChars", a.maxBlockOutputChars)
+			if b.ExecutionInfo != nil {
+				b.ExecutionInfo.Truncated = true
+			}
+		}
+	}
+}
 
-	return builder.HandleEvents(ctx, eStream, sender)
+// getModel returns the configuration for the requested model. If model is empty the default model is returned.
+// An error is returned if the model isn't in the allow-list.
+func (a *Agent) getModel(model string) (config.ModelConfig, error) {
+	if model == "" {
+		model = a.defaultModel
+	}
+	m, ok := a.models[model]
+	if !ok {
+		return config.ModelConfig{}, errors.Errorf("Model %s is not allowed", model)
+	}
+	return m, nil
 }
 
 // fillInToolcalls fills in the tool calls for the request for the previousResponse.
 // This is necessary because OpenAI returns an error if any of the function calls in the previous response
 // are missing output
-func fillInToolcalls(ctx context.Context, responseCache *lru.Cache[string, []string], blocksCache *lru.Cache[string, *cassie.Block], req *cassie.GenerateRequest) error {
+func fillInToolcalls(ctx context.Context, store ConversationStore, req *cassie.GenerateRequest) error {
 	if req.PreviousResponseId == "" {
 		return nil
 	}
 
-	// Check if the previous response ID is in the cache
-	prevCalls, ok := responseCache.Get(req.PreviousResponseId)
+	// Check if the previous response ID is in the store
+	prevCalls, ok, err := store.GetResponse(ctx, req.PreviousResponseId)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to get response %s", req.PreviousResponseId)
+	}
 
 	// No responses for the previous response ID
 	if !ok {
@@ -347,12 +983,14 @@ func fillInToolcalls(ctx context.Context, responseCache *lru.Cache[string, []str
 
 	// If there are any missing function calls then add them
 	for callID := range missingPrevBlocks {
-		b, ok := blocksCache.Get(callID)
-		if !ok {
+		b, err := store.GetBlock(ctx, callID)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to get block %s", callID)
+		}
+		if b == nil {
 			return errors.Errorf("Missing block for block ID; %v", callID)
 		}
-		blockCopy := proto.Clone(b).(*cassie.Block)
-		req.Blocks = append(req.Blocks, blockCopy)
+		req.Blocks = append(req.Blocks, b)
 	}
 
 	return nil
@@ -0,0 +1,81 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/jlewi/cloud-assistant/app/pkg/risk"
+	"github.com/jlewi/cloud-assistant/app/pkg/runme"
+	"github.com/jlewi/cloud-assistant/protos/gen/cassie"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// CommandRunner runs shell commands on the server. It is implemented by runme.Runner.
+type CommandRunner interface {
+	Run(ctx context.Context, id string, language string, contents string) (*runme.RunResult, error)
+}
+
+// canAutorun returns true if autopilot should run the call represented by the block rather than the user. The
+// command must be in the configured allow-list as well as read-only so that a command the classifier wrongly rates
+// read-only isn't run unless it was explicitly allowed.
+func (a *Agent) canAutorun(tool Tool, block *cassie.Block) bool {
+	if !a.autopilot || tool.Name() != ShellToolName {
+		return false
+	}
+	// Classify the command again rather than trusting the metadata on the block.
+	result, err := classifyBlock(a.classifier, block)
+	if err != nil {
+		return false
+	}
+	// Streaming commands e.g. kubectl logs -f would only stop when the timeout fires.
+	return result.Level == risk.LevelReadOnly && !result.Streaming && a.autorun.Allows(result)
+}
+
+// runCommand runs the program in the block with the runner and stores the output in the block. If the program
+// doesn't finish within the command timeout it is cancelled and the output it produced so far is stored.
+func (a *Agent) runCommand(ctx context.Context, block *cassie.Block) error {
+	runCtx, cancel := context.WithTimeout(ctx, a.commandTimeout)
+	defer cancel()
+	result, err := a.runner.Run(runCtx, block.Id, block.Language, block.Contents)
+	if err != nil {
+		return err
+	}
+	timedOut := ctx.Err() == nil && errors.Is(runCtx.Err(), context.DeadlineExceeded)
+	if timedOut {
+		result.Stderr = append(result.Stderr, fmt.Sprintf("\nCommand timed out after %s\n", a.commandTimeout)...)
+	}
+
+	block.Outputs = []*cassie.BlockOutput{
+		{
+			Kind:  cassie.BlockOutputKind_STDOUT,
+			Items: []*cassie.BlockOutputItem{{Mime: textMimeType, TextData: string(result.Stdout)}},
+		},
+		{
+			Kind:  cassie.BlockOutputKind_STDERR,
+			Items: []*cassie.BlockOutputItem{{Mime: textMimeType, TextData: string(result.Stderr)}},
+		},
+	}
+	block.ExecutionInfo = &cassie.ExecutionInfo{
+		StartTime: timestamppb.New(result.StartTime),
+		EndTime:   timestamppb.New(result.EndTime),
+		Cancelled: result.Cancelled || timedOut,
+		Truncated: timedOut,
+		RunnerId:  serverRunnerID(),
+	}
+	if result.ExitCode >= 0 && !result.Cancelled {
+		exitCode := int32(result.ExitCode)
+		block.ExecutionInfo.ExitCode = &exitCode
+	}
+	return nil
+}
+
+// serverRunnerID identifies the runner used by autopilot in ExecutionInfo.
+func serverRunnerID() string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		return "server"
+	}
+	return "server/" + hostname
+}
@@ -0,0 +1,316 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jlewi/cloud-assistant/app/pkg/runme"
+	"github.com/jlewi/cloud-assistant/protos/gen/cassie"
+	"github.com/openai/openai-go/responses"
+)
+
+// fakeRunner is a CommandRunner that records the programs it runs.
+type fakeRunner struct {
+	commands  []string
+	languages []string
+}
+
+func (f *fakeRunner) Run(ctx context.Context, id string, language string, contents string) (*runme.RunResult, error) {
+	f.commands = append(f.commands, contents)
+	f.languages = append(f.languages, language)
+	start := time.Date(2025, 6, 1, 10, 0, 0, 0, time.UTC)
+	return &runme.RunResult{
+		Stdout:    []byte("pod-1 Running\n"),
+		ExitCode:  0,
+		StartTime: start,
+		EndTime:   start.Add(1500 * time.Millisecond),
+	}, nil
+}
+
+// shellCallEvents returns the events for a response containing a single call to the shell tool.
+func shellCallEvents(t *testing.T, respID string, itemID string, callID string, command string) []responses.ResponseStreamEventUnion {
+	t.Helper()
+	args, err := json.Marshal(ShellArgs{Shell: command})
+	if err != nil {
+		t.Fatalf("Failed to marshal arguments: %+v", err)
+	}
+	return []responses.ResponseStreamEventUnion{
+		mustEvent(t, map[string]any{
+			"type":     "response.created",
+			"response": map[string]any{"id": respID, "model": "gpt-4.1"},
+		}),
+		mustEvent(t, map[string]any{
+			"type": "response.output_item.added",
+			"item": map[string]any{"type": "function_call", "id": itemID, "call_id": callID, "name": ShellToolName},
+		}),
+		mustEvent(t, map[string]any{
+			"type":      "response.function_call_arguments.done",
+			"item_id":   itemID,
+			"arguments": string(args),
+		}),
+	}
+}
+
+func Test_AutopilotStopsAtMutatingCommand(t *testing.T) {
+	provider := &fakeProvider{
+		responses: [][]responses.ResponseStreamEventUnion{
+			shellCallEvents(t, "resp_1", "fc_1", "call_1", "kubectl get pods"),
+			shellCallEvents(t, "resp_2", "fc_2", "call_2", "kubectl delete pod pod-1"),
+		},
+	}
+	runner := &fakeRunner{}
+
+	agent, err := NewAgent(AgentOptions{
+		Provider:          provider,
+		Autopilot:         true,
+		AutopilotCommands: []string{"kubectl get"},
+		Runner:            runner,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create agent: %+v", err)
+	}
+
+	sent := make(map[string]*cassie.Block)
+	sender := func(resp *cassie.GenerateResponse) error {
+		for _, b := range resp.Blocks {
+			sent[b.Id] = b
+		}
+		return nil
+	}
+
+	req := &cassie.GenerateRequest{
+		Blocks: []*cassie.Block{
+			{Id: "user_1", Kind: cassie.BlockKind_MARKUP, Role: cassie.BlockRole_BLOCK_ROLE_USER, Contents: "Delete the broken pod"},
+		},
+	}
+
+	if err := agent.ProcessWithOpenAI(context.Background(), req, sender); err != nil {
+		t.Fatalf("ProcessWithOpenAI failed: %+v", err)
+	}
+
+	if len(provider.requests) != 2 {
+		t.Fatalf("Expected 2 requests to the model; got %d", len(provider.requests))
+	}
+	if len(runner.commands) != 1 || runner.commands[0] != "kubectl get pods" {
+		t.Errorf("Expected only the read-only command to be run; got %v", runner.commands)
+	}
+	if len(runner.languages) != 1 || runner.languages[0] != runme.LanguageBash {
+		t.Errorf("Expected the command to be run with bash; got %v", runner.languages)
+	}
+
+	output, err := (&ShellTool{}).BlockToOutput(sent["fc_1"])
+	if err != nil {
+		t.Fatalf("BlockToOutput failed: %+v", err)
+	}
+	var actual map[string]any
+	if err := json.Unmarshal([]byte(output), &actual); err != nil {
+		t.Fatalf("Failed to unmarshal output %s: %+v", output, err)
+	}
+	expected := map[string]any{
+		"STDOUT":     "pod-1 Running\n",
+		"STDERR":     "",
+		"exit_code":  float64(0),
+		"started_at": "2025-06-01T10:00:00Z",
+		"duration":   "1.5s",
+	}
+	for k, v := range expected {
+		if actual[k] != v {
+			t.Errorf("Unexpected %s in output for fc_1; want %v got %v", k, v, actual[k])
+		}
+	}
+	if runnerID, _ := actual["runner"].(string); !strings.HasPrefix(runnerID, "server") {
+		t.Errorf("Unexpected runner in output for fc_1: %v", actual["runner"])
+	}
+	if len(sent["fc_2"].GetOutputs()) != 0 {
+		t.Errorf("The mutating command should be returned to the user without being run")
+	}
+}
+
+func Test_AutopilotStepBudget(t *testing.T) {
+	provider := &fakeProvider{
+		responses: [][]responses.ResponseStreamEventUnion{
+			shellCallEvents(t, "resp_1", "fc_1", "call_1", "kubectl get pods"),
+			shellCallEvents(t, "resp_2", "fc_2", "call_2", "kubectl get nodes"),
+			shellCallEvents(t, "resp_3", "fc_3", "call_3", "kubectl get services"),
+		},
+	}
+	runner := &fakeRunner{}
+
+	agent, err := NewAgent(AgentOptions{
+		Provider:          provider,
+		Autopilot:         true,
+		AutopilotCommands: []string{"kubectl get"},
+		Runner:            runner,
+		MaxSteps:          2,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create agent: %+v", err)
+	}
+
+	req := &cassie.GenerateRequest{
+		Blocks: []*cassie.Block{
+			{Id: "user_1", Kind: cassie.BlockKind_MARKUP, Role: cassie.BlockRole_BLOCK_ROLE_USER, Contents: "What's running?"},
+		},
+	}
+
+	if err := agent.ProcessWithOpenAI(context.Background(), req, NullOpSender); err != nil {
+		t.Fatalf("ProcessWithOpenAI failed: %+v", err)
+	}
+
+	if len(provider.requests) != 2 {
+		t.Errorf("Expected 2 requests to the model; got %d", len(provider.requests))
+	}
+	// The command in the last response should be left for the user since its output can't be sent to the model.
+	if len(runner.commands) != 1 {
+		t.Errorf("Expected 1 command to be run; got %v", runner.commands)
+	}
+}
+
+// hangingRunner is a CommandRunner whose programs write some output and then never exit. Like runme.Runner it
+// returns the partial output when the context is done.
+type hangingRunner struct{}
+
+func (r *hangingRunner) Run(ctx context.Context, id string, language string, contents string) (*runme.RunResult, error) {
+	start := time.Now()
+	<-ctx.Done()
+	return &runme.RunResult{
+		Stdout:    []byte("pod-1 Running\n"),
+		ExitCode:  -1,
+		StartTime: start,
+		EndTime:   time.Now(),
+		Cancelled: true,
+	}, nil
+}
+
+func Test_AutopilotCommandTimeout(t *testing.T) {
+	provider := &fakeProvider{
+		responses: [][]responses.ResponseStreamEventUnion{
+			shellCallEvents(t, "resp_1", "fc_1", "call_1", "kubectl get pods"),
+			textEvents(t, "resp_2", "msg_1", "The command timed out."),
+		},
+	}
+
+	agent, err := NewAgent(AgentOptions{
+		Provider:          provider,
+		Autopilot:         true,
+		AutopilotCommands: []string{"kubectl get"},
+		Runner:            &hangingRunner{},
+		CommandTimeout:    50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create agent: %+v", err)
+	}
+
+	sent := make(map[string]*cassie.Block)
+	sender := func(resp *cassie.GenerateResponse) error {
+		for _, b := range resp.Blocks {
+			sent[b.Id] = b
+		}
+		return nil
+	}
+	req := &cassie.GenerateRequest{
+		Blocks: []*cassie.Block{
+			{Id: "user_1", Kind: cassie.BlockKind_MARKUP, Role: cassie.BlockRole_BLOCK_ROLE_USER, Contents: "What's running?"},
+		},
+	}
+	if err := agent.ProcessWithOpenAI(context.Background(), req, sender); err != nil {
+		t.Fatalf("ProcessWithOpenAI failed: %+v", err)
+	}
+
+	if len(provider.requests) != 2 {
+		t.Fatalf("Expected the partial output to be sent to the model; got %d requests", len(provider.requests))
+	}
+	block := sent["fc_1"]
+	info := block.GetExecutionInfo()
+	if !info.GetCancelled() || !info.GetTruncated() || info.ExitCode != nil {
+		t.Errorf("Expected the run to be marked cancelled and truncated; got %v", info)
+	}
+	output, err := (&ShellTool{}).BlockToOutput(block)
+	if err != nil {
+		t.Fatalf("BlockToOutput failed: %+v", err)
+	}
+	var actual map[string]any
+	if err := json.Unmarshal([]byte(output), &actual); err != nil {
+		t.Fatalf("Failed to unmarshal output %s: %+v", output, err)
+	}
+	if actual["STDOUT"] != "pod-1 Running\n" || !strings.Contains(actual["STDERR"].(string), "Command timed out after 50ms") {
+		t.Errorf("Expected the partial output and the timeout in the output; got %s", output)
+	}
+}
+
+func Test_AutopilotSkipsStreamingCommands(t *testing.T) {
+	for _, command := range []string{"kubectl get pods -w", "kubectl logs -f pod-1", "tail -f /var/log/syslog", "watch kubectl get pods"} {
+		t.Run(command, func(t *testing.T) {
+			provider := &fakeProvider{
+				responses: [][]responses.ResponseStreamEventUnion{
+					shellCallEvents(t, "resp_1", "fc_1", "call_1", command),
+				},
+			}
+			runner := &fakeRunner{}
+			agent, err := NewAgent(AgentOptions{
+				Provider:          provider,
+				Autopilot:         true,
+				AutopilotCommands: []string{"kubectl get", "kubectl logs", "tail"},
+				Runner:            runner,
+			})
+			if err != nil {
+				t.Fatalf("Failed to create agent: %+v", err)
+			}
+			req := &cassie.GenerateRequest{
+				Blocks: []*cassie.Block{
+					{Id: "user_1", Kind: cassie.BlockKind_MARKUP, Role: cassie.BlockRole_BLOCK_ROLE_USER, Contents: "Watch the pods"},
+				},
+			}
+			if err := agent.ProcessWithOpenAI(context.Background(), req, NullOpSender); err != nil {
+				t.Fatalf("ProcessWithOpenAI failed: %+v", err)
+			}
+			if len(runner.commands) != 0 {
+				t.Errorf("Expected the streaming command to be returned to the user; got %v", runner.commands)
+			}
+		})
+	}
+}
+
+func Test_AutopilotOnlyRunsAllowedCommands(t *testing.T) {
+	// Both commands are read-only but only kubectl get is allowed.
+	for command, run := range map[string]bool{"kubectl get pods": true, "cat /etc/hosts": false, "kubectl get pods | sort": false} {
+		t.Run(command, func(t *testing.T) {
+			provider := &fakeProvider{
+				responses: [][]responses.ResponseStreamEventUnion{
+					shellCallEvents(t, "resp_1", "fc_1", "call_1", command),
+					textEvents(t, "resp_2", "msg_1", "Done."),
+				},
+			}
+			runner := &fakeRunner{}
+			agent, err := NewAgent(AgentOptions{
+				Provider:          provider,
+				Autopilot:         true,
+				AutopilotCommands: []string{"kubectl get"},
+				Runner:            runner,
+			})
+			if err != nil {
+				t.Fatalf("Failed to create agent: %+v", err)
+			}
+			req := &cassie.GenerateRequest{
+				Blocks: []*cassie.Block{
+					{Id: "user_1", Kind: cassie.BlockKind_MARKUP, Role: cassie.BlockRole_BLOCK_ROLE_USER, Contents: "What's running?"},
+				},
+			}
+			if err := agent.ProcessWithOpenAI(context.Background(), req, NullOpSender); err != nil {
+				t.Fatalf("ProcessWithOpenAI failed: %+v", err)
+			}
+			if ran := len(runner.commands) == 1; ran != run {
+				t.Errorf("Want command run %v; got %v", run, runner.commands)
+			}
+		})
+	}
+}
+
+func Test_AutopilotRequiresCommands(t *testing.T) {
+	if _, err := NewAgent(AgentOptions{Provider: &fakeProvider{}, Autopilot: true, Runner: &fakeRunner{}}); err == nil {
+		t.Errorf("Expected an error when autopilot is enabled without any commands")
+	}
+}
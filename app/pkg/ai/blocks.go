@@ -2,29 +2,40 @@ package ai
 
 import (
 	"context"
-	"encoding/json"
+	"sort"
+	"strings"
 	"sync"
 
 	"connectrpc.com/connect"
-	lru "github.com/hashicorp/golang-lru/v2"
 	"github.com/jlewi/cloud-assistant/app/pkg/docs"
 	"github.com/jlewi/cloud-assistant/app/pkg/logs"
 	"github.com/jlewi/cloud-assistant/protos/gen/cassie"
-	"github.com/openai/openai-go/packages/ssestream"
 	"github.com/openai/openai-go/responses"
 	"github.com/pkg/errors"
 )
 
+const (
+	// EncryptedReasoningMetadataKey is the key in Block.Metadata of a REASONING block that holds the encrypted
+	// content of the reasoning item. Stateless servers send it back so the model gets its reasoning without the
+	// provider storing the response.
+	EncryptedReasoningMetadataKey = "cloudassistant.io/encrypted-reasoning"
+)
+
 // BlocksBuilder processes the stream of deltas from the responses API and turns them into
 // blocks to be streamed back to the frontend. This is a stateful operation because responses are deltas
 // to be added to previous responses
 type BlocksBuilder struct {
-	filenameToLink func(string) string
+	fileToLink func(fileID string, filename string) string
+	tools      *ToolRegistry
 
-	responseCache *lru.Cache[string, []string]
-	blocksCache   *lru.Cache[string, *cassie.Block]
+	// store records the blocks and the tool calls in the response once the stream is done.
+	store ConversationStore
 
 	responseID string
+	// model is the model generating the response.
+	model string
+	// usage is the token usage of the response. It is nil until the response is completed.
+	usage *cassie.Usage
 
 	// idToCallID is a map from the OpenAI item id to the call_id for function calling.
 	// Per the spec https://platform.openai.com/docs/guides/function-calling?api-mode=responses#streaming
@@ -34,18 +45,41 @@ type BlocksBuilder struct {
 	// in blocks.
 	idToCallID map[string]string
 
+	// idToToolName is a map from the OpenAI item id to the name of the function being called.
+	// Like the call_id the name is only provided on the response.output_item.added and response.output_item.done events.
+	idToToolName map[string]string
+
+	// completedCalls are the item IDs of the function calls whose arguments are complete. If the stream is
+	// cancelled the other calls are incomplete and aren't recorded as part of the response.
+	completedCalls map[string]bool
+
+	// onResponseID is called with the ID of the response as soon as it is known. It can be nil.
+	onResponseID func(responseID string)
+
+	// attempt is the attempt generating the response. It is included in every response sent to the client.
+	attempt *cassie.Attempt
+
+	// filenames maps the IDs of the files found by file search to their names. File citations only include the ID.
+	filenames map[string]string
+
 	// Map from block ID to block
 	blocks map[string]*cassie.Block
-	mu     sync.Mutex
+	// order is the IDs of the blocks in the order they were created.
+	order []string
+	mu    sync.Mutex
 }
 
-func NewBlocksBuilder(filenameToLink func(string) string, responseCache *lru.Cache[string, []string], blocksCache *lru.Cache[string, *cassie.Block]) *BlocksBuilder {
+func NewBlocksBuilder(fileToLink func(fileID string, filename string) string, store ConversationStore, model string, tools *ToolRegistry) *BlocksBuilder {
 	return &BlocksBuilder{
+		model:          model,
+		tools:          tools,
+		idToToolName:   make(map[string]string),
+		completedCalls: make(map[string]bool),
 		blocks:         make(map[string]*cassie.Block),
-		filenameToLink: filenameToLink,
-		responseCache:  responseCache,
-		blocksCache:    blocksCache,
+		fileToLink:     fileToLink,
+		store:          store,
 		idToCallID:     make(map[string]string),
+		filenames:      make(map[string]string),
 	}
 }
 
@@ -54,30 +88,49 @@ type BlockSender func(*cassie.GenerateResponse) error
 
 // HandleEvents processes a stream of events from the responses API and updates the internal state of the builder
 // Function will keep running until the context is cancelled or the stream of events is closed
-func (b *BlocksBuilder) HandleEvents(ctx context.Context, events *ssestream.Stream[responses.ResponseStreamEventUnion], sender BlockSender) error {
+func (b *BlocksBuilder) HandleEvents(ctx context.Context, events EventStream, sender BlockSender) error {
 	log := logs.FromContext(ctx)
+	// Close the stream so the connection is released even if we stop reading part way through.
+	defer func() {
+		if err := events.Close(); err != nil {
+			log.Error(err, "Failed to close event stream")
+		}
+	}()
 	defer func() {
 		resp := &cassie.GenerateResponse{
 			Blocks:     make([]*cassie.Block, 0, len(b.blocks)),
 			ResponseId: b.responseID,
+			Model:      b.model,
 		}
 
 		previousIDs := make([]string, 0, len(b.blocks))
 
+		cancelled := ctx.Err() != nil
 		for _, block := range b.blocks {
+			if cancelled && block.CallId != "" && !b.completedCalls[block.Id] {
+				// The model never finished the call so there's nothing for the next turn to send an output for.
+				continue
+			}
 			resp.Blocks = append(resp.Blocks, block)
 
-			// Update the block
-			b.blocksCache.Add(block.Id, block)
-
 			// N.B. This ends up including code blocks which we parsed out of the markdown and therefore ones which
 			// the AI didn't actually generate. Do we want to filter those out?
-			if block.Kind == cassie.BlockKind_CODE {
+			if block.Kind == cassie.BlockKind_CODE || block.CallId != "" {
 				previousIDs = append(previousIDs, block.Id)
 			}
 		}
 
-		b.responseCache.Add(resp.ResponseId, previousIDs)
+		// Errors are logged rather than returned; the blocks were already streamed to the client and storing them
+		// only matters if the client leaves calls out of its next request. A response that failed before it got
+		// an ID can't be continued so there's nothing to store.
+		if resp.ResponseId != "" {
+			if err := b.store.PutBlocks(ctx, resp.Blocks...); err != nil {
+				log.Error(err, "Failed to store blocks", "responseId", resp.ResponseId)
+			}
+			if err := b.store.PutResponse(ctx, resp.ResponseId, previousIDs); err != nil {
+				log.Error(err, "Failed to store response", "responseId", resp.ResponseId)
+			}
+		}
 		// Log the final response.
 		log.Info("GenerateResponse", logs.ZapProto("response", resp))
 	}()
@@ -87,6 +140,9 @@ func (b *BlocksBuilder) HandleEvents(ctx context.Context, events *ssestream.Stre
 		// Terminate because the request got cancelled
 		case <-ctx.Done():
 			log.Info("Context cancelled; stopping streaming request", "err", ctx.Err())
+			if isCancelled(ctx) {
+				return connect.NewError(connect.CodeCanceled, context.Cause(ctx))
+			}
 			if errors.Is(ctx.Err(), context.Canceled) || errors.Is(ctx.Err(), context.DeadlineExceeded) {
 				// N.B. If the context was cancelled then we should return a DeadlineExceeded error to indicate we hit
 				// a timeout on the server.
@@ -106,6 +162,10 @@ func (b *BlocksBuilder) HandleEvents(ctx context.Context, events *ssestream.Stre
 	}
 
 	if err := events.Err(); err != nil {
+		if isCancelled(ctx) {
+			log.Info("Streaming request was cancelled", "responseId", b.responseID)
+			return connect.NewError(connect.CodeCanceled, context.Cause(ctx))
+		}
 		log.Error(err, "Error processing events")
 		return connect.NewError(connect.CodeInternal, errors.Wrapf(err, "Error processing events"))
 	}
@@ -123,6 +183,9 @@ func (b *BlocksBuilder) ProcessEvent(ctx context.Context, e responses.ResponseSt
 	if e.Response.ID != "" {
 		if b.responseID == "" {
 			b.responseID = e.Response.ID
+			if b.onResponseID != nil {
+				b.onResponseID(b.responseID)
+			}
 		} else {
 			if b.responseID != e.Response.ID {
 				log.Error(errors.New("response ID changed mid-stream"), "old", b.responseID, "new", e.Response.ID)
@@ -130,9 +193,17 @@ func (b *BlocksBuilder) ProcessEvent(ctx context.Context, e responses.ResponseSt
 		}
 	}
 
+	// The API reports the model snapshot that actually served the request (e.g. gpt-4.1-2025-04-14) which is
+	// more precise than the model we requested.
+	if e.Response.Model != "" {
+		b.model = string(e.Response.Model)
+	}
+
 	resp := &cassie.GenerateResponse{
 		ResponseId: b.responseID,
+		Model:      b.model,
 		Blocks:     make([]*cassie.Block, 0, 5),
+		Attempt:    b.attempt,
 	}
 
 	switch e.AsAny().(type) {
@@ -141,6 +212,9 @@ func (b *BlocksBuilder) ProcessEvent(ctx context.Context, e responses.ResponseSt
 		if item.Item.CallID != "" {
 			b.idToCallID[item.Item.ID] = item.Item.CallID
 		}
+		if item.Item.Name != "" {
+			b.idToToolName[item.Item.ID] = item.Item.Name
+		}
 	case responses.ResponseContentPartDoneEvent:
 		log.Info(e.Type, "event", e)
 	case responses.ResponseTextDeltaEvent:
@@ -162,11 +236,34 @@ func (b *BlocksBuilder) ProcessEvent(ctx context.Context, e responses.ResponseSt
 				Contents: "",
 				Role:     cassie.BlockRole_BLOCK_ROLE_ASSISTANT,
 			}
-			b.blocks[itemID] = block
+			b.addBlock(block)
 		}
 		block.Contents += textDelta.Delta
 		resp.Blocks = append(resp.Blocks, block)
 
+	case responses.ResponseReasoningSummaryPartAddedEvent:
+		part := e.AsResponseReasoningSummaryPartAdded()
+		if part.ItemID == "" {
+			return errors.New("reasoning summary part has no item ID")
+		}
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		block := b.getOrCreateReasoningBlock(part.ItemID)
+		if part.SummaryIndex > 0 {
+			// Separate the parts of the summary so they are rendered as paragraphs.
+			block.Contents += "\n\n"
+		}
+		resp.Blocks = append(resp.Blocks, block)
+	case responses.ResponseReasoningSummaryTextDeltaEvent:
+		delta := e.AsResponseReasoningSummaryTextDelta()
+		if delta.ItemID == "" {
+			return errors.New("reasoning summary delta has no item ID")
+		}
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		block := b.getOrCreateReasoningBlock(delta.ItemID)
+		block.Contents += delta.Delta
+		resp.Blocks = append(resp.Blocks, block)
 	case responses.ResponseFunctionCallArgumentsDeltaEvent:
 		item := e.AsResponseFunctionCallArgumentsDelta()
 		itemID := item.ItemID
@@ -175,7 +272,6 @@ func (b *BlocksBuilder) ProcessEvent(ctx context.Context, e responses.ResponseSt
 		}
 		b.mu.Lock()
 		defer b.mu.Unlock()
-		var block *cassie.Block
 
 		callID, callIDOK := b.idToCallID[itemID]
 
@@ -184,19 +280,7 @@ func (b *BlocksBuilder) ProcessEvent(ctx context.Context, e responses.ResponseSt
 			// ResponseOutputItemAddedEvent or it was missing a call_id.
 			return errors.New("function call arguments delta has no call ID")
 		}
-		ok := false
-		block, ok = b.blocks[itemID]
-		if !ok {
-			// There is no existing block so we need to initialize a new one.
-			block = &cassie.Block{
-				Id:       itemID,
-				Kind:     cassie.BlockKind_CODE,
-				Contents: "",
-				Role:     cassie.BlockRole_BLOCK_ROLE_ASSISTANT,
-				CallId:   callID,
-			}
-			b.blocks[itemID] = block
-		}
+		block := b.getOrCreateCallBlock(itemID, callID)
 		// N.B. The delta is the "json string" of the arguments
 		// e.g. the deltas will spell out the string {"shell": } character by character
 		// So ideally we'd do some kind streaming processing to avoid showing "shell" to the user.
@@ -218,26 +302,17 @@ func (b *BlocksBuilder) ProcessEvent(ctx context.Context, e responses.ResponseSt
 		}
 		b.mu.Lock()
 		defer b.mu.Unlock()
-		var block *cassie.Block
-		ok := false
-		block, ok = b.blocks[itemID]
-		if !ok {
-			block = &cassie.Block{
-				Id:       itemID,
-				Kind:     cassie.BlockKind_CODE,
-				Contents: "",
-				Role:     cassie.BlockRole_BLOCK_ROLE_ASSISTANT,
-				CallId:   callID,
-			}
-			b.blocks[itemID] = block
-		}
+		block := b.getOrCreateCallBlock(itemID, callID)
+		b.completedCalls[itemID] = true
 
-		shellArgs := &ShellArgs{}
-		if err := json.Unmarshal([]byte(e.Arguments), shellArgs); err != nil {
-			log.Error(err, "Failed to unmarshal shell arguments", "delta", e.Arguments)
+		name := b.idToToolName[itemID]
+		tool, ok := b.tools.Get(name)
+		if !ok {
+			log.Error(errors.Errorf("Unknown tool %s", name), "Model called an unknown tool", "name", name, "arguments", e.Arguments)
+			block.Contents = e.Arguments
+		} else if err := tool.CallToBlock(e.Arguments, block); err != nil {
+			log.Error(err, "Failed to convert tool call to block", "name", name, "arguments", e.Arguments)
 			block.Contents = e.Arguments
-		} else {
-			block.Contents = shellArgs.Shell
 		}
 		resp.Blocks = append(resp.Blocks, block)
 	case responses.ResponseOutputItemDoneEvent:
@@ -257,12 +332,25 @@ func (b *BlocksBuilder) ProcessEvent(ctx context.Context, e responses.ResponseSt
 	case responses.ResponseCompletedEvent:
 		// Log the final response
 		log.Info(e.Type, "event", e)
+		u := e.AsResponseCompleted().Response.Usage
+		b.usage = &cassie.Usage{
+			InputTokens:       u.InputTokens,
+			CachedInputTokens: u.InputTokensDetails.CachedTokens,
+			OutputTokens:      u.OutputTokens,
+			TotalTokens:       u.TotalTokens,
+		}
+		// Stream the usage so the client can show the cost of the response.
+		resp.Usage = b.usage
+	case responses.ResponseFailedEvent:
+		log.Info(e.Type, "event", e)
+		failure := e.AsResponseFailed().Response.Error
+		return &responseFailedError{code: string(failure.Code), message: failure.Message}
 	default:
 		log.Info("Ignoring event", "event", e)
 		log.V(logs.Debug).Info("Ignoring event", "event", e)
 	}
 
-	if len(resp.Blocks) == 0 {
+	if len(resp.Blocks) == 0 && resp.Usage == nil {
 		log.V(logs.Debug).Info("No blocks to send")
 		return nil
 	}
@@ -274,6 +362,82 @@ func (b *BlocksBuilder) ProcessEvent(ctx context.Context, e responses.ResponseSt
 	return nil
 }
 
+// callBlocks returns the blocks that are function calls generated by the model ordered by ID.
+func (b *BlocksBuilder) callBlocks() []*cassie.Block {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	blocks := make([]*cassie.Block, 0, len(b.blocks))
+	for _, block := range b.blocks {
+		if block.CallId != "" {
+			blocks = append(blocks, block)
+		}
+	}
+	sort.Slice(blocks, func(i, j int) bool {
+		return blocks[i].Id < blocks[j].Id
+	})
+	return blocks
+}
+
+// orderedBlocks returns the blocks generated by the model in the order they were created.
+func (b *BlocksBuilder) orderedBlocks() []*cassie.Block {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	blocks := make([]*cassie.Block, 0, len(b.order))
+	for _, id := range b.order {
+		blocks = append(blocks, b.blocks[id])
+	}
+	return blocks
+}
+
+// addBlock adds a new block. The caller must hold the lock.
+func (b *BlocksBuilder) addBlock(block *cassie.Block) {
+	b.blocks[block.Id] = block
+	b.order = append(b.order, block.Id)
+}
+
+// getOrCreateReasoningBlock returns the block for the summary of the reasoning item with the given ID, creating it if
+// necessary. The caller must hold the lock.
+func (b *BlocksBuilder) getOrCreateReasoningBlock(itemID string) *cassie.Block {
+	if block, ok := b.blocks[itemID]; ok {
+		return block
+	}
+	block := &cassie.Block{
+		Id:   itemID,
+		Kind: cassie.BlockKind_REASONING,
+		Role: cassie.BlockRole_BLOCK_ROLE_ASSISTANT,
+	}
+	b.addBlock(block)
+	return block
+}
+
+// getOrCreateCallBlock returns the block for the function call with the given item ID, creating it if necessary.
+// The caller must hold the lock.
+func (b *BlocksBuilder) getOrCreateCallBlock(itemID string, callID string) *cassie.Block {
+	if block, ok := b.blocks[itemID]; ok {
+		return block
+	}
+
+	// Default to a code block if we don't know the tool so the user can at least see the arguments.
+	kind := cassie.BlockKind_CODE
+	name := b.idToToolName[itemID]
+	if tool, ok := b.tools.Get(name); ok {
+		kind = tool.BlockKind()
+	}
+
+	block := &cassie.Block{
+		Id:       itemID,
+		Kind:     kind,
+		Contents: "",
+		Role:     cassie.BlockRole_BLOCK_ROLE_ASSISTANT,
+		CallId:   callID,
+	}
+	if name != "" {
+		block.Metadata = map[string]string{ToolNameMetadataKey: name}
+	}
+	b.addBlock(block)
+	return block
+}
+
 func (b *BlocksBuilder) itemDoneToBlock(ctx context.Context, item responses.ResponseOutputItemUnion) ([]*cassie.Block, error) {
 	log := logs.FromContext(ctx)
 	results := make([]*cassie.Block, 0, 5)
@@ -282,6 +446,9 @@ func (b *BlocksBuilder) itemDoneToBlock(ctx context.Context, item responses.Resp
 		// For regular output messages we want to parse out any code blocks and turn them into code blocks
 		// so they get rendered as executable code. This is a bit of a hack to make them executable.
 		m := item.AsMessage()
+		if block := b.addCitations(ctx, m); block != nil {
+			results = append(results, block)
+		}
 		for _, message := range m.Content {
 			if message.Text == "" {
 				continue
@@ -304,10 +471,40 @@ func (b *BlocksBuilder) itemDoneToBlock(ctx context.Context, item responses.Resp
 		b, err := b.fileSearchDoneItemToBlock(ctx, item.AsFileSearchCall())
 		results = append(results, b)
 		return results, err
+	case responses.ResponseReasoningItem:
+		if block := b.reasoningDoneItemToBlock(item.AsReasoning()); block != nil {
+			results = append(results, block)
+		}
 	}
 	return results, nil
 }
 
+// reasoningDoneItemToBlock sets the block for a reasoning item to its complete summary in case any deltas were
+// missed and keeps its encrypted content if there is any. It returns nil if the model neither summarized its
+// reasoning e.g. because summaries aren't enabled nor returned the encrypted content.
+func (b *BlocksBuilder) reasoningDoneItemToBlock(item responses.ResponseReasoningItem) *cassie.Block {
+	parts := make([]string, 0, len(item.Summary))
+	for _, s := range item.Summary {
+		if s.Text != "" {
+			parts = append(parts, s.Text)
+		}
+	}
+	if len(parts) == 0 && item.EncryptedContent == "" {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	block := b.getOrCreateReasoningBlock(item.ID)
+	block.Contents = strings.Join(parts, "\n\n")
+	if item.EncryptedContent != "" {
+		if block.Metadata == nil {
+			block.Metadata = make(map[string]string)
+		}
+		block.Metadata[EncryptedReasoningMetadataKey] = item.EncryptedContent
+	}
+	return block
+}
+
 // N.B. It doesn't look like the file search call actually has the results in it. I think its the item done.
 func (b *BlocksBuilder) fileSearchDoneItemToBlock(ctx context.Context, item responses.ResponseFileSearchToolCall) (*cassie.Block, error) {
 	b.mu.Lock()
@@ -322,7 +519,7 @@ func (b *BlocksBuilder) fileSearchDoneItemToBlock(ctx context.Context, item resp
 			Role:              cassie.BlockRole_BLOCK_ROLE_ASSISTANT,
 			FileSearchResults: make([]*cassie.FileSearchResult, 0),
 		}
-		b.blocks[item.ID] = block
+		b.addBlock(block)
 	}
 
 	existing := make(map[string]bool)
@@ -336,9 +533,10 @@ func (b *BlocksBuilder) fileSearchDoneItemToBlock(ctx context.Context, item resp
 		}
 
 		link := r.Filename
-		if b.filenameToLink != nil {
-			link = b.filenameToLink(r.Filename)
+		if b.fileToLink != nil {
+			link = b.fileToLink(r.FileID, r.Filename)
 		}
+		b.filenames[r.FileID] = r.Filename
 
 		block.FileSearchResults = append(block.FileSearchResults, &cassie.FileSearchResult{
 			FileID:   r.FileID,
@@ -3,12 +3,15 @@ package ai
 import (
 	"context"
 	"encoding/json"
+	"net/http"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/jlewi/cloud-assistant/protos/gen/cassie"
 	"github.com/openai/openai-go/responses"
+	"google.golang.org/protobuf/proto"
 )
 
 func NullOpSender(resp *cassie.GenerateResponse) error {
@@ -94,3 +97,181 @@ func Test_ProcessEvent(t *testing.T) {
 		})
 	}
 }
+
+// recordingStore is a ConversationStore that records the IDs of the responses stored.
+type recordingStore struct {
+	ConversationStore
+	responseIDs []string
+}
+
+func (s *recordingStore) PutResponse(ctx context.Context, responseID string, blockIDs []string) error {
+	s.responseIDs = append(s.responseIDs, responseID)
+	return s.ConversationStore.PutResponse(ctx, responseID, blockIDs)
+}
+
+func Test_HandleEventsFailsBeforeResponseID(t *testing.T) {
+	store := &recordingStore{ConversationStore: NewMemoryConversationStore(10, time.Hour)}
+	b := NewBlocksBuilder(nil, store, "gpt-4.1", nil)
+	// The stream fails after streaming some text but before the response.created event.
+	events := &fakeEventStream{
+		events: textEvents(t, "resp_1", "msg_1", "Let me check")[1:],
+		err:    apiError(http.StatusInternalServerError),
+	}
+	if err := b.HandleEvents(context.Background(), events, NullOpSender); err == nil {
+		t.Fatalf("Expected HandleEvents to fail")
+	}
+	if len(store.responseIDs) != 0 {
+		t.Errorf("Expected a response without an ID not to be stored; got %v", store.responseIDs)
+	}
+}
+
+func Test_Citations(t *testing.T) {
+	fileToLink := func(fileID string, filename string) string {
+		return "https://docs.acme.com/" + filename
+	}
+	b := NewBlocksBuilder(fileToLink, NewMemoryConversationStore(10, time.Hour), "gpt-4.1", nil)
+
+	// The second part of the message is in a separate content part so its indexes are relative to that part.
+	parts := []string{"Restart the pod.", " See the docs."}
+	events := []responses.ResponseStreamEventUnion{
+		mustEvent(t, map[string]any{
+			"type": "response.output_item.done",
+			"item": map[string]any{
+				"type":    "file_search_call",
+				"id":      "fs_1",
+				"status":  "completed",
+				"queries": []string{"restart pod"},
+				"results": []map[string]any{{"file_id": "file_1", "filename": "runbook.md", "score": 0.9}},
+			},
+		}),
+		mustEvent(t, map[string]any{"type": "response.output_text.delta", "item_id": "msg_1", "delta": parts[0]}),
+		mustEvent(t, map[string]any{"type": "response.output_text.delta", "item_id": "msg_1", "delta": parts[1]}),
+		mustEvent(t, map[string]any{
+			"type": "response.output_item.done",
+			"item": map[string]any{
+				"type":   "message",
+				"id":     "msg_1",
+				"role":   "assistant",
+				"status": "completed",
+				"content": []map[string]any{
+					{
+						"type":        "output_text",
+						"text":        parts[0],
+						"annotations": []map[string]any{{"type": "file_citation", "index": 16, "file_id": "file_1"}},
+					},
+					{
+						"type": "output_text",
+						"text": parts[1],
+						"annotations": []map[string]any{
+							{"type": "url_citation", "start_index": 1, "end_index": 14, "url": "https://kubernetes.io/docs", "title": "Kubernetes"},
+							{"type": "file_citation", "index": 14, "file_id": "file_2", "filename": "pods.md"},
+						},
+					},
+				},
+			},
+		}),
+	}
+
+	var last *cassie.Block
+	sender := func(resp *cassie.GenerateResponse) error {
+		for _, block := range resp.GetBlocks() {
+			if block.GetId() == "msg_1" {
+				last = block
+			}
+		}
+		return nil
+	}
+	for _, e := range events {
+		if err := b.ProcessEvent(context.Background(), e, sender); err != nil {
+			t.Fatalf("Failed to process event: %+v", err)
+		}
+	}
+
+	expected := []*cassie.Citation{
+		{StartIndex: 16, EndIndex: 16, FileId: "file_1", Filename: "runbook.md", Link: "https://docs.acme.com/runbook.md"},
+		{StartIndex: 17, EndIndex: 30, Link: "https://kubernetes.io/docs", Title: "Kubernetes"},
+		{StartIndex: 30, EndIndex: 30, FileId: "file_2", Filename: "pods.md", Link: "https://docs.acme.com/pods.md"},
+	}
+	if d := cmp.Diff(expected, last.GetCitations(), cmpopts.IgnoreUnexported(cassie.Citation{})); d != "" {
+		t.Errorf("Unexpected citations (-want +got):\n%s", d)
+	}
+}
+
+func Test_ReasoningSummary(t *testing.T) {
+	provider := &fakeProvider{
+		responses: [][]responses.ResponseStreamEventUnion{
+			append([]responses.ResponseStreamEventUnion{
+				mustEvent(t, map[string]any{"type": "response.created", "response": map[string]any{"id": "resp_1", "model": "o4-mini"}}),
+				mustEvent(t, map[string]any{"type": "response.reasoning_summary_part.added", "item_id": "rs_1", "summary_index": 0, "part": map[string]any{"type": "summary_text", "text": ""}}),
+				mustEvent(t, map[string]any{"type": "response.reasoning_summary_text.delta", "item_id": "rs_1", "summary_index": 0, "delta": "Checking the "}),
+				mustEvent(t, map[string]any{"type": "response.reasoning_summary_text.delta", "item_id": "rs_1", "summary_index": 0, "delta": "pods first."}),
+				mustEvent(t, map[string]any{"type": "response.reasoning_summary_part.added", "item_id": "rs_1", "summary_index": 1, "part": map[string]any{"type": "summary_text", "text": ""}}),
+				mustEvent(t, map[string]any{"type": "response.reasoning_summary_text.delta", "item_id": "rs_1", "summary_index": 1, "delta": "Then the nodes."}),
+				mustEvent(t, map[string]any{
+					"type": "response.output_item.done",
+					"item": map[string]any{
+						"type":    "reasoning",
+						"id":      "rs_1",
+						"summary": []map[string]any{{"type": "summary_text", "text": "Checking the pods first."}, {"type": "summary_text", "text": "Then the nodes."}},
+					},
+				}),
+			}, shellCallEvents(t, "resp_1", "fc_1", "call_1", "kubectl get pods")[1:]...),
+			textEvents(t, "resp_2", "msg_2", "All pods are running."),
+		},
+	}
+	agent, err := NewAgent(AgentOptions{Provider: provider})
+	if err != nil {
+		t.Fatalf("Failed to create agent: %+v", err)
+	}
+
+	// summaries are the contents of the reasoning block each time it was streamed.
+	summaries := make([]string, 0, 5)
+	blocks := make(map[string]*cassie.Block)
+	sender := func(resp *cassie.GenerateResponse) error {
+		for _, b := range resp.GetBlocks() {
+			if b.GetKind() == cassie.BlockKind_REASONING {
+				summaries = append(summaries, b.GetContents())
+			}
+			blocks[b.GetId()] = proto.Clone(b).(*cassie.Block)
+		}
+		return nil
+	}
+	if err := agent.ProcessWithOpenAI(context.Background(), &cassie.GenerateRequest{
+		Blocks: []*cassie.Block{
+			{Id: "user_1", Kind: cassie.BlockKind_MARKUP, Role: cassie.BlockRole_BLOCK_ROLE_USER, Contents: "Is the cluster healthy?"},
+		},
+	}, sender); err != nil {
+		t.Fatalf("ProcessWithOpenAI failed: %+v", err)
+	}
+
+	expected := []string{
+		"",
+		"Checking the ",
+		"Checking the pods first.",
+		"Checking the pods first.\n\n",
+		"Checking the pods first.\n\nThen the nodes.",
+		"Checking the pods first.\n\nThen the nodes.",
+	}
+	if d := cmp.Diff(expected, summaries); d != "" {
+		t.Errorf("Unexpected reasoning summaries (-want +got):\n%s", d)
+	}
+
+	// Clients send back every block since the previous response; the reasoning stays with the stored response.
+	call := blocks["fc_1"]
+	call.Outputs = []*cassie.BlockOutput{
+		{
+			Kind:  cassie.BlockOutputKind_STDOUT,
+			Items: []*cassie.BlockOutputItem{{Mime: textMimeType, TextData: "pod-1 Running"}},
+		},
+	}
+	if err := agent.ProcessWithOpenAI(context.Background(), &cassie.GenerateRequest{
+		PreviousResponseId: "resp_1",
+		Blocks:             []*cassie.Block{blocks["rs_1"], call},
+	}, sender); err != nil {
+		t.Fatalf("ProcessWithOpenAI failed: %+v", err)
+	}
+	input := provider.requests[1].Input.OfInputItemList
+	if len(input) != 1 || input[0].OfFunctionCallOutput == nil || input[0].OfFunctionCallOutput.CallID != "call_1" {
+		t.Errorf("Expected the input to only be the output of call_1; got %+v", input)
+	}
+}
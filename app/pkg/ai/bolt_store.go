@@ -0,0 +1,356 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	"github.com/jlewi/cloud-assistant/app/pkg/boltdb"
+	"github.com/jlewi/cloud-assistant/protos/gen/cassie"
+	"github.com/openai/openai-go"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	responsesBucket = []byte("responses")
+	blocksBucket    = []byte("blocks")
+	turnsBucket     = []byte("turns")
+	// blockTurnsBucket maps the IDs of blocks to the IDs of the responses that generated them.
+	blockTurnsBucket = []byte("blockTurns")
+	branchesBucket   = []byte("branches")
+	// conversationBranchesBucket indexes branches by conversation. Its keys are conversationBranchKey and its values
+	// only hold the expiration time.
+	conversationBranchesBucket = []byte("conversationBranches")
+	// chatHistoryBucket maps the IDs of responses to the JSON encoded messages of their conversation.
+	chatHistoryBucket = []byte("chatHistory")
+
+	boltBuckets = [][]byte{responsesBucket, blocksBucket, turnsBucket, blockTurnsBucket, branchesBucket, conversationBranchesBucket, chatHistoryBucket}
+)
+
+// BoltConversationStore is a ConversationStore backed by a bbolt database on a local disk.
+type BoltConversationStore struct {
+	db  *boltdb.DB
+	ttl time.Duration
+	// now returns the current time. It can be overridden in tests.
+	now func() time.Time
+	// lastSweep is when expired entries were last deleted. It is only accessed in read-write transactions.
+	lastSweep time.Time
+}
+
+// NewBoltConversationStore creates a store using the database at path. Entries expire after ttl.
+func NewBoltConversationStore(path string, ttl time.Duration) (*BoltConversationStore, error) {
+	if ttl <= 0 {
+		ttl = DefaultConversationTTL
+	}
+	db, err := boltdb.New(path, "conversation store", boltBuckets...)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Update(indexBranches); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &BoltConversationStore{
+		db:  db,
+		ttl: ttl,
+		now: time.Now,
+	}, nil
+}
+
+// indexBranches adds the branches to the conversation index if it's empty. Databases written before the index was
+// kept already have branches.
+func indexBranches(tx *bolt.Tx) error {
+	index := tx.Bucket(conversationBranchesBucket)
+	if k, _ := index.Cursor().First(); k != nil {
+		return nil
+	}
+	return tx.Bucket(branchesBucket).ForEach(func(k, v []byte) error {
+		if len(v) < 8 {
+			return nil
+		}
+		branch := &cassie.Branch{}
+		if err := proto.Unmarshal(v[8:], branch); err != nil {
+			return errors.Wrapf(err, "Failed to unmarshal branch %s", k)
+		}
+		// The index entry expires with the branch.
+		if err := index.Put(conversationBranchKey(branch.GetConversationId(), branch.GetId()), append([]byte{}, v[:8]...)); err != nil {
+			return errors.Wrapf(err, "Failed to index branch %s", k)
+		}
+		return nil
+	})
+}
+
+// conversationBranchKey returns the key of a branch in the conversation index. Keys start with the conversation ID so
+// the branches of a conversation are found by seeking to its prefix.
+func conversationBranchKey(conversationID string, branchID string) []byte {
+	return []byte(conversationID + "/" + branchID)
+}
+
+// Close closes the database.
+func (s *BoltConversationStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *BoltConversationStore) PutBlocks(ctx context.Context, blocks ...*cassie.Block) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(blocksBucket)
+		for _, b := range blocks {
+			data, err := proto.Marshal(b)
+			if err != nil {
+				return errors.Wrapf(err, "Failed to marshal block %s", b.Id)
+			}
+			if err := bucket.Put([]byte(b.Id), s.encode(data)); err != nil {
+				return errors.Wrapf(err, "Failed to store block %s", b.Id)
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BoltConversationStore) GetBlock(ctx context.Context, id string) (*cassie.Block, error) {
+	var block *cassie.Block
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data, ok := s.decode(tx.Bucket(blocksBucket).Get([]byte(id)))
+		if !ok {
+			return nil
+		}
+		block = &cassie.Block{}
+		if err := proto.Unmarshal(data, block); err != nil {
+			return errors.Wrapf(err, "Failed to unmarshal block %s", id)
+		}
+		return nil
+	})
+	return block, err
+}
+
+func (s *BoltConversationStore) PutResponse(ctx context.Context, responseID string, blockIDs []string) error {
+	data, err := json.Marshal(blockIDs)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to marshal block IDs for response %s", responseID)
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(responsesBucket).Put([]byte(responseID), s.encode(data)); err != nil {
+			return errors.Wrapf(err, "Failed to store response %s", responseID)
+		}
+		return s.sweep(tx)
+	})
+}
+
+func (s *BoltConversationStore) GetResponse(ctx context.Context, responseID string) ([]string, bool, error) {
+	var ids []string
+	found := false
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data, ok := s.decode(tx.Bucket(responsesBucket).Get([]byte(responseID)))
+		if !ok {
+			return nil
+		}
+		found = true
+		if err := json.Unmarshal(data, &ids); err != nil {
+			return errors.Wrapf(err, "Failed to unmarshal block IDs for response %s", responseID)
+		}
+		return nil
+	})
+	return ids, found, err
+}
+
+func (s *BoltConversationStore) PutTurn(ctx context.Context, turn *Turn) error {
+	data, err := json.Marshal(turn)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to marshal turn for response %s", turn.ResponseID)
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(turnsBucket).Put([]byte(turn.ResponseID), s.encode(data)); err != nil {
+			return errors.Wrapf(err, "Failed to store turn for response %s", turn.ResponseID)
+		}
+		bucket := tx.Bucket(blockTurnsBucket)
+		for _, id := range turn.BlockIDs {
+			if err := bucket.Put([]byte(id), s.encode([]byte(turn.ResponseID))); err != nil {
+				return errors.Wrapf(err, "Failed to store turn for block %s", id)
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BoltConversationStore) GetTurn(ctx context.Context, responseID string) (*Turn, error) {
+	var turn *Turn
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		turn, err = s.getTurn(tx, responseID)
+		return err
+	})
+	return turn, err
+}
+
+func (s *BoltConversationStore) FindTurn(ctx context.Context, blockID string) (*Turn, error) {
+	var turn *Turn
+	err := s.db.View(func(tx *bolt.Tx) error {
+		responseID, ok := s.decode(tx.Bucket(blockTurnsBucket).Get([]byte(blockID)))
+		if !ok {
+			return nil
+		}
+		var err error
+		turn, err = s.getTurn(tx, string(responseID))
+		return err
+	})
+	return turn, err
+}
+
+func (s *BoltConversationStore) getTurn(tx *bolt.Tx, responseID string) (*Turn, error) {
+	data, ok := s.decode(tx.Bucket(turnsBucket).Get([]byte(responseID)))
+	if !ok {
+		return nil, nil
+	}
+	turn := &Turn{}
+	if err := json.Unmarshal(data, turn); err != nil {
+		return nil, errors.Wrapf(err, "Failed to unmarshal turn for response %s", responseID)
+	}
+	return turn, nil
+}
+
+func (s *BoltConversationStore) PutBranch(ctx context.Context, branch *cassie.Branch) error {
+	data, err := proto.Marshal(branch)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to marshal branch %s", branch.Id)
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		value := s.encode(data)
+		if err := tx.Bucket(branchesBucket).Put([]byte(branch.Id), value); err != nil {
+			return errors.Wrapf(err, "Failed to store branch %s", branch.Id)
+		}
+		// The index entry expires with the branch.
+		if err := tx.Bucket(conversationBranchesBucket).Put(conversationBranchKey(branch.ConversationId, branch.Id), value[:8]); err != nil {
+			return errors.Wrapf(err, "Failed to index branch %s", branch.Id)
+		}
+		return nil
+	})
+}
+
+func (s *BoltConversationStore) GetBranch(ctx context.Context, id string) (*cassie.Branch, error) {
+	var branch *cassie.Branch
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data, ok := s.decode(tx.Bucket(branchesBucket).Get([]byte(id)))
+		if !ok {
+			return nil
+		}
+		branch = &cassie.Branch{}
+		if err := proto.Unmarshal(data, branch); err != nil {
+			return errors.Wrapf(err, "Failed to unmarshal branch %s", id)
+		}
+		return nil
+	})
+	return branch, err
+}
+
+// ListBranches seeks to the conversation in the index so it only reads the conversation's branches.
+func (s *BoltConversationStore) ListBranches(ctx context.Context, conversationID string) ([]*cassie.Branch, error) {
+	branches := make([]*cassie.Branch, 0, 1)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		prefix := conversationBranchKey(conversationID, "")
+		bucket := tx.Bucket(branchesBucket)
+		c := tx.Bucket(conversationBranchesBucket).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			if len(v) < 8 || s.expired(v) {
+				continue
+			}
+			id := k[len(prefix):]
+			data, ok := s.decode(bucket.Get(id))
+			if !ok {
+				continue
+			}
+			branch := &cassie.Branch{}
+			if err := proto.Unmarshal(data, branch); err != nil {
+				return errors.Wrapf(err, "Failed to unmarshal branch %s", id)
+			}
+			if branch.GetConversationId() == conversationID {
+				branches = append(branches, branch)
+			}
+		}
+		return nil
+	})
+	sortBranches(branches)
+	return branches, err
+}
+
+func (s *BoltConversationStore) PutChatHistory(ctx context.Context, responseID string, messages []openai.ChatCompletionMessageParamUnion) error {
+	data, err := json.Marshal(messages)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to marshal chat history for response %s", responseID)
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(chatHistoryBucket).Put([]byte(responseID), s.encode(data)); err != nil {
+			return errors.Wrapf(err, "Failed to store chat history for response %s", responseID)
+		}
+		return s.sweep(tx)
+	})
+}
+
+func (s *BoltConversationStore) GetChatHistory(ctx context.Context, responseID string) ([]openai.ChatCompletionMessageParamUnion, bool, error) {
+	var messages []openai.ChatCompletionMessageParamUnion
+	found := false
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data, ok := s.decode(tx.Bucket(chatHistoryBucket).Get([]byte(responseID)))
+		if !ok {
+			return nil
+		}
+		found = true
+		if err := json.Unmarshal(data, &messages); err != nil {
+			return errors.Wrapf(err, "Failed to unmarshal chat history for response %s", responseID)
+		}
+		return nil
+	})
+	return messages, found, err
+}
+
+// encode prefixes the data with its expiration time.
+func (s *BoltConversationStore) encode(data []byte) []byte {
+	v := make([]byte, 8+len(data))
+	binary.BigEndian.PutUint64(v, uint64(s.now().Add(s.ttl).UnixNano()))
+	copy(v[8:], data)
+	return v
+}
+
+// decode returns a copy of the data if the value exists and hasn't expired. Values returned by bbolt are only
+// valid for the life of the transaction which is why the data is copied.
+func (s *BoltConversationStore) decode(v []byte) ([]byte, bool) {
+	if len(v) < 8 || s.expired(v) {
+		return nil, false
+	}
+	return append([]byte{}, v[8:]...), true
+}
+
+func (s *BoltConversationStore) expired(v []byte) bool {
+	expiresAt := time.Unix(0, int64(binary.BigEndian.Uint64(v)))
+	return !s.now().Before(expiresAt)
+}
+
+// sweep deletes expired entries if it hasn't done so recently.
+func (s *BoltConversationStore) sweep(tx *bolt.Tx) error {
+	if s.now().Sub(s.lastSweep) < boltdb.SweepInterval {
+		return nil
+	}
+	s.lastSweep = s.now()
+	for _, name := range boltBuckets {
+		bucket := tx.Bucket(name)
+		// Collect the keys first since deleting while iterating with a cursor can skip entries.
+		expired := make([][]byte, 0, 10)
+		if err := bucket.ForEach(func(k, v []byte) error {
+			if len(v) < 8 || s.expired(v) {
+				expired = append(expired, append([]byte{}, k...))
+			}
+			return nil
+		}); err != nil {
+			return errors.Wrapf(err, "Failed to find expired entries in %s", name)
+		}
+		for _, k := range expired {
+			if err := bucket.Delete(k); err != nil {
+				return errors.Wrapf(err, "Failed to delete expired entry %s", k)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package ai
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jlewi/cloud-assistant/protos/gen/cassie"
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestBoltConversationStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "conversations.db")
+
+	// Two stores on the same file share the open database.
+	replica1, err := NewBoltConversationStore(path, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create store: %+v", err)
+	}
+	replica2, err := NewBoltConversationStore(path, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create store: %+v", err)
+	}
+
+	block := &cassie.Block{
+		Id:       "fc_1",
+		Kind:     cassie.BlockKind_CODE,
+		Contents: "kubectl get pods",
+		CallId:   "call_1",
+	}
+	if err := replica1.PutBlocks(ctx, block); err != nil {
+		t.Fatalf("Failed to put blocks: %+v", err)
+	}
+	if err := replica1.PutResponse(ctx, "resp_1", []string{"fc_1"}); err != nil {
+		t.Fatalf("Failed to put response: %+v", err)
+	}
+
+	ids, ok, err := replica2.GetResponse(ctx, "resp_1")
+	if err != nil {
+		t.Fatalf("Failed to get response: %+v", err)
+	}
+	if !ok {
+		t.Fatalf("Response resp_1 wasn't found")
+	}
+	if d := cmp.Diff([]string{"fc_1"}, ids); d != "" {
+		t.Errorf("Unexpected block IDs (-want +got):\n%s", d)
+	}
+
+	actual, err := replica2.GetBlock(ctx, "fc_1")
+	if err != nil {
+		t.Fatalf("Failed to get block: %+v", err)
+	}
+	if d := cmp.Diff(block, actual, protocmp.Transform()); d != "" {
+		t.Errorf("Unexpected block (-want +got):\n%s", d)
+	}
+
+	if b, err := replica2.GetBlock(ctx, "missing"); err != nil || b != nil {
+		t.Errorf("Expected no block for a missing ID; got %v, %v", b, err)
+	}
+}
+
+func TestBoltConversationStore_Expiry(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewBoltConversationStore(filepath.Join(t.TempDir(), "conversations.db"), time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create store: %+v", err)
+	}
+
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	if err := store.PutBlocks(ctx, &cassie.Block{Id: "fc_1"}); err != nil {
+		t.Fatalf("Failed to put blocks: %+v", err)
+	}
+	if err := store.PutResponse(ctx, "resp_1", []string{"fc_1"}); err != nil {
+		t.Fatalf("Failed to put response: %+v", err)
+	}
+
+	now = now.Add(2 * time.Hour)
+
+	if _, ok, err := store.GetResponse(ctx, "resp_1"); err != nil || ok {
+		t.Errorf("Expected resp_1 to have expired; got %v, %v", ok, err)
+	}
+	if b, err := store.GetBlock(ctx, "fc_1"); err != nil || b != nil {
+		t.Errorf("Expected fc_1 to have expired; got %v, %v", b, err)
+	}
+
+	// Putting a new response sweeps the expired entries.
+	if err := store.PutResponse(ctx, "resp_2", nil); err != nil {
+		t.Fatalf("Failed to put response: %+v", err)
+	}
+	store.now = func() time.Time { return now.Add(-2 * time.Hour) }
+	if _, ok, err := store.GetResponse(ctx, "resp_1"); err != nil || ok {
+		t.Errorf("Expected resp_1 to have been deleted; got %v, %v", ok, err)
+	}
+}
+
+func TestBoltConversationStore_Branches(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "conversations.db")
+	store, err := NewBoltConversationStore(path, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create store: %+v", err)
+	}
+
+	turn := &Turn{ResponseID: "resp_1", ConversationID: "conv_1", BranchID: "conv_1", BlockIDs: []string{"msg_1", "fc_1"}}
+	if err := store.PutTurn(ctx, turn); err != nil {
+		t.Fatalf("Failed to put turn: %+v", err)
+	}
+	actual, err := store.FindTurn(ctx, "fc_1")
+	if err != nil {
+		t.Fatalf("Failed to find turn: %+v", err)
+	}
+	if d := cmp.Diff(turn, actual); d != "" {
+		t.Errorf("Unexpected turn (-want +got):\n%s", d)
+	}
+	if tr, err := store.FindTurn(ctx, "missing"); err != nil || tr != nil {
+		t.Errorf("Expected no turn for a missing block; got %v, %v", tr, err)
+	}
+
+	start := time.Date(2025, 6, 1, 10, 0, 0, 0, time.UTC)
+	branches := []*cassie.Branch{
+		{Id: "fork_1", ConversationId: "conv_1", ParentBranchId: "conv_1", ForkResponseId: "resp_1", CreateTime: timestamppb.New(start.Add(time.Minute))},
+		{Id: "conv_1", ConversationId: "conv_1", Name: "main", CreateTime: timestamppb.New(start)},
+		{Id: "conv_2", ConversationId: "conv_2", Name: "main", CreateTime: timestamppb.New(start)},
+		// Its ID starts with the ID of the first conversation.
+		{Id: "conv_10", ConversationId: "conv_10", Name: "main", CreateTime: timestamppb.New(start)},
+	}
+	for _, b := range branches {
+		if err := store.PutBranch(ctx, b); err != nil {
+			t.Fatalf("Failed to put branch: %+v", err)
+		}
+	}
+	listed, err := store.ListBranches(ctx, "conv_1")
+	if err != nil {
+		t.Fatalf("Failed to list branches: %+v", err)
+	}
+	if d := cmp.Diff([]*cassie.Branch{branches[1], branches[0]}, listed, protocmp.Transform()); d != "" {
+		t.Errorf("Unexpected branches (-want +got):\n%s", d)
+	}
+
+	// Databases written before the index was kept are indexed when they're opened.
+	if err := store.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(conversationBranchesBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucket(conversationBranchesBucket)
+		return err
+	}); err != nil {
+		t.Fatalf("Failed to delete the index: %+v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Failed to close store: %+v", err)
+	}
+	store, err = NewBoltConversationStore(path, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %+v", err)
+	}
+	defer store.Close()
+	listed, err = store.ListBranches(ctx, "conv_1")
+	if err != nil {
+		t.Fatalf("Failed to list branches: %+v", err)
+	}
+	if d := cmp.Diff([]*cassie.Branch{branches[1], branches[0]}, listed, protocmp.Transform()); d != "" {
+		t.Errorf("Unexpected branches after reopening (-want +got):\n%s", d)
+	}
+}
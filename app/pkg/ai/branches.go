@@ -0,0 +1,239 @@
+package ai
+
+import (
+	"context"
+
+	"connectrpc.com/connect"
+	"github.com/google/uuid"
+	"github.com/jlewi/cloud-assistant/app/pkg/iam"
+	"github.com/jlewi/cloud-assistant/app/pkg/logs"
+	"github.com/jlewi/cloud-assistant/protos/gen/cassie"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	// mainBranchName is the name of the branch a conversation starts on.
+	mainBranchName = "main"
+)
+
+// ForkConversation creates a branch of a conversation that continues from an earlier response. The tool calls in
+// that response and their outputs are looked up in the conversation store so the client doesn't need to have them.
+func (a *Agent) ForkConversation(ctx context.Context, req *connect.Request[cassie.ForkConversationRequest]) (*connect.Response[cassie.ForkConversationResponse], error) {
+	log := logs.FromContext(ctx)
+	if a.stateless {
+		return nil, connect.NewError(connect.CodeFailedPrecondition, errors.New("Conversations can't be forked in stateless mode; send the blocks up to the fork point instead"))
+	}
+	if req.Msg.GetResponseId() == "" && req.Msg.GetBlockId() == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("Either response_id or block_id must be set"))
+	}
+
+	var turn *Turn
+	var err error
+	if req.Msg.GetResponseId() != "" {
+		turn, err = a.store.GetTurn(ctx, req.Msg.GetResponseId())
+	} else {
+		turn, err = a.store.FindTurn(ctx, req.Msg.GetBlockId())
+	}
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, errors.Wrapf(err, "Failed to look up the fork point"))
+	}
+	if turn == nil {
+		return nil, connect.NewError(connect.CodeNotFound, errors.Errorf("No response found for response_id %q or block_id %q; it may have expired", req.Msg.GetResponseId(), req.Msg.GetBlockId()))
+	}
+
+	// Check the owner of the turn rather than of its branch since the branch may have expired before the turn.
+	if !ownsTurn(ctx, turn) {
+		return nil, connect.NewError(connect.CodePermissionDenied, errors.New("Conversations can only be forked by the principal that owns them"))
+	}
+
+	callIDs, _, err := a.store.GetResponse(ctx, turn.ResponseID)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, errors.Wrapf(err, "Failed to get response %s", turn.ResponseID))
+	}
+	blocks := make([]*cassie.Block, 0, len(callIDs))
+	for _, id := range callIDs {
+		b, err := a.store.GetBlock(ctx, id)
+		if err != nil {
+			return nil, connect.NewError(connect.CodeInternal, errors.Wrapf(err, "Failed to get block %s", id))
+		}
+		if b == nil {
+			return nil, connect.NewError(connect.CodeNotFound, errors.Errorf("Block %s of response %s has expired", id, turn.ResponseID))
+		}
+		blocks = append(blocks, b)
+	}
+
+	branch := newBranch(ctx, turn.ConversationID, req.Msg.GetName())
+	branch.ParentBranchId = turn.BranchID
+	branch.ForkResponseId = turn.ResponseID
+	branch.HeadResponseId = turn.ResponseID
+	if err := a.store.PutBranch(ctx, branch); err != nil {
+		return nil, connect.NewError(connect.CodeInternal, errors.Wrapf(err, "Failed to store branch"))
+	}
+	log.Info("Forked conversation", "conversationId", branch.ConversationId, "branchId", branch.Id, "responseId", turn.ResponseID)
+	return connect.NewResponse(&cassie.ForkConversationResponse{Branch: branch, Blocks: blocks}), nil
+}
+
+// ListBranches lists the branches of a conversation. Only the branches owned by the caller are returned.
+func (a *Agent) ListBranches(ctx context.Context, req *connect.Request[cassie.ListBranchesRequest]) (*connect.Response[cassie.ListBranchesResponse], error) {
+	conversationID := req.Msg.GetConversationId()
+	if conversationID == "" && req.Msg.GetResponseId() != "" {
+		turn, err := a.store.GetTurn(ctx, req.Msg.GetResponseId())
+		if err != nil {
+			return nil, connect.NewError(connect.CodeInternal, errors.Wrapf(err, "Failed to get turn for response %s", req.Msg.GetResponseId()))
+		}
+		if turn == nil {
+			return nil, connect.NewError(connect.CodeNotFound, errors.Errorf("Response %s not found; it may have expired", req.Msg.GetResponseId()))
+		}
+		conversationID = turn.ConversationID
+	}
+	if conversationID == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("Either conversation_id or response_id must be set"))
+	}
+
+	all, err := a.store.ListBranches(ctx, conversationID)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, errors.Wrapf(err, "Failed to list branches of conversation %s", conversationID))
+	}
+	principal := iam.GetPrincipal(ctx)
+	branches := make([]*cassie.Branch, 0, len(all))
+	for _, b := range all {
+		if b.GetPrincipal() == principal {
+			branches = append(branches, b)
+		}
+	}
+	return connect.NewResponse(&cassie.ListBranchesResponse{Branches: branches}), nil
+}
+
+// resolveBranch returns the branch a Generate call continues. If the request names a branch and no previous
+// response, the request is updated to continue from the branch's latest response. Requests that don't continue a
+// known branch start a new conversation. It returns nil in stateless mode since there are no responses to branch from.
+func (a *Agent) resolveBranch(ctx context.Context, req *cassie.GenerateRequest) (*cassie.Branch, error) {
+	if a.stateless {
+		return nil, nil
+	}
+	principal := iam.GetPrincipal(ctx)
+
+	if req.GetBranchId() != "" {
+		branch, err := a.store.GetBranch(ctx, req.GetBranchId())
+		if err != nil {
+			return nil, connect.NewError(connect.CodeInternal, errors.Wrapf(err, "Failed to get branch %s", req.GetBranchId()))
+		}
+		if branch == nil {
+			return nil, connect.NewError(connect.CodeNotFound, errors.Errorf("Branch %s not found; it may have expired", req.GetBranchId()))
+		}
+		if branch.GetPrincipal() != principal {
+			return nil, connect.NewError(connect.CodePermissionDenied, errors.New("Branches can only be continued by the principal that owns them"))
+		}
+		if req.PreviousResponseId == "" {
+			req.PreviousResponseId = branch.GetHeadResponseId()
+		}
+		return branch, nil
+	}
+
+	if req.GetPreviousResponseId() != "" {
+		turn, err := a.store.GetTurn(ctx, req.GetPreviousResponseId())
+		if err != nil {
+			return nil, connect.NewError(connect.CodeInternal, errors.Wrapf(err, "Failed to get turn for response %s", req.GetPreviousResponseId()))
+		}
+		if turn != nil {
+			branch, err := a.store.GetBranch(ctx, turn.BranchID)
+			if err != nil {
+				return nil, connect.NewError(connect.CodeInternal, errors.Wrapf(err, "Failed to get branch %s", turn.BranchID))
+			}
+			if branch != nil && branch.GetPrincipal() == principal {
+				if branch.GetHeadResponseId() == turn.ResponseID {
+					return branch, nil
+				}
+				// The client went back to an earlier response so continuing the branch would lose its later
+				// responses; start a new branch from that response instead.
+				fork := newBranch(ctx, turn.ConversationID, "")
+				fork.ParentBranchId = branch.GetId()
+				fork.ForkResponseId = turn.ResponseID
+				fork.HeadResponseId = turn.ResponseID
+				return fork, nil
+			}
+		}
+	}
+
+	// The branch isn't stored until its first response is recorded.
+	branch := newBranch(ctx, "", mainBranchName)
+	branch.HeadResponseId = req.GetPreviousResponseId()
+	return branch, nil
+}
+
+// newBranch returns a branch of the conversation owned by the caller. If conversationID is empty the branch starts
+// a new conversation.
+func newBranch(ctx context.Context, conversationID string, name string) *cassie.Branch {
+	id := uuid.NewString()
+	if conversationID == "" {
+		conversationID = id
+	}
+	return &cassie.Branch{
+		Id:             id,
+		ConversationId: conversationID,
+		Name:           name,
+		CreateTime:     timestamppb.Now(),
+		Principal:      iam.GetPrincipal(ctx),
+	}
+}
+
+// recordTurn records the response generated by builder as the latest response on the branch. Errors are logged
+// rather than returned since the response was already streamed to the client.
+func (a *Agent) recordTurn(ctx context.Context, branch *cassie.Branch, builder *BlocksBuilder) {
+	log := logs.FromContext(ctx)
+	if branch == nil || builder == nil || builder.responseID == "" {
+		return
+	}
+
+	blocks := builder.orderedBlocks()
+	turn := &Turn{
+		ResponseID:     builder.responseID,
+		ConversationID: branch.GetConversationId(),
+		BranchID:       branch.GetId(),
+		BlockIDs:       make([]string, 0, len(blocks)),
+		Principal:      iam.GetPrincipal(ctx),
+	}
+	for _, b := range blocks {
+		turn.BlockIDs = append(turn.BlockIDs, b.GetId())
+	}
+	if err := a.store.PutTurn(ctx, turn); err != nil {
+		log.Error(err, "Failed to store turn", "responseId", turn.ResponseID)
+	}
+
+	branch.HeadResponseId = builder.responseID
+	if err := a.store.PutBranch(ctx, branch); err != nil {
+		log.Error(err, "Failed to store branch", "branchId", branch.GetId())
+	}
+}
+
+// ownsTurn returns true if the caller is the principal that generated the turn's response.
+func ownsTurn(ctx context.Context, turn *Turn) bool {
+	return turn.Principal == iam.GetPrincipal(ctx)
+}
+
+// storeOutputs stores the tool calls the client sent outputs for so that branches forked from the response
+// containing the calls start with the outputs. Errors are logged since the outputs are also in the request.
+func (a *Agent) storeOutputs(ctx context.Context, blocks []*cassie.Block) {
+	log := logs.FromContext(ctx)
+	calls := make([]*cassie.Block, 0, len(blocks))
+	for _, b := range blocks {
+		if b.GetCallId() != "" && len(b.GetOutputs()) > 0 {
+			calls = append(calls, b)
+		}
+	}
+	if len(calls) == 0 {
+		return
+	}
+	if err := a.store.PutBlocks(ctx, calls...); err != nil {
+		log.Error(err, "Failed to store the outputs of tool calls")
+	}
+}
+
+// withBranchID returns a sender that sets the branch ID on every response.
+func withBranchID(sender BlockSender, branchID string) BlockSender {
+	return func(resp *cassie.GenerateResponse) error {
+		resp.BranchId = branchID
+		return sender(resp)
+	}
+}
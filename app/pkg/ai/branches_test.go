@@ -0,0 +1,170 @@
+package ai
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/jlewi/cloud-assistant/app/pkg/iam"
+	"github.com/jlewi/cloud-assistant/protos/gen/cassie"
+	"github.com/openai/openai-go/responses"
+)
+
+func Test_ForkConversation(t *testing.T) {
+	provider := &fakeProvider{
+		responses: [][]responses.ResponseStreamEventUnion{
+			shellCallEvents(t, "resp_1", "fc_1", "call_1", "kubectl get pods"),
+			shellCallEvents(t, "resp_2", "fc_2", "call_2", "kubectl get nodes"),
+			shellCallEvents(t, "resp_3", "fc_3", "call_3", "kubectl describe pod pod-1"),
+		},
+	}
+	agent, err := NewAgent(AgentOptions{Provider: provider})
+	if err != nil {
+		t.Fatalf("Failed to create agent: %+v", err)
+	}
+	ctx := iam.ContextWithPrincipal(context.Background(), "alice@acme.com")
+
+	// generate runs a turn and returns the ID of the branch it was generated on.
+	generate := func(req *cassie.GenerateRequest) string {
+		t.Helper()
+		branchID := ""
+		sender := func(resp *cassie.GenerateResponse) error {
+			branchID = resp.GetBranchId()
+			return nil
+		}
+		if err := agent.ProcessWithOpenAI(ctx, req, sender); err != nil {
+			t.Fatalf("ProcessWithOpenAI failed: %+v", err)
+		}
+		return branchID
+	}
+
+	mainID := generate(&cassie.GenerateRequest{
+		Blocks: []*cassie.Block{
+			{Id: "user_1", Kind: cassie.BlockKind_MARKUP, Role: cassie.BlockRole_BLOCK_ROLE_USER, Contents: "What's running?"},
+		},
+	})
+	if mainID == "" {
+		t.Fatalf("Expected responses to include the branch ID")
+	}
+
+	// The client continues the branch by ID and sends the output of the call.
+	call := &cassie.Block{
+		Id:       "fc_1",
+		Kind:     cassie.BlockKind_CODE,
+		CallId:   "call_1",
+		Contents: "kubectl get pods",
+		Outputs: []*cassie.BlockOutput{
+			{
+				Kind:  cassie.BlockOutputKind_STDOUT,
+				Items: []*cassie.BlockOutputItem{{Mime: textMimeType, TextData: "pod-1 Running"}},
+			},
+		},
+	}
+	if id := generate(&cassie.GenerateRequest{
+		BranchId: mainID,
+		Blocks: []*cassie.Block{
+			call,
+			{Id: "user_2", Kind: cassie.BlockKind_MARKUP, Role: cassie.BlockRole_BLOCK_ROLE_USER, Contents: "What about the nodes?"},
+		},
+	}); id != mainID {
+		t.Errorf("Expected the turn to continue branch %s; got %s", mainID, id)
+	}
+	if got := provider.requests[1].PreviousResponseID.Value; got != "resp_1" {
+		t.Errorf("Expected the branch to continue from resp_1; got %q", got)
+	}
+
+	// Other principals can't fork the conversation.
+	_, err = agent.ForkConversation(iam.ContextWithPrincipal(context.Background(), "mallory@acme.com"), connect.NewRequest(&cassie.ForkConversationRequest{BlockId: "fc_1"}))
+	if connect.CodeOf(err) != connect.CodePermissionDenied {
+		t.Errorf("Expected PermissionDenied for another principal; got %v", err)
+	}
+
+	fork, err := agent.ForkConversation(ctx, connect.NewRequest(&cassie.ForkConversationRequest{BlockId: "fc_1", Name: "describe"}))
+	if err != nil {
+		t.Fatalf("ForkConversation failed: %+v", err)
+	}
+	branch := fork.Msg.GetBranch()
+	if branch.GetConversationId() != mainID || branch.GetParentBranchId() != mainID || branch.GetHeadResponseId() != "resp_1" {
+		t.Errorf("Unexpected branch: %v", branch)
+	}
+	blocks := fork.Msg.GetBlocks()
+	if len(blocks) != 1 || blocks[0].GetId() != "fc_1" || len(blocks[0].GetOutputs()) != 1 {
+		t.Fatalf("Expected the fork to carry over the call and its output; got %v", blocks)
+	}
+
+	// The client only sends the new question; the output of the call is filled in from the store.
+	if id := generate(&cassie.GenerateRequest{
+		BranchId: branch.GetId(),
+		Blocks: []*cassie.Block{
+			{Id: "user_3", Kind: cassie.BlockKind_MARKUP, Role: cassie.BlockRole_BLOCK_ROLE_USER, Contents: "Describe pod-1"},
+		},
+	}); id != branch.GetId() {
+		t.Errorf("Expected the turn to continue branch %s; got %s", branch.GetId(), id)
+	}
+	forked := provider.requests[2]
+	if got := forked.PreviousResponseID.Value; got != "resp_1" {
+		t.Errorf("Expected the fork to continue from resp_1; got %q", got)
+	}
+	hasOutput := false
+	for _, item := range forked.Input.OfInputItemList {
+		if item.OfFunctionCallOutput != nil && item.OfFunctionCallOutput.CallID == "call_1" {
+			hasOutput = true
+		}
+	}
+	if !hasOutput {
+		t.Errorf("Expected the output of call_1 to be sent on the fork")
+	}
+
+	list, err := agent.ListBranches(ctx, connect.NewRequest(&cassie.ListBranchesRequest{ResponseId: "resp_3"}))
+	if err != nil {
+		t.Fatalf("ListBranches failed: %+v", err)
+	}
+	heads := map[string]string{}
+	for _, b := range list.Msg.GetBranches() {
+		heads[b.GetId()] = b.GetHeadResponseId()
+	}
+	if len(heads) != 2 || heads[mainID] != "resp_2" || heads[branch.GetId()] != "resp_3" {
+		t.Errorf("Unexpected branches: %v", list.Msg.GetBranches())
+	}
+	if list.Msg.GetBranches()[0].GetId() != mainID {
+		t.Errorf("Expected the first branch to be listed first")
+	}
+
+	other, err := agent.ListBranches(iam.ContextWithPrincipal(context.Background(), "mallory@acme.com"), connect.NewRequest(&cassie.ListBranchesRequest{ConversationId: mainID}))
+	if err != nil {
+		t.Fatalf("ListBranches failed: %+v", err)
+	}
+	if len(other.Msg.GetBranches()) != 0 {
+		t.Errorf("Expected other principals not to see the branches; got %v", other.Msg.GetBranches())
+	}
+}
+
+func Test_ForkConversationExpiredBranch(t *testing.T) {
+	store := NewMemoryConversationStore(10, time.Hour)
+	agent, err := NewAgent(AgentOptions{Provider: &fakeProvider{}, ConversationStore: store})
+	if err != nil {
+		t.Fatalf("Failed to create agent: %+v", err)
+	}
+	ctx := context.Background()
+	if err := store.PutBlocks(ctx, &cassie.Block{Id: "fc_1", Kind: cassie.BlockKind_CODE, CallId: "call_1", Contents: "kubectl get pods"}); err != nil {
+		t.Fatalf("Failed to put blocks: %+v", err)
+	}
+	if err := store.PutResponse(ctx, "resp_1", []string{"fc_1"}); err != nil {
+		t.Fatalf("Failed to put response: %+v", err)
+	}
+	// The branch of the turn isn't in the store e.g. because it expired.
+	if err := store.PutTurn(ctx, &Turn{ResponseID: "resp_1", ConversationID: "conv_1", BranchID: "branch_1", BlockIDs: []string{"fc_1"}, Principal: "alice@acme.com"}); err != nil {
+		t.Fatalf("Failed to put turn: %+v", err)
+	}
+
+	mallory := iam.ContextWithPrincipal(ctx, "mallory@acme.com")
+	if _, err := agent.ForkConversation(mallory, connect.NewRequest(&cassie.ForkConversationRequest{ResponseId: "resp_1"})); connect.CodeOf(err) != connect.CodePermissionDenied {
+		t.Errorf("Expected PermissionDenied for another principal; got %v", err)
+	}
+
+	alice := iam.ContextWithPrincipal(ctx, "alice@acme.com")
+	if _, err := agent.ForkConversation(alice, connect.NewRequest(&cassie.ForkConversationRequest{ResponseId: "resp_1"})); err != nil {
+		t.Errorf("Expected the owner to be able to fork; got %+v", err)
+	}
+}
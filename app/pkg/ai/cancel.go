@@ -0,0 +1,194 @@
+package ai
+
+import (
+	"context"
+	"sync"
+
+	"connectrpc.com/connect"
+	"github.com/google/uuid"
+	"github.com/jlewi/cloud-assistant/app/pkg/iam"
+	"github.com/jlewi/cloud-assistant/app/pkg/logs"
+	"github.com/jlewi/cloud-assistant/protos/gen/cassie"
+	"github.com/openai/openai-go/option"
+	"github.com/pkg/errors"
+)
+
+const (
+	// CancelledMetadataKey is the key in Block.Metadata that marks the block sent at the end of a cancelled
+	// Generate call.
+	CancelledMetadataKey = "cloudassistant.io/cancelled"
+)
+
+// errGenerationCancelled is the cause of the context of a generation cancelled with CancelGenerate. It
+// distinguishes cancellation from the client dropping the stream or a timeout.
+var errGenerationCancelled = errors.New("Generation was cancelled by CancelGenerate")
+
+// Canceller is implemented by providers that can cancel a response on the backend. Cancelling the context of a
+// streaming request stops the stream but the backend may keep generating the response.
+type Canceller interface {
+	Cancel(ctx context.Context, responseID string, opts ...option.RequestOption) error
+}
+
+// generation is a Generate call that is in flight.
+type generation struct {
+	requestID string
+	principal string
+	cancel    context.CancelCauseFunc
+
+	mu sync.Mutex
+	// responseIDs are the IDs of the responses generated so far; there is one per step.
+	responseIDs []string
+	// provider is the provider serving the current response. It can be a fallback rather than the agent's provider
+	// so it's the one asked to cancel the response.
+	provider Provider
+	// opts are the request options (e.g. the OAuth token) used to talk to the provider.
+	opts []option.RequestOption
+}
+
+// generations tracks the Generate calls in flight so they can be cancelled by request or response ID. Generations
+// are only tracked in memory so CancelGenerate has to reach the replica serving the Generate call; with several
+// replicas the load balancer has to route both calls of a principal to the same replica.
+type generations struct {
+	mu         sync.Mutex
+	byRequest  map[string]*generation
+	byResponse map[string]*generation
+}
+
+func newGenerations() *generations {
+	return &generations{
+		byRequest:  make(map[string]*generation),
+		byResponse: make(map[string]*generation),
+	}
+}
+
+// start registers a generation. The returned context is cancelled when the generation is cancelled and done must
+// be called once the generation finishes.
+func (g *generations) start(ctx context.Context, requestID string) (context.Context, *generation, func()) {
+	if requestID == "" {
+		requestID = uuid.NewString()
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	gen := &generation{
+		requestID: requestID,
+		principal: iam.GetPrincipal(ctx),
+		cancel:    cancel,
+	}
+
+	g.mu.Lock()
+	g.byRequest[requestID] = gen
+	g.mu.Unlock()
+
+	done := func() {
+		g.mu.Lock()
+		if g.byRequest[requestID] == gen {
+			delete(g.byRequest, requestID)
+		}
+		gen.mu.Lock()
+		for _, id := range gen.responseIDs {
+			delete(g.byResponse, id)
+		}
+		gen.mu.Unlock()
+		g.mu.Unlock()
+		cancel(nil)
+	}
+	return ctx, gen, done
+}
+
+// addResponse records that the generation is streaming the response with the given ID from provider.
+func (g *generations) addResponse(gen *generation, responseID string, provider Provider, opts []option.RequestOption) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	gen.mu.Lock()
+	defer gen.mu.Unlock()
+	gen.responseIDs = append(gen.responseIDs, responseID)
+	gen.provider = provider
+	gen.opts = opts
+	g.byResponse[responseID] = gen
+}
+
+// find returns the generation with the given request or response ID.
+func (g *generations) find(requestID string, responseID string) (*generation, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if gen, ok := g.byRequest[requestID]; ok && requestID != "" {
+		return gen, true
+	}
+	if gen, ok := g.byResponse[responseID]; ok && responseID != "" {
+		return gen, true
+	}
+	return nil, false
+}
+
+// lastResponseID returns the ID of the response currently being generated or the empty string if there isn't one
+// yet.
+func (gen *generation) lastResponseID() string {
+	gen.mu.Lock()
+	defer gen.mu.Unlock()
+	if len(gen.responseIDs) == 0 {
+		return ""
+	}
+	return gen.responseIDs[len(gen.responseIDs)-1]
+}
+
+// CancelGenerate cancels an in-flight Generate call. Principals can only cancel their own generations.
+func (a *Agent) CancelGenerate(ctx context.Context, req *connect.Request[cassie.CancelGenerateRequest]) (*connect.Response[cassie.CancelGenerateResponse], error) {
+	log := logs.FromContext(ctx)
+	if req.Msg.GetRequestId() == "" && req.Msg.GetResponseId() == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("Either request_id or response_id must be set"))
+	}
+
+	gen, ok := a.generations.find(req.Msg.GetRequestId(), req.Msg.GetResponseId())
+	if !ok {
+		return connect.NewResponse(&cassie.CancelGenerateResponse{Cancelled: false}), nil
+	}
+	if gen.principal != iam.GetPrincipal(ctx) {
+		return nil, connect.NewError(connect.CodePermissionDenied, errors.New("Generations can only be cancelled by the principal that started them"))
+	}
+
+	log.Info("Cancelling generation", "requestId", gen.requestID, "responseId", gen.lastResponseID())
+	gen.cancel(errGenerationCancelled)
+	a.cancelUpstream(ctx, gen)
+	return connect.NewResponse(&cassie.CancelGenerateResponse{Cancelled: true}), nil
+}
+
+// cancelUpstream asks the provider serving the current response to stop generating it if it supports
+// cancellation. Failures are only logged since the stream to the provider has already been closed.
+func (a *Agent) cancelUpstream(ctx context.Context, gen *generation) {
+	log := logs.FromContext(ctx)
+	responseID := gen.lastResponseID()
+	if responseID == "" {
+		return
+	}
+	gen.mu.Lock()
+	provider := gen.provider
+	opts := gen.opts
+	gen.mu.Unlock()
+	canceller, ok := provider.(Canceller)
+	if !ok {
+		return
+	}
+	if err := canceller.Cancel(context.WithoutCancel(ctx), responseID, opts...); err != nil {
+		log.Info("Provider didn't cancel the response", "responseId", responseID, "err", err.Error())
+	}
+}
+
+// isCancelled returns true if ctx was cancelled by CancelGenerate.
+func isCancelled(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), errGenerationCancelled)
+}
+
+// cancelledResponse is the final response sent when a generation is cancelled.
+func cancelledResponse(responseID string) *cassie.GenerateResponse {
+	return &cassie.GenerateResponse{
+		ResponseId: responseID,
+		Blocks: []*cassie.Block{
+			{
+				Id:       "cancelled_" + uuid.NewString(),
+				Kind:     cassie.BlockKind_MARKUP,
+				Role:     cassie.BlockRole_BLOCK_ROLE_ASSISTANT,
+				Contents: "_Generation cancelled._",
+				Metadata: map[string]string{CancelledMetadataKey: "true"},
+			},
+		},
+	}
+}
@@ -0,0 +1,205 @@
+package ai
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/google/go-cmp/cmp"
+	"github.com/jlewi/cloud-assistant/app/pkg/iam"
+	"github.com/jlewi/cloud-assistant/protos/gen/cassie"
+	"github.com/openai/openai-go/option"
+	"github.com/openai/openai-go/responses"
+)
+
+// hangingProvider is a Provider whose stream sends its events and then blocks until the request is cancelled.
+type hangingProvider struct {
+	events []responses.ResponseStreamEventUnion
+
+	mu        sync.Mutex
+	cancelled []string
+}
+
+func (p *hangingProvider) NewStreaming(ctx context.Context, params responses.ResponseNewParams, opts ...option.RequestOption) EventStream {
+	return &hangingEventStream{ctx: ctx, events: p.events}
+}
+
+func (p *hangingProvider) Cancel(ctx context.Context, responseID string, opts ...option.RequestOption) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cancelled = append(p.cancelled, responseID)
+	return nil
+}
+
+type hangingEventStream struct {
+	ctx    context.Context
+	events []responses.ResponseStreamEventUnion
+	pos    int
+}
+
+func (s *hangingEventStream) Next() bool {
+	if s.pos < len(s.events) {
+		s.pos++
+		return true
+	}
+	<-s.ctx.Done()
+	return false
+}
+
+func (s *hangingEventStream) Current() responses.ResponseStreamEventUnion {
+	return s.events[s.pos-1]
+}
+
+func (s *hangingEventStream) Err() error {
+	return s.ctx.Err()
+}
+
+func (s *hangingEventStream) Close() error {
+	return nil
+}
+
+func Test_CancelGenerate(t *testing.T) {
+	// The model finishes one call and is part way through a second when the generation is cancelled.
+	events := append(shellCallEvents(t, "resp_1", "fc_1", "call_1", "kubectl get pods"),
+		mustEvent(t, map[string]any{
+			"type": "response.output_item.added",
+			"item": map[string]any{"type": "function_call", "id": "fc_2", "call_id": "call_2", "name": ShellToolName},
+		}),
+		mustEvent(t, map[string]any{
+			"type":    "response.function_call_arguments.delta",
+			"item_id": "fc_2",
+			"delta":   `{"shell":"kubectl get`,
+		}),
+	)
+	provider := &hangingProvider{events: events}
+	agent, err := NewAgent(AgentOptions{Provider: provider})
+	if err != nil {
+		t.Fatalf("Failed to create agent: %+v", err)
+	}
+
+	ctx := iam.ContextWithPrincipal(context.Background(), "alice@acme.com")
+
+	sent := make(chan *cassie.GenerateResponse, 100)
+	sender := func(resp *cassie.GenerateResponse) error {
+		sent <- resp
+		return nil
+	}
+
+	req := &cassie.GenerateRequest{
+		RequestId: "req_1",
+		Blocks: []*cassie.Block{
+			{Id: "user_1", Kind: cassie.BlockKind_MARKUP, Role: cassie.BlockRole_BLOCK_ROLE_USER, Contents: "What's running?"},
+		},
+	}
+	result := make(chan error, 1)
+	go func() {
+		result <- agent.ProcessWithOpenAI(ctx, req, sender)
+	}()
+
+	// Wait for the partial call so we know the stream is blocked.
+	for resp := range sent {
+		if len(resp.Blocks) > 0 && resp.Blocks[0].Id == "fc_2" {
+			break
+		}
+	}
+
+	// Other principals can't cancel the generation.
+	_, err = agent.CancelGenerate(iam.ContextWithPrincipal(context.Background(), "mallory@acme.com"), connect.NewRequest(&cassie.CancelGenerateRequest{ResponseId: "resp_1"}))
+	if connect.CodeOf(err) != connect.CodePermissionDenied {
+		t.Errorf("Expected PermissionDenied for another principal; got %v", err)
+	}
+
+	resp, err := agent.CancelGenerate(ctx, connect.NewRequest(&cassie.CancelGenerateRequest{ResponseId: "resp_1"}))
+	if err != nil {
+		t.Fatalf("CancelGenerate failed: %+v", err)
+	}
+	if !resp.Msg.GetCancelled() {
+		t.Errorf("Expected the generation to be cancelled")
+	}
+
+	if err := <-result; err != nil {
+		t.Fatalf("ProcessWithOpenAI failed: %+v", err)
+	}
+	close(sent)
+	var last *cassie.GenerateResponse
+	for r := range sent {
+		last = r
+	}
+	if last == nil || len(last.Blocks) != 1 || last.Blocks[0].GetMetadata()[CancelledMetadataKey] != "true" {
+		t.Errorf("Expected the last response to mark the turn as cancelled; got %v", last)
+	}
+	if last.GetResponseId() != "resp_1" {
+		t.Errorf("Expected the cancelled response to be resp_1; got %s", last.GetResponseId())
+	}
+
+	if d := cmp.Diff([]string{"resp_1"}, provider.cancelled); d != "" {
+		t.Errorf("Unexpected responses cancelled with the provider (-want +got):\n%s", d)
+	}
+
+	// Only the completed call is recorded so the next turn only has to send its output.
+	calls, ok, err := agent.store.GetResponse(context.Background(), "resp_1")
+	if err != nil || !ok {
+		t.Fatalf("Failed to get response resp_1: ok=%v err=%+v", ok, err)
+	}
+	if d := cmp.Diff([]string{"fc_1"}, calls); d != "" {
+		t.Errorf("Unexpected calls recorded for resp_1 (-want +got):\n%s", d)
+	}
+
+	// The generation is finished so there's nothing left to cancel.
+	resp, err = agent.CancelGenerate(ctx, connect.NewRequest(&cassie.CancelGenerateRequest{RequestId: "req_1"}))
+	if err != nil {
+		t.Fatalf("CancelGenerate failed: %+v", err)
+	}
+	if resp.Msg.GetCancelled() {
+		t.Errorf("Expected nothing to be cancelled once the generation finished")
+	}
+}
+
+func Test_CancelGenerateFallback(t *testing.T) {
+	// The primary model is rate limited so the response is served by a fallback on another provider.
+	primary := &scriptedProvider{streams: []*fakeEventStream{{err: apiError(http.StatusTooManyRequests)}}}
+	fallback := &hangingProvider{events: textEvents(t, "resp_1", "msg_1", "Let me check")}
+	agent, err := NewAgent(AgentOptions{
+		Provider:     primary,
+		ProviderName: "openai",
+		Model:        "gpt-4.1",
+		Fallbacks:    []Fallback{{Model: "claude-sonnet", Provider: fallback, ProviderName: "chatcompletions"}},
+		RetryBackoff: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create agent: %+v", err)
+	}
+
+	ctx := iam.ContextWithPrincipal(context.Background(), "alice@acme.com")
+	started := make(chan struct{})
+	var once sync.Once
+	sender := func(resp *cassie.GenerateResponse) error {
+		if resp.GetResponseId() == "resp_1" {
+			once.Do(func() { close(started) })
+		}
+		return nil
+	}
+	result := make(chan error, 1)
+	go func() {
+		result <- agent.ProcessWithOpenAI(ctx, &cassie.GenerateRequest{
+			RequestId: "req_1",
+			Blocks: []*cassie.Block{
+				{Id: "user_1", Kind: cassie.BlockKind_MARKUP, Role: cassie.BlockRole_BLOCK_ROLE_USER, Contents: "What's running?"},
+			},
+		}, sender)
+	}()
+	<-started
+
+	if _, err := agent.CancelGenerate(ctx, connect.NewRequest(&cassie.CancelGenerateRequest{RequestId: "req_1"})); err != nil {
+		t.Fatalf("CancelGenerate failed: %+v", err)
+	}
+	if err := <-result; err != nil {
+		t.Fatalf("ProcessWithOpenAI failed: %+v", err)
+	}
+	if d := cmp.Diff([]string{"resp_1"}, fallback.cancelled); d != "" {
+		t.Errorf("Expected the fallback provider to cancel the response (-want +got):\n%s", d)
+	}
+}
@@ -0,0 +1,155 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/jlewi/cloud-assistant/app/pkg/cassette"
+	"github.com/jlewi/cloud-assistant/protos/gen/cassie"
+	"github.com/openai/openai-go/option"
+)
+
+// Test_ReplayCassette runs a conversation against a recorded Responses API stream. Run it with
+// CASSETTE_RECORD=true and OPENAI_API_KEY set to record the cassette again. The test only checks the structure of the
+// conversation, not the IDs or text the model generated, so it keeps passing when the cassette is recorded again.
+func Test_ReplayCassette(t *testing.T) {
+	rt, recording := cassette.ForTest(t, "testdata/cassettes/shell_call.yaml", nil)
+	apiKey := "replayed"
+	if recording {
+		apiKey = os.Getenv("OPENAI_API_KEY")
+	}
+	client, err := NewClientWithKey(apiKey, option.WithHTTPClient(&http.Client{Transport: rt}), option.WithMaxRetries(0))
+	if err != nil {
+		t.Fatalf("Failed to create client: %+v", err)
+	}
+	agent, err := NewAgent(AgentOptions{Client: client})
+	if err != nil {
+		t.Fatalf("Failed to create agent: %+v", err)
+	}
+
+	ctx := context.Background()
+	blocks := map[string]*cassie.Block{}
+	responseID := ""
+	sender := func(resp *cassie.GenerateResponse) error {
+		responseID = resp.GetResponseId()
+		for _, b := range resp.GetBlocks() {
+			blocks[b.GetId()] = b
+		}
+		return nil
+	}
+
+	inputText := "Use kubectl to tell me the current status of the rube-dev deployment in the a0s context."
+	if err := agent.ProcessWithOpenAI(ctx, &cassie.GenerateRequest{
+		Blocks: []*cassie.Block{
+			{Id: "user_1", Kind: cassie.BlockKind_MARKUP, Role: cassie.BlockRole_BLOCK_ROLE_USER, Contents: inputText},
+		},
+	}, sender); err != nil {
+		t.Fatalf("ProcessWithOpenAI failed: %+v", err)
+	}
+
+	var call *cassie.Block
+	for _, b := range blocks {
+		if b.GetKind() == cassie.BlockKind_CODE {
+			call = b
+		}
+	}
+	if call == nil {
+		t.Fatalf("Expected a block for the shell call; got %v", blocks)
+	}
+	if call.GetCallId() == "" || !regexp.MustCompile(`kubectl.*get.*deployment.*rube-dev`).MatchString(call.GetContents()) {
+		t.Errorf("Unexpected call block: %v", call)
+	}
+	firstResponseID := responseID
+
+	for _, as := range []*cassie.Assertion{
+		{
+			Name:    "uses-shell",
+			Type:    cassie.Assertion_TYPE_TOOL_INVOKED,
+			Payload: &cassie.Assertion_ToolInvocation_{ToolInvocation: &cassie.Assertion_ToolInvocation{ToolName: "shell"}},
+		},
+		{
+			Name: "kubectl-flags",
+			Type: cassie.Assertion_TYPE_SHELL_REQUIRED_FLAG,
+			Payload: &cassie.Assertion_ShellRequiredFlag_{ShellRequiredFlag: &cassie.Assertion_ShellRequiredFlag{
+				Command: "kubectl",
+				Flags:   []string{"--context"},
+			}},
+		},
+	} {
+		var err error
+		switch as.GetType() {
+		case cassie.Assertion_TYPE_TOOL_INVOKED:
+			err = toolInvocation{}.Assert(ctx, as, inputText, blocks)
+		case cassie.Assertion_TYPE_SHELL_REQUIRED_FLAG:
+			err = shellRequiredFlag{}.Assert(ctx, as, inputText, blocks)
+		}
+		if err != nil {
+			t.Fatalf("Assertion %s failed: %+v", as.GetName(), err)
+		}
+		if as.GetResult() != cassie.Assertion_RESULT_TRUE {
+			t.Errorf("Expected assertion %s to pass; got %v: %s", as.GetName(), as.GetResult(), as.GetFailureReason())
+		}
+	}
+
+	// The client runs the command and sends the output with the next turn.
+	call.Outputs = []*cassie.BlockOutput{
+		{
+			Kind:  cassie.BlockOutputKind_STDOUT,
+			Items: []*cassie.BlockOutputItem{{Mime: textMimeType, TextData: "rube-dev   2/2     2            2           12d"}},
+		},
+	}
+	blocks = map[string]*cassie.Block{}
+	if err := agent.ProcessWithOpenAI(ctx, &cassie.GenerateRequest{
+		PreviousResponseId: firstResponseID,
+		Blocks:             []*cassie.Block{call},
+	}, sender); err != nil {
+		t.Fatalf("ProcessWithOpenAI failed: %+v", err)
+	}
+
+	hasAnswer := false
+	for _, b := range blocks {
+		if b.GetKind() == cassie.BlockKind_MARKUP && b.GetRole() == cassie.BlockRole_BLOCK_ROLE_ASSISTANT && b.GetContents() != "" {
+			hasAnswer = true
+		}
+	}
+	if !hasAnswer {
+		t.Errorf("Expected an answer after sending the output of the call; got %v", blocks)
+	}
+	if responseID == "" || responseID == firstResponseID {
+		t.Errorf("Expected the last turn to be a new response; got %q", responseID)
+	}
+
+	if recording {
+		return
+	}
+	requests := rt.(*cassette.Replayer).Requests()
+	if len(requests) != 2 {
+		t.Fatalf("Expected 2 requests; got %d", len(requests))
+	}
+	body := struct {
+		PreviousResponseID string `json:"previous_response_id"`
+		Input              []struct {
+			Type   string `json:"type"`
+			CallID string `json:"call_id"`
+		} `json:"input"`
+	}{}
+	if err := json.Unmarshal([]byte(requests[1].Body), &body); err != nil {
+		t.Fatalf("Failed to parse the second request: %+v", err)
+	}
+	if body.PreviousResponseID != firstResponseID {
+		t.Errorf("Expected the second request to continue %s; got %q", firstResponseID, body.PreviousResponseID)
+	}
+	hasOutput := false
+	for _, item := range body.Input {
+		if item.Type == "function_call_output" && item.CallID == call.GetCallId() {
+			hasOutput = true
+		}
+	}
+	if !hasOutput {
+		t.Errorf("Expected the second request to send the output of call %s; got %s", call.GetCallId(), requests[1].Body)
+	}
+}
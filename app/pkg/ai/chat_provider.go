@@ -0,0 +1,503 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jlewi/cloud-assistant/app/pkg/logs"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"github.com/openai/openai-go/responses"
+	"github.com/openai/openai-go/shared"
+	"github.com/pkg/errors"
+)
+
+// ChatCompletionsProvider is a Provider for OpenAI compatible Chat Completions endpoints (e.g. vLLM, Ollama or
+// an internal gateway).
+//
+// The Chat Completions API is stateless; there is no equivalent of previous_response_id. So the provider records the
+// conversation history of each response it generates in a ChatHistoryStore and replays it when a request continues
+// that response. Using the conversation store lets the provider continue responses generated before a restart.
+// The chat completion chunks are translated into Responses API events so the BlocksBuilder can process them.
+type ChatCompletionsProvider struct {
+	client *openai.Client
+	// model is used when the request doesn't select a model.
+	model string
+
+	history ChatHistoryStore
+}
+
+// NewChatCompletionsProvider creates a new provider. model is used for requests that don't select a model. If
+// history is nil the history is kept in memory so responses can only be continued by this process.
+func NewChatCompletionsProvider(client *openai.Client, model string, history ChatHistoryStore) (*ChatCompletionsProvider, error) {
+	if client == nil {
+		return nil, errors.New("Client is nil")
+	}
+	if history == nil {
+		history = NewMemoryConversationStore(defaultMemoryStoreSize, DefaultConversationTTL)
+	}
+	return &ChatCompletionsProvider{
+		client:  client,
+		model:   model,
+		history: history,
+	}, nil
+}
+
+func (p *ChatCompletionsProvider) NewStreaming(ctx context.Context, params responses.ResponseNewParams, opts ...option.RequestOption) EventStream {
+	log := logs.FromContext(ctx)
+
+	var history []openai.ChatCompletionMessageParamUnion
+	if params.PreviousResponseID.Valid() {
+		prev, ok, err := p.history.GetChatHistory(ctx, params.PreviousResponseID.Value)
+		if err != nil {
+			return &chatEventStream{err: errors.Wrapf(err, "Failed to get conversation history for previous response %s", params.PreviousResponseID.Value)}
+		}
+		if !ok {
+			return &chatEventStream{err: errors.Errorf("No conversation history for previous response %s", params.PreviousResponseID.Value)}
+		}
+		history = prev
+	}
+
+	conversation, err := toChatMessages(history, params.Input.OfInputItemList)
+	if err != nil {
+		return &chatEventStream{err: err}
+	}
+
+	messages := make([]openai.ChatCompletionMessageParamUnion, 0, len(conversation)+1)
+	if params.Instructions.Valid() {
+		messages = append(messages, openai.SystemMessage(params.Instructions.Value))
+	}
+	messages = append(messages, conversation...)
+
+	// The request's model may have been selected by the user or be a fallback so it takes precedence.
+	model := string(params.Model)
+	if model == "" {
+		model = p.model
+	}
+
+	req := openai.ChatCompletionNewParams{
+		Messages:          messages,
+		Model:             model,
+		Tools:             toChatTools(ctx, params.Tools),
+		ParallelToolCalls: params.ParallelToolCalls,
+		Temperature:       params.Temperature,
+		ReasoningEffort:   params.Reasoning.Effort,
+		// Ask for the token usage in the last chunk so it can be reported in the response.completed event.
+		StreamOptions: openai.ChatCompletionStreamOptionsParam{
+			IncludeUsage: openai.Bool(true),
+		},
+	}
+
+	if params.MaxOutputTokens.Valid() {
+		req.MaxCompletionTokens = params.MaxOutputTokens
+	}
+
+	log.Info("ChatCompletionRequest", "model", model, "numMessages", len(messages))
+	stream := p.client.Chat.Completions.NewStreaming(ctx, req, opts...)
+	return newChatEventStream(stream, func(responseID string, reply openai.ChatCompletionMessageParamUnion) error {
+		full := make([]openai.ChatCompletionMessageParamUnion, 0, len(conversation)+1)
+		full = append(full, conversation...)
+		full = append(full, reply)
+		return errors.Wrapf(p.history.PutChatHistory(ctx, responseID, full), "Failed to store conversation history for response %s", responseID)
+	})
+}
+
+// toChatMessages converts Responses API input items into chat messages and appends them to history.
+//
+// The Agent sends the function call along with the output for code blocks that weren't generated by the previous
+// response e.g. cells added by the user. If the history already contains the assistant message that issued the call
+// we skip the call to avoid duplicating it.
+func toChatMessages(history []openai.ChatCompletionMessageParamUnion, items []responses.ResponseInputItemUnionParam) ([]openai.ChatCompletionMessageParamUnion, error) {
+	messages := make([]openai.ChatCompletionMessageParamUnion, 0, len(history)+len(items))
+	messages = append(messages, history...)
+
+	knownCalls := make(map[string]bool)
+	for _, m := range history {
+		if m.OfAssistant == nil {
+			continue
+		}
+		for _, c := range m.OfAssistant.ToolCalls {
+			knownCalls[c.ID] = true
+		}
+	}
+
+	// Consecutive function calls are grouped into a single assistant message.
+	var pending []openai.ChatCompletionMessageToolCallParam
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+		messages = append(messages, openai.ChatCompletionMessageParamUnion{
+			OfAssistant: &openai.ChatCompletionAssistantMessageParam{
+				ToolCalls: pending,
+			},
+		})
+		pending = nil
+	}
+
+	for _, item := range items {
+		switch {
+		case item.OfMessage != nil:
+			flush()
+			if parts, ok := toChatContentParts(item.OfMessage.Content.OfInputItemContentList); ok && item.OfMessage.Role == responses.EasyInputMessageRoleUser {
+				messages = append(messages, openai.UserMessage(parts))
+				continue
+			}
+			text := item.OfMessage.Content.OfString.Value
+			if !item.OfMessage.Content.OfString.Valid() {
+				parts := make([]string, 0, len(item.OfMessage.Content.OfInputItemContentList))
+				for _, c := range item.OfMessage.Content.OfInputItemContentList {
+					if c.OfInputText != nil {
+						parts = append(parts, c.OfInputText.Text)
+					}
+				}
+				text = strings.Join(parts, "\n")
+			}
+			switch item.OfMessage.Role {
+			case responses.EasyInputMessageRoleAssistant:
+				messages = append(messages, openai.AssistantMessage(text))
+			case responses.EasyInputMessageRoleSystem, responses.EasyInputMessageRoleDeveloper:
+				messages = append(messages, openai.SystemMessage(text))
+			default:
+				messages = append(messages, openai.UserMessage(text))
+			}
+		case item.OfFunctionCall != nil:
+			if knownCalls[item.OfFunctionCall.CallID] {
+				continue
+			}
+			knownCalls[item.OfFunctionCall.CallID] = true
+			pending = append(pending, openai.ChatCompletionMessageToolCallParam{
+				ID: item.OfFunctionCall.CallID,
+				Function: openai.ChatCompletionMessageToolCallFunctionParam{
+					Name:      item.OfFunctionCall.Name,
+					Arguments: item.OfFunctionCall.Arguments,
+				},
+			})
+		case item.OfFunctionCallOutput != nil:
+			flush()
+			messages = append(messages, openai.ToolMessage(item.OfFunctionCallOutput.Output, item.OfFunctionCallOutput.CallID))
+		case item.OfReasoning != nil:
+			// The Chat Completions API can't take reasoning back; the model reasons again from the conversation.
+		default:
+			return nil, errors.New("Unsupported input item for the Chat Completions API")
+		}
+	}
+	flush()
+	return messages, nil
+}
+
+// toChatContentParts converts the content of a message to chat content parts. ok is false if the content doesn't
+// contain any images or files in which case the message is sent as text.
+func toChatContentParts(content responses.ResponseInputMessageContentListParam) ([]openai.ChatCompletionContentPartUnionParam, bool) {
+	parts := make([]openai.ChatCompletionContentPartUnionParam, 0, len(content))
+	media := false
+	for _, c := range content {
+		switch {
+		case c.OfInputText != nil:
+			parts = append(parts, openai.TextContentPart(c.OfInputText.Text))
+		case c.OfInputImage != nil:
+			media = true
+			parts = append(parts, openai.ImageContentPart(openai.ChatCompletionContentPartImageImageURLParam{
+				URL:    c.OfInputImage.ImageURL.Value,
+				Detail: string(c.OfInputImage.Detail),
+			}))
+		case c.OfInputFile != nil:
+			media = true
+			parts = append(parts, openai.FileContentPart(openai.ChatCompletionFileContentPartParam{
+				FileData: c.OfInputFile.FileData,
+				Filename: c.OfInputFile.Filename,
+			}))
+		}
+	}
+	return parts, media
+}
+
+// toChatTools converts the function tools to chat tools. Hosted tools (e.g. file search) aren't supported by
+// the Chat Completions API so they are dropped.
+func toChatTools(ctx context.Context, tools []responses.ToolUnionParam) []openai.ChatCompletionToolParam {
+	log := logs.FromContext(ctx)
+	result := make([]openai.ChatCompletionToolParam, 0, len(tools))
+	for _, t := range tools {
+		if t.OfFunction == nil {
+			log.Info("Dropping tool not supported by the Chat Completions API", "tool", t)
+			continue
+		}
+		result = append(result, openai.ChatCompletionToolParam{
+			Function: shared.FunctionDefinitionParam{
+				Name:        t.OfFunction.Name,
+				Description: t.OfFunction.Description,
+				Parameters:  t.OfFunction.Parameters,
+				Strict:      t.OfFunction.Strict,
+			},
+		})
+	}
+	return result
+}
+
+// chunkStream is a stream of chat completion chunks.
+// It is satisfied by *ssestream.Stream[openai.ChatCompletionChunk].
+type chunkStream interface {
+	Next() bool
+	Current() openai.ChatCompletionChunk
+	Err() error
+	Close() error
+}
+
+type chatToolCall struct {
+	itemID    string
+	callID    string
+	name      string
+	arguments string
+}
+
+// chatEventStream translates a stream of chat completion chunks into Responses API events.
+type chatEventStream struct {
+	chunks chunkStream
+	// onComplete is invoked with the response ID and the assistant message once the stream completes successfully.
+	// If it fails the stream fails since the response couldn't be continued.
+	onComplete func(string, openai.ChatCompletionMessageParamUnion) error
+
+	responseID string
+	model      string
+	messageID  string
+	text       strings.Builder
+	calls      map[int64]*chatToolCall
+	// usage is the token usage reported in the last chunk if the server supports it.
+	usage openai.CompletionUsage
+
+	pending []responses.ResponseStreamEventUnion
+	current responses.ResponseStreamEventUnion
+	done    bool
+	err     error
+}
+
+func newChatEventStream(chunks chunkStream, onComplete func(string, openai.ChatCompletionMessageParamUnion) error) *chatEventStream {
+	return &chatEventStream{
+		chunks:     chunks,
+		onComplete: onComplete,
+		calls:      make(map[int64]*chatToolCall),
+	}
+}
+
+func (s *chatEventStream) Next() bool {
+	for len(s.pending) == 0 {
+		if s.err != nil || s.done || s.chunks == nil {
+			return false
+		}
+		if s.chunks.Next() {
+			if err := s.processChunk(s.chunks.Current()); err != nil {
+				s.err = err
+				return false
+			}
+			continue
+		}
+		if err := s.chunks.Err(); err != nil {
+			s.err = err
+			return false
+		}
+		s.done = true
+		if err := s.finish(); err != nil {
+			s.err = err
+			return false
+		}
+	}
+	s.current = s.pending[0]
+	s.pending = s.pending[1:]
+	return true
+}
+
+func (s *chatEventStream) Current() responses.ResponseStreamEventUnion {
+	return s.current
+}
+
+func (s *chatEventStream) Err() error {
+	return s.err
+}
+
+func (s *chatEventStream) Close() error {
+	if s.chunks == nil {
+		return nil
+	}
+	return s.chunks.Close()
+}
+
+func (s *chatEventStream) processChunk(chunk openai.ChatCompletionChunk) error {
+	if s.responseID == "" {
+		s.responseID = chunk.ID
+		if s.responseID == "" {
+			s.responseID = "chatcmpl-" + uuid.NewString()
+		}
+		s.model = chunk.Model
+		s.messageID = "msg_" + s.responseID
+		if err := s.emit(map[string]any{
+			"type":     "response.created",
+			"response": map[string]any{"id": s.responseID, "model": s.model, "status": "in_progress"},
+		}); err != nil {
+			return err
+		}
+	}
+
+	if chunk.Usage.TotalTokens > 0 {
+		s.usage = chunk.Usage
+	}
+
+	for _, choice := range chunk.Choices {
+		// We never request more than one choice.
+		if choice.Index != 0 {
+			continue
+		}
+		if choice.Delta.Content != "" {
+			s.text.WriteString(choice.Delta.Content)
+			if err := s.emit(map[string]any{
+				"type":    "response.output_text.delta",
+				"item_id": s.messageID,
+				"delta":   choice.Delta.Content,
+			}); err != nil {
+				return err
+			}
+		}
+
+		for _, tc := range choice.Delta.ToolCalls {
+			call, ok := s.calls[tc.Index]
+			if !ok {
+				callID := tc.ID
+				if callID == "" {
+					callID = "call_" + uuid.NewString()
+				}
+				call = &chatToolCall{
+					itemID: "fc_" + callID,
+					callID: callID,
+					name:   tc.Function.Name,
+				}
+				s.calls[tc.Index] = call
+				if err := s.emit(map[string]any{
+					"type": "response.output_item.added",
+					"item": call.item("in_progress"),
+				}); err != nil {
+					return err
+				}
+			}
+			if tc.Function.Arguments == "" {
+				continue
+			}
+			call.arguments += tc.Function.Arguments
+			if err := s.emit(map[string]any{
+				"type":    "response.function_call_arguments.delta",
+				"item_id": call.itemID,
+				"delta":   tc.Function.Arguments,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// finish emits the events signaling the end of the output items and the response.
+func (s *chatEventStream) finish() error {
+	if s.responseID == "" {
+		return errors.New("Chat completion stream ended without any chunks")
+	}
+
+	reply := &openai.ChatCompletionAssistantMessageParam{}
+
+	if s.text.Len() > 0 {
+		reply.Content.OfString = openai.Opt(s.text.String())
+		if err := s.emit(map[string]any{
+			"type": "response.output_item.done",
+			"item": map[string]any{
+				"type":   "message",
+				"id":     s.messageID,
+				"role":   "assistant",
+				"status": "completed",
+				"content": []map[string]any{
+					{"type": "output_text", "text": s.text.String(), "annotations": []any{}},
+				},
+			},
+		}); err != nil {
+			return err
+		}
+	}
+
+	indexes := make([]int64, 0, len(s.calls))
+	for i := range s.calls {
+		indexes = append(indexes, i)
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+
+	for _, i := range indexes {
+		call := s.calls[i]
+		reply.ToolCalls = append(reply.ToolCalls, openai.ChatCompletionMessageToolCallParam{
+			ID: call.callID,
+			Function: openai.ChatCompletionMessageToolCallFunctionParam{
+				Name:      call.name,
+				Arguments: call.arguments,
+			},
+		})
+		if err := s.emit(map[string]any{
+			"type":      "response.function_call_arguments.done",
+			"item_id":   call.itemID,
+			"arguments": call.arguments,
+		}); err != nil {
+			return err
+		}
+		if err := s.emit(map[string]any{
+			"type": "response.output_item.done",
+			"item": call.item("completed"),
+		}); err != nil {
+			return err
+		}
+	}
+
+	// Record the history before the response completes so a failure fails the response rather than the next one.
+	if s.onComplete != nil {
+		if err := s.onComplete(s.responseID, openai.ChatCompletionMessageParamUnion{OfAssistant: reply}); err != nil {
+			return err
+		}
+	}
+
+	return s.emit(map[string]any{
+		"type": "response.completed",
+		"response": map[string]any{
+			"id":     s.responseID,
+			"model":  s.model,
+			"status": "completed",
+			"usage": map[string]any{
+				"input_tokens":          s.usage.PromptTokens,
+				"input_tokens_details":  map[string]any{"cached_tokens": s.usage.PromptTokensDetails.CachedTokens},
+				"output_tokens":         s.usage.CompletionTokens,
+				"output_tokens_details": map[string]any{"reasoning_tokens": s.usage.CompletionTokensDetails.ReasoningTokens},
+				"total_tokens":          s.usage.TotalTokens,
+			},
+		},
+	})
+}
+
+func (c *chatToolCall) item(status string) map[string]any {
+	return map[string]any{
+		"type":      "function_call",
+		"id":        c.itemID,
+		"call_id":   c.callID,
+		"name":      c.name,
+		"arguments": c.arguments,
+		"status":    status,
+	}
+}
+
+// emit queues a Responses API event. The union types in the SDK are decoded lazily from the raw JSON so the
+// only reliable way to construct one is to unmarshal it.
+func (s *chatEventStream) emit(event map[string]any) error {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to marshal event")
+	}
+	e := responses.ResponseStreamEventUnion{}
+	if err := e.UnmarshalJSON(b); err != nil {
+		return errors.Wrapf(err, "Failed to unmarshal event")
+	}
+	s.pending = append(s.pending, e)
+	return nil
+}
@@ -0,0 +1,348 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jlewi/cloud-assistant/app/pkg/config"
+	"github.com/jlewi/cloud-assistant/app/pkg/runme"
+	"github.com/jlewi/cloud-assistant/protos/gen/cassie"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/responses"
+	"google.golang.org/protobuf/testing/protocmp"
+)
+
+// fakeChunkStream replays a fixed list of chunks.
+type fakeChunkStream struct {
+	chunks []openai.ChatCompletionChunk
+	index  int
+}
+
+func (f *fakeChunkStream) Next() bool {
+	if f.index >= len(f.chunks) {
+		return false
+	}
+	f.index++
+	return true
+}
+
+func (f *fakeChunkStream) Current() openai.ChatCompletionChunk {
+	return f.chunks[f.index-1]
+}
+
+func (f *fakeChunkStream) Err() error {
+	return nil
+}
+
+func (f *fakeChunkStream) Close() error {
+	return nil
+}
+
+func mustChunk(t *testing.T, raw string) openai.ChatCompletionChunk {
+	t.Helper()
+	c := openai.ChatCompletionChunk{}
+	if err := c.UnmarshalJSON([]byte(raw)); err != nil {
+		t.Fatalf("Failed to unmarshal chunk: %+v", err)
+	}
+	return c
+}
+
+func Test_ChatEventStream(t *testing.T) {
+	chunks := []openai.ChatCompletionChunk{
+		mustChunk(t, `{"id":"chatcmpl-1","model":"qwen","choices":[{"index":0,"delta":{"role":"assistant","content":"Let me "}}]}`),
+		mustChunk(t, `{"id":"chatcmpl-1","choices":[{"index":0,"delta":{"content":"check."}}]}`),
+		mustChunk(t, `{"id":"chatcmpl-1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"shell","arguments":""}}]}}]}`),
+		mustChunk(t, `{"id":"chatcmpl-1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"shell\":"}}]}}]}`),
+		mustChunk(t, `{"id":"chatcmpl-1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"kubectl get pods\"}"}}]}}]}`),
+		mustChunk(t, `{"id":"chatcmpl-1","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`),
+	}
+
+	var completedID string
+	var reply openai.ChatCompletionMessageParamUnion
+	stream := newChatEventStream(&fakeChunkStream{chunks: chunks}, func(id string, m openai.ChatCompletionMessageParamUnion) error {
+		completedID = id
+		reply = m
+		return nil
+	})
+
+	tools, err := NewToolRegistry(&ShellTool{})
+	if err != nil {
+		t.Fatalf("Failed to create tool registry: %+v", err)
+	}
+
+	builder := NewBlocksBuilder(nil, NewMemoryConversationStore(10, time.Hour), "gpt-4.1", tools)
+	if err := builder.HandleEvents(context.Background(), stream, NullOpSender); err != nil {
+		t.Fatalf("HandleEvents failed: %+v", err)
+	}
+
+	expected := map[string]*cassie.Block{
+		"msg_chatcmpl-1": {
+			Id:       "msg_chatcmpl-1",
+			Kind:     cassie.BlockKind_MARKUP,
+			Role:     cassie.BlockRole_BLOCK_ROLE_ASSISTANT,
+			Contents: "Let me check.",
+		},
+		"fc_call_1": {
+			Id:       "fc_call_1",
+			Kind:     cassie.BlockKind_CODE,
+			Role:     cassie.BlockRole_BLOCK_ROLE_ASSISTANT,
+			Language: runme.LanguageBash,
+			Contents: "kubectl get pods",
+			CallId:   "call_1",
+			Metadata: map[string]string{ToolNameMetadataKey: ShellToolName},
+		},
+	}
+
+	if d := cmp.Diff(expected, builder.blocks, protocmp.Transform()); d != "" {
+		t.Errorf("Unexpected blocks (-want +got):\n%s", d)
+	}
+
+	if builder.responseID != "chatcmpl-1" {
+		t.Errorf("Expected response ID chatcmpl-1; got %s", builder.responseID)
+	}
+
+	if builder.model != "qwen" {
+		t.Errorf("Expected model qwen; got %s", builder.model)
+	}
+
+	if completedID != "chatcmpl-1" {
+		t.Errorf("Expected onComplete to be called with chatcmpl-1; got %s", completedID)
+	}
+
+	if reply.OfAssistant == nil || len(reply.OfAssistant.ToolCalls) != 1 || reply.OfAssistant.ToolCalls[0].ID != "call_1" {
+		t.Errorf("Expected reply to contain tool call call_1; got %+v", reply)
+	}
+}
+
+func Test_ToChatMessages(t *testing.T) {
+	history := []openai.ChatCompletionMessageParamUnion{
+		openai.UserMessage("list the pods"),
+		{
+			OfAssistant: &openai.ChatCompletionAssistantMessageParam{
+				ToolCalls: []openai.ChatCompletionMessageToolCallParam{
+					{
+						ID: "call_1",
+						Function: openai.ChatCompletionMessageToolCallFunctionParam{
+							Name:      ShellToolName,
+							Arguments: `{"shell":"kubectl get pods"}`,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	items := []responses.ResponseInputItemUnionParam{
+		{
+			// The call is already in the history so it should be skipped.
+			OfFunctionCall: &responses.ResponseFunctionToolCallParam{
+				CallID:    "call_1",
+				Name:      ShellToolName,
+				Arguments: `{"shell":"kubectl get pods"}`,
+			},
+		},
+		{
+			OfFunctionCallOutput: &responses.ResponseInputItemFunctionCallOutputParam{
+				CallID: "call_1",
+				Output: `{"STDOUT":"pod-1"}`,
+			},
+		},
+		{
+			// Reasoning sent back by a stateless server is dropped.
+			OfReasoning: &responses.ResponseReasoningItemParam{
+				ID:               "rs_1",
+				EncryptedContent: openai.Opt("gAAAA-encrypted"),
+			},
+		},
+		{
+			// A cell the user added themselves.
+			OfFunctionCall: &responses.ResponseFunctionToolCallParam{
+				CallID:    "call_2",
+				Name:      ShellToolName,
+				Arguments: `{"shell":"kubectl get nodes"}`,
+			},
+		},
+		{
+			OfFunctionCallOutput: &responses.ResponseInputItemFunctionCallOutputParam{
+				CallID: "call_2",
+				Output: `{"STDOUT":"node-1"}`,
+			},
+		},
+		{
+			OfMessage: &responses.EasyInputMessageParam{
+				Role: responses.EasyInputMessageRoleUser,
+				Content: responses.EasyInputMessageContentUnionParam{
+					OfString: openai.Opt("why is pod-1 crashing?"),
+				},
+			},
+		},
+		{
+			OfMessage: &responses.EasyInputMessageParam{
+				Role: responses.EasyInputMessageRoleUser,
+				Content: responses.EasyInputMessageContentUnionParam{
+					OfInputItemContentList: responses.ResponseInputMessageContentListParam{
+						responses.ResponseInputContentParamOfInputText("Here's the dashboard."),
+						{OfInputImage: &responses.ResponseInputImageParam{Detail: responses.ResponseInputImageDetailAuto, ImageURL: openai.Opt("data:image/png;base64,cG5n")}},
+					},
+				},
+			},
+		},
+	}
+
+	messages, err := toChatMessages(history, items)
+	if err != nil {
+		t.Fatalf("toChatMessages failed: %+v", err)
+	}
+
+	// Summarize each message by its role and tool call ID to keep the expectations readable.
+	actual := make([]string, 0, len(messages))
+	for _, m := range messages {
+		switch {
+		case m.OfUser != nil:
+			s := "user"
+			for _, p := range m.OfUser.Content.OfArrayOfContentParts {
+				if p.OfImageURL != nil {
+					s += ":" + p.OfImageURL.ImageURL.URL
+				}
+			}
+			actual = append(actual, s)
+		case m.OfAssistant != nil:
+			s := "assistant"
+			for _, c := range m.OfAssistant.ToolCalls {
+				s += ":" + c.ID
+			}
+			actual = append(actual, s)
+		case m.OfTool != nil:
+			actual = append(actual, "tool:"+m.OfTool.ToolCallID)
+		default:
+			actual = append(actual, "other")
+		}
+	}
+
+	expected := []string{"user", "assistant:call_1", "tool:call_1", "assistant:call_2", "tool:call_2", "user", "user:data:image/png;base64,cG5n"}
+	if d := cmp.Diff(expected, actual); d != "" {
+		t.Errorf("Unexpected messages (-want +got):\n%s", d)
+	}
+}
+
+func Test_ChatCompletionsProviderSharedHistory(t *testing.T) {
+	// The server replies to every request with the same message and records the messages it was sent.
+	var requests [][]map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Messages []map[string]any `json:"messages"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("Failed to decode request: %+v", err)
+		}
+		requests = append(requests, body.Messages)
+		id := fmt.Sprintf("chatcmpl-%d", len(requests))
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "data: {\"id\":%q,\"model\":\"qwen\",\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"All good.\"}}]}\n\n", id)
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	// Two providers sharing a conversation store simulate a restart.
+	store, err := NewBoltConversationStore(filepath.Join(t.TempDir(), "conversations.db"), time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create store: %+v", err)
+	}
+	client, err := NewChatCompletionsClient(config.ChatCompletionsConfig{BaseURL: server.URL})
+	if err != nil {
+		t.Fatalf("Failed to create client: %+v", err)
+	}
+	replica1, err := NewChatCompletionsProvider(client, "", store)
+	if err != nil {
+		t.Fatalf("Failed to create provider: %+v", err)
+	}
+	replica2, err := NewChatCompletionsProvider(client, "", store)
+	if err != nil {
+		t.Fatalf("Failed to create provider: %+v", err)
+	}
+
+	ctx := context.Background()
+	drain := func(stream EventStream) {
+		t.Helper()
+		for stream.Next() {
+		}
+		if err := stream.Err(); err != nil {
+			t.Fatalf("Stream failed: %+v", err)
+		}
+	}
+	userMessage := func(text string) responses.ResponseNewParamsInputUnion {
+		return responses.ResponseNewParamsInputUnion{OfInputItemList: []responses.ResponseInputItemUnionParam{
+			newMessage(responses.EasyInputMessageRoleUser, text),
+		}}
+	}
+
+	drain(replica1.NewStreaming(ctx, responses.ResponseNewParams{Model: "qwen", Input: userMessage("Is the cluster up?")}))
+	drain(replica2.NewStreaming(ctx, responses.ResponseNewParams{
+		Model:              "qwen",
+		Input:              userMessage("What pods are running?"),
+		PreviousResponseID: openai.Opt("chatcmpl-1"),
+	}))
+
+	if len(requests) != 2 {
+		t.Fatalf("Expected 2 requests; got %d", len(requests))
+	}
+	contents := make([]string, 0, len(requests[1]))
+	for _, m := range requests[1] {
+		contents = append(contents, fmt.Sprintf("%s: %v", m["role"], m["content"]))
+	}
+	expected := []string{"user: Is the cluster up?", "assistant: All good.", "user: What pods are running?"}
+	if d := cmp.Diff(expected, contents); d != "" {
+		t.Errorf("Unexpected messages (-want +got):\n%s", d)
+	}
+}
+
+func Test_ChatCompletionsProviderModel(t *testing.T) {
+	var models []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Model string `json:"model"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("Failed to decode request: %+v", err)
+		}
+		models = append(models, body.Model)
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "data: {\"id\":\"chatcmpl-%d\",\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"Hi.\"}}]}\n\n", len(models))
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	client, err := NewChatCompletionsClient(config.ChatCompletionsConfig{BaseURL: server.URL})
+	if err != nil {
+		t.Fatalf("Failed to create client: %+v", err)
+	}
+	provider, err := NewChatCompletionsProvider(client, "qwen", nil)
+	if err != nil {
+		t.Fatalf("Failed to create provider: %+v", err)
+	}
+
+	// A model selected by the request, e.g. a fallback, is used; the provider's model is the default.
+	for _, model := range []string{"llama-3.1-70b", ""} {
+		stream := provider.NewStreaming(context.Background(), responses.ResponseNewParams{
+			Model: model,
+			Input: responses.ResponseNewParamsInputUnion{OfInputItemList: []responses.ResponseInputItemUnionParam{
+				newMessage(responses.EasyInputMessageRoleUser, "Hello"),
+			}},
+		})
+		for stream.Next() {
+		}
+		if err := stream.Err(); err != nil {
+			t.Fatalf("Stream failed: %+v", err)
+		}
+	}
+	if d := cmp.Diff([]string{"llama-3.1-70b", "qwen"}, models); d != "" {
+		t.Errorf("Unexpected models (-want +got):\n%s", d)
+	}
+}
@@ -0,0 +1,78 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"unicode/utf8"
+
+	"github.com/jlewi/cloud-assistant/app/pkg/logs"
+	"github.com/jlewi/cloud-assistant/protos/gen/cassie"
+	"github.com/openai/openai-go/responses"
+)
+
+// addCitations adds the citations annotating a message to the MARKUP block streamed for it. It returns the block
+// or nil if the message has no citations.
+//
+// The annotations index into the text of each content part whereas the block holds the text of all the parts so
+// the indexes are offset by the length of the preceding parts. Indexes count characters i.e. Unicode code points.
+func (b *BlocksBuilder) addCitations(ctx context.Context, m responses.ResponseOutputMessage) *cassie.Block {
+	log := logs.FromContext(ctx)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	citations := make([]*cassie.Citation, 0, 5)
+	offset := 0
+	for _, content := range m.Content {
+		for _, a := range content.Annotations {
+			var c *cassie.Citation
+			switch a.Type {
+			case "file_citation":
+				c = &cassie.Citation{
+					StartIndex: int32(offset + int(a.Index)),
+					EndIndex:   int32(offset + int(a.Index)),
+					FileId:     a.FileID,
+					Filename:   b.citedFilename(a),
+				}
+				c.Link = c.Filename
+				if b.fileToLink != nil {
+					c.Link = b.fileToLink(c.FileId, c.Filename)
+				}
+			case "url_citation":
+				c = &cassie.Citation{
+					StartIndex: int32(offset + int(a.StartIndex)),
+					EndIndex:   int32(offset + int(a.EndIndex)),
+					Link:       a.URL,
+					Title:      a.Title,
+				}
+			default:
+				log.V(logs.Debug).Info("Ignoring annotation", "type", a.Type)
+				continue
+			}
+			citations = append(citations, c)
+		}
+		offset += utf8.RuneCountInString(content.Text)
+	}
+	if len(citations) == 0 {
+		return nil
+	}
+
+	block, ok := b.blocks[m.ID]
+	if !ok {
+		log.Info("Dropping citations for a message that wasn't streamed", "itemId", m.ID)
+		return nil
+	}
+	block.Citations = citations
+	return block
+}
+
+// citedFilename returns the name of the file cited by a file_citation annotation. The name is only included in the
+// annotation by newer versions of the API so otherwise it is looked up in the results of the file searches.
+func (b *BlocksBuilder) citedFilename(a responses.ResponseOutputTextAnnotationUnion) string {
+	annotation := struct {
+		Filename string `json:"filename"`
+	}{}
+	if err := json.Unmarshal([]byte(a.RawJSON()), &annotation); err == nil && annotation.Filename != "" {
+		return annotation.Filename
+	}
+	return b.filenames[a.FileID]
+}
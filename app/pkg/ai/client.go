@@ -1,6 +1,7 @@
 package ai
 
 import (
+	"net/http"
 	"os"
 	"strings"
 
@@ -12,8 +13,8 @@ import (
 	"github.com/pkg/errors"
 )
 
-// NewClient helper function to create a new OpenAI client from  a config
-func NewClient(cfg config.OpenAIConfig) (*openai.Client, error) {
+// NewClient helper function to create a new OpenAI client from  a config. opts are applied after the defaults.
+func NewClient(cfg config.OpenAIConfig, opts ...option.RequestOption) (*openai.Client, error) {
 
 	if cfg.APIKeyFile == "" {
 		return nil, errors.New("OpenAI API key is empty")
@@ -26,10 +27,15 @@ func NewClient(cfg config.OpenAIConfig) (*openai.Client, error) {
 
 	key := strings.TrimSpace(string(b))
 
-	return NewClientWithKey(key)
+	if cfg.BaseURL != "" {
+		opts = append([]option.RequestOption{option.WithBaseURL(cfg.BaseURL)}, opts...)
+	}
+	return NewClientWithKey(key, opts...)
 }
 
-func NewClientWithKey(key string) (*openai.Client, error) {
+// NewClientWithKey creates a client using the given API key. opts are applied after the defaults so they can e.g.
+// replace the HTTP client to record or replay the requests in tests.
+func NewClientWithKey(key string, opts ...option.RequestOption) (*openai.Client, error) {
 	// ************************************************************************
 	// Setup middleware
 	// ************************************************************************
@@ -38,11 +44,50 @@ func NewClientWithKey(key string) (*openai.Client, error) {
 	// To handle retryable errors we use hashi corp's retryable client. This client will automatically retry on
 	// retryable errors like 429; rate limiting
 	retryClient := retryablehttp.NewClient()
+	// Once the retries are exhausted return the last response rather than a generic error so the SDK reports the
+	// status code; the agent uses it to decide whether to fall back to another model.
+	retryClient.ErrorHandler = retryablehttp.PassthroughErrorHandler
 	httpClient := retryClient.StandardClient()
 
-	client := openai.NewClient(
+	client := openai.NewClient(append([]option.RequestOption{
 		option.WithAPIKey(key), // defaults to os.LookupEnv("OPENAI_API_KEY")
 		option.WithHTTPClient(httpClient),
-	)
+	}, opts...)...)
+	return &client, nil
+}
+
+// NewChatCompletionsClient creates a client for an OpenAI compatible Chat Completions endpoint. opts are applied after
+// the defaults.
+func NewChatCompletionsClient(cfg config.ChatCompletionsConfig, opts ...option.RequestOption) (*openai.Client, error) {
+	if cfg.BaseURL == "" {
+		return nil, errors.New("Chat Completions BaseURL is empty")
+	}
+
+	// Self-hosted servers (e.g. vLLM, Ollama) frequently don't require an API key. The SDK would otherwise fall
+	// back to OPENAI_API_KEY which we don't want to leak to a different endpoint.
+	key := "none"
+	if cfg.APIKeyFile != "" {
+		b, err := os.ReadFile(cfg.APIKeyFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read Chat Completions API key file: %s", cfg.APIKeyFile)
+		}
+		key = strings.TrimSpace(string(b))
+	}
+
+	retryClient := retryablehttp.NewClient()
+	retryClient.ErrorHandler = retryablehttp.PassthroughErrorHandler
+	httpClient := retryClient.StandardClient()
+
+	client := openai.NewClient(append([]option.RequestOption{
+		option.WithAPIKey(key),
+		option.WithBaseURL(cfg.BaseURL),
+		option.WithHTTPClient(httpClient),
+	}, opts...)...)
 	return &client, nil
 }
+
+// withoutRetries are the options for clients that don't retry failed requests. Neither the HTTP client nor the SDK
+// retries.
+func withoutRetries() []option.RequestOption {
+	return []option.RequestOption{option.WithHTTPClient(http.DefaultClient), option.WithMaxRetries(0)}
+}
@@ -0,0 +1,208 @@
+package ai
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	"github.com/jlewi/cloud-assistant/protos/gen/cassie"
+	"github.com/openai/openai-go"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// DefaultConversationTTL is how long conversations are kept if no TTL is configured.
+	DefaultConversationTTL = 24 * time.Hour
+
+	// defaultMemoryStoreSize is the maximum number of responses and blocks kept by the in memory store.
+	defaultMemoryStoreSize = 10000
+)
+
+// ConversationStore records the responses generated by the model and their blocks.
+//
+// OpenAI returns an error if any of the function calls in the previous response are missing output. The client
+// doesn't necessarily send back every block so the agent uses the store to fill in the calls the client left out.
+// Stores return copies of the blocks so callers must put blocks again after modifying them.
+type ConversationStore interface {
+	// PutBlocks creates or updates the blocks.
+	PutBlocks(ctx context.Context, blocks ...*cassie.Block) error
+	// GetBlock returns the block with the given ID. It returns nil if the block doesn't exist or has expired.
+	GetBlock(ctx context.Context, id string) (*cassie.Block, error)
+	// PutResponse records the IDs of the blocks containing the tool calls in the response.
+	PutResponse(ctx context.Context, responseID string, blockIDs []string) error
+	// GetResponse returns the IDs of the blocks containing the tool calls in the response. The boolean is false if
+	// the response doesn't exist or has expired.
+	GetResponse(ctx context.Context, responseID string) ([]string, bool, error)
+
+	// PutTurn records the branch a response was generated on and the blocks it generated.
+	PutTurn(ctx context.Context, turn *Turn) error
+	// GetTurn returns the turn of the response. It returns nil if the turn doesn't exist or has expired.
+	GetTurn(ctx context.Context, responseID string) (*Turn, error)
+	// FindTurn returns the turn of the response that generated the block. It returns nil if there isn't one.
+	FindTurn(ctx context.Context, blockID string) (*Turn, error)
+
+	// PutBranch creates or updates a branch.
+	PutBranch(ctx context.Context, branch *cassie.Branch) error
+	// GetBranch returns the branch with the given ID. It returns nil if the branch doesn't exist or has expired.
+	GetBranch(ctx context.Context, id string) (*cassie.Branch, error)
+	// ListBranches returns the branches of the conversation ordered by creation time.
+	ListBranches(ctx context.Context, conversationID string) ([]*cassie.Branch, error)
+
+	ChatHistoryStore
+}
+
+// ChatHistoryStore records the messages of the conversations generated by a ChatCompletionsProvider. The Chat
+// Completions API has no equivalent of previous_response_id so the provider replays them instead.
+type ChatHistoryStore interface {
+	// PutChatHistory records the messages (excluding the system prompt) of the conversation up to and including
+	// the response.
+	PutChatHistory(ctx context.Context, responseID string, messages []openai.ChatCompletionMessageParamUnion) error
+	// GetChatHistory returns the messages recorded for the response. The boolean is false if they don't exist or
+	// have expired.
+	GetChatHistory(ctx context.Context, responseID string) ([]openai.ChatCompletionMessageParamUnion, bool, error)
+}
+
+// Turn is a response generated on a branch of a conversation. Turns let conversations be forked from a response
+// or one of its blocks.
+type Turn struct {
+	ResponseID     string   `json:"responseId"`
+	ConversationID string   `json:"conversationId"`
+	BranchID       string   `json:"branchId"`
+	BlockIDs       []string `json:"blockIds"`
+	// Principal is the principal that generated the response. Only they can fork from it or rate it.
+	Principal string `json:"principal"`
+}
+
+func (t *Turn) clone() *Turn {
+	c := *t
+	c.BlockIDs = append([]string{}, t.BlockIDs...)
+	return &c
+}
+
+// sortBranches orders branches by creation time.
+func sortBranches(branches []*cassie.Branch) {
+	sort.SliceStable(branches, func(i, j int) bool {
+		return branches[i].GetCreateTime().AsTime().Before(branches[j].GetCreateTime().AsTime())
+	})
+}
+
+// MemoryConversationStore is a ConversationStore that keeps conversations in memory. Conversations are lost when
+// the server restarts and aren't shared between replicas.
+type MemoryConversationStore struct {
+	responses *expirable.LRU[string, []string]
+	blocks    *expirable.LRU[string, *cassie.Block]
+	turns     *expirable.LRU[string, *Turn]
+	// blockTurns maps the IDs of blocks to the IDs of the responses that generated them.
+	blockTurns *expirable.LRU[string, string]
+	branches   *expirable.LRU[string, *cassie.Branch]
+	// chatHistory maps the IDs of responses to the messages of their conversation.
+	chatHistory *expirable.LRU[string, []openai.ChatCompletionMessageParamUnion]
+}
+
+// NewMemoryConversationStore creates a store that keeps up to size responses and blocks for ttl.
+func NewMemoryConversationStore(size int, ttl time.Duration) *MemoryConversationStore {
+	if size <= 0 {
+		size = defaultMemoryStoreSize
+	}
+	if ttl <= 0 {
+		ttl = DefaultConversationTTL
+	}
+	return &MemoryConversationStore{
+		responses:   expirable.NewLRU[string, []string](size, nil, ttl),
+		blocks:      expirable.NewLRU[string, *cassie.Block](size, nil, ttl),
+		turns:       expirable.NewLRU[string, *Turn](size, nil, ttl),
+		blockTurns:  expirable.NewLRU[string, string](size, nil, ttl),
+		branches:    expirable.NewLRU[string, *cassie.Branch](size, nil, ttl),
+		chatHistory: expirable.NewLRU[string, []openai.ChatCompletionMessageParamUnion](size, nil, ttl),
+	}
+}
+
+func (s *MemoryConversationStore) PutBlocks(ctx context.Context, blocks ...*cassie.Block) error {
+	for _, b := range blocks {
+		s.blocks.Add(b.Id, proto.Clone(b).(*cassie.Block))
+	}
+	return nil
+}
+
+func (s *MemoryConversationStore) GetBlock(ctx context.Context, id string) (*cassie.Block, error) {
+	b, ok := s.blocks.Get(id)
+	if !ok {
+		return nil, nil
+	}
+	return proto.Clone(b).(*cassie.Block), nil
+}
+
+func (s *MemoryConversationStore) PutResponse(ctx context.Context, responseID string, blockIDs []string) error {
+	s.responses.Add(responseID, append([]string{}, blockIDs...))
+	return nil
+}
+
+func (s *MemoryConversationStore) GetResponse(ctx context.Context, responseID string) ([]string, bool, error) {
+	ids, ok := s.responses.Get(responseID)
+	if !ok {
+		return nil, false, nil
+	}
+	return append([]string{}, ids...), true, nil
+}
+
+func (s *MemoryConversationStore) PutTurn(ctx context.Context, turn *Turn) error {
+	s.turns.Add(turn.ResponseID, turn.clone())
+	for _, id := range turn.BlockIDs {
+		s.blockTurns.Add(id, turn.ResponseID)
+	}
+	return nil
+}
+
+func (s *MemoryConversationStore) GetTurn(ctx context.Context, responseID string) (*Turn, error) {
+	t, ok := s.turns.Get(responseID)
+	if !ok {
+		return nil, nil
+	}
+	return t.clone(), nil
+}
+
+func (s *MemoryConversationStore) FindTurn(ctx context.Context, blockID string) (*Turn, error) {
+	responseID, ok := s.blockTurns.Get(blockID)
+	if !ok {
+		return nil, nil
+	}
+	return s.GetTurn(ctx, responseID)
+}
+
+func (s *MemoryConversationStore) PutBranch(ctx context.Context, branch *cassie.Branch) error {
+	s.branches.Add(branch.Id, proto.Clone(branch).(*cassie.Branch))
+	return nil
+}
+
+func (s *MemoryConversationStore) GetBranch(ctx context.Context, id string) (*cassie.Branch, error) {
+	b, ok := s.branches.Get(id)
+	if !ok {
+		return nil, nil
+	}
+	return proto.Clone(b).(*cassie.Branch), nil
+}
+
+func (s *MemoryConversationStore) ListBranches(ctx context.Context, conversationID string) ([]*cassie.Branch, error) {
+	branches := make([]*cassie.Branch, 0, 1)
+	for _, b := range s.branches.Values() {
+		if b.GetConversationId() == conversationID {
+			branches = append(branches, proto.Clone(b).(*cassie.Branch))
+		}
+	}
+	sortBranches(branches)
+	return branches, nil
+}
+
+func (s *MemoryConversationStore) PutChatHistory(ctx context.Context, responseID string, messages []openai.ChatCompletionMessageParamUnion) error {
+	s.chatHistory.Add(responseID, append([]openai.ChatCompletionMessageParamUnion{}, messages...))
+	return nil
+}
+
+func (s *MemoryConversationStore) GetChatHistory(ctx context.Context, responseID string) ([]openai.ChatCompletionMessageParamUnion, bool, error) {
+	messages, ok := s.chatHistory.Get(responseID)
+	if !ok {
+		return nil, false, nil
+	}
+	return append([]openai.ChatCompletionMessageParamUnion{}, messages...), true, nil
+}
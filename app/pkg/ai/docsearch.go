@@ -0,0 +1,174 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-logr/zapr"
+	"github.com/jlewi/cloud-assistant/app/pkg/config"
+	"github.com/jlewi/cloud-assistant/app/pkg/search"
+	"github.com/jlewi/cloud-assistant/protos/gen/cassie"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	// DocsSearchToolName is the name of the function for searching the local documentation.
+	DocsSearchToolName = "search_docs"
+
+	defaultDocsMaxResults = 5
+
+	docsSearchDescription = `Search the team's documentation (e.g. runbooks) for sections relevant to the query.
+Use this to find the procedures and commands to use before proposing them.`
+)
+
+var docsSearchJSONSchema = map[string]any{
+	"$schema": "http://json-schema.org/draft-07/schema#",
+	"type":    "object",
+	"properties": map[string]any{
+		"query": map[string]any{
+			"type":        "string",
+			"description": "Keywords describing what to search for",
+		},
+	},
+	"required":             []string{"query"},
+	"additionalProperties": false,
+}
+
+// DocsSearchArgs are the arguments of a call to the DocsSearchTool.
+type DocsSearchArgs struct {
+	Query string `json:"query"`
+}
+
+// DocsSearchTool searches a local index of markdown documents. It is an alternative to OpenAI vector stores for
+// documents that can't be uploaded to OpenAI. Calls are rendered as FILE_SEARCH_RESULTS blocks; the contents are the
+// query and the server executes the search and stores the matching files in the block's FileSearchResults and the
+// matching sections in its outputs.
+type DocsSearchTool struct {
+	index      *search.Index
+	maxResults int
+	// fileToLink converts a file to a link to display in the UI. If nil the file name is used.
+	fileToLink func(fileID string, filename string) string
+}
+
+// NewDocsSearchTool creates a tool that searches the index. If maxResults is zero a default is used.
+func NewDocsSearchTool(index *search.Index, maxResults int, fileToLink func(fileID string, filename string) string) *DocsSearchTool {
+	if maxResults <= 0 {
+		maxResults = defaultDocsMaxResults
+	}
+	return &DocsSearchTool{
+		index:      index,
+		maxResults: maxResults,
+		fileToLink: fileToLink,
+	}
+}
+
+// NewDocsSearchToolFromConfig creates the tool described by the configuration. If cfg.IndexPath exists the index is
+// loaded from it; otherwise the index is built from cfg.Dir and, if cfg.IndexPath is set, saved there.
+func NewDocsSearchToolFromConfig(cfg config.LocalDocsConfig, fileToLink func(fileID string, filename string) string) (*DocsSearchTool, error) {
+	log := zapr.NewLogger(zap.L())
+	var index *search.Index
+	if cfg.IndexPath != "" {
+		if _, err := os.Stat(cfg.IndexPath); err == nil {
+			index, err = search.LoadIndex(cfg.IndexPath)
+			if err != nil {
+				return nil, err
+			}
+			log.Info("Loaded local docs index", "path", cfg.IndexPath, "chunks", len(index.Chunks))
+		}
+	}
+
+	if index == nil {
+		if cfg.Dir == "" {
+			return nil, errors.Errorf("Index %s doesn't exist and no directory to index is configured", cfg.IndexPath)
+		}
+		var err error
+		index, err = search.BuildIndex(cfg.Dir)
+		if err != nil {
+			return nil, err
+		}
+		log.Info("Indexed local docs", "dir", cfg.Dir, "chunks", len(index.Chunks))
+		if cfg.IndexPath != "" {
+			if err := index.Save(cfg.IndexPath); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return NewDocsSearchTool(index, cfg.MaxResults, fileToLink), nil
+}
+
+func (d *DocsSearchTool) Name() string {
+	return DocsSearchToolName
+}
+
+func (d *DocsSearchTool) Description(data PromptData) (string, error) {
+	return docsSearchDescription, nil
+}
+
+func (d *DocsSearchTool) Parameters() map[string]any {
+	return docsSearchJSONSchema
+}
+
+func (d *DocsSearchTool) BlockKind() cassie.BlockKind {
+	return cassie.BlockKind_FILE_SEARCH_RESULTS
+}
+
+func (d *DocsSearchTool) CallToBlock(args string, block *cassie.Block) error {
+	searchArgs := &DocsSearchArgs{}
+	if err := json.Unmarshal([]byte(args), searchArgs); err != nil {
+		return errors.Wrapf(err, "Failed to unmarshal %s arguments", DocsSearchToolName)
+	}
+	block.Contents = searchArgs.Query
+	return nil
+}
+
+func (d *DocsSearchTool) BlockToCall(block *cassie.Block) (string, error) {
+	b, err := json.Marshal(&DocsSearchArgs{Query: block.Contents})
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to marshal %s arguments", DocsSearchToolName)
+	}
+	return string(b), nil
+}
+
+func (d *DocsSearchTool) BlockToOutput(block *cassie.Block) (string, error) {
+	return outputsToJSON(block)
+}
+
+// Execute searches the index. The files are stored in FileSearchResults so the UI can display links to them and
+// the text of the matching sections is stored as STDOUT for the model.
+func (d *DocsSearchTool) Execute(ctx context.Context, block *cassie.Block) error {
+	results := d.index.Search(block.Contents, d.maxResults)
+
+	block.FileSearchResults = make([]*cassie.FileSearchResult, 0, len(results))
+	text := strings.Builder{}
+	for _, r := range results {
+		// The file ID is the path of the document so link manifests can refer to documents by ID.
+		link := r.Chunk.File
+		if d.fileToLink != nil {
+			link = d.fileToLink(r.Chunk.File, r.Chunk.File)
+		}
+		block.FileSearchResults = append(block.FileSearchResults, &cassie.FileSearchResult{
+			FileID:   r.Chunk.File,
+			ChunkID:  r.Chunk.ID,
+			FileName: r.Chunk.File,
+			Score:    r.Score,
+			Link:     link,
+		})
+		fmt.Fprintf(&text, "File: %s\n%s\n\n", r.Chunk.File, r.Chunk.Text)
+	}
+
+	if len(results) == 0 {
+		text.WriteString("No documents matched the query.")
+	}
+
+	block.Outputs = []*cassie.BlockOutput{
+		{
+			Kind:  cassie.BlockOutputKind_STDOUT,
+			Items: []*cassie.BlockOutputItem{{Mime: textMimeType, TextData: text.String()}},
+		},
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package ai
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jlewi/cloud-assistant/app/pkg/config"
+	"github.com/jlewi/cloud-assistant/protos/gen/cassie"
+)
+
+func TestDocsSearchTool(t *testing.T) {
+	dir := t.TempDir()
+	runbook := "# Ingress\n\n## Restarting the ingress controller\n\nRestart the ingress controller when it is unhealthy.\n"
+	if err := os.WriteFile(filepath.Join(dir, "ingress.md"), []byte(runbook), 0o644); err != nil {
+		t.Fatalf("Failed to write runbook: %+v", err)
+	}
+
+	indexPath := filepath.Join(t.TempDir(), "index.json")
+	tool, err := NewDocsSearchToolFromConfig(config.LocalDocsConfig{Dir: dir, IndexPath: indexPath}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create tool: %+v", err)
+	}
+	if _, err := os.Stat(indexPath); err != nil {
+		t.Fatalf("Expected the index to be saved: %+v", err)
+	}
+
+	// Once saved the index is loaded rather than rebuilt so the directory is no longer needed.
+	// Links are looked up by the path of the document rather than of the matching section.
+	fileToLink := func(fileID string, filename string) string {
+		return "https://wiki.acme.com/" + fileID
+	}
+	tool, err = NewDocsSearchToolFromConfig(config.LocalDocsConfig{IndexPath: indexPath}, fileToLink)
+	if err != nil {
+		t.Fatalf("Failed to create tool from the saved index: %+v", err)
+	}
+
+	block := &cassie.Block{Kind: tool.BlockKind()}
+	if err := tool.CallToBlock(`{"query": "restart ingress"}`, block); err != nil {
+		t.Fatalf("CallToBlock failed: %+v", err)
+	}
+	if err := tool.Execute(context.Background(), block); err != nil {
+		t.Fatalf("Execute failed: %+v", err)
+	}
+
+	if len(block.FileSearchResults) != 1 {
+		t.Fatalf("Expected 1 result; got %+v", block.FileSearchResults)
+	}
+	result := block.FileSearchResults[0]
+	if result.FileID != "ingress.md" || result.ChunkID != "ingress.md#0" || result.FileName != "ingress.md" || result.Link != "https://wiki.acme.com/ingress.md" || result.Score <= 0 {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+
+	output, err := tool.BlockToOutput(block)
+	if err != nil {
+		t.Fatalf("BlockToOutput failed: %+v", err)
+	}
+	if !strings.Contains(output, "Restart the ingress controller when it is unhealthy.") {
+		t.Errorf("Expected the output to contain the matching section; got %s", output)
+	}
+
+	args, err := tool.BlockToCall(block)
+	if err != nil {
+		t.Fatalf("BlockToCall failed: %+v", err)
+	}
+	if args != `{"query":"restart ingress"}` {
+		t.Errorf("Unexpected arguments: %s", args)
+	}
+}
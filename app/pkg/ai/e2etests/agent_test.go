@@ -3,6 +3,8 @@ package e2etests
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"net/http"
 	"os"
 	"os/exec"
 	"regexp"
@@ -10,8 +12,10 @@ import (
 	"sync"
 	"testing"
 
+	"github.com/jlewi/cloud-assistant/app/pkg/cassette"
 	"github.com/jlewi/cloud-assistant/app/pkg/config"
 	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
 
 	"github.com/go-logr/zapr"
 	"github.com/jlewi/cloud-assistant/app/pkg/ai"
@@ -22,44 +26,67 @@ import (
 	"google.golang.org/protobuf/encoding/protojson"
 )
 
+// agentCassette is the recording of Test_Agent that's replayed when the test doesn't run against the API.
+const agentCassette = "testdata/cassettes/agent.yaml"
+
 func Test_Agent(t *testing.T) {
 	// This test verifies that function calling works.
-	// We run it in GHA or locally if RUN_MANUAL_TESTS is set
+	// We run it against the API in GHA or locally if RUN_MANUAL_TESTS is set. Otherwise it replays agentCassette;
+	// set CASSETTE_RECORD to record the cassette again.
 	isGHA := os.Getenv("GITHUB_ACTIONS") == "true"
-	if !isGHA {
-		SkipIfMissing(t, "RUN_MANUAL_TESTS")
-	}
-	app := application.NewApp()
-	if err := app.LoadConfig(nil); err != nil {
-		t.Fatal(err)
-	}
-	if err := app.SetupLogging(); err != nil {
-		t.Fatal(err)
-	}
-	if err := app.SetupOTEL(); err != nil {
-		t.Fatal(err)
+	_, isManual := os.LookupEnv("RUN_MANUAL_TESTS")
+	recording := os.Getenv(cassette.RecordEnv) != ""
+	live := isGHA || isManual || recording
+
+	var replayer *cassette.Replayer
+	clientOpts := make([]option.RequestOption, 0, 2)
+	if recording || !live {
+		if _, err := os.Stat(agentCassette); err != nil && !recording {
+			t.Skipf("Cassette %s hasn't been recorded; run the test with %s=true to record it", agentCassette, cassette.RecordEnv)
+		}
+		rt, _ := cassette.ForTest(t, agentCassette, nil)
+		replayer, _ = rt.(*cassette.Replayer)
+		clientOpts = append(clientOpts, option.WithHTTPClient(&http.Client{Transport: rt}), option.WithMaxRetries(0))
 	}
-	cfg := app.GetConfig()
 
 	var client *openai.Client
 	var err error
 
 	agentOptions := &ai.AgentOptions{}
 	var agentConfg config.CloudAssistantConfig
-	if !isGHA {
+	switch {
+	case !live:
+		client, err = ai.NewClientWithKey("replayed", clientOpts...)
+		if err != nil {
+			t.Fatalf("Failed to create client; %v", err)
+		}
+		agentConfg.VectorStores = []string{"vs_67a829aae998819189b2ba29cef645f6"}
+	case !isGHA:
+		app := application.NewApp()
+		if err := app.LoadConfig(nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := app.SetupLogging(); err != nil {
+			t.Fatal(err)
+		}
+		if err := app.SetupOTEL(); err != nil {
+			t.Fatal(err)
+		}
+		cfg := app.GetConfig()
+
 		// When running locally create the OpenAI client using the config
-		client, err = ai.NewClient(*cfg.OpenAI)
+		client, err = ai.NewClient(*cfg.OpenAI, clientOpts...)
 		if err != nil {
 			t.Fatalf("Failed to create client from application configuration; %v", err)
 		}
 		agentConfg = *cfg.CloudAssistant
-	} else {
+	default:
 		// In GHA we get the API key from the environment variable
 		apiKey := os.Getenv("OPENAI_API_KEY")
 		if apiKey == "" {
 			t.Fatal("OPENAI_API_KEY environment variable is not set")
 		}
-		client, err = ai.NewClientWithKey(apiKey)
+		client, err = ai.NewClientWithKey(apiKey, clientOpts...)
 
 		if err != nil {
 			t.Fatalf("Failed to create client from environment variable OPENAI_API_KEY; %v", err)
@@ -158,6 +185,7 @@ func Test_Agent(t *testing.T) {
 		t.Fatalf("Error processing request: %+v", err)
 	}
 
+	hasAnswer := false
 	for _, b := range codeResp.Blocks {
 		o := protojson.MarshalOptions{
 			Multiline: true,
@@ -168,6 +196,43 @@ func Test_Agent(t *testing.T) {
 			t.Fatalf("Failed to marshal block: %+v", err)
 		}
 		t.Logf("Block:\n%+v", string(j))
+		if b.Kind == cassie.BlockKind_MARKUP && b.Role == cassie.BlockRole_BLOCK_ROLE_ASSISTANT && b.Contents != "" {
+			hasAnswer = true
+		}
+	}
+	if !hasAnswer {
+		t.Errorf("Expected the AI to answer after getting the output of the command")
+	}
+
+	if replayer == nil {
+		return
+	}
+	// Check that the second request continued the first response with the output of the call.
+	requests := replayer.Requests()
+	if len(requests) < 2 {
+		t.Fatalf("Expected at least 2 requests; got %d", len(requests))
+	}
+	body := struct {
+		PreviousResponseID string `json:"previous_response_id"`
+		Input              []struct {
+			Type   string `json:"type"`
+			CallID string `json:"call_id"`
+		} `json:"input"`
+	}{}
+	if err := json.Unmarshal([]byte(requests[len(requests)-1].Body), &body); err != nil {
+		t.Fatalf("Failed to parse the last request: %+v", err)
+	}
+	if body.PreviousResponseID != previousResponseID {
+		t.Errorf("Expected the last request to continue %s; got %q", previousResponseID, body.PreviousResponseID)
+	}
+	hasOutput := false
+	for _, item := range body.Input {
+		if item.Type == "function_call_output" && item.CallID == codeBlocks[0].CallId {
+			hasOutput = true
+		}
+	}
+	if !hasOutput {
+		t.Errorf("Expected the last request to send the output of call %s", codeBlocks[0].CallId)
 	}
 }
 
@@ -12,6 +12,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"slices"
 	"sort"
 	"strings"
 	"time"
@@ -22,6 +23,7 @@ import (
 	"github.com/go-logr/zapr"
 	"github.com/jlewi/cloud-assistant/app/pkg/docs"
 	"github.com/jlewi/cloud-assistant/app/pkg/logs"
+	"github.com/jlewi/cloud-assistant/app/pkg/risk"
 	"github.com/jlewi/cloud-assistant/app/pkg/version"
 	"github.com/jlewi/cloud-assistant/protos/gen/cassie"
 	"github.com/jlewi/cloud-assistant/protos/gen/cassie/cassieconnect"
@@ -268,15 +270,61 @@ func (c codeblockRegex) Assert(ctx context.Context, as *cassie.Assertion, inputT
 	return nil
 }
 
+type maxRisk struct{}
+
+func (m maxRisk) Assert(ctx context.Context, as *cassie.Assertion, inputText string, blocks map[string]*cassie.Block) error {
+	maxLevel, err := risk.ParseLevel(as.GetMaxRisk().GetLevel())
+	if err != nil {
+		as.Result = cassie.Assertion_RESULT_FALSE
+		return err
+	}
+
+	// Blocks that weren't annotated by the server (e.g. code blocks parsed out of markdown) are classified with the
+	// default rules.
+	classifier, err := risk.NewClassifier(nil, "")
+	if err != nil {
+		return err
+	}
+
+	as.Result = cassie.Assertion_RESULT_TRUE
+	for _, block := range blocks {
+		if block.Kind != cassie.BlockKind_CODE {
+			continue
+		}
+		level, ok := risk.FromBlock(block)
+		if !ok {
+			result, err := classifyBlock(classifier, block)
+			if err != nil {
+				as.Result = cassie.Assertion_RESULT_FALSE
+				as.FailureReason = fmt.Sprintf("Failed to classify code block %s: %v", block.Id, err)
+				break
+			}
+			level = result.Level
+		}
+		if level.Rank() > maxLevel.Rank() {
+			as.Result = cassie.Assertion_RESULT_FALSE
+			as.FailureReason = fmt.Sprintf("Code block is %s which exceeds %s: %s", level, maxLevel, block.Contents)
+			break
+		}
+	}
+
+	logger, _ := logr.FromContext(ctx)
+	logger.Info("maxRisk", "assertion", as.Name, "result", as.Result)
+	return nil
+}
+
 var registry = map[cassie.Assertion_Type]Asserter{
 	cassie.Assertion_TYPE_SHELL_REQUIRED_FLAG: shellRequiredFlag{},
 	cassie.Assertion_TYPE_TOOL_INVOKED:        toolInvocation{},
 	cassie.Assertion_TYPE_FILE_RETRIEVED:      fileRetrieved{},
 	cassie.Assertion_TYPE_LLM_JUDGE:           llmJudge{},
 	cassie.Assertion_TYPE_CODEBLOCK_REGEX:     codeblockRegex{},
+	cassie.Assertion_TYPE_MAX_RISK:            maxRisk{},
 }
 
-func runInference(input string, cassieCookie string, inferenceEndpoint string) (map[string]*cassie.Block, error) {
+// runInference sends the input to the inference endpoint. It returns the generated blocks and the model that
+// generated them.
+func runInference(input string, cassieCookie string, inferenceEndpoint string, model string) (map[string]*cassie.Block, string, error) {
 	log := zapr.NewLoggerWithOptions(zap.L(), zapr.AllowZapFields(true))
 
 	blocks := make(map[string]*cassie.Block)
@@ -290,13 +338,13 @@ func runInference(input string, cassieCookie string, inferenceEndpoint string) (
 
 	baseURL := inferenceEndpoint
 	if baseURL == "" {
-		return blocks, errors.New("inferenceEndpoint is not set in config")
+		return blocks, "", errors.New("inferenceEndpoint is not set in config")
 	}
 
 	u, err := url.Parse(baseURL)
 	if err != nil {
 		log.Error(err, "Failed to parse URL")
-		return blocks, errors.Wrapf(err, "Failed to parse URL")
+		return blocks, "", errors.Wrapf(err, "Failed to parse URL")
 	}
 
 	var client cassieconnect.BlocksServiceClient
@@ -346,6 +394,7 @@ func runInference(input string, cassieCookie string, inferenceEndpoint string) (
 				Contents: input,
 			},
 		},
+		Model: model,
 	}
 	req := connect.NewRequest(genReq)
 	cookie := &http.Cookie{
@@ -356,23 +405,27 @@ func runInference(input string, cassieCookie string, inferenceEndpoint string) (
 	req.Header().Add("Cookie", cookie.String())
 	stream, err := client.Generate(ctx, req)
 	if err != nil {
-		return blocks, errors.Wrapf(err, "Failed to create generate stream")
+		return blocks, "", errors.Wrapf(err, "Failed to create generate stream")
 	}
 
 	// Receive responses
+	usedModel := ""
 	for stream.Receive() {
 		response := stream.Msg()
+		if response.Model != "" {
+			usedModel = response.Model
+		}
 		for _, block := range response.Blocks {
 			blocks[block.Id] = block
 		}
 	}
 	if stream.Err() != nil {
-		return blocks, errors.Wrapf(stream.Err(), "Error receiving response")
+		return blocks, "", errors.Wrapf(stream.Err(), "Error receiving response")
 	}
 	for _, block := range blocks {
 		log.Info(fmt.Sprintf("Received %d blocks. Type: %s, Role: %s, Contents: %s", len(blocks), block.Kind, block.Role, block.Contents))
 	}
-	return blocks, nil
+	return blocks, usedModel, nil
 }
 
 // markdownReport holds the data needed to render the evaluation markdown report
@@ -511,7 +564,6 @@ func EvalFromExperiment(exp *cassie.Experiment, experimentFilePath string, cooki
 		AssertionTypeStats: map[string]struct{ Passed, Failed, Skipped int }{},
 		Commit:             version.Commit,
 		Version:            version.Version,
-		Model:              "gpt-4o-mini", // TODO: fetch dynamically if possible
 		Runner:             "linux-amd64", // TODO: fetch dynamically if possible
 		GoVersion:          runtime.Version(),
 		Date:               time.Now().In(loc).Format("2006-01-02 15:04 MST"),
@@ -522,12 +574,17 @@ func EvalFromExperiment(exp *cassie.Experiment, experimentFilePath string, cooki
 	numFailed := 0
 	numSkipped := 0
 	failedAssertions := []struct{ Sample, Assertion, Reason, BlocksDump string }{}
+	// models is the list of distinct models reported by the server. There should normally be exactly one.
+	models := []string{}
 
 	for _, sample := range samples {
-		blocks, err := runInference(sample.InputText, cassieCookie, inferenceEndpoint)
+		blocks, model, err := runInference(sample.InputText, cassieCookie, inferenceEndpoint, exp.Spec.GetModel())
 		if err != nil {
 			return nil, errors.Wrapf(err, "failed to run inference")
 		}
+		if model != "" && !slices.Contains(models, model) {
+			models = append(models, model)
+		}
 		for _, assertion := range sample.Assertions {
 			err := registry[assertion.Type].Assert(ctx, assertion, sample.InputText, blocks)
 			if err != nil {
@@ -556,6 +613,10 @@ func EvalFromExperiment(exp *cassie.Experiment, experimentFilePath string, cooki
 			report.AssertionTypeStats[typeName] = stat
 		}
 	}
+	report.Model = strings.Join(models, ", ")
+	if report.Model == "" {
+		report.Model = "unknown"
+	}
 	report.NumAssertions = totalAssertions
 	report.NumPassed = numPassed
 	report.NumFailed = numFailed
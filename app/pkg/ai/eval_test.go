@@ -11,6 +11,7 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/jlewi/cloud-assistant/app/pkg/application"
+	"github.com/jlewi/cloud-assistant/app/pkg/risk"
 	"github.com/jlewi/cloud-assistant/protos/gen/cassie"
 	"go.uber.org/zap"
 )
@@ -243,6 +244,69 @@ func TestAssertions(t *testing.T) {
 				Result: cassie.Assertion_RESULT_FALSE,
 			},
 		},
+		{
+			name:     "max-risk-read-only",
+			asserter: maxRisk{},
+			assertion: &cassie.Assertion{
+				Name: "read-only",
+				Type: cassie.Assertion_TYPE_MAX_RISK,
+				Payload: &cassie.Assertion_MaxRisk_{
+					MaxRisk: &cassie.Assertion_MaxRisk{
+						Level: "read-only",
+					},
+				},
+			},
+			blocks: map[string]*cassie.Block{
+				"1": {
+					Kind:     cassie.BlockKind_CODE,
+					Contents: "kubectl get pods | grep Running",
+				},
+			},
+			expectedAssertion: &cassie.Assertion{
+				Name: "read-only",
+				Type: cassie.Assertion_TYPE_MAX_RISK,
+				Payload: &cassie.Assertion_MaxRisk_{
+					MaxRisk: &cassie.Assertion_MaxRisk{
+						Level: "read-only",
+					},
+				},
+				Result: cassie.Assertion_RESULT_TRUE,
+			},
+		},
+		{
+			name:     "max-risk-destructive",
+			asserter: maxRisk{},
+			assertion: &cassie.Assertion{
+				Name: "read-only",
+				Type: cassie.Assertion_TYPE_MAX_RISK,
+				Payload: &cassie.Assertion_MaxRisk_{
+					MaxRisk: &cassie.Assertion_MaxRisk{
+						Level: "read-only",
+					},
+				},
+			},
+			blocks: map[string]*cassie.Block{
+				"1": {
+					Kind:     cassie.BlockKind_CODE,
+					Contents: "kubectl get pods",
+				},
+				"2": {
+					Kind:     cassie.BlockKind_CODE,
+					Contents: "kubectl delete pod foo",
+					Metadata: map[string]string{risk.LevelMetadataKey: string(risk.LevelDestructive)},
+				},
+			},
+			expectedAssertion: &cassie.Assertion{
+				Name: "read-only",
+				Type: cassie.Assertion_TYPE_MAX_RISK,
+				Payload: &cassie.Assertion_MaxRisk_{
+					MaxRisk: &cassie.Assertion_MaxRisk{
+						Level: "read-only",
+					},
+				},
+				Result: cassie.Assertion_RESULT_FALSE,
+			},
+		},
 		{
 			name:     "llm-judge-basic",
 			asserter: llmJudge{client: client},
@@ -285,6 +349,7 @@ func TestAssertions(t *testing.T) {
 			cassie.Assertion_FileRetrieval{},
 			cassie.Assertion_CodeblockRegex{},
 			cassie.Assertion_LLMJudge{},
+			cassie.Assertion_MaxRisk{},
 		),
 		cmpopts.IgnoreFields(cassie.Assertion{}, "FailureReason"),
 	}
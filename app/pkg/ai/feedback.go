@@ -0,0 +1,85 @@
+package ai
+
+import (
+	"context"
+
+	"connectrpc.com/connect"
+	"github.com/google/uuid"
+	"github.com/jlewi/cloud-assistant/app/pkg/iam"
+	"github.com/jlewi/cloud-assistant/app/pkg/logs"
+	"github.com/jlewi/cloud-assistant/protos/gen/cassie"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// SubmitFeedback records a rating of a response or block along with the snapshot of the conversation sent by the
+// client. The snapshot, the comment and the corrected command are redacted before they are logged or stored.
+func (a *Agent) SubmitFeedback(ctx context.Context, req *connect.Request[cassie.SubmitFeedbackRequest]) (*connect.Response[cassie.SubmitFeedbackResponse], error) {
+	log := logs.FromContext(ctx)
+	msg := req.Msg
+	if msg.GetResponseId() == "" && msg.GetBlockId() == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("Either response_id or block_id must be set"))
+	}
+	if msg.GetRating() == cassie.Rating_RATING_UNSPECIFIED {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("rating must be set"))
+	}
+	if len(msg.GetBlocks()) == 0 {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("blocks must contain the conversation being rated"))
+	}
+	if err := a.checkRatedTurn(ctx, msg.GetResponseId(), msg.GetBlockId()); err != nil {
+		return nil, err
+	}
+
+	blocks := make([]*cassie.Block, 0, len(msg.GetBlocks()))
+	for _, b := range msg.GetBlocks() {
+		blocks = append(blocks, proto.Clone(b).(*cassie.Block))
+	}
+	a.redactBlocks(ctx, blocks)
+	comment := msg.GetComment()
+	correctedCommand := msg.GetCorrectedCommand()
+	if a.redactor != nil {
+		comment, _ = a.redactor.Redact(comment)
+		correctedCommand, _ = a.redactor.Redact(correctedCommand)
+	}
+
+	f := &cassie.Feedback{
+		Id:               uuid.NewString(),
+		CreateTime:       timestamppb.Now(),
+		Principal:        iam.GetPrincipal(ctx),
+		ResponseId:       msg.GetResponseId(),
+		BlockId:          msg.GetBlockId(),
+		Rating:           msg.GetRating(),
+		Comment:          comment,
+		CorrectedCommand: correctedCommand,
+		Blocks:           blocks,
+	}
+	log.Info("Feedback", "feedbackId", f.Id, "principal", f.Principal, "responseId", f.ResponseId, "blockId", f.BlockId, "rating", f.Rating.String(), "comment", f.Comment, "correctedCommand", f.CorrectedCommand, "numBlocks", len(f.Blocks))
+	if a.feedback != nil {
+		if err := a.feedback.Add(ctx, f); err != nil {
+			log.Error(err, "Failed to store feedback", "feedbackId", f.Id)
+			return nil, connect.NewError(connect.CodeInternal, errors.Wrapf(err, "Failed to store feedback"))
+		}
+	}
+	return connect.NewResponse(&cassie.SubmitFeedbackResponse{FeedbackId: f.Id}), nil
+}
+
+// checkRatedTurn returns an error if the rated response, or the response that generated the rated block if
+// responseID is empty, was generated for another principal. Responses that aren't in the store e.g. because they
+// expired can be rated since the snapshot comes from the client.
+func (a *Agent) checkRatedTurn(ctx context.Context, responseID string, blockID string) error {
+	var turn *Turn
+	var err error
+	if responseID != "" {
+		turn, err = a.store.GetTurn(ctx, responseID)
+	} else {
+		turn, err = a.store.FindTurn(ctx, blockID)
+	}
+	if err != nil {
+		return connect.NewError(connect.CodeInternal, errors.Wrapf(err, "Failed to look up the rated response"))
+	}
+	if turn != nil && !ownsTurn(ctx, turn) {
+		return connect.NewError(connect.CodePermissionDenied, errors.New("Responses can only be rated by the principal that generated them"))
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+package ai
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jlewi/cloud-assistant/app/pkg/docs"
+	"github.com/jlewi/cloud-assistant/protos/gen/cassie"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/responses"
+)
+
+const (
+	// DefaultMaxInputTokens is the default token budget for the conversation history in stateless mode.
+	DefaultMaxInputTokens = 100000
+
+	// charsPerToken is a rough estimate of the number of characters in a token. We use it to apply the token budget
+	// without having to tokenize the history with the model's tokenizer.
+	charsPerToken = 4
+
+	// maxBlockShare is the maximum fraction of the budget (1/maxBlockShare) a single block can use. It keeps a single
+	// huge output from crowding out the rest of the conversation.
+	maxBlockShare = 4
+)
+
+// buildHistory converts the blocks of a notebook into input messages for a model that doesn't have any state
+// about the conversation. Each block is rendered as markdown and truncated using docs.BlockToMarkdown. If the
+// blocks don't fit within maxTokens the oldest blocks are dropped and replaced with a note saying they were omitted.
+// The most recent block is always included. Images and files in blocks are sent along with their text if media
+// allows them; they don't count towards the budget. Neither does the encrypted reasoning of REASONING blocks which
+// is sent back as reasoning items. The API rejects a reasoning item that isn't followed by the item it led to so the
+// assistant messages and calls following it are sent as the items the model output; reasoning that isn't followed by
+// one is dropped.
+func buildHistory(blocks []*cassie.Block, maxTokens int, media *mediaPolicy, tools *ToolRegistry) []responses.ResponseInputItemUnionParam {
+	if maxTokens <= 0 {
+		maxTokens = DefaultMaxInputTokens
+	}
+	maxChars := maxTokens * charsPerToken
+	maxBlockChars := maxChars / maxBlockShare
+
+	outputs := outputBlocks(blocks, tools)
+
+	// Walk the blocks from newest to oldest so that if we run out of budget it's the oldest blocks that get dropped.
+	items := make([]responses.ResponseInputItemUnionParam, 0, len(blocks)+1)
+	used := 0
+	dropped := 0
+	for i := len(blocks) - 1; i >= 0; i-- {
+		b := blocks[i]
+		if b.GetKind() == cassie.BlockKind_FILE_SEARCH_RESULTS && len(b.GetOutputs()) == 0 {
+			// The results of OpenAI file search are links for the user; the model gets the contents of the files
+			// from the search itself. Local searches store the contents in the outputs so those are kept.
+			continue
+		}
+		if b.GetKind() == cassie.BlockKind_REASONING {
+			// Summaries are written for the user; the model gets its actual reasoning back from the encrypted
+			// content. Without it the model reasons again from the conversation.
+			if item, ok := reasoningItem(b); ok && len(items) > 0 && isOutputItem(items[len(items)-1]) {
+				items = append(items, item)
+			}
+			continue
+		}
+
+		text := docs.BlockToMarkdown(b, maxBlockChars)
+		if summary := executionSummary(b.GetExecutionInfo()); summary != "" {
+			text += "\n" + summary + "\n"
+		}
+		if used+len(text) > maxChars && len(items) > 0 {
+			dropped = i + 1
+			break
+		}
+		used += len(text)
+
+		if outputs[i] {
+			if output, ok := outputItems(b, text, media, tools); ok {
+				items = append(items, output...)
+				continue
+			}
+		}
+
+		role := responses.EasyInputMessageRoleUser
+		if b.GetKind() == cassie.BlockKind_MARKUP && b.GetRole() == cassie.BlockRole_BLOCK_ROLE_ASSISTANT {
+			role = responses.EasyInputMessageRoleAssistant
+		}
+		if role == responses.EasyInputMessageRoleUser {
+			if message, ok := media.mediaMessage(text, mediaItems(b)); ok {
+				items = append(items, message)
+				continue
+			}
+		}
+		items = append(items, newMessage(role, text))
+	}
+
+	if dropped > 0 {
+		items = append(items, newMessage(responses.EasyInputMessageRoleUser, fmt.Sprintf("<...%d earlier cells were omitted to fit the context window...>", dropped)))
+	}
+
+	// Restore chronological order.
+	for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+		items[i], items[j] = items[j], items[i]
+	}
+	return items
+}
+
+// executionSummary describes how a command ran e.g. its exit code and duration. It returns an empty string if the
+// block wasn't executed.
+func executionSummary(info *cassie.ExecutionInfo) string {
+	if info == nil {
+		return ""
+	}
+	parts := make([]string, 0, 3)
+	if info.GetCancelled() {
+		parts = append(parts, "cancelled")
+	} else if info.ExitCode != nil {
+		parts = append(parts, fmt.Sprintf("exit code %d", info.GetExitCode()))
+	}
+	if info.GetStartTime() != nil && info.GetEndTime() != nil {
+		duration := info.GetEndTime().AsTime().Sub(info.GetStartTime().AsTime())
+		parts = append(parts, "took "+duration.Round(time.Millisecond).String())
+	}
+	if info.GetTruncated() {
+		parts = append(parts, "output truncated")
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "<execution: " + strings.Join(parts, ", ") + ">"
+}
+
+// reasoningItem returns the reasoning input item for a REASONING block. It returns false if the block doesn't have
+// the encrypted content of the reasoning e.g. because it was generated by a server that stores responses.
+func reasoningItem(b *cassie.Block) (responses.ResponseInputItemUnionParam, bool) {
+	encrypted := b.GetMetadata()[EncryptedReasoningMetadataKey]
+	if encrypted == "" {
+		return responses.ResponseInputItemUnionParam{}, false
+	}
+	summary := make([]responses.ResponseReasoningItemSummaryParam, 0, 1)
+	if b.GetContents() != "" {
+		summary = append(summary, responses.ResponseReasoningItemSummaryParam{Text: b.GetContents()})
+	}
+	return responses.ResponseInputItemUnionParam{
+		OfReasoning: &responses.ResponseReasoningItemParam{
+			ID:               b.GetId(),
+			Summary:          summary,
+			EncryptedContent: openai.Opt(encrypted),
+		},
+	}, true
+}
+
+// outputBlocks returns which blocks follow a REASONING block with encrypted content, directly or after other blocks
+// that follow it, and are assistant messages or calls to a tool in tools. Those blocks are sent as the items the model
+// output.
+func outputBlocks(blocks []*cassie.Block, tools *ToolRegistry) []bool {
+	outputs := make([]bool, len(blocks))
+	afterReasoning := false
+	for i, b := range blocks {
+		switch {
+		case b.GetKind() == cassie.BlockKind_REASONING:
+			_, afterReasoning = reasoningItem(b)
+		case b.GetKind() == cassie.BlockKind_FILE_SEARCH_RESULTS && len(b.GetOutputs()) == 0:
+			// buildHistory skips these blocks.
+		case b.GetId() == "" || b.GetRole() != cassie.BlockRole_BLOCK_ROLE_ASSISTANT:
+			afterReasoning = false
+		case b.GetKind() == cassie.BlockKind_MARKUP:
+			outputs[i] = afterReasoning
+		default:
+			_, isTool := tools.ForBlock(b)
+			outputs[i] = afterReasoning && isTool && b.GetCallId() != ""
+			afterReasoning = outputs[i]
+		}
+	}
+	return outputs
+}
+
+// outputItems returns the items the model output for a block returned by outputBlocks in reverse order. An assistant
+// message is an output message; a call is the function call followed by its output. The output is the block's text
+// so it's truncated like the other blocks. It returns false if the block can't be converted to a call.
+func outputItems(b *cassie.Block, text string, media *mediaPolicy, tools *ToolRegistry) ([]responses.ResponseInputItemUnionParam, bool) {
+	if b.GetKind() == cassie.BlockKind_MARKUP {
+		return []responses.ResponseInputItemUnionParam{{
+			OfOutputMessage: &responses.ResponseOutputMessageParam{
+				ID: b.GetId(),
+				Content: []responses.ResponseOutputMessageContentUnionParam{{
+					OfOutputText: &responses.ResponseOutputTextParam{
+						Text:        text,
+						Annotations: []responses.ResponseOutputTextAnnotationUnionParam{},
+					},
+				}},
+				Status: responses.ResponseOutputMessageStatusCompleted,
+			},
+		}}, true
+	}
+
+	tool, ok := tools.ForBlock(b)
+	if !ok {
+		return nil, false
+	}
+	args, err := tool.BlockToCall(b)
+	if err != nil {
+		return nil, false
+	}
+	items := make([]responses.ResponseInputItemUnionParam, 0, 3)
+	// The output of a call can only be text so images and files output by the call follow in a message.
+	if message, ok := media.mediaMessage(fmt.Sprintf("Images and files output by call %s:", b.GetCallId()), mediaItems(b)); ok {
+		items = append(items, message)
+	}
+	items = append(items,
+		responses.ResponseInputItemUnionParam{
+			OfFunctionCallOutput: &responses.ResponseInputItemFunctionCallOutputParam{
+				CallID: b.GetCallId(),
+				Output: text,
+			},
+		},
+		responses.ResponseInputItemUnionParam{
+			OfFunctionCall: &responses.ResponseFunctionToolCallParam{
+				ID:        openai.Opt(b.GetId()),
+				CallID:    b.GetCallId(),
+				Name:      tool.Name(),
+				Arguments: args,
+			},
+		},
+	)
+	return items, true
+}
+
+// isOutputItem returns true if the item is a message or call output by the model.
+func isOutputItem(item responses.ResponseInputItemUnionParam) bool {
+	return item.OfOutputMessage != nil || item.OfFunctionCall != nil
+}
+
+func newMessage(role responses.EasyInputMessageRole, text string) responses.ResponseInputItemUnionParam {
+	return responses.ResponseInputItemUnionParam{
+		OfMessage: &responses.EasyInputMessageParam{
+			Role: role,
+			Content: responses.EasyInputMessageContentUnionParam{
+				OfString: openai.Opt(text),
+			},
+		},
+	}
+}
+
+// withStateless returns a sender that marks every response as coming from a stateless server so the client knows to
+// send the whole conversation in its next request.
+func withStateless(sender BlockSender) BlockSender {
+	return func(resp *cassie.GenerateResponse) error {
+		resp.Stateless = true
+		return sender(resp)
+	}
+}
@@ -0,0 +1,424 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"connectrpc.com/connect"
+	"github.com/google/go-cmp/cmp"
+	"github.com/jlewi/cloud-assistant/app/pkg/config"
+	"github.com/jlewi/cloud-assistant/protos/gen/cassie"
+	"github.com/openai/openai-go/responses"
+)
+
+// historyText returns the role and text of each message in the input and the IDs and text of the items output by the
+// model.
+func historyText(items []responses.ResponseInputItemUnionParam) []string {
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		if item.OfReasoning != nil {
+			result = append(result, "reasoning: "+item.OfReasoning.EncryptedContent.Value)
+			continue
+		}
+		if m := item.OfOutputMessage; m != nil {
+			result = append(result, "assistant output "+m.ID+": "+m.Content[0].OfOutputText.Text)
+			continue
+		}
+		if c := item.OfFunctionCall; c != nil {
+			result = append(result, "call "+c.ID.Value+" "+c.CallID+" "+c.Name+": "+c.Arguments)
+			continue
+		}
+		if o := item.OfFunctionCallOutput; o != nil {
+			result = append(result, "output "+o.CallID+": "+o.Output)
+			continue
+		}
+		if item.OfMessage == nil {
+			result = append(result, "<not a message>")
+			continue
+		}
+		text := item.OfMessage.Content.OfString.Value
+		for _, c := range item.OfMessage.Content.OfInputItemContentList {
+			switch {
+			case c.OfInputText != nil:
+				text += c.OfInputText.Text
+			case c.OfInputImage != nil:
+				text += "<image " + c.OfInputImage.ImageURL.Value + ">"
+			case c.OfInputFile != nil:
+				text += "<file " + c.OfInputFile.Filename.Value + " " + c.OfInputFile.FileData.Value + ">"
+			}
+		}
+		result = append(result, string(item.OfMessage.Role)+": "+text)
+	}
+	return result
+}
+
+// markupBlocks returns n user blocks whose contents are length characters long.
+func markupBlocks(n int, length int) []*cassie.Block {
+	blocks := make([]*cassie.Block, 0, n)
+	for i := 0; i < n; i++ {
+		blocks = append(blocks, &cassie.Block{
+			Id:       fmt.Sprintf("user_%d", i),
+			Kind:     cassie.BlockKind_MARKUP,
+			Role:     cassie.BlockRole_BLOCK_ROLE_USER,
+			Contents: strings.Repeat(string(rune('a'+i)), length),
+		})
+	}
+	return blocks
+}
+
+func TestBuildHistory(t *testing.T) {
+	type testCase struct {
+		name      string
+		blocks    []*cassie.Block
+		maxTokens int
+		expected  []string
+	}
+
+	cases := []testCase{
+		{
+			name: "conversation",
+			blocks: []*cassie.Block{
+				{Id: "user_1", Kind: cassie.BlockKind_MARKUP, Role: cassie.BlockRole_BLOCK_ROLE_USER, Contents: "What pods are running?"},
+				{Id: "rs_1", Kind: cassie.BlockKind_REASONING, Role: cassie.BlockRole_BLOCK_ROLE_ASSISTANT, Contents: "The user wants the pods."},
+				{Id: "msg_1", Kind: cassie.BlockKind_MARKUP, Role: cassie.BlockRole_BLOCK_ROLE_ASSISTANT, Contents: "Let's check."},
+				{Id: "fs_1", Kind: cassie.BlockKind_FILE_SEARCH_RESULTS, Role: cassie.BlockRole_BLOCK_ROLE_ASSISTANT},
+				{
+					Id:       "fc_1",
+					Kind:     cassie.BlockKind_CODE,
+					Role:     cassie.BlockRole_BLOCK_ROLE_ASSISTANT,
+					Contents: "kubectl get pods",
+					CallId:   "call_1",
+					Outputs: []*cassie.BlockOutput{
+						{Items: []*cassie.BlockOutputItem{{TextData: "pod-1 Running"}}},
+					},
+				},
+			},
+			expected: []string{
+				"user: What pods are running?\n",
+				"assistant: Let's check.\n",
+				"user: ```bash\nkubectl get pods\n```\n```output\npod-1 Running\n```\n",
+			},
+		},
+		{
+			name:   "drop-old-blocks",
+			blocks: markupBlocks(9, 50),
+			// 100 tokens is 400 characters; each block is 51 characters so only the last 7 blocks fit.
+			maxTokens: 100,
+			expected: append(
+				[]string{"user: <...2 earlier cells were omitted to fit the context window...>"},
+				historyText(buildHistory(markupBlocks(9, 50)[2:], 0, newMediaPolicy(0, nil, false), nil))...,
+			),
+		},
+		{
+			name: "media",
+			blocks: []*cassie.Block{
+				{
+					Id:       "user_1",
+					Kind:     cassie.BlockKind_MARKUP,
+					Role:     cassie.BlockRole_BLOCK_ROLE_USER,
+					Contents: "Why is latency high?",
+					Attachments: []*cassie.BlockOutputItem{
+						{Mime: "application/pdf", Name: "runbook.pdf", BinaryData: []byte("pdf")},
+						{Mime: "image/tiff", Name: "scan.tiff", BinaryData: []byte("tiff")},
+					},
+				},
+				{
+					Id:       "fc_1",
+					Kind:     cassie.BlockKind_CODE,
+					Contents: "grafana-snapshot latency",
+					Outputs: []*cassie.BlockOutput{
+						{Items: []*cassie.BlockOutputItem{
+							{TextData: "saved latency.png"},
+							{Mime: "image/png", BinaryData: []byte("png")},
+						}},
+					},
+				},
+			},
+			expected: []string{
+				"user: Why is latency high?\n<file runbook.pdf data:application/pdf;base64,cGRm><scan.tiff (image/tiff, 4 bytes) was omitted: the MIME type isn't allowed>",
+				"user: ```bash\ngrafana-snapshot latency\n```\n```output\nsaved latency.png\n```\n<image data:image/png;base64,cG5n>",
+			},
+		},
+		{
+			name: "truncate-output",
+			blocks: []*cassie.Block{
+				{
+					Id:       "fc_1",
+					Kind:     cassie.BlockKind_CODE,
+					Contents: "cat log.txt",
+					Outputs: []*cassie.BlockOutput{
+						{Items: []*cassie.BlockOutputItem{{TextData: strings.Repeat("x", 1000)}}},
+					},
+				},
+			},
+			// Each block gets at most a quarter of the 400 character budget.
+			maxTokens: 100,
+			expected: []string{
+				"user: ```bash\ncat log.txt\n```\n```output\n" + strings.Repeat("x", 51) + "<...stdout was truncated...>\n```\n",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual := historyText(buildHistory(c.blocks, c.maxTokens, newMediaPolicy(0, nil, false), nil))
+			if d := cmp.Diff(c.expected, actual); d != "" {
+				t.Errorf("Unexpected history (-want +got):\n%s", d)
+			}
+		})
+	}
+}
+
+func TestBuildHistoryReasoning(t *testing.T) {
+	type testCase struct {
+		name     string
+		blocks   []*cassie.Block
+		expected []string
+	}
+
+	encrypted := map[string]string{EncryptedReasoningMetadataKey: "gAAAA-encrypted"}
+	question := &cassie.Block{Id: "user_1", Kind: cassie.BlockKind_MARKUP, Role: cassie.BlockRole_BLOCK_ROLE_USER, Contents: "What pods are running?"}
+	reasoning := &cassie.Block{Id: "rs_1", Kind: cassie.BlockKind_REASONING, Role: cassie.BlockRole_BLOCK_ROLE_ASSISTANT, Metadata: encrypted}
+	call := func(id string, callID string, command string) *cassie.Block {
+		return &cassie.Block{
+			Id:       id,
+			Kind:     cassie.BlockKind_CODE,
+			Role:     cassie.BlockRole_BLOCK_ROLE_ASSISTANT,
+			Contents: command,
+			CallId:   callID,
+			Outputs: []*cassie.BlockOutput{
+				{Items: []*cassie.BlockOutputItem{{TextData: "ok"}}},
+			},
+		}
+	}
+
+	cases := []testCase{
+		{
+			name: "message",
+			blocks: []*cassie.Block{
+				question,
+				reasoning,
+				{Id: "msg_1", Kind: cassie.BlockKind_MARKUP, Role: cassie.BlockRole_BLOCK_ROLE_ASSISTANT, Contents: "Let's check."},
+				{Id: "user_2", Kind: cassie.BlockKind_MARKUP, Role: cassie.BlockRole_BLOCK_ROLE_USER, Contents: "Go ahead."},
+			},
+			expected: []string{
+				"user: What pods are running?\n",
+				"reasoning: gAAAA-encrypted",
+				"assistant output msg_1: Let's check.\n",
+				"user: Go ahead.\n",
+			},
+		},
+		{
+			name: "parallel-calls",
+			blocks: []*cassie.Block{
+				question,
+				reasoning,
+				call("fc_1", "call_1", "kubectl get pods"),
+				call("fc_2", "call_2", "kubectl get nodes"),
+			},
+			expected: []string{
+				"user: What pods are running?\n",
+				"reasoning: gAAAA-encrypted",
+				`call fc_1 call_1 shell: {"shell":"kubectl get pods"}`,
+				"output call_1: ```bash\nkubectl get pods\n```\n```output\nok\n```\n",
+				`call fc_2 call_2 shell: {"shell":"kubectl get nodes"}`,
+				"output call_2: ```bash\nkubectl get nodes\n```\n```output\nok\n```\n",
+			},
+		},
+		{
+			// The user deleted the message the reasoning led to.
+			name: "followed-by-user",
+			blocks: []*cassie.Block{
+				question,
+				reasoning,
+				{Id: "user_2", Kind: cassie.BlockKind_MARKUP, Role: cassie.BlockRole_BLOCK_ROLE_USER, Contents: "Never mind."},
+			},
+			expected: []string{
+				"user: What pods are running?\n",
+				"user: Never mind.\n",
+			},
+		},
+		{
+			name: "unknown-tool",
+			blocks: []*cassie.Block{
+				question,
+				reasoning,
+				{
+					Id:       "fc_1",
+					Kind:     cassie.BlockKind_TOOL_CALL,
+					Role:     cassie.BlockRole_BLOCK_ROLE_ASSISTANT,
+					Contents: "pods",
+					CallId:   "call_1",
+					Metadata: map[string]string{ToolNameMetadataKey: "search_docs"},
+				},
+			},
+			expected: []string{
+				"user: What pods are running?\n",
+				"user: pods\n",
+			},
+		},
+	}
+
+	tools, err := NewToolRegistry(&ShellTool{})
+	if err != nil {
+		t.Fatalf("Failed to create tool registry: %+v", err)
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual := historyText(buildHistory(c.blocks, 0, newMediaPolicy(0, nil, false), tools))
+			if d := cmp.Diff(c.expected, actual); d != "" {
+				t.Errorf("Unexpected history (-want +got):\n%s", d)
+			}
+		})
+	}
+}
+
+func Test_AgentStateless(t *testing.T) {
+	provider := &fakeProvider{
+		responses: [][]responses.ResponseStreamEventUnion{
+			shellCallEvents(t, "resp_1", "fc_1", "call_1", "kubectl get pods"),
+		},
+	}
+	runner := &fakeRunner{}
+
+	agent, err := NewAgent(AgentOptions{
+		Provider:          provider,
+		Autopilot:         true,
+		AutopilotCommands: []string{"kubectl get"},
+		Runner:            runner,
+		Stateless:         true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create agent: %+v", err)
+	}
+
+	// The client sends the whole notebook.
+	blocks := []*cassie.Block{
+		{Id: "user_1", Kind: cassie.BlockKind_MARKUP, Role: cassie.BlockRole_BLOCK_ROLE_USER, Contents: "Is the cluster up?"},
+		{Id: "msg_0", Kind: cassie.BlockKind_MARKUP, Role: cassie.BlockRole_BLOCK_ROLE_ASSISTANT, Contents: "Yes."},
+		{Id: "user_2", Kind: cassie.BlockKind_MARKUP, Role: cassie.BlockRole_BLOCK_ROLE_USER, Contents: "What pods are running?"},
+	}
+
+	// A client that refers to a previous response would lose the earlier turns so the request is rejected.
+	err = agent.ProcessWithOpenAI(context.Background(), &cassie.GenerateRequest{PreviousResponseId: "resp_0", Blocks: blocks[2:]}, NullOpSender)
+	if connect.CodeOf(err) != connect.CodeInvalidArgument {
+		t.Errorf("Expected InvalidArgument for a request with a previous response ID; got %v", err)
+	}
+	if len(provider.requests) != 0 {
+		t.Fatalf("Expected the rejected request not to be sent to the model; got %d requests", len(provider.requests))
+	}
+
+	stateless := true
+	sender := func(resp *cassie.GenerateResponse) error {
+		stateless = stateless && resp.GetStateless()
+		return nil
+	}
+	if err := agent.ProcessWithOpenAI(context.Background(), &cassie.GenerateRequest{Blocks: blocks}, sender); err != nil {
+		t.Fatalf("ProcessWithOpenAI failed: %+v", err)
+	}
+	if !stateless {
+		t.Errorf("Expected every response to tell the client the server is stateless")
+	}
+
+	if len(provider.requests) != 2 {
+		t.Fatalf("Expected 2 requests to the model; got %d", len(provider.requests))
+	}
+	for i, r := range provider.requests {
+		if r.PreviousResponseID.Valid() {
+			t.Errorf("Request %d should not set the previous response ID", i)
+		}
+		if !r.Store.Valid() || r.Store.Value {
+			t.Errorf("Request %d should not store the response", i)
+		}
+		// The model isn't configured for reasoning so it isn't asked for encrypted reasoning which it may not support.
+		if d := cmp.Diff([]responses.ResponseIncludable{responses.ResponseIncludableFileSearchCallResults}, r.Include); d != "" {
+			t.Errorf("Unexpected includes in request %d (-want +got):\n%s", i, d)
+		}
+	}
+
+	// The follow-up request should contain the whole conversation including the command that was run.
+	expected := []string{
+		"user: Is the cluster up?\n",
+		"assistant: Yes.\n",
+		"user: What pods are running?\n",
+		"user: ```bash\nkubectl get pods\n```\n```output\npod-1 Running\n\n```\n```output\n\n```\n\n<execution: exit code 0, took 1.5s>\n",
+	}
+	if d := cmp.Diff(expected, historyText(provider.requests[1].Input.OfInputItemList)); d != "" {
+		t.Errorf("Unexpected history (-want +got):\n%s", d)
+	}
+}
+
+func Test_AgentStatelessReasoning(t *testing.T) {
+	provider := &fakeProvider{
+		responses: [][]responses.ResponseStreamEventUnion{
+			append([]responses.ResponseStreamEventUnion{
+				mustEvent(t, map[string]any{"type": "response.created", "response": map[string]any{"id": "resp_1", "model": "o4-mini"}}),
+				mustEvent(t, map[string]any{
+					"type": "response.output_item.done",
+					"item": map[string]any{
+						"type":              "reasoning",
+						"id":                "rs_1",
+						"summary":           []map[string]any{},
+						"encrypted_content": "gAAAA-encrypted",
+					},
+				}),
+			}, shellCallEvents(t, "resp_1", "fc_1", "call_1", "kubectl get pods")[1:]...),
+		},
+	}
+	agent, err := NewAgent(AgentOptions{
+		Provider:          provider,
+		Model:             "o4-mini",
+		Models:            []config.ModelConfig{{Name: "o4-mini", ReasoningEffort: "low"}},
+		Autopilot:         true,
+		AutopilotCommands: []string{"kubectl get"},
+		Runner:            &fakeRunner{},
+		Stateless:         true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create agent: %+v", err)
+	}
+
+	var reasoning *cassie.Block
+	sender := func(resp *cassie.GenerateResponse) error {
+		for _, b := range resp.GetBlocks() {
+			if b.GetKind() == cassie.BlockKind_REASONING {
+				reasoning = b
+			}
+		}
+		return nil
+	}
+	if err := agent.ProcessWithOpenAI(context.Background(), &cassie.GenerateRequest{
+		Blocks: []*cassie.Block{
+			{Id: "user_1", Kind: cassie.BlockKind_MARKUP, Role: cassie.BlockRole_BLOCK_ROLE_USER, Contents: "What pods are running?"},
+		},
+	}, sender); err != nil {
+		t.Fatalf("ProcessWithOpenAI failed: %+v", err)
+	}
+
+	// The reasoning isn't summarized but the client still gets it so it can send it back.
+	if reasoning == nil || reasoning.GetMetadata()[EncryptedReasoningMetadataKey] != "gAAAA-encrypted" {
+		t.Fatalf("Expected the reasoning block to keep the encrypted content; got %v", reasoning)
+	}
+
+	if len(provider.requests) != 2 {
+		t.Fatalf("Expected 2 requests to the model; got %d", len(provider.requests))
+	}
+	for i, r := range provider.requests {
+		if d := cmp.Diff([]responses.ResponseIncludable{responses.ResponseIncludableFileSearchCallResults, responses.ResponseIncludableReasoningEncryptedContent}, r.Include); d != "" {
+			t.Errorf("Unexpected includes in request %d (-want +got):\n%s", i, d)
+		}
+	}
+
+	// The autopilot step gives the model its reasoning back followed by the call it led to.
+	expected := []string{
+		"user: What pods are running?\n",
+		"reasoning: gAAAA-encrypted",
+		`call fc_1 call_1 shell: {"shell":"kubectl get pods"}`,
+		"output call_1: ```bash\nkubectl get pods\n```\n```output\npod-1 Running\n\n```\n```output\n\n```\n\n<execution: exit code 0, took 1.5s>\n",
+	}
+	if d := cmp.Diff(expected, historyText(provider.requests[1].Input.OfInputItemList)); d != "" {
+		t.Errorf("Unexpected history (-want +got):\n%s", d)
+	}
+}
@@ -0,0 +1,280 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/go-logr/zapr"
+	"github.com/jlewi/cloud-assistant/app/pkg/config"
+	"github.com/jlewi/cloud-assistant/protos/gen/cassie"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	// mcpClientName is the name the assistant uses to identify itself to MCP servers.
+	mcpClientName = "cloud-assistant"
+
+	// mcpToolNameSeparator separates the server name from the tool name in the name of the function exposed to the
+	// model. This avoids collisions between tools with the same name on different servers.
+	mcpToolNameSeparator = "__"
+
+	textMimeType = "text/plain"
+	jsonMimeType = "application/json"
+)
+
+var (
+	// invalidToolNameChars matches characters that aren't allowed in function names.
+	invalidToolNameChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+)
+
+// MCPClients manages the connections to the MCP servers.
+type MCPClients struct {
+	sessions []*mcpSession
+}
+
+type mcpSession struct {
+	name    string
+	session *mcp.ClientSession
+}
+
+// ConnectMCPServers connects to the MCP servers. If connecting to any of the servers fails the connections
+// that were already established are closed.
+func ConnectMCPServers(ctx context.Context, servers []config.MCPServerConfig) (*MCPClients, error) {
+	log := zapr.NewLogger(zap.L())
+	c := &MCPClients{
+		sessions: make([]*mcpSession, 0, len(servers)),
+	}
+
+	for _, s := range servers {
+		transport, err := newMCPTransport(s)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+
+		log.Info("Connecting to MCP server", "name", s.Name, "command", s.Command, "url", s.URL)
+		session, err := newMCPClient().Connect(ctx, transport, nil)
+		if err != nil {
+			c.Close()
+			return nil, errors.Wrapf(err, "Failed to connect to MCP server %s", s.Name)
+		}
+		c.sessions = append(c.sessions, &mcpSession{name: s.Name, session: session})
+	}
+	return c, nil
+}
+
+// newMCPClient creates the client used to connect to MCP servers.
+func newMCPClient() *mcp.Client {
+	return mcp.NewClient(&mcp.Implementation{Name: mcpClientName}, nil)
+}
+
+// newMCPTransport creates the transport for the server.
+func newMCPTransport(s config.MCPServerConfig) (mcp.Transport, error) {
+	if s.Command != "" {
+		cmd := exec.Command(s.Command, s.Args...)
+		cmd.Env = os.Environ()
+		for k, v := range s.Env {
+			cmd.Env = append(cmd.Env, k+"="+v)
+		}
+		// Surface the server's logs in the server's logs.
+		cmd.Stderr = os.Stderr
+		return &mcp.CommandTransport{Command: cmd}, nil
+	}
+
+	if s.URL != "" {
+		client := http.DefaultClient
+		if len(s.Headers) > 0 {
+			client = &http.Client{
+				Transport: &headerTransport{headers: s.Headers, base: http.DefaultTransport},
+			}
+		}
+		return &mcp.StreamableClientTransport{Endpoint: s.URL, HTTPClient: client}, nil
+	}
+
+	return nil, errors.Errorf("MCP server %s must set either command or url", s.Name)
+}
+
+// headerTransport adds headers to every request.
+type headerTransport struct {
+	headers map[string]string
+	base    http.RoundTripper
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// Tools lists the tools of all the servers.
+func (c *MCPClients) Tools(ctx context.Context) ([]Tool, error) {
+	tools := make([]Tool, 0, 10)
+	for _, s := range c.sessions {
+		serverTools, err := listMCPTools(ctx, s.name, s.session)
+		if err != nil {
+			return nil, err
+		}
+		tools = append(tools, serverTools...)
+	}
+	return tools, nil
+}
+
+// Close closes the connections to all the servers.
+func (c *MCPClients) Close() {
+	log := zapr.NewLogger(zap.L())
+	for _, s := range c.sessions {
+		if err := s.session.Close(); err != nil {
+			log.Error(err, "Failed to close MCP session", "name", s.name)
+		}
+	}
+}
+
+// listMCPTools returns the tools provided by the server.
+func listMCPTools(ctx context.Context, server string, session *mcp.ClientSession) ([]Tool, error) {
+	tools := make([]Tool, 0, 10)
+	for t, err := range session.Tools(ctx, nil) {
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to list tools of MCP server %s", server)
+		}
+
+		params := map[string]any{}
+		if t.InputSchema != nil {
+			b, err := json.Marshal(t.InputSchema)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Failed to marshal input schema of tool %s", t.Name)
+			}
+			if err := json.Unmarshal(b, &params); err != nil {
+				return nil, errors.Wrapf(err, "Failed to unmarshal input schema of tool %s", t.Name)
+			}
+		}
+
+		tools = append(tools, &MCPTool{
+			name:        mcpToolName(server, t.Name),
+			toolName:    t.Name,
+			description: t.Description,
+			parameters:  params,
+			session:     session,
+		})
+	}
+	return tools, nil
+}
+
+// mcpToolName returns the name of the function exposed to the model for the tool on the server.
+func mcpToolName(server string, tool string) string {
+	name := invalidToolNameChars.ReplaceAllString(server+mcpToolNameSeparator+tool, "_")
+	// Function names are limited to 64 characters.
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
+// MCPTool is a tool provided by an MCP server. Calls are rendered as TOOL_CALL blocks whose contents are the JSON
+// arguments of the call. The server executes the calls and stores the results in the outputs of the block.
+type MCPTool struct {
+	// name is the name of the function exposed to the model.
+	name string
+	// toolName is the name of the tool on the MCP server.
+	toolName    string
+	description string
+	parameters  map[string]any
+	session     *mcp.ClientSession
+}
+
+func (m *MCPTool) Name() string {
+	return m.name
+}
+
+func (m *MCPTool) Description(data PromptData) (string, error) {
+	return m.description, nil
+}
+
+func (m *MCPTool) Parameters() map[string]any {
+	return m.parameters
+}
+
+func (m *MCPTool) BlockKind() cassie.BlockKind {
+	return cassie.BlockKind_TOOL_CALL
+}
+
+func (m *MCPTool) CallToBlock(args string, block *cassie.Block) error {
+	block.Contents = args
+	return nil
+}
+
+func (m *MCPTool) BlockToCall(block *cassie.Block) (string, error) {
+	if strings.TrimSpace(block.Contents) == "" {
+		return "{}", nil
+	}
+	return block.Contents, nil
+}
+
+func (m *MCPTool) BlockToOutput(block *cassie.Block) (string, error) {
+	return outputsToJSON(block)
+}
+
+// Execute calls the tool on the MCP server. Text content is stored as STDOUT; if the server reports that the call
+// failed it is stored as STDERR so the model can tell the difference.
+func (m *MCPTool) Execute(ctx context.Context, block *cassie.Block) error {
+	args, err := m.BlockToCall(block)
+	if err != nil {
+		return err
+	}
+
+	result, err := m.session.CallTool(ctx, &mcp.CallToolParams{
+		Name:      m.toolName,
+		Arguments: json.RawMessage(args),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "Failed to call MCP tool %s", m.toolName)
+	}
+
+	kind := cassie.BlockOutputKind_STDOUT
+	if result.IsError {
+		kind = cassie.BlockOutputKind_STDERR
+	}
+
+	output := &cassie.BlockOutput{
+		Kind:  kind,
+		Items: make([]*cassie.BlockOutputItem, 0, len(result.Content)),
+	}
+
+	for _, c := range result.Content {
+		if text, ok := c.(*mcp.TextContent); ok {
+			output.Items = append(output.Items, &cassie.BlockOutputItem{Mime: textMimeType, TextData: text.Text})
+			continue
+		}
+		if image, ok := c.(*mcp.ImageContent); ok {
+			output.Items = append(output.Items, &cassie.BlockOutputItem{Mime: image.MIMEType, BinaryData: image.Data})
+			continue
+		}
+		// Other content (e.g. audio and resources) is passed to the model as JSON.
+		b, err := json.Marshal(c)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to marshal content returned by MCP tool %s", m.toolName)
+		}
+		output.Items = append(output.Items, &cassie.BlockOutputItem{Mime: jsonMimeType, TextData: string(b)})
+	}
+
+	// Only include the structured content if there isn't any content since servers are supposed to include
+	// the serialized structured content as text for backwards compatibility.
+	if len(output.Items) == 0 && result.StructuredContent != nil {
+		b, err := json.Marshal(result.StructuredContent)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to marshal structured content returned by MCP tool %s", m.toolName)
+		}
+		output.Items = append(output.Items, &cassie.BlockOutputItem{Mime: jsonMimeType, TextData: string(b)})
+	}
+
+	block.Outputs = []*cassie.BlockOutput{output}
+	return nil
+}
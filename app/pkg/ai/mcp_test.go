@@ -0,0 +1,235 @@
+package ai
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jlewi/cloud-assistant/protos/gen/cassie"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openai/openai-go/option"
+	"github.com/openai/openai-go/responses"
+	"google.golang.org/protobuf/testing/protocmp"
+)
+
+// fakeEventStream is an EventStream that returns a fixed list of events.
+type fakeEventStream struct {
+	events []responses.ResponseStreamEventUnion
+	index  int
+	// err is the error returned once the events are exhausted.
+	err error
+}
+
+func (f *fakeEventStream) Next() bool {
+	if f.index >= len(f.events) {
+		return false
+	}
+	f.index++
+	return true
+}
+
+func (f *fakeEventStream) Current() responses.ResponseStreamEventUnion {
+	return f.events[f.index-1]
+}
+
+func (f *fakeEventStream) Err() error {
+	if f.index < len(f.events) {
+		return nil
+	}
+	return f.err
+}
+
+func (f *fakeEventStream) Close() error {
+	return nil
+}
+
+// fakeProvider is a Provider that returns scripted responses and records the requests it receives.
+type fakeProvider struct {
+	responses [][]responses.ResponseStreamEventUnion
+	requests  []responses.ResponseNewParams
+}
+
+func (f *fakeProvider) NewStreaming(ctx context.Context, params responses.ResponseNewParams, opts ...option.RequestOption) EventStream {
+	f.requests = append(f.requests, params)
+	if len(f.responses) == 0 {
+		return &fakeEventStream{}
+	}
+	events := f.responses[0]
+	f.responses = f.responses[1:]
+	return &fakeEventStream{events: events}
+}
+
+type echoArgs struct {
+	Text string `json:"text"`
+}
+
+// startFakeMCPServer starts an in-memory MCP server with an echo tool and returns a session connected to it.
+func startFakeMCPServer(t *testing.T) *mcp.ClientSession {
+	t.Helper()
+	ctx := context.Background()
+	server := mcp.NewServer(&mcp.Implementation{Name: "fake"}, nil)
+	mcp.AddTool(server, &mcp.Tool{Name: "echo", Description: "Echo the text"}, func(ctx context.Context, req *mcp.CallToolRequest, args echoArgs) (*mcp.CallToolResult, any, error) {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: "echo: " + args.Text}},
+		}, nil, nil
+	})
+
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	serverSession, err := server.Connect(ctx, serverTransport, nil)
+	if err != nil {
+		t.Fatalf("Failed to start MCP server: %+v", err)
+	}
+	t.Cleanup(func() { _ = serverSession.Close() })
+
+	session, err := newMCPClient().Connect(ctx, clientTransport, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect to MCP server: %+v", err)
+	}
+	t.Cleanup(func() { _ = session.Close() })
+	return session
+}
+
+func Test_AgentExecutesMCPTools(t *testing.T) {
+	ctx := context.Background()
+	session := startFakeMCPServer(t)
+
+	tools, err := listMCPTools(ctx, "fake", session)
+	if err != nil {
+		t.Fatalf("Failed to list MCP tools: %+v", err)
+	}
+	if len(tools) != 1 || tools[0].Name() != "fake__echo" {
+		t.Fatalf("Unexpected tools: %v", tools)
+	}
+
+	provider := &fakeProvider{
+		responses: [][]responses.ResponseStreamEventUnion{
+			{
+				mustEvent(t, map[string]any{
+					"type":     "response.created",
+					"response": map[string]any{"id": "resp_1", "model": "gpt-4.1"},
+				}),
+				mustEvent(t, map[string]any{
+					"type": "response.output_item.added",
+					"item": map[string]any{"type": "function_call", "id": "fc_1", "call_id": "call_1", "name": "fake__echo"},
+				}),
+				mustEvent(t, map[string]any{
+					"type":      "response.function_call_arguments.done",
+					"item_id":   "fc_1",
+					"arguments": `{"text":"hello"}`,
+				}),
+			},
+			{
+				mustEvent(t, map[string]any{
+					"type":     "response.created",
+					"response": map[string]any{"id": "resp_2", "model": "gpt-4.1"},
+				}),
+				mustEvent(t, map[string]any{
+					"type":    "response.output_text.delta",
+					"item_id": "msg_1",
+					"delta":   "The tool said hello",
+				}),
+			},
+		},
+	}
+
+	agent, err := NewAgent(AgentOptions{
+		Provider: provider,
+		Tools:    tools,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create agent: %+v", err)
+	}
+
+	// Keep the last version of every block we were sent.
+	sent := make(map[string]*cassie.Block)
+	sender := func(resp *cassie.GenerateResponse) error {
+		for _, b := range resp.Blocks {
+			sent[b.Id] = b
+		}
+		return nil
+	}
+
+	req := &cassie.GenerateRequest{
+		Blocks: []*cassie.Block{
+			{
+				Id:       "user_1",
+				Kind:     cassie.BlockKind_MARKUP,
+				Role:     cassie.BlockRole_BLOCK_ROLE_USER,
+				Contents: "Say hello",
+			},
+		},
+	}
+
+	if err := agent.ProcessWithOpenAI(ctx, req, sender); err != nil {
+		t.Fatalf("ProcessWithOpenAI failed: %+v", err)
+	}
+
+	expected := map[string]*cassie.Block{
+		"fc_1": {
+			Id:       "fc_1",
+			Kind:     cassie.BlockKind_TOOL_CALL,
+			Role:     cassie.BlockRole_BLOCK_ROLE_ASSISTANT,
+			Contents: `{"text":"hello"}`,
+			CallId:   "call_1",
+			Metadata: map[string]string{ToolNameMetadataKey: "fake__echo"},
+			Outputs: []*cassie.BlockOutput{
+				{
+					Kind:  cassie.BlockOutputKind_STDOUT,
+					Items: []*cassie.BlockOutputItem{{Mime: textMimeType, TextData: "echo: hello"}},
+				},
+			},
+		},
+		"msg_1": {
+			Id:       "msg_1",
+			Kind:     cassie.BlockKind_MARKUP,
+			Role:     cassie.BlockRole_BLOCK_ROLE_ASSISTANT,
+			Contents: "The tool said hello",
+		},
+	}
+
+	if d := cmp.Diff(expected, sent, protocmp.Transform()); d != "" {
+		t.Errorf("Unexpected blocks (-want +got):\n%s", d)
+	}
+
+	if len(provider.requests) != 2 {
+		t.Fatalf("Expected 2 requests to the model; got %d", len(provider.requests))
+	}
+
+	followUp := provider.requests[1]
+	if followUp.PreviousResponseID.Value != "resp_1" {
+		t.Errorf("Expected previous response ID resp_1; got %q", followUp.PreviousResponseID.Value)
+	}
+
+	var output *responses.ResponseInputItemFunctionCallOutputParam
+	for _, item := range followUp.Input.OfInputItemList {
+		if item.OfFunctionCallOutput != nil {
+			output = item.OfFunctionCallOutput
+		}
+	}
+	if output == nil {
+		t.Fatalf("Follow up request doesn't contain the output of the tool call")
+	}
+	if output.CallID != "call_1" {
+		t.Errorf("Expected output for call_1; got %q", output.CallID)
+	}
+	if output.Output != `{"STDOUT":"echo: hello"}` {
+		t.Errorf("Unexpected output %q", output.Output)
+	}
+}
+
+func TestMCPToolName(t *testing.T) {
+	tests := []struct {
+		server   string
+		tool     string
+		expected string
+	}{
+		{server: "github", tool: "list_issues", expected: "github__list_issues"},
+		{server: "my.server", tool: "get/pods", expected: "my_server__get_pods"},
+	}
+
+	for _, tc := range tests {
+		if actual := mcpToolName(tc.server, tc.tool); actual != tc.expected {
+			t.Errorf("Want %q; got %q", tc.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package ai
+
+import (
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"strings"
+
+	"github.com/jlewi/cloud-assistant/protos/gen/cassie"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/responses"
+)
+
+// DefaultMaxMediaBytes is the default maximum size of an image or file sent to the model.
+const DefaultMaxMediaBytes = 10 << 20
+
+// DefaultMediaMimeTypes are the MIME types of the images and files sent to the model by default. They are the
+// image types the vision models accept and PDFs.
+var DefaultMediaMimeTypes = []string{"image/png", "image/jpeg", "image/gif", "image/webp", "application/pdf"}
+
+// mediaPolicy decides which images and files in blocks are sent to the model and converts them to input content.
+type mediaPolicy struct {
+	disabled bool
+	maxBytes int
+	// allowed are the allowed MIME types; a type ending in "/*" allows all its subtypes.
+	allowed []string
+}
+
+// newMediaPolicy creates a policy. If maxBytes is zero DefaultMaxMediaBytes is used and if mimeTypes is empty
+// DefaultMediaMimeTypes is used.
+func newMediaPolicy(maxBytes int, mimeTypes []string, disabled bool) *mediaPolicy {
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxMediaBytes
+	}
+	if len(mimeTypes) == 0 {
+		mimeTypes = DefaultMediaMimeTypes
+	}
+	return &mediaPolicy{
+		disabled: disabled,
+		maxBytes: maxBytes,
+		allowed:  mimeTypes,
+	}
+}
+
+// isAllowed returns true if items of the MIME type can be sent to the model.
+func (p *mediaPolicy) isAllowed(mimeType string) bool {
+	for _, a := range p.allowed {
+		if a == mimeType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(a, "/*"); ok && strings.HasPrefix(mimeType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// mediaItems returns the items of the block that aren't text: the files attached by the user followed by the
+// binary outputs.
+func mediaItems(b *cassie.Block) []*cassie.BlockOutputItem {
+	items := make([]*cassie.BlockOutputItem, 0, len(b.GetAttachments()))
+	items = append(items, b.GetAttachments()...)
+	for _, o := range b.GetOutputs() {
+		for _, item := range o.GetItems() {
+			if len(item.GetBinaryData()) > 0 {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+// content converts the items into input content for the model. Images are sent as image inputs and other files
+// as file inputs. Items that aren't allowed are replaced with a note so the model knows something was omitted.
+func (p *mediaPolicy) content(items []*cassie.BlockOutputItem) []responses.ResponseInputContentUnionParam {
+	content := make([]responses.ResponseInputContentUnionParam, 0, len(items))
+	for _, item := range items {
+		mimeType, _, err := mime.ParseMediaType(item.GetMime())
+		if err != nil {
+			mimeType = item.GetMime()
+		}
+		name := item.GetName()
+		if name == "" {
+			name = defaultFilename(mimeType)
+		}
+
+		size := len(item.GetBinaryData())
+		if note := p.omitted(mimeType, size); note != "" {
+			content = append(content, responses.ResponseInputContentParamOfInputText(fmt.Sprintf("<%s (%s, %d bytes) was omitted: %s>", name, mimeType, size, note)))
+			continue
+		}
+
+		dataURL := "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(item.GetBinaryData())
+		if strings.HasPrefix(mimeType, "image/") {
+			content = append(content, responses.ResponseInputContentUnionParam{
+				OfInputImage: &responses.ResponseInputImageParam{
+					Detail:   responses.ResponseInputImageDetailAuto,
+					ImageURL: openai.Opt(dataURL),
+				},
+			})
+			continue
+		}
+		content = append(content, responses.ResponseInputContentUnionParam{
+			OfInputFile: &responses.ResponseInputFileParam{
+				FileData: openai.Opt(dataURL),
+				Filename: openai.Opt(name),
+			},
+		})
+	}
+	return content
+}
+
+// omitted returns the reason an item can't be sent to the model or an empty string if it can be.
+func (p *mediaPolicy) omitted(mimeType string, size int) string {
+	switch {
+	case p.disabled:
+		return "images and files are disabled"
+	case !p.isAllowed(mimeType):
+		return "the MIME type isn't allowed"
+	case size > p.maxBytes:
+		return fmt.Sprintf("it is larger than the limit of %d bytes", p.maxBytes)
+	}
+	return ""
+}
+
+// mediaMessage returns a user message containing text followed by the items. ok is false if there are no items.
+func (p *mediaPolicy) mediaMessage(text string, items []*cassie.BlockOutputItem) (responses.ResponseInputItemUnionParam, bool) {
+	if len(items) == 0 {
+		return responses.ResponseInputItemUnionParam{}, false
+	}
+	content := make(responses.ResponseInputMessageContentListParam, 0, len(items)+1)
+	if text != "" {
+		content = append(content, responses.ResponseInputContentParamOfInputText(text))
+	}
+	content = append(content, p.content(items)...)
+	return responses.ResponseInputItemUnionParam{
+		OfMessage: &responses.EasyInputMessageParam{
+			Role: responses.EasyInputMessageRoleUser,
+			Content: responses.EasyInputMessageContentUnionParam{
+				OfInputItemContentList: content,
+			},
+		},
+	}, true
+}
+
+// defaultFilename returns a name for an item that doesn't have one based on its MIME type.
+func defaultFilename(mimeType string) string {
+	exts, err := mime.ExtensionsByType(mimeType)
+	if err != nil || len(exts) == 0 {
+		return "attachment"
+	}
+	return "attachment" + exts[0]
+}
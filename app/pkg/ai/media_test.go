@@ -0,0 +1,80 @@
+package ai
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jlewi/cloud-assistant/protos/gen/cassie"
+	"github.com/openai/openai-go/responses"
+)
+
+func Test_MediaInputs(t *testing.T) {
+	provider := &fakeProvider{
+		responses: [][]responses.ResponseStreamEventUnion{
+			textEvents(t, "resp_1", "msg_1", "The p99 latency spiked at 10:00."),
+		},
+	}
+	agent, err := NewAgent(AgentOptions{Provider: provider, MaxMediaBytes: 4, MediaMimeTypes: []string{"image/*"}})
+	if err != nil {
+		t.Fatalf("Failed to create agent: %+v", err)
+	}
+
+	if err := agent.ProcessWithOpenAI(context.Background(), &cassie.GenerateRequest{
+		Blocks: []*cassie.Block{
+			{
+				Id:       "user_1",
+				Kind:     cassie.BlockKind_MARKUP,
+				Role:     cassie.BlockRole_BLOCK_ROLE_USER,
+				Contents: "Why is latency high?",
+				Attachments: []*cassie.BlockOutputItem{
+					{Mime: "image/jpeg", Name: "screenshot.jpg", BinaryData: []byte("jpg")},
+					{Mime: "application/pdf", Name: "runbook.pdf", BinaryData: []byte("pdf")},
+				},
+			},
+			{
+				Id:       "cell_1",
+				Kind:     cassie.BlockKind_CODE,
+				Role:     cassie.BlockRole_BLOCK_ROLE_USER,
+				Contents: "grafana-snapshot latency",
+				Outputs: []*cassie.BlockOutput{
+					{
+						Kind: cassie.BlockOutputKind_STDOUT,
+						Items: []*cassie.BlockOutputItem{
+							{Mime: textMimeType, TextData: "saved 2 panels"},
+							{Mime: "image/png", BinaryData: []byte("png")},
+							{Mime: "image/png", BinaryData: []byte("too large")},
+						},
+					},
+				},
+			},
+		},
+	}, NullOpSender); err != nil {
+		t.Fatalf("ProcessWithOpenAI failed: %+v", err)
+	}
+
+	input := provider.requests[0].Input.OfInputItemList
+	actual := make([]string, 0, len(input))
+	for _, item := range input {
+		switch {
+		case item.OfFunctionCall != nil:
+			actual = append(actual, "call: "+item.OfFunctionCall.Arguments)
+		case item.OfFunctionCallOutput != nil:
+			actual = append(actual, "output: "+item.OfFunctionCallOutput.Output)
+		default:
+			// The call ID of the cell is generated so it is removed from the text.
+			text := historyText([]responses.ResponseInputItemUnionParam{item})[0]
+			actual = append(actual, strings.Replace(text, input[1].OfFunctionCall.CallID, "<call>", 1))
+		}
+	}
+	expected := []string{
+		"user: Why is latency high?<image data:image/jpeg;base64,anBn><runbook.pdf (application/pdf, 3 bytes) was omitted: the MIME type isn't allowed>",
+		`call: {"shell":"grafana-snapshot latency"}`,
+		`output: {"STDOUT":"saved 2 panels"}`,
+		"user: Images and files output by call <call>:<image data:image/png;base64,cG5n><attachment.png (image/png, 9 bytes) was omitted: it is larger than the limit of 4 bytes>",
+	}
+	if d := cmp.Diff(expected, actual); d != "" {
+		t.Errorf("Unexpected input (-want +got):\n%s", d)
+	}
+}
@@ -0,0 +1,77 @@
+package ai
+
+import (
+	"bytes"
+	"text/template"
+
+	"github.com/jlewi/cloud-assistant/app/pkg/reload"
+	"github.com/pkg/errors"
+)
+
+// PromptData is the data available to the instructions and tool description templates.
+//
+// For example
+//
+//	You are assisting {{.Principal}} on {{.Date}}. The default cluster is {{.Values.cluster}}.
+type PromptData struct {
+	// Principal is the user making the request as determined from their ID token. Empty if OIDC isn't enabled.
+	Principal string
+	// ServerName is the name of the server taken from the Metadata.Name in the configuration.
+	ServerName string
+	// Date is the current date in YYYY-MM-DD format.
+	Date string
+	// Values are custom key/values from the configuration.
+	Values map[string]string
+}
+
+// promptTemplate is a text/template that is optionally backed by a file.
+// If it is backed by a file the template is reloaded whenever the file changes on disk.
+type promptTemplate struct {
+	name string
+	// tmpl is the template if it isn't backed by a file.
+	tmpl *template.Template
+	// file is the file containing the template. Nil if the template isn't backed by a file.
+	file *reload.File[*template.Template]
+}
+
+// newPromptTemplate creates a template from text.
+func newPromptTemplate(name string, text string) (*promptTemplate, error) {
+	tmpl, err := parsePromptTemplate(name, text)
+	if err != nil {
+		return nil, err
+	}
+	return &promptTemplate{name: name, tmpl: tmpl}, nil
+}
+
+// newPromptTemplateFromFile creates a template from a file.
+func newPromptTemplateFromFile(name string, path string) (*promptTemplate, error) {
+	file, err := reload.NewFile(path, func(data []byte) (*template.Template, error) {
+		return parsePromptTemplate(name, string(data))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &promptTemplate{name: name, file: file}, nil
+}
+
+func parsePromptTemplate(name string, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse template %s", name)
+	}
+	return tmpl, nil
+}
+
+// Render executes the template with the given data.
+func (t *promptTemplate) Render(data PromptData) (string, error) {
+	tmpl := t.tmpl
+	if t.file != nil {
+		tmpl = t.file.Get()
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", errors.Wrapf(err, "Failed to render template %s", t.name)
+	}
+	return buf.String(), nil
+}
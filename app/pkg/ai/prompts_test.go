@@ -0,0 +1,73 @@
+package ai
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPromptTemplate_Render(t *testing.T) {
+	tmpl, err := newPromptTemplate("test", "Hello {{.Principal}} from {{.ServerName}} on {{.Date}}. Cluster: {{.Values.cluster}}. Missing: '{{.Values.missing}}'")
+	if err != nil {
+		t.Fatalf("Failed to create template: %+v", err)
+	}
+
+	actual, err := tmpl.Render(PromptData{
+		Principal:  "alice@acme.com",
+		ServerName: "cassie",
+		Date:       "2025-01-02",
+		Values:     map[string]string{"cluster": "prod-1"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to render template: %+v", err)
+	}
+
+	expected := "Hello alice@acme.com from cassie on 2025-01-02. Cluster: prod-1. Missing: ''"
+	if actual != expected {
+		t.Errorf("Want:\n%s\nGot:\n%s", expected, actual)
+	}
+}
+
+func TestPromptTemplate_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "instructions.md")
+	if err := os.WriteFile(path, []byte("v1 {{.Principal}}"), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %+v", err)
+	}
+
+	tmpl, err := newPromptTemplateFromFile("instructions", path)
+	if err != nil {
+		t.Fatalf("Failed to create template: %+v", err)
+	}
+
+	data := PromptData{Principal: "bob"}
+	if actual, err := tmpl.Render(data); err != nil || actual != "v1 bob" {
+		t.Fatalf("Want v1 bob; got %q, %v", actual, err)
+	}
+
+	// Update the file and make sure the modification time changes even on filesystems with coarse timestamps.
+	if err := os.WriteFile(path, []byte("v2 {{.Principal}}"), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %+v", err)
+	}
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatalf("Failed to update modification time: %+v", err)
+	}
+
+	if actual, err := tmpl.Render(data); err != nil || actual != "v2 bob" {
+		t.Fatalf("Want v2 bob; got %q, %v", actual, err)
+	}
+
+	// A broken template should keep the last good version.
+	if err := os.WriteFile(path, []byte("v3 {{.Principal"), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %+v", err)
+	}
+	future = future.Add(time.Minute)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatalf("Failed to update modification time: %+v", err)
+	}
+
+	if actual, err := tmpl.Render(data); err != nil || actual != "v2 bob" {
+		t.Fatalf("Want v2 bob; got %q, %v", actual, err)
+	}
+}
@@ -0,0 +1,116 @@
+package ai
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/jlewi/cloud-assistant/app/pkg/config"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"github.com/openai/openai-go/responses"
+	"github.com/pkg/errors"
+)
+
+// Provider is the interface the Agent uses to talk to an LLM backend.
+//
+// The request and the streamed events use the Responses API types. The Responses API is the richest API we
+// support so we use it as the lingua franca; providers for other APIs are responsible for translating to and from it.
+// This lets the Agent and the BlocksBuilder stay agnostic to the backend.
+type Provider interface {
+	// NewStreaming starts a new streaming request.
+	NewStreaming(ctx context.Context, params responses.ResponseNewParams, opts ...option.RequestOption) EventStream
+}
+
+// EventStream is a stream of Responses API events.
+// It is satisfied by *ssestream.Stream[responses.ResponseStreamEventUnion].
+type EventStream interface {
+	Next() bool
+	Current() responses.ResponseStreamEventUnion
+	Err() error
+	Close() error
+}
+
+// ResponsesProvider is a Provider that uses the OpenAI Responses API.
+type ResponsesProvider struct {
+	client *openai.Client
+}
+
+// NewResponsesProvider creates a provider that uses the OpenAI Responses API.
+func NewResponsesProvider(client *openai.Client) *ResponsesProvider {
+	return &ResponsesProvider{client: client}
+}
+
+func (p *ResponsesProvider) NewStreaming(ctx context.Context, params responses.ResponseNewParams, opts ...option.RequestOption) EventStream {
+	return p.client.Responses.NewStreaming(ctx, params, opts...)
+}
+
+// Cancel cancels a response. The Responses API only cancels responses created in background mode; for other
+// responses an error is returned and closing the stream is what stops the generation.
+func (p *ResponsesProvider) Cancel(ctx context.Context, responseID string, opts ...option.RequestOption) error {
+	if err := p.client.Post(ctx, "responses/"+url.PathEscape(responseID)+"/cancel", nil, nil, opts...); err != nil {
+		return errors.Wrapf(err, "Failed to cancel response %s", responseID)
+	}
+	return nil
+}
+
+// NewProvider creates the Provider configured for this deployment.
+func NewProvider(cfg config.Config, history ChatHistoryStore) (Provider, error) {
+	return newProvider(cfg, cfg.CloudAssistant.GetProvider(), history)
+}
+
+// NewFallbacks creates the fallbacks configured in cfg.CloudAssistant.Resilience. Fallbacks on the primary provider
+// share its Provider.
+func NewFallbacks(cfg config.Config, history ChatHistoryStore) ([]Fallback, error) {
+	if cfg.CloudAssistant == nil || cfg.CloudAssistant.Resilience == nil {
+		return nil, nil
+	}
+	primary := cfg.CloudAssistant.GetProvider()
+	providers := make(map[string]Provider)
+	fallbacks := make([]Fallback, 0, len(cfg.CloudAssistant.Resilience.Fallbacks))
+	for _, f := range cfg.CloudAssistant.Resilience.Fallbacks {
+		fallback := Fallback{Model: f.Model}
+		if f.Provider != "" && f.Provider != primary {
+			p, ok := providers[f.Provider]
+			if !ok {
+				var err error
+				p, err = newProvider(cfg, f.Provider, history)
+				if err != nil {
+					return nil, errors.Wrapf(err, "Failed to create provider %s for fallback model %s", f.Provider, f.Model)
+				}
+				providers[f.Provider] = p
+			}
+			fallback.Provider = p
+			fallback.ProviderName = f.Provider
+		}
+		fallbacks = append(fallbacks, fallback)
+	}
+	return fallbacks, nil
+}
+
+// newProvider creates the provider with the given name. Its client doesn't retry failed requests since the Agent
+// retries failed attempts and falls back to other models itself; retrying in the client as well would retry a rate
+// limited model for about a minute before falling back.
+func newProvider(cfg config.Config, name string, history ChatHistoryStore) (Provider, error) {
+	switch name {
+	case config.ProviderOpenAI:
+		if cfg.OpenAI == nil {
+			return nil, errors.New("openai must be configured when using the openai provider")
+		}
+		client, err := NewClient(*cfg.OpenAI, withoutRetries()...)
+		if err != nil {
+			return nil, err
+		}
+		return NewResponsesProvider(client), nil
+	case config.ProviderChatCompletions:
+		if cfg.ChatCompletions == nil {
+			return nil, errors.New("chatCompletions must be configured when using the chatCompletions provider")
+		}
+		client, err := NewChatCompletionsClient(*cfg.ChatCompletions, withoutRetries()...)
+		if err != nil {
+			return nil, err
+		}
+		return NewChatCompletionsProvider(client, cfg.ChatCompletions.Model, history)
+	default:
+		return nil, errors.Errorf("Unsupported provider %s", name)
+	}
+}
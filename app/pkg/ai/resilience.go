@@ -0,0 +1,266 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/jlewi/cloud-assistant/app/pkg/config"
+	"github.com/jlewi/cloud-assistant/app/pkg/logs"
+	"github.com/jlewi/cloud-assistant/protos/gen/cassie"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"github.com/openai/openai-go/packages/param"
+	"github.com/openai/openai-go/responses"
+	"github.com/openai/openai-go/shared"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultMaxAttempts is the number of attempts on each model if no limit is configured.
+	DefaultMaxAttempts = 2
+	// DefaultRetryBackoff is the delay before the first retry if none is configured.
+	DefaultRetryBackoff = time.Second
+
+	// RetractedMetadataKey is the key in Block.Metadata that marks a block streamed by an attempt that failed.
+	// Clients should remove the block; the next attempt streams the response again with new blocks.
+	RetractedMetadataKey = "cloudassistant.io/retracted"
+)
+
+// Fallback is a model to use when the model of a request is rate limited or unavailable.
+type Fallback struct {
+	Model string
+	// Provider serves the model. If nil the agent's provider is used.
+	Provider Provider
+	// ProviderName is the name of Provider e.g. config.ProviderChatCompletions. It is reported in
+	// GenerateResponse.attempt.
+	ProviderName string
+}
+
+// target is a model and the provider to attempt a generation with.
+type target struct {
+	provider     Provider
+	providerName string
+	model        config.ModelConfig
+	fallback     bool
+	// opts are the request options to use with the provider.
+	opts []option.RequestOption
+}
+
+// failure classifies why an attempt failed.
+type failure string
+
+const (
+	// failurePermanent errors would fail again e.g. invalid requests.
+	failurePermanent failure = "permanent"
+	// failureTransient errors are worth retrying on the same model e.g. 5xx or the stream being dropped.
+	failureTransient failure = "transient"
+	// failureRateLimited means the model is rate limited so the next fallback is tried rather than retrying.
+	failureRateLimited failure = "rateLimited"
+)
+
+// responseFailedError is the error for a response.failed event.
+type responseFailedError struct {
+	code    string
+	message string
+}
+
+func (e *responseFailedError) Error() string {
+	return fmt.Sprintf("Response failed: %s: %s", e.code, e.message)
+}
+
+// classifyFailure classifies the error an attempt failed with.
+func classifyFailure(err error) failure {
+	var apiErr *openai.Error
+	if errors.As(err, &apiErr) {
+		switch {
+		case apiErr.StatusCode == http.StatusTooManyRequests:
+			return failureRateLimited
+		case apiErr.StatusCode >= 500, apiErr.StatusCode == http.StatusRequestTimeout:
+			return failureTransient
+		default:
+			return failurePermanent
+		}
+	}
+
+	var failed *responseFailedError
+	if errors.As(err, &failed) {
+		return classifyErrorCode(failed.code)
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return failureTransient
+	}
+
+	// The SDK reports error events in the stream as a plain error containing the JSON of the error.
+	if msg := err.Error(); strings.Contains(msg, "received error while streaming") {
+		return classifyErrorCode(msg)
+	}
+	return failurePermanent
+}
+
+// classifyErrorCode classifies an error code from the Responses API. code can also be a message containing the code.
+func classifyErrorCode(code string) failure {
+	switch {
+	case strings.Contains(code, "rate_limit"):
+		return failureRateLimited
+	case strings.Contains(code, "server_error"), code == "":
+		return failureTransient
+	default:
+		return failurePermanent
+	}
+}
+
+// targets returns the models to attempt a generation with in order. Fallbacks on a different provider are skipped
+// if the request continues a previous response since providers don't share stored responses.
+func (a *Agent) targets(ctx context.Context, primary config.ModelConfig, opts []option.RequestOption, continuing bool) []target {
+	log := logs.FromContext(ctx)
+	targets := []target{{provider: a.provider, providerName: a.providerName, model: primary, opts: opts}}
+	for _, f := range a.fallbacks {
+		t := target{provider: a.provider, providerName: a.providerName, fallback: true, opts: opts}
+		if f.Provider != nil {
+			if continuing {
+				log.V(logs.Debug).Info("Skipping fallback on a different provider for a request that continues a previous response", "model", f.Model, "provider", f.ProviderName)
+				continue
+			}
+			t.provider = f.Provider
+			t.providerName = f.ProviderName
+			// The options can contain the user's OpenAI access token which mustn't be sent to another provider.
+			t.opts = nil
+		} else if f.Model == primary.Name {
+			continue
+		}
+		m, ok := a.models[f.Model]
+		if !ok {
+			m = config.ModelConfig{Name: f.Model}
+		}
+		t.model = m
+		targets = append(targets, t)
+	}
+	return targets
+}
+
+// streamResponse streams the response to params. Attempts that fail with a transient error are retried and when a
+// model is rate limited or keeps failing the fallbacks are tried in order. Blocks streamed by a failed attempt are
+// retracted so the client doesn't show them twice. It returns the builder of the last attempt.
+func (a *Agent) streamResponse(ctx context.Context, params responses.ResponseNewParams, opts []option.RequestOption, modelCfg config.ModelConfig, sender BlockSender, gen *generation) (*BlocksBuilder, error) {
+	log := logs.FromContext(ctx)
+	previousResponseID := params.PreviousResponseID.Value
+
+	var builder *BlocksBuilder
+	var err error
+	number := 0
+	for _, t := range a.targets(ctx, modelCfg, opts, params.PreviousResponseID.Valid()) {
+		applyModelConfig(&params, t.model)
+		for try := 0; try < a.maxAttempts; try++ {
+			if try > 0 {
+				select {
+				case <-ctx.Done():
+					return builder, err
+				case <-time.After(a.retryBackoff << (try - 1)):
+				}
+			}
+			number++
+			builder = NewBlocksBuilder(a.fileToLink, a.store, t.model.Name, a.tools)
+			builder.attempt = &cassie.Attempt{
+				Number:   int32(number),
+				Model:    t.model.Name,
+				Provider: t.providerName,
+				Fallback: t.fallback,
+			}
+			builder.onResponseID = func(responseID string) {
+				a.generations.addResponse(gen, responseID, t.provider, t.opts)
+			}
+
+			// Only log metadata; the input contains the user's messages and the outputs of their commands.
+			log.Info("ResponseRequest", "attempt", number, "provider", t.providerName, "model", params.Model, "previousResponseId", params.PreviousResponseID.Value, "numInputItems", len(params.Input.OfInputItemList), "numTools", len(params.Tools))
+			err = builder.HandleEvents(ctx, t.provider.NewStreaming(ctx, params, t.opts...), sender)
+			a.recordUsage(ctx, builder)
+			if err == nil || ctx.Err() != nil {
+				return builder, err
+			}
+
+			f := classifyFailure(err)
+			log.Info("Generation attempt failed", "attempt", number, "model", t.model.Name, "provider", t.providerName, "failure", f, "err", err.Error())
+			if f == failurePermanent {
+				return builder, err
+			}
+			if err := retract(builder, previousResponseID, sender); err != nil {
+				return builder, err
+			}
+			if f == failureRateLimited {
+				break
+			}
+		}
+	}
+	return builder, connect.NewError(connect.CodeUnavailable, errors.Wrapf(err, "All %d attempts to generate a response failed", number))
+}
+
+// retract tells the client to remove the blocks streamed by a failed attempt. The response ID is reset to the
+// previous response so a client that gives up continues from there rather than from the failed response.
+func retract(builder *BlocksBuilder, previousResponseID string, sender BlockSender) error {
+	blocks := builder.orderedBlocks()
+	if len(blocks) == 0 {
+		return nil
+	}
+	resp := &cassie.GenerateResponse{
+		ResponseId: previousResponseID,
+		Blocks:     make([]*cassie.Block, 0, len(blocks)),
+	}
+	for _, b := range blocks {
+		resp.Blocks = append(resp.Blocks, &cassie.Block{
+			Id:       b.GetId(),
+			Kind:     b.GetKind(),
+			Role:     b.GetRole(),
+			Metadata: map[string]string{RetractedMetadataKey: "true"},
+		})
+	}
+	if err := sender(resp); err != nil {
+		return connect.NewError(connect.CodeInternal, errors.Wrapf(err, "Failed to send response to client"))
+	}
+	return nil
+}
+
+// applyModelConfig sets the model and its parameters on the request replacing those of any other model.
+func applyModelConfig(params *responses.ResponseNewParams, m config.ModelConfig) {
+	params.Model = m.Name
+	params.Temperature = param.Opt[float64]{}
+	params.MaxOutputTokens = param.Opt[int64]{}
+	params.Reasoning = shared.ReasoningParam{}
+
+	if m.Temperature != nil {
+		params.Temperature = openai.Opt(*m.Temperature)
+	}
+
+	if m.MaxOutputTokens > 0 {
+		params.MaxOutputTokens = openai.Opt(m.MaxOutputTokens)
+	}
+
+	if m.ReasoningEffort != "" {
+		params.Reasoning.Effort = shared.ReasoningEffort(m.ReasoningEffort)
+	}
+
+	if m.ReasoningSummary != "" {
+		params.Reasoning.Summary = shared.ReasoningSummary(m.ReasoningSummary)
+	}
+
+	// Without a stored response the model can only get its reasoning back from the encrypted content. Only
+	// reasoning models support it so it's only requested for models configured for reasoning.
+	include := make([]responses.ResponseIncludable, 0, len(params.Include)+1)
+	for _, i := range params.Include {
+		if i != responses.ResponseIncludableReasoningEncryptedContent {
+			include = append(include, i)
+		}
+	}
+	stateless := params.Store.Valid() && !params.Store.Value
+	if stateless && (m.ReasoningEffort != "" || m.ReasoningSummary != "") {
+		include = append(include, responses.ResponseIncludableReasoningEncryptedContent)
+	}
+	params.Include = include
+}
@@ -0,0 +1,250 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/jlewi/cloud-assistant/app/pkg/config"
+	"github.com/jlewi/cloud-assistant/protos/gen/cassie"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"github.com/openai/openai-go/responses"
+	"google.golang.org/protobuf/testing/protocmp"
+)
+
+// scriptedProvider returns the scripted streams in order and records the models requested.
+type scriptedProvider struct {
+	streams []*fakeEventStream
+	models  []string
+}
+
+func (p *scriptedProvider) NewStreaming(ctx context.Context, params responses.ResponseNewParams, opts ...option.RequestOption) EventStream {
+	p.models = append(p.models, params.Model)
+	s := p.streams[0]
+	p.streams = p.streams[1:]
+	return s
+}
+
+// apiError returns the error the SDK returns for a response with the given status code.
+func apiError(status int) error {
+	return &openai.Error{
+		StatusCode: status,
+		Request:    httptest.NewRequest(http.MethodPost, "https://api.openai.com/v1/responses", nil),
+		Response:   &http.Response{StatusCode: status},
+	}
+}
+
+// textEvents are the events for a response containing a text message.
+func textEvents(t *testing.T, respID string, itemID string, text string) []responses.ResponseStreamEventUnion {
+	t.Helper()
+	return []responses.ResponseStreamEventUnion{
+		mustEvent(t, map[string]any{
+			"type":     "response.created",
+			"response": map[string]any{"id": respID, "model": "gpt-4.1"},
+		}),
+		mustEvent(t, map[string]any{
+			"type":    "response.output_text.delta",
+			"item_id": itemID,
+			"delta":   text,
+		}),
+	}
+}
+
+func Test_GenerateRetries(t *testing.T) {
+	type testCase struct {
+		name      string
+		streams   func(t *testing.T) []*fakeEventStream
+		fallbacks []Fallback
+		// expectedModels are the models requested by each attempt.
+		expectedModels []string
+		// expectedCode is the code of the error if the generation fails.
+		expectedCode connect.Code
+		// expectedAttempt is the attempt of the last response sent.
+		expectedAttempt *cassie.Attempt
+		// expectedRetracted are the IDs of the blocks retracted.
+		expectedRetracted []string
+	}
+
+	cases := []testCase{
+		{
+			name: "stream-dropped",
+			streams: func(t *testing.T) []*fakeEventStream {
+				return []*fakeEventStream{
+					{events: textEvents(t, "resp_1", "msg_1", "Hel"), err: io.ErrUnexpectedEOF},
+					{events: textEvents(t, "resp_2", "msg_2", "Hello")},
+				}
+			},
+			expectedModels:    []string{"gpt-4.1", "gpt-4.1"},
+			expectedAttempt:   &cassie.Attempt{Number: 2, Model: "gpt-4.1", Provider: "openai"},
+			expectedRetracted: []string{"msg_1"},
+		},
+		{
+			name: "rate-limited",
+			streams: func(t *testing.T) []*fakeEventStream {
+				return []*fakeEventStream{
+					{err: apiError(http.StatusTooManyRequests)},
+					{events: textEvents(t, "resp_1", "msg_1", "Hello")},
+				}
+			},
+			fallbacks:       []Fallback{{Model: "gpt-4.1-mini"}},
+			expectedModels:  []string{"gpt-4.1", "gpt-4.1-mini"},
+			expectedAttempt: &cassie.Attempt{Number: 2, Model: "gpt-4.1-mini", Provider: "openai", Fallback: true},
+		},
+		{
+			name: "server-errors-then-fallback",
+			streams: func(t *testing.T) []*fakeEventStream {
+				failed := mustEvent(t, map[string]any{
+					"type":     "response.failed",
+					"response": map[string]any{"id": "resp_2", "error": map[string]any{"code": "server_error", "message": "boom"}},
+				})
+				return []*fakeEventStream{
+					{err: apiError(http.StatusServiceUnavailable)},
+					{events: []responses.ResponseStreamEventUnion{failed}},
+					{events: textEvents(t, "resp_3", "msg_3", "Hello")},
+				}
+			},
+			fallbacks:       []Fallback{{Model: "gpt-4.1-mini"}},
+			expectedModels:  []string{"gpt-4.1", "gpt-4.1", "gpt-4.1-mini"},
+			expectedAttempt: &cassie.Attempt{Number: 3, Model: "gpt-4.1-mini", Provider: "openai", Fallback: true},
+		},
+		{
+			name: "invalid-request",
+			streams: func(t *testing.T) []*fakeEventStream {
+				return []*fakeEventStream{{err: apiError(http.StatusBadRequest)}}
+			},
+			fallbacks:      []Fallback{{Model: "gpt-4.1-mini"}},
+			expectedModels: []string{"gpt-4.1"},
+			expectedCode:   connect.CodeInternal,
+		},
+		{
+			name: "all-attempts-fail",
+			streams: func(t *testing.T) []*fakeEventStream {
+				return []*fakeEventStream{
+					{err: apiError(http.StatusInternalServerError)},
+					{err: apiError(http.StatusInternalServerError)},
+				}
+			},
+			expectedModels: []string{"gpt-4.1", "gpt-4.1"},
+			expectedCode:   connect.CodeUnavailable,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			provider := &scriptedProvider{streams: c.streams(t)}
+			agent, err := NewAgent(AgentOptions{
+				Provider:     provider,
+				ProviderName: "openai",
+				Model:        "gpt-4.1",
+				Fallbacks:    c.fallbacks,
+				RetryBackoff: time.Millisecond,
+			})
+			if err != nil {
+				t.Fatalf("Failed to create agent: %+v", err)
+			}
+
+			var last *cassie.GenerateResponse
+			retracted := make([]string, 0, 1)
+			sender := func(resp *cassie.GenerateResponse) error {
+				for _, b := range resp.Blocks {
+					if b.GetMetadata()[RetractedMetadataKey] == "true" {
+						retracted = append(retracted, b.GetId())
+					}
+				}
+				last = resp
+				return nil
+			}
+
+			req := &cassie.GenerateRequest{
+				Blocks: []*cassie.Block{
+					{Id: "user_1", Kind: cassie.BlockKind_MARKUP, Role: cassie.BlockRole_BLOCK_ROLE_USER, Contents: "What's running?"},
+				},
+			}
+			err = agent.ProcessWithOpenAI(context.Background(), req, sender)
+			if c.expectedCode != 0 {
+				if connect.CodeOf(err) != c.expectedCode {
+					t.Errorf("Expected code %v; got %v", c.expectedCode, err)
+				}
+			} else if err != nil {
+				t.Fatalf("ProcessWithOpenAI failed: %+v", err)
+			}
+
+			if d := cmp.Diff(c.expectedModels, provider.models); d != "" {
+				t.Errorf("Unexpected models requested (-want +got):\n%s", d)
+			}
+			if d := cmp.Diff(c.expectedRetracted, retracted, cmpopts.EquateEmpty()); d != "" {
+				t.Errorf("Unexpected blocks retracted (-want +got):\n%s", d)
+			}
+			if c.expectedAttempt != nil {
+				if d := cmp.Diff(c.expectedAttempt, last.GetAttempt(), protocmp.Transform()); d != "" {
+					t.Errorf("Unexpected attempt (-want +got):\n%s", d)
+				}
+			}
+		})
+	}
+}
+
+func Test_RateLimitedFallsBackAfterOneCall(t *testing.T) {
+	// The model on the Responses API is rate limited; the fallback on the Chat Completions endpoint works.
+	calls := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls[r.URL.Path]++
+		if r.URL.Path == "/responses" {
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, `{"error":{"message":"Rate limit reached"}}`, http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"id\":\"chatcmpl-1\",\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"All good.\"}}]}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	keyFile := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(keyFile, []byte("sk-test"), 0o600); err != nil {
+		t.Fatalf("Failed to write key file: %+v", err)
+	}
+	cfg := config.Config{
+		OpenAI:          &config.OpenAIConfig{APIKeyFile: keyFile, BaseURL: server.URL},
+		ChatCompletions: &config.ChatCompletionsConfig{BaseURL: server.URL},
+		CloudAssistant: &config.CloudAssistantConfig{
+			Resilience: &config.ResilienceConfig{
+				Fallbacks: []config.FallbackConfig{{Model: "llama-3.1-70b", Provider: config.ProviderChatCompletions}},
+			},
+		},
+	}
+	provider, err := NewProvider(cfg, nil)
+	if err != nil {
+		t.Fatalf("Failed to create provider: %+v", err)
+	}
+	fallbacks, err := NewFallbacks(cfg, nil)
+	if err != nil {
+		t.Fatalf("Failed to create fallbacks: %+v", err)
+	}
+	agent, err := NewAgent(AgentOptions{Provider: provider, Fallbacks: fallbacks, RetryBackoff: time.Millisecond})
+	if err != nil {
+		t.Fatalf("Failed to create agent: %+v", err)
+	}
+
+	req := &cassie.GenerateRequest{
+		Blocks: []*cassie.Block{
+			{Id: "user_1", Kind: cassie.BlockKind_MARKUP, Role: cassie.BlockRole_BLOCK_ROLE_USER, Contents: "Is the cluster up?"},
+		},
+	}
+	if err := agent.ProcessWithOpenAI(context.Background(), req, NullOpSender); err != nil {
+		t.Fatalf("ProcessWithOpenAI failed: %+v", err)
+	}
+	if d := cmp.Diff(map[string]int{"/responses": 1, "/chat/completions": 1}, calls); d != "" {
+		t.Errorf("Unexpected calls (-want +got):\n%s", d)
+	}
+}
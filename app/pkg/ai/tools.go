@@ -1,5 +1,273 @@
 package ai
 
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/zapr"
+	"github.com/jlewi/cloud-assistant/app/pkg/risk"
+	"github.com/jlewi/cloud-assistant/app/pkg/runme"
+	"github.com/jlewi/cloud-assistant/protos/gen/cassie"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	// ToolNameMetadataKey is the key in Block.Metadata that records the name of the tool a block is a call to.
+	// Blocks without it are treated as calls to the shell tool if they are CODE blocks.
+	ToolNameMetadataKey = "cloudassistant.io/tool"
+)
+
+// Tool is a function tool that the model can call.
+//
+// Every call to a tool is represented as a block. The tool is responsible for translating between the arguments
+// and outputs of the function call and the block.
+type Tool interface {
+	// Name is the name of the function. It must be unique.
+	Name() string
+	// Description returns the description of the function for the model.
+	Description(data PromptData) (string, error)
+	// Parameters returns the JSON schema for the arguments of the function.
+	Parameters() map[string]any
+	// BlockKind is the kind of block used to represent calls to the tool.
+	BlockKind() cassie.BlockKind
+	// CallToBlock updates the block using the JSON encoded arguments generated by the model.
+	CallToBlock(args string, block *cassie.Block) error
+	// BlockToCall returns the JSON encoded arguments of the call represented by the block.
+	BlockToCall(block *cassie.Block) (string, error)
+	// BlockToOutput returns the output of the call to send to the model.
+	BlockToOutput(block *cassie.Block) (string, error)
+}
+
+// ExecutableTool is a tool whose calls are executed by the server rather than by the user.
+// The agent executes the calls and sends the outputs back to the model without waiting for the client.
+type ExecutableTool interface {
+	Tool
+	// Execute runs the call represented by the block and stores the result in the block's outputs.
+	Execute(ctx context.Context, block *cassie.Block) error
+}
+
+// ToolRegistry is the set of tools available to the model.
+type ToolRegistry struct {
+	mu    sync.RWMutex
+	tools map[string]Tool
+	// order is the order in which tools were registered so that requests are deterministic.
+	order []string
+}
+
+// NewToolRegistry creates a registry containing the tools.
+func NewToolRegistry(tools ...Tool) (*ToolRegistry, error) {
+	r := &ToolRegistry{
+		tools: make(map[string]Tool),
+	}
+	for _, t := range tools {
+		if err := r.Register(t); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Register adds a tool to the registry. It is an error to register two tools with the same name.
+func (r *ToolRegistry) Register(t Tool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.tools[t.Name()]; ok {
+		return errors.Errorf("Tool %s is already registered", t.Name())
+	}
+	r.tools[t.Name()] = t
+	r.order = append(r.order, t.Name())
+	return nil
+}
+
+// Get returns the tool with the given name.
+func (r *ToolRegistry) Get(name string) (Tool, bool) {
+	if r == nil {
+		return nil, false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.tools[name]
+	return t, ok
+}
+
+// Tools returns the registered tools in the order they were registered.
+func (r *ToolRegistry) Tools() []Tool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	tools := make([]Tool, 0, len(r.order))
+	for _, name := range r.order {
+		tools = append(tools, r.tools[name])
+	}
+	return tools
+}
+
+// ForBlock returns the tool that the block is a call to.
+func (r *ToolRegistry) ForBlock(block *cassie.Block) (Tool, bool) {
+	name := block.GetMetadata()[ToolNameMetadataKey]
+	if name == "" {
+		// Code blocks that weren't generated by a function call (e.g. added by the user or parsed out of markdown)
+		// are shell commands.
+		if block.Kind != cassie.BlockKind_CODE {
+			return nil, false
+		}
+		name = ShellToolName
+	}
+	return r.Get(name)
+}
+
 type ShellArgs struct {
 	Shell string `json:"shell"`
+	// Language is the language of the program. If empty the program is bash.
+	Language string `json:"language,omitempty"`
+}
+
+var (
+	shellToolJSONSchema = map[string]any{
+		"$schema": "http://json-schema.org/draft-07/schema#",
+		"title":   "Shell Function Schema",
+		"type":    "object",
+		"properties": map[string]interface{}{
+			"shell": map[string]interface{}{
+				"type":        "string",
+				"description": "A short program to be executed. It is a bash program unless language is set.",
+			},
+			"language": map[string]interface{}{
+				"type": "string",
+				"enum": runme.Languages(),
+				"description": "The language of the program; defaults to bash. python programs are run with python3, " +
+					"jq programs are run with null input and kubectl-apply programs are Kubernetes manifests that are " +
+					"applied with kubectl apply -f.",
+			},
+		},
+		"required":             []string{"shell"},
+		"additionalProperties": false,
+	}
+)
+
+// ShellTool is the tool for running shell commands. Calls are rendered as CODE blocks which the user executes
+// with the runner.
+type ShellTool struct {
+	description *promptTemplate
+	// classifier classifies the risk of the commands. If nil blocks aren't annotated.
+	classifier *risk.Classifier
+}
+
+func (s *ShellTool) Name() string {
+	return ShellToolName
+}
+
+func (s *ShellTool) Description(data PromptData) (string, error) {
+	return s.description.Render(data)
+}
+
+func (s *ShellTool) Parameters() map[string]any {
+	return shellToolJSONSchema
+}
+
+func (s *ShellTool) BlockKind() cassie.BlockKind {
+	return cassie.BlockKind_CODE
+}
+
+func (s *ShellTool) CallToBlock(args string, block *cassie.Block) error {
+	shellArgs := &ShellArgs{}
+	if err := json.Unmarshal([]byte(args), shellArgs); err != nil {
+		return errors.Wrapf(err, "Failed to unmarshal shell arguments")
+	}
+	block.Contents = shellArgs.Shell
+	block.Language = runme.LanguageBash
+	if shellArgs.Language != "" {
+		language, ok := runme.LookupLanguage(shellArgs.Language)
+		if !ok {
+			return errors.Errorf("Unsupported language %q; must be one of %s", shellArgs.Language, strings.Join(runme.Languages(), ", "))
+		}
+		block.Language = language.ID
+	}
+
+	if s.classifier == nil {
+		return nil
+	}
+	// A command that doesn't parse is still returned to the user; it just isn't annotated.
+	result, err := classifyBlock(s.classifier, block)
+	if err != nil {
+		log := zapr.NewLogger(zap.L())
+		log.Error(err, "Failed to classify shell command", "command", block.Contents, "language", block.Language)
+		return nil
+	}
+	return result.Annotate(block)
+}
+
+// classifyBlock classifies the risk of the program in a code block. Programs in languages other than bash are
+// classified as the command that runs them e.g. kubectl apply -f for kubectl-apply blocks.
+func classifyBlock(classifier *risk.Classifier, block *cassie.Block) (*risk.Result, error) {
+	language, ok := runme.LookupLanguage(block.GetLanguage())
+	if !ok {
+		return nil, errors.Errorf("Unsupported language %q", block.GetLanguage())
+	}
+	if language.IsShell() {
+		return classifier.Classify(block.GetContents())
+	}
+	return classifier.Classify(language.CommandLine("cell"))
+}
+
+func (s *ShellTool) BlockToCall(block *cassie.Block) (string, error) {
+	shellArgs := &ShellArgs{
+		Shell: block.Contents,
+	}
+	if language, ok := runme.LookupLanguage(block.Language); ok && !language.IsShell() {
+		shellArgs.Language = language.ID
+	}
+
+	shellArgsJSON, err := json.Marshal(shellArgs)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to marshal shell args")
+	}
+	return string(shellArgsJSON), nil
+}
+
+func (s *ShellTool) BlockToOutput(block *cassie.Block) (string, error) {
+	return outputsToJSON(block)
+}
+
+// outputsToJSON returns the outputs of the block as a JSON object keyed by the output kind (e.g. STDOUT, STDERR).
+// If the block has execution info it is included so the model can tell whether the command failed or was cancelled.
+func outputsToJSON(block *cassie.Block) (string, error) {
+	dict := map[string]any{}
+
+	for _, o := range block.Outputs {
+		text := ""
+		for _, item := range o.Items {
+			text += item.TextData
+		}
+		dict[o.Kind.String()] = text
+	}
+
+	if info := block.GetExecutionInfo(); info != nil {
+		if info.ExitCode != nil {
+			dict["exit_code"] = info.GetExitCode()
+		}
+		if info.GetStartTime() != nil && info.GetEndTime() != nil {
+			start := info.GetStartTime().AsTime()
+			dict["started_at"] = start.Format(time.RFC3339)
+			dict["duration"] = info.GetEndTime().AsTime().Sub(start).Round(time.Millisecond).String()
+		}
+		if info.GetCancelled() {
+			dict["cancelled"] = true
+		}
+		if info.GetTruncated() {
+			dict["truncated"] = true
+		}
+		if info.GetRunnerId() != "" {
+			dict["runner"] = info.GetRunnerId()
+		}
+	}
+
+	output, err := json.Marshal(dict)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to marshal output")
+	}
+	return string(output), nil
 }
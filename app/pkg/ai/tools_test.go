@@ -0,0 +1,324 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jlewi/cloud-assistant/app/pkg/risk"
+	"github.com/jlewi/cloud-assistant/app/pkg/runme"
+	"github.com/jlewi/cloud-assistant/protos/gen/cassie"
+	"github.com/openai/openai-go/responses"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// kubectlGetTool is a structured tool used to test routing calls by tool name.
+type kubectlGetTool struct{}
+
+type kubectlGetArgs struct {
+	Resource  string `json:"resource"`
+	Namespace string `json:"namespace"`
+}
+
+func (k *kubectlGetTool) Name() string { return "kubectl_get" }
+
+func (k *kubectlGetTool) Description(data PromptData) (string, error) {
+	return "Get Kubernetes resources", nil
+}
+
+func (k *kubectlGetTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"resource":  map[string]any{"type": "string"},
+			"namespace": map[string]any{"type": "string"},
+		},
+	}
+}
+
+func (k *kubectlGetTool) BlockKind() cassie.BlockKind { return cassie.BlockKind_CODE }
+
+func (k *kubectlGetTool) CallToBlock(args string, block *cassie.Block) error {
+	a := &kubectlGetArgs{}
+	if err := json.Unmarshal([]byte(args), a); err != nil {
+		return err
+	}
+	block.Contents = "kubectl get " + a.Resource + " -n " + a.Namespace
+	return nil
+}
+
+func (k *kubectlGetTool) BlockToCall(block *cassie.Block) (string, error) {
+	return "{}", nil
+}
+
+func (k *kubectlGetTool) BlockToOutput(block *cassie.Block) (string, error) {
+	return "", nil
+}
+
+func mustEvent(t *testing.T, event map[string]any) responses.ResponseStreamEventUnion {
+	t.Helper()
+	b, err := json.Marshal(event)
+	if err != nil {
+		t.Fatalf("Failed to marshal event: %+v", err)
+	}
+	e := responses.ResponseStreamEventUnion{}
+	if err := e.UnmarshalJSON(b); err != nil {
+		t.Fatalf("Failed to unmarshal event: %+v", err)
+	}
+	return e
+}
+
+func Test_BlocksBuilderRoutesByToolName(t *testing.T) {
+	tools, err := NewToolRegistry(&ShellTool{}, &kubectlGetTool{})
+	if err != nil {
+		t.Fatalf("Failed to create tool registry: %+v", err)
+	}
+
+	builder := NewBlocksBuilder(nil, NewMemoryConversationStore(10, time.Hour), "gpt-4.1", tools)
+
+	events := []responses.ResponseStreamEventUnion{
+		mustEvent(t, map[string]any{
+			"type": "response.output_item.added",
+			"item": map[string]any{"type": "function_call", "id": "fc_1", "call_id": "call_1", "name": "kubectl_get"},
+		}),
+		mustEvent(t, map[string]any{
+			"type":    "response.function_call_arguments.delta",
+			"item_id": "fc_1",
+			"delta":   `{"resource":"pods",`,
+		}),
+		mustEvent(t, map[string]any{
+			"type":      "response.function_call_arguments.done",
+			"item_id":   "fc_1",
+			"arguments": `{"resource":"pods","namespace":"kube-system"}`,
+		}),
+		mustEvent(t, map[string]any{
+			"type": "response.output_item.added",
+			"item": map[string]any{"type": "function_call", "id": "fc_2", "call_id": "call_2", "name": "shell"},
+		}),
+		mustEvent(t, map[string]any{
+			"type":      "response.function_call_arguments.done",
+			"item_id":   "fc_2",
+			"arguments": `{"shell":"kubectl get nodes"}`,
+		}),
+	}
+
+	for _, e := range events {
+		if err := builder.ProcessEvent(context.Background(), e, NullOpSender); err != nil {
+			t.Fatalf("Failed to process event: %+v", err)
+		}
+	}
+
+	expected := map[string]*cassie.Block{
+		"fc_1": {
+			Id:       "fc_1",
+			Kind:     cassie.BlockKind_CODE,
+			Role:     cassie.BlockRole_BLOCK_ROLE_ASSISTANT,
+			Contents: "kubectl get pods -n kube-system",
+			CallId:   "call_1",
+			Metadata: map[string]string{ToolNameMetadataKey: "kubectl_get"},
+		},
+		"fc_2": {
+			Id:       "fc_2",
+			Kind:     cassie.BlockKind_CODE,
+			Role:     cassie.BlockRole_BLOCK_ROLE_ASSISTANT,
+			Language: runme.LanguageBash,
+			Contents: "kubectl get nodes",
+			CallId:   "call_2",
+			Metadata: map[string]string{ToolNameMetadataKey: ShellToolName},
+		},
+	}
+
+	if d := cmp.Diff(expected, builder.blocks, protocmp.Transform()); d != "" {
+		t.Errorf("Unexpected blocks (-want +got):\n%s", d)
+	}
+}
+
+func TestToolRegistry_ForBlock(t *testing.T) {
+	tools, err := NewToolRegistry(&ShellTool{}, &kubectlGetTool{})
+	if err != nil {
+		t.Fatalf("Failed to create tool registry: %+v", err)
+	}
+
+	if err := tools.Register(&kubectlGetTool{}); err == nil {
+		t.Errorf("Expected an error registering a duplicate tool")
+	}
+
+	tests := []struct {
+		name     string
+		block    *cassie.Block
+		expected string
+	}{
+		{
+			name:     "user-code-block",
+			block:    &cassie.Block{Kind: cassie.BlockKind_CODE},
+			expected: ShellToolName,
+		},
+		{
+			name:     "tool-metadata",
+			block:    &cassie.Block{Kind: cassie.BlockKind_CODE, Metadata: map[string]string{ToolNameMetadataKey: "kubectl_get"}},
+			expected: "kubectl_get",
+		},
+		{
+			name:     "markup",
+			block:    &cassie.Block{Kind: cassie.BlockKind_MARKUP},
+			expected: "",
+		},
+		{
+			name:     "unknown-tool",
+			block:    &cassie.Block{Kind: cassie.BlockKind_CODE, Metadata: map[string]string{ToolNameMetadataKey: "unknown"}},
+			expected: "",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tool, ok := tools.ForBlock(tc.block)
+			actual := ""
+			if ok {
+				actual = tool.Name()
+			}
+			if actual != tc.expected {
+				t.Errorf("Want %q; got %q", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func Test_OutputsToJSON(t *testing.T) {
+	start := time.Date(2025, 6, 1, 10, 0, 0, 0, time.UTC)
+	exitCode := int32(1)
+
+	type testCase struct {
+		name     string
+		block    *cassie.Block
+		expected string
+	}
+
+	outputs := []*cassie.BlockOutput{
+		{
+			Kind:  cassie.BlockOutputKind_STDOUT,
+			Items: []*cassie.BlockOutputItem{{TextData: "out"}},
+		},
+		{
+			Kind:  cassie.BlockOutputKind_STDERR,
+			Items: []*cassie.BlockOutputItem{{TextData: "err"}},
+		},
+	}
+
+	cases := []testCase{
+		{
+			name:     "no-execution-info",
+			block:    &cassie.Block{Outputs: outputs},
+			expected: `{"STDERR":"err","STDOUT":"out"}`,
+		},
+		{
+			name: "failed",
+			block: &cassie.Block{
+				Outputs: outputs,
+				ExecutionInfo: &cassie.ExecutionInfo{
+					ExitCode:  &exitCode,
+					StartTime: timestamppb.New(start),
+					EndTime:   timestamppb.New(start.Add(2 * time.Second)),
+					RunnerId:  "wss://localhost/ws",
+				},
+			},
+			expected: `{"STDERR":"err","STDOUT":"out","duration":"2s","exit_code":1,"runner":"wss://localhost/ws","started_at":"2025-06-01T10:00:00Z"}`,
+		},
+		{
+			name: "cancelled-and-truncated",
+			block: &cassie.Block{
+				Outputs: outputs,
+				ExecutionInfo: &cassie.ExecutionInfo{
+					Cancelled: true,
+					Truncated: true,
+				},
+			},
+			expected: `{"STDERR":"err","STDOUT":"out","cancelled":true,"truncated":true}`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual, err := outputsToJSON(c.block)
+			if err != nil {
+				t.Fatalf("outputsToJSON failed: %+v", err)
+			}
+			if d := cmp.Diff(c.expected, actual); d != "" {
+				t.Errorf("Unexpected output (-want +got):\n%s", d)
+			}
+		})
+	}
+}
+
+func Test_ShellToolLanguages(t *testing.T) {
+	classifier, err := risk.NewClassifier(nil, "")
+	if err != nil {
+		t.Fatalf("Failed to create classifier: %+v", err)
+	}
+	tool := &ShellTool{classifier: classifier}
+
+	type testCase struct {
+		name     string
+		args     string
+		language string
+		level    risk.Level
+	}
+
+	cases := []testCase{
+		{
+			name:     "bash",
+			args:     `{"shell":"kubectl get pods"}`,
+			language: runme.LanguageBash,
+			level:    risk.LevelReadOnly,
+		},
+		{
+			name:     "python",
+			args:     `{"shell":"import json\nprint(json.dumps({}))","language":"python"}`,
+			language: runme.LanguagePython,
+			level:    risk.LevelMutating,
+		},
+		{
+			name:     "jq",
+			args:     `{"shell":"{a: 1}","language":"jq"}`,
+			language: runme.LanguageJQ,
+			level:    risk.LevelReadOnly,
+		},
+		{
+			name:     "kubectl-apply",
+			args:     `{"shell":"apiVersion: v1\nkind: Namespace\nmetadata:\n  name: test","language":"kubectl-apply"}`,
+			language: runme.LanguageKubectlApply,
+			level:    risk.LevelMutating,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			block := &cassie.Block{}
+			if err := tool.CallToBlock(c.args, block); err != nil {
+				t.Fatalf("CallToBlock failed: %+v", err)
+			}
+			if block.Language != c.language {
+				t.Errorf("Unexpected language; want %s got %s", c.language, block.Language)
+			}
+			if level, _ := risk.FromBlock(block); level != c.level {
+				t.Errorf("Unexpected risk level; want %s got %s", c.level, level)
+			}
+
+			// The call should round trip so the model sees the language it asked for.
+			args, err := tool.BlockToCall(block)
+			if err != nil {
+				t.Fatalf("BlockToCall failed: %+v", err)
+			}
+			if args != c.args {
+				t.Errorf("Unexpected arguments; want %s got %s", c.args, args)
+			}
+		})
+	}
+
+	if err := tool.CallToBlock(`{"shell":"x","language":"cobol"}`, &cassie.Block{}); err == nil {
+		t.Errorf("Expected an error for an unsupported language")
+	}
+}
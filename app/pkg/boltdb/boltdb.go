@@ -0,0 +1,146 @@
+// Package boltdb provides bbolt databases that stay open for the life of the process.
+package boltdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// LockTimeout is how long to wait for another process to close the database.
+	LockTimeout = 10 * time.Second
+	// SweepInterval is how often stores delete expired entries.
+	SweepInterval = 10 * time.Minute
+)
+
+var (
+	// mu guards open.
+	mu sync.Mutex
+	// open are the databases open in the process keyed by their absolute path.
+	open = map[string]*openDB{}
+)
+
+// openDB is a database open in the process along with the number of DBs using it.
+type openDB struct {
+	db   *bolt.DB
+	refs int
+}
+
+// DB is a bbolt database that stays open until it is closed.
+//
+// bbolt locks the file so only one process can have it open at a time; other processes, e.g. CLI commands reading
+// the database, wait up to LockTimeout for it to be closed. DBs in the same process for the same file share one open
+// database. bbolt relies on file locks and mmap, which aren't safe on network file systems, so the file must be on a
+// local disk and can't be shared by replicas; running several replicas requires a networked store.
+type DB struct {
+	db   *bolt.DB
+	path string
+	// name describes the database in errors e.g. "usage store".
+	name string
+	once sync.Once
+}
+
+// New opens the database at path, creating it if it doesn't exist, with the given buckets so read-only transactions
+// can assume they exist. name describes the database in errors.
+func New(path string, name string, buckets ...[]byte) (*DB, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get absolute path of %s %s", name, path)
+	}
+
+	mu.Lock()
+	o, ok := open[abs]
+	if !ok {
+		if err := os.MkdirAll(filepath.Dir(abs), 0o755); err != nil {
+			mu.Unlock()
+			return nil, errors.Wrapf(err, "Failed to create directory for %s %s", name, path)
+		}
+		db, err := bolt.Open(abs, 0o600, &bolt.Options{Timeout: LockTimeout})
+		if err != nil {
+			mu.Unlock()
+			return nil, errors.Wrapf(err, "Failed to open %s %s; it may be open in another process", name, path)
+		}
+		o = &openDB{db: db}
+		open[abs] = o
+	}
+	o.refs++
+	mu.Unlock()
+
+	d := &DB{db: o.db, path: abs, name: name}
+	if err := d.Update(func(tx *bolt.Tx) error {
+		for _, b := range buckets {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return errors.Wrapf(err, "Failed to create bucket %s", b)
+			}
+		}
+		return nil
+	}); err != nil {
+		_ = d.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// Close closes the database once no other DB in the process uses it.
+func (d *DB) Close() error {
+	var err error
+	d.once.Do(func() {
+		mu.Lock()
+		defer mu.Unlock()
+		o := open[d.path]
+		o.refs--
+		if o.refs > 0 {
+			return
+		}
+		delete(open, d.path)
+		if closeErr := o.db.Close(); closeErr != nil {
+			err = errors.Wrapf(closeErr, "Failed to close %s %s", d.name, d.path)
+		}
+	})
+	return err
+}
+
+// Update runs fn in a read-write transaction.
+func (d *DB) Update(fn func(tx *bolt.Tx) error) error {
+	return d.db.Update(fn)
+}
+
+// View runs fn in a read-only transaction.
+func (d *DB) View(fn func(tx *bolt.Tx) error) error {
+	return d.db.View(fn)
+}
+
+// TimeKey returns a key that sorts in time order. Times before the Unix epoch, e.g. the zero time, sort first;
+// UnixNano overflows for them.
+func TimeKey(t time.Time) []byte {
+	k := make([]byte, 8)
+	if t.After(time.Unix(0, 0)) {
+		binary.BigEndian.PutUint64(k, uint64(t.UnixNano()))
+	}
+	return k
+}
+
+// DeleteBefore deletes the entries of a bucket whose keys sort before end e.g. the entries keyed by TimeKey that are
+// older than a given time.
+func DeleteBefore(tx *bolt.Tx, bucket []byte, end []byte) error {
+	b := tx.Bucket(bucket)
+	// Collect the keys first since deleting while iterating with a cursor can skip entries.
+	expired := make([][]byte, 0, 10)
+	c := b.Cursor()
+	for k, _ := c.First(); k != nil && bytes.Compare(k, end) < 0; k, _ = c.Next() {
+		expired = append(expired, append([]byte{}, k...))
+	}
+	for _, k := range expired {
+		if err := b.Delete(k); err != nil {
+			return errors.Wrapf(err, "Failed to delete expired entry %x from %s", k, bucket)
+		}
+	}
+	return nil
+}
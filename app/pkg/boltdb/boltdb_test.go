@@ -0,0 +1,95 @@
+package boltdb
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestDeleteBefore(t *testing.T) {
+	bucket := []byte("records")
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := New(path, "test store", bucket)
+	if err != nil {
+		t.Fatalf("Failed to create database: %+v", err)
+	}
+	// A second DB on the same file in the same process shares the open database.
+	other, err := New(path, "test store", bucket)
+	if err != nil {
+		t.Fatalf("Failed to create database: %+v", err)
+	}
+
+	start := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	if err := db.Update(func(tx *bolt.Tx) error {
+		for i, id := range []string{"a", "b", "c"} {
+			key := append(TimeKey(start.Add(time.Duration(i)*time.Hour)), []byte(id)...)
+			if err := tx.Bucket(bucket).Put(key, []byte(id)); err != nil {
+				return err
+			}
+		}
+		return DeleteBefore(tx, bucket, TimeKey(start.Add(time.Hour)))
+	}); err != nil {
+		t.Fatalf("Update failed: %+v", err)
+	}
+
+	actual := make([]string, 0, 2)
+	if err := other.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).ForEach(func(k, v []byte) error {
+			actual = append(actual, string(v))
+			return nil
+		})
+	}); err != nil {
+		t.Fatalf("View failed: %+v", err)
+	}
+	if d := cmp.Diff([]string{"b", "c"}, actual); d != "" {
+		t.Errorf("Unexpected entries (-want +got):\n%s", d)
+	}
+}
+
+func TestClose(t *testing.T) {
+	bucket := []byte("records")
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := New(path, "test store", bucket)
+	if err != nil {
+		t.Fatalf("Failed to create database: %+v", err)
+	}
+	other, err := New(path, "test store", bucket)
+	if err != nil {
+		t.Fatalf("Failed to create database: %+v", err)
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put([]byte("a"), []byte("a"))
+	}); err != nil {
+		t.Fatalf("Update failed: %+v", err)
+	}
+
+	// The database stays open until every DB using it is closed; closing twice is a no-op.
+	for i := 0; i < 2; i++ {
+		if err := db.Close(); err != nil {
+			t.Fatalf("Close failed: %+v", err)
+		}
+	}
+	if err := other.View(func(tx *bolt.Tx) error { return nil }); err != nil {
+		t.Fatalf("View failed after closing the other DB: %+v", err)
+	}
+	if err := other.Close(); err != nil {
+		t.Fatalf("Close failed: %+v", err)
+	}
+
+	reopened, err := New(path, "test store", bucket)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %+v", err)
+	}
+	defer reopened.Close()
+	if err := reopened.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(bucket).Get([]byte("a")); string(v) != "a" {
+			t.Errorf("Want a; got %q", v)
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("View failed: %+v", err)
+	}
+}
@@ -0,0 +1,264 @@
+// Package cassette records the HTTP interactions of a client into cassette files and replays them. It lets code
+// that calls the OpenAI APIs, e.g. the event streams of the Responses API, be tested without network access or an
+// API key. A bug report can be turned into a regression test by attaching the cassette recorded when it happened.
+//
+// Only the method, path and body of requests and the status, content type and body of responses are recorded so
+// credentials in headers never end up in cassettes.
+package cassette
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// RecordEnv is the environment variable that switches tests using ForTest from replaying cassettes to
+	// recording them.
+	RecordEnv = "CASSETTE_RECORD"
+)
+
+// Cassette is a sequence of recorded interactions.
+type Cassette struct {
+	Interactions []*Interaction `yaml:"interactions"`
+}
+
+// Interaction is a request and the response to it.
+type Interaction struct {
+	Request  Request  `yaml:"request"`
+	Response Response `yaml:"response"`
+}
+
+// Request is a recorded request.
+type Request struct {
+	Method string `yaml:"method"`
+	Path   string `yaml:"path"`
+	Body   string `yaml:"body,omitempty"`
+}
+
+// Response is a recorded response. For streaming responses the body is the raw event stream.
+type Response struct {
+	StatusCode  int    `yaml:"statusCode"`
+	ContentType string `yaml:"contentType,omitempty"`
+	Body        string `yaml:"body,omitempty"`
+}
+
+// Load reads the cassette at path.
+func Load(path string) (*Cassette, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read cassette %s", path)
+	}
+	c := &Cassette{}
+	if err := yaml.Unmarshal(b, c); err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse cassette %s", path)
+	}
+	return c, nil
+}
+
+// Save writes the cassette to path.
+func (c *Cassette) Save(path string) error {
+	b, err := yaml.Marshal(c)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to marshal cassette")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return errors.Wrapf(err, "Failed to create directory for cassette %s", path)
+	}
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		return errors.Wrapf(err, "Failed to write cassette %s", path)
+	}
+	return nil
+}
+
+// Recorder is an http.RoundTripper that sends requests with another RoundTripper and records the interactions.
+type Recorder struct {
+	next http.RoundTripper
+
+	mu       sync.Mutex
+	cassette Cassette
+}
+
+// NewRecorder creates a recorder that sends requests with next. If next is nil http.DefaultTransport is used.
+func NewRecorder(next http.RoundTripper) *Recorder {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &Recorder{next: next}
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	i := &Interaction{
+		Request: Request{Method: req.Method, Path: req.URL.Path, Body: body},
+		Response: Response{
+			StatusCode:  resp.StatusCode,
+			ContentType: resp.Header.Get("Content-Type"),
+		},
+	}
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, i)
+	r.mu.Unlock()
+
+	// The body of a streaming response is recorded as the client reads it.
+	resp.Body = &recordingBody{
+		body: resp.Body,
+		onRead: func(data string) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			i.Response.Body = data
+		},
+	}
+	return resp, nil
+}
+
+// Save writes the interactions recorded so far to path. Responses are recorded as far as the client has read them
+// so it should be called once the client is done.
+func (r *Recorder) Save(path string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cassette.Save(path)
+}
+
+// recordingBody records the data read from a response body.
+type recordingBody struct {
+	body   io.ReadCloser
+	buf    bytes.Buffer
+	onRead func(data string)
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	b.buf.Write(p[:n])
+	b.onRead(b.buf.String())
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	return b.body.Close()
+}
+
+// Replayer is an http.RoundTripper that replays the interactions in a cassette in order. Requests are matched on
+// their method and path only since bodies typically contain values that change between runs (e.g. the date in the
+// instructions). Use Requests to check what the client sent.
+type Replayer struct {
+	mu       sync.Mutex
+	cassette *Cassette
+	next     int
+	requests []Request
+}
+
+// NewReplayer creates a replayer for the cassette.
+func NewReplayer(c *Cassette) *Replayer {
+	return &Replayer{cassette: c}
+}
+
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, Request{Method: req.Method, Path: req.URL.Path, Body: body})
+	if r.next >= len(r.cassette.Interactions) {
+		return nil, errors.Errorf("Cassette has no interaction for request %d: %s %s", len(r.requests), req.Method, req.URL.Path)
+	}
+	i := r.cassette.Interactions[r.next]
+	r.next++
+	if i.Request.Method != req.Method || i.Request.Path != req.URL.Path {
+		return nil, errors.Errorf("Request %d is %s %s but the cassette has %s %s", len(r.requests), req.Method, req.URL.Path, i.Request.Method, i.Request.Path)
+	}
+
+	header := http.Header{}
+	if i.Response.ContentType != "" {
+		header.Set("Content-Type", i.Response.ContentType)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", i.Response.StatusCode, http.StatusText(i.Response.StatusCode)),
+		StatusCode:    i.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(i.Response.Body)),
+		ContentLength: int64(len(i.Response.Body)),
+		Request:       req,
+	}, nil
+}
+
+// Requests returns the requests received so far.
+func (r *Replayer) Requests() []Request {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Request{}, r.requests...)
+}
+
+// Remaining returns the number of interactions that haven't been replayed.
+func (r *Replayer) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.cassette.Interactions) - r.next
+}
+
+// ForTest returns the RoundTripper for a test using the cassette at path. If RecordEnv is set requests are sent with
+// next and the cassette is saved when the test finishes; otherwise the cassette is replayed and the test fails if it
+// isn't replayed completely. It returns true when recording so the test can use real credentials.
+func ForTest(t testing.TB, path string, next http.RoundTripper) (http.RoundTripper, bool) {
+	t.Helper()
+	if os.Getenv(RecordEnv) != "" {
+		recorder := NewRecorder(next)
+		t.Cleanup(func() {
+			if err := recorder.Save(path); err != nil {
+				t.Errorf("Failed to save cassette: %+v", err)
+			}
+		})
+		return recorder, true
+	}
+
+	c, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load cassette; set %s to record it: %+v", RecordEnv, err)
+	}
+	replayer := NewReplayer(c)
+	t.Cleanup(func() {
+		if n := replayer.Remaining(); n > 0 && !t.Failed() {
+			t.Errorf("%d interactions in cassette %s weren't replayed", n, path)
+		}
+	})
+	return replayer, false
+}
+
+// readBody reads the body of the request and replaces it so it can still be sent.
+func readBody(req *http.Request) (string, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return "", nil
+	}
+	b, err := io.ReadAll(req.Body)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to read the body of request %s %s", req.Method, req.URL.Path)
+	}
+	if err := req.Body.Close(); err != nil {
+		return "", errors.Wrapf(err, "Failed to close the body of request %s %s", req.Method, req.URL.Path)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(b))
+	return string(b), nil
+}
@@ -0,0 +1,105 @@
+package cassette
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const events = "event: response.created\ndata: {\"type\":\"response.created\"}\n\nevent: response.completed\ndata: {\"type\":\"response.completed\"}\n\n"
+
+func Test_RecordAndReplay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		if _, err := io.WriteString(w, events); err != nil {
+			t.Errorf("Failed to write events: %+v", err)
+		}
+	}))
+	defer server.Close()
+
+	// do sends a request with client and returns the body of the response.
+	do := func(client *http.Client, url string) string {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPost, url+"/v1/responses", strings.NewReader(`{"model":"gpt-4.1"}`))
+		if err != nil {
+			t.Fatalf("Failed to create request: %+v", err)
+		}
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %+v", err)
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("Failed to read response: %+v", err)
+		}
+		return string(b)
+	}
+
+	recorder := NewRecorder(nil)
+	if got := do(&http.Client{Transport: recorder}, server.URL); got != events {
+		t.Fatalf("Unexpected response while recording; got %q", got)
+	}
+
+	path := filepath.Join(t.TempDir(), "cassette.yaml")
+	if err := recorder.Save(path); err != nil {
+		t.Fatalf("Failed to save cassette: %+v", err)
+	}
+	c, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load cassette: %+v", err)
+	}
+	expected := &Cassette{
+		Interactions: []*Interaction{
+			{
+				Request:  Request{Method: http.MethodPost, Path: "/v1/responses", Body: `{"model":"gpt-4.1"}`},
+				Response: Response{StatusCode: http.StatusOK, ContentType: "text/event-stream", Body: events},
+			},
+		},
+	}
+	if d := cmp.Diff(expected, c); d != "" {
+		t.Errorf("Unexpected cassette (-want +got):\n%s", d)
+	}
+
+	// The server isn't needed to replay the cassette.
+	replayer := NewReplayer(c)
+	client := &http.Client{Transport: replayer}
+	if got := do(client, "http://localhost:1"); got != events {
+		t.Errorf("Unexpected response while replaying; got %q", got)
+	}
+	if replayer.Remaining() != 0 {
+		t.Errorf("Expected the cassette to be replayed completely")
+	}
+	if got := replayer.Requests(); len(got) != 1 || got[0].Body != `{"model":"gpt-4.1"}` {
+		t.Errorf("Unexpected requests: %v", got)
+	}
+
+	if _, err := client.Get("http://localhost:1/v1/responses"); err == nil {
+		t.Errorf("Expected an error once the cassette is exhausted")
+	}
+}
+
+func Test_ReplayMismatch(t *testing.T) {
+	replayer := NewReplayer(&Cassette{
+		Interactions: []*Interaction{
+			{
+				Request:  Request{Method: http.MethodPost, Path: "/v1/responses"},
+				Response: Response{StatusCode: http.StatusOK},
+			},
+		},
+	})
+	client := &http.Client{Transport: replayer}
+	if _, err := client.Get("http://localhost:1/v1/files"); err == nil {
+		t.Errorf("Expected an error for a request that doesn't match the cassette")
+	}
+}
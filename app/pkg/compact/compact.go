@@ -0,0 +1,250 @@
+// Package compact shrinks large command outputs so they fit in the model's context window while keeping as much of
+// their meaning as possible.
+//
+// The format of the output is detected and each format is compacted differently
+//   - JSON and YAML: large arrays are pruned to their first few items plus a note with the number of items omitted
+//     and the keys they have, and long strings are truncated
+//   - Tables (e.g. kubectl get): runs of rows that only differ by name and numbers are collapsed
+//   - Everything else (e.g. logs): repeated lines are collapsed and the head and tail are kept along with the number
+//     of lines, errors and warnings omitted
+package compact
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jlewi/cloud-assistant/protos/gen/cassie"
+)
+
+// Format is the format of an output.
+type Format string
+
+const (
+	FormatJSON  Format = "json"
+	FormatYAML  Format = "yaml"
+	FormatTable Format = "table"
+	FormatText  Format = "text"
+)
+
+// minItemChars is the smallest budget given to an output item so that small items in a block with a huge one
+// still say something useful.
+const minItemChars = 200
+
+// Detect returns the format of the text.
+func Detect(text string) Format {
+	trimmed := strings.TrimSpace(text)
+	if looksLikeJSON(trimmed) {
+		return FormatJSON
+	}
+	if looksLikeYAML(trimmed) {
+		return FormatYAML
+	}
+	if looksLikeTable(trimmed) {
+		return FormatTable
+	}
+	return FormatText
+}
+
+// Compact returns the text compacted to at most about maxChars characters. Text that already fits is returned
+// unchanged.
+func Compact(text string, maxChars int) string {
+	if maxChars <= 0 || len(text) <= maxChars {
+		return text
+	}
+
+	var out string
+	ok := false
+	switch Detect(text) {
+	case FormatJSON:
+		out, ok = compactJSON(text, maxChars)
+	case FormatYAML:
+		out, ok = compactYAML(text, maxChars)
+	case FormatTable:
+		out, ok = compactTable(text, maxChars)
+	}
+	if ok && len(out) <= maxChars {
+		return out
+	}
+	if !ok {
+		out = text
+	}
+	return compactLines(out, maxChars)
+}
+
+// CompactBlock compacts the text outputs of the block so that together they are at most about maxChars characters.
+// The budget is shared between the outputs in proportion to their size. It returns true if anything was compacted.
+func CompactBlock(block *cassie.Block, maxChars int) bool {
+	if maxChars <= 0 {
+		return false
+	}
+	total := 0
+	for _, o := range block.GetOutputs() {
+		for _, item := range o.GetItems() {
+			total += len(item.TextData)
+		}
+	}
+	if total <= maxChars {
+		return false
+	}
+
+	changed := false
+	for _, o := range block.GetOutputs() {
+		for _, item := range o.GetItems() {
+			budget := maxChars * len(item.TextData) / total
+			if budget < minItemChars {
+				budget = minItemChars
+			}
+			if len(item.TextData) <= budget {
+				continue
+			}
+			item.TextData = Compact(item.TextData, budget)
+			changed = true
+		}
+	}
+	return changed
+}
+
+var (
+	digitsRegex = regexp.MustCompile(`[0-9]+`)
+	levelRegex  = regexp.MustCompile(`(?i)\b(error|warn|warning|fatal|panic)\b`)
+)
+
+// normalize replaces numbers so lines that only differ by e.g. timestamps or counts are considered the same.
+func normalize(line string) string {
+	return digitsRegex.ReplaceAllString(line, "#")
+}
+
+// compactLines compacts text line by line. Runs of lines that only differ by numbers are collapsed and if that
+// isn't enough the head and tail are kept.
+func compactLines(text string, maxChars int) string {
+	lines := collapseRepeatedLines(strings.Split(text, "\n"))
+	collapsed := strings.Join(lines, "\n")
+	if len(collapsed) <= maxChars {
+		return collapsed
+	}
+	return headAndTail(lines, maxChars)
+}
+
+func collapseRepeatedLines(lines []string) []string {
+	result := make([]string, 0, len(lines))
+	for i := 0; i < len(lines); {
+		j := i + 1
+		key := normalize(lines[i])
+		for j < len(lines) && normalize(lines[j]) == key && strings.TrimSpace(lines[j]) != "" {
+			j++
+		}
+		result = append(result, lines[i])
+		if repeats := j - i - 1; repeats > 1 {
+			result = append(result, fmt.Sprintf("... previous line repeated %d more times", repeats))
+		} else if repeats == 1 {
+			result = append(result, lines[i+1])
+		}
+		i = j
+	}
+	return result
+}
+
+// headAndTail keeps the first and last lines that fit in maxChars. Logs usually have the interesting part at the
+// end so the tail gets more of the budget.
+func headAndTail(lines []string, maxChars int) string {
+	// Reserve space for the marker.
+	budget := maxChars - 100
+	if budget < 0 {
+		budget = 0
+	}
+	headBudget := budget * 2 / 5
+	tailBudget := budget - headBudget
+
+	head := 0
+	used := 0
+	for head < len(lines) && used+len(lines[head])+1 <= headBudget {
+		used += len(lines[head]) + 1
+		head++
+	}
+	tail := len(lines)
+	used = 0
+	for tail > head && used+len(lines[tail-1])+1 <= tailBudget {
+		used += len(lines[tail-1]) + 1
+		tail--
+	}
+
+	omitted := lines[head:tail]
+	if len(omitted) == 1 && head == 0 && tail == len(lines) {
+		// A single line that is too long on its own.
+		return truncateChars(omitted[0], maxChars)
+	}
+
+	sb := strings.Builder{}
+	for _, l := range lines[:head] {
+		sb.WriteString(l + "\n")
+	}
+	sb.WriteString(omittedMarker(omitted))
+	for _, l := range lines[tail:] {
+		sb.WriteString("\n" + l)
+	}
+	return sb.String()
+}
+
+// omittedMarker describes the omitted lines including how many of them were errors and warnings.
+func omittedMarker(omitted []string) string {
+	counts := map[string]int{}
+	order := []string{"ERROR", "WARN", "FATAL", "PANIC"}
+	for _, l := range omitted {
+		if m := levelRegex.FindStringSubmatch(l); m != nil {
+			level := strings.ToUpper(m[1])
+			if level == "WARNING" {
+				level = "WARN"
+			}
+			counts[level]++
+		}
+	}
+	details := make([]string, 0, len(order))
+	for _, level := range order {
+		if counts[level] > 0 {
+			details = append(details, fmt.Sprintf("%d %s", counts[level], level))
+		}
+	}
+	if len(details) == 0 {
+		return fmt.Sprintf("... %d lines omitted ...", len(omitted))
+	}
+	return fmt.Sprintf("... %d lines omitted (%s) ...", len(omitted), strings.Join(details, ", "))
+}
+
+// truncateChars keeps the head and tail of a string.
+func truncateChars(s string, maxChars int) string {
+	if len(s) <= maxChars {
+		return s
+	}
+	budget := maxChars - 50
+	if budget < 0 {
+		budget = 0
+	}
+	head := prefix(s, budget*2/5)
+	tail := suffix(s, budget-len(head))
+	return fmt.Sprintf("%s... %d characters omitted ...%s", head, len(s)-len(head)-len(tail), tail)
+}
+
+// prefix returns the longest prefix of s that is at most n bytes and doesn't split a UTF-8 encoded character.
+func prefix(s string, n int) string {
+	if n >= len(s) {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// suffix returns the longest suffix of s that is at most n bytes and doesn't split a UTF-8 encoded character.
+func suffix(s string, n int) string {
+	if n >= len(s) {
+		return s
+	}
+	i := len(s) - n
+	for i < len(s) && !utf8.RuneStart(s[i]) {
+		i++
+	}
+	return s[i:]
+}
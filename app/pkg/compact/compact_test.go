@@ -0,0 +1,209 @@
+package compact
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/jlewi/cloud-assistant/protos/gen/cassie"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestDetect(t *testing.T) {
+	cases := []struct {
+		name     string
+		text     string
+		expected Format
+	}{
+		{name: "json-object", text: `{"items": []}`, expected: FormatJSON},
+		{name: "json-array", text: "[1, 2]\n", expected: FormatJSON},
+		{name: "yaml", text: "apiVersion: v1\nkind: Pod\nmetadata:\n  name: web\n", expected: FormatYAML},
+		{name: "table", text: "NAME    READY   STATUS\nweb-1   1/1     Running\nweb-2   1/1     Running\n", expected: FormatTable},
+		{name: "logs", text: "2025-06-01T10:00:00Z INFO starting\n2025-06-01T10:00:01Z ERROR failed: boom\n", expected: FormatText},
+		{name: "invalid-json", text: "{not json", expected: FormatText},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if actual := Detect(c.text); actual != c.expected {
+				t.Errorf("Expected %s; got %s", c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestCompactJSON(t *testing.T) {
+	items := make([]map[string]any, 0, 500)
+	for i := 0; i < 500; i++ {
+		items = append(items, map[string]any{
+			"metadata": map[string]any{"name": fmt.Sprintf("pod-%d", i), "namespace": "default"},
+			"status":   map[string]any{"phase": "Running"},
+		})
+	}
+	b, err := json.MarshalIndent(map[string]any{"apiVersion": "v1", "kind": "List", "items": items}, "", "    ")
+	if err != nil {
+		t.Fatalf("Failed to marshal: %+v", err)
+	}
+
+	out := Compact(string(b), 2000)
+	if len(out) > 2000 {
+		t.Errorf("Output is %d characters; expected at most 2000", len(out))
+	}
+	if !json.Valid([]byte(out)) {
+		t.Fatalf("Compacted JSON isn't valid:\n%s", out)
+	}
+	for _, want := range []string{`"List"`, `"pod-0"`, "480 more items omitted with keys: metadata, status"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected output to contain %q; got\n%s", want, out)
+		}
+	}
+}
+
+func TestCompactYAML(t *testing.T) {
+	sb := strings.Builder{}
+	sb.WriteString("apiVersion: v1\nkind: ConfigMap\ndata:\n  entries:\n")
+	for i := 0; i < 300; i++ {
+		fmt.Fprintf(&sb, "  - host-%d.example.com\n", i)
+	}
+
+	out := Compact(sb.String(), 1000)
+	if len(out) > 1000 {
+		t.Errorf("Output is %d characters; expected at most 1000", len(out))
+	}
+	for _, want := range []string{"kind: ConfigMap", "host-0.example.com", "more items omitted"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected output to contain %q; got\n%s", want, out)
+		}
+	}
+}
+
+func TestCompactTable(t *testing.T) {
+	sb := strings.Builder{}
+	sb.WriteString("NAMESPACE   NAME                   READY   STATUS             RESTARTS   AGE\n")
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&sb, "default     web-%d                  1/1     Running            0          %dd\n", i, i%7)
+	}
+	sb.WriteString("default     worker-0               0/1     CrashLoopBackOff   12         3d\n")
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&sb, "kube-system coredns-%d              1/1     Running            0          30d\n", i)
+	}
+
+	out := Compact(sb.String(), 1000)
+	expected := `NAMESPACE   NAME                   READY   STATUS             RESTARTS   AGE
+default     web-0                  1/1     Running            0          0d
+... 199 more rows like the above
+default     worker-0               0/1     CrashLoopBackOff   12         3d
+kube-system coredns-0              1/1     Running            0          30d
+... 99 more rows like the above`
+	if out != expected {
+		t.Errorf("Unexpected output; got\n%s", out)
+	}
+}
+
+func TestCompactLogs(t *testing.T) {
+	paths := []string{"users", "orders", "carts", "search"}
+	sb := strings.Builder{}
+	for i := 0; i < 1000; i++ {
+		level := "INFO"
+		if i%100 == 0 {
+			level = "ERROR"
+		}
+		fmt.Fprintf(&sb, "2025-06-01T10:%02d:%02dZ %s GET /api/%s handled\n", i/60%60, i%60, level, paths[i%len(paths)])
+	}
+	sb.WriteString("2025-06-01T11:00:00Z FATAL out of memory")
+
+	out := Compact(sb.String(), 2000)
+	if len(out) > 2000 {
+		t.Errorf("Output is %d characters; expected at most 2000", len(out))
+	}
+	if !strings.HasPrefix(out, "2025-06-01T10:00:00Z ERROR GET /api/users") {
+		t.Errorf("Expected the head to be kept; got\n%s", out)
+	}
+	if !strings.HasSuffix(out, "FATAL out of memory") {
+		t.Errorf("Expected the tail to be kept; got\n%s", out)
+	}
+	if !strings.Contains(out, "lines omitted (") || !strings.Contains(out, " ERROR) ...") {
+		t.Errorf("Expected a marker with the number of omitted errors; got\n%s", out)
+	}
+}
+
+func TestCompactRepeatedLines(t *testing.T) {
+	text := "starting\n" + strings.Repeat("2025-06-01T10:00:00Z retrying connection to db:5432\n", 50) + "connected"
+	out := Compact(text, 200)
+	expected := "starting\n2025-06-01T10:00:00Z retrying connection to db:5432\n... previous line repeated 49 more times\nconnected"
+	if out != expected {
+		t.Errorf("Unexpected output; got\n%s", out)
+	}
+}
+
+func TestCompactLongLine(t *testing.T) {
+	out := Compact(strings.Repeat("a", 10000), 500)
+	if len(out) > 500 || !strings.Contains(out, "characters omitted") {
+		t.Errorf("Unexpected output (%d characters): %s", len(out), out)
+	}
+}
+
+func TestCompactBlock(t *testing.T) {
+	block := &cassie.Block{
+		Outputs: []*cassie.BlockOutput{
+			{
+				Kind:  cassie.BlockOutputKind_STDOUT,
+				Items: []*cassie.BlockOutputItem{{TextData: strings.Repeat("line of output\n", 1000)}},
+			},
+			{
+				Kind:  cassie.BlockOutputKind_STDERR,
+				Items: []*cassie.BlockOutputItem{{TextData: "warning: deprecated flag"}},
+			},
+		},
+	}
+
+	if !CompactBlock(block, 1000) {
+		t.Fatalf("Expected the block to be compacted")
+	}
+	if n := len(block.Outputs[0].Items[0].TextData); n > 1000 {
+		t.Errorf("STDOUT is %d characters; expected at most 1000", n)
+	}
+	if actual := block.Outputs[1].Items[0].TextData; actual != "warning: deprecated flag" {
+		t.Errorf("Small outputs should be unchanged; got %s", actual)
+	}
+	if CompactBlock(block, 1000) {
+		t.Errorf("Expected a compacted block not to change")
+	}
+}
+
+func TestCompactNonASCII(t *testing.T) {
+	// Cutting on byte offsets could split the multi-byte characters.
+	logs := strings.Repeat("服务启动失败：无法连接数据库\n", 250)
+	items := make([]map[string]any, 0, 50)
+	for i := 0; i < 50; i++ {
+		items = append(items, map[string]any{"message": strings.Repeat("数据库连接超时", 100)})
+	}
+	b, err := json.Marshal(map[string]any{"items": items})
+	if err != nil {
+		t.Fatalf("Failed to marshal: %+v", err)
+	}
+
+	for name, text := range map[string]string{"logs": logs, "line": strings.Repeat("错误", 5000), "json": string(b)} {
+		t.Run(name, func(t *testing.T) {
+			block := &cassie.Block{
+				Outputs: []*cassie.BlockOutput{
+					{
+						Kind:  cassie.BlockOutputKind_STDOUT,
+						Items: []*cassie.BlockOutputItem{{TextData: text}},
+					},
+				},
+			}
+			if !CompactBlock(block, 1001) {
+				t.Fatalf("Expected the block to be compacted")
+			}
+			// Encoding JSON replaces invalid UTF-8 with the replacement character.
+			if out := block.Outputs[0].Items[0].TextData; !utf8.ValidString(out) || strings.ContainsRune(out, utf8.RuneError) {
+				t.Errorf("Compacted output isn't valid UTF-8:\n%s", out)
+			}
+			if _, err := proto.Marshal(block); err != nil {
+				t.Errorf("Failed to marshal the compacted block: %+v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package compact
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// pruneLevels are the limits tried in order until the output fits; each level keeps fewer array items and shorter
+// strings.
+var pruneLevels = []struct {
+	maxItems  int
+	maxString int
+}{
+	{maxItems: 20, maxString: 1000},
+	{maxItems: 10, maxString: 500},
+	{maxItems: 5, maxString: 200},
+	{maxItems: 3, maxString: 100},
+	{maxItems: 1, maxString: 50},
+}
+
+var yamlKeyRegex = regexp.MustCompile(`^(- )?[A-Za-z_][A-Za-z0-9_.-]*:(\s|$)`)
+
+func looksLikeJSON(trimmed string) bool {
+	if !strings.HasPrefix(trimmed, "{") && !strings.HasPrefix(trimmed, "[") {
+		return false
+	}
+	return json.Valid([]byte(trimmed))
+}
+
+func looksLikeYAML(trimmed string) bool {
+	first, _, _ := strings.Cut(trimmed, "\n")
+	if first == "---" {
+		return true
+	}
+	if !yamlKeyRegex.MatchString(first) {
+		return false
+	}
+	var v any
+	if err := yaml.Unmarshal([]byte(trimmed), &v); err != nil {
+		return false
+	}
+	switch v.(type) {
+	case map[string]any, []any:
+		return true
+	default:
+		return false
+	}
+}
+
+func compactJSON(text string, maxChars int) (string, bool) {
+	d := json.NewDecoder(strings.NewReader(text))
+	d.UseNumber()
+	var v any
+	if err := d.Decode(&v); err != nil {
+		return "", false
+	}
+
+	var smallest string
+	for _, l := range pruneLevels {
+		pruned := prune(v, l.maxItems, l.maxString)
+		b, err := json.MarshalIndent(pruned, "", "  ")
+		if err != nil {
+			return "", false
+		}
+		if len(b) <= maxChars {
+			return string(b), true
+		}
+		b, err = json.Marshal(pruned)
+		if err != nil {
+			return "", false
+		}
+		smallest = string(b)
+		if len(b) <= maxChars {
+			return smallest, true
+		}
+	}
+	return smallest, true
+}
+
+func compactYAML(text string, maxChars int) (string, bool) {
+	docs := make([]any, 0, 1)
+	d := yaml.NewDecoder(strings.NewReader(text))
+	for {
+		var v any
+		if err := d.Decode(&v); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return "", false
+		}
+		docs = append(docs, v)
+	}
+
+	var smallest string
+	for _, l := range pruneLevels {
+		var buf bytes.Buffer
+		e := yaml.NewEncoder(&buf)
+		e.SetIndent(2)
+		for _, doc := range docs {
+			if err := e.Encode(prune(doc, l.maxItems, l.maxString)); err != nil {
+				return "", false
+			}
+		}
+		if err := e.Close(); err != nil {
+			return "", false
+		}
+		smallest = buf.String()
+		if len(smallest) <= maxChars {
+			return smallest, true
+		}
+	}
+	return smallest, true
+}
+
+// prune returns a copy of v with arrays longer than maxItems cut down to maxItems items followed by a note
+// describing the omitted items, and strings longer than maxString truncated.
+func prune(v any, maxItems int, maxString int) any {
+	switch t := v.(type) {
+	case map[string]any:
+		result := make(map[string]any, len(t))
+		for k, e := range t {
+			result[k] = prune(e, maxItems, maxString)
+		}
+		return result
+	case []any:
+		n := len(t)
+		if n > maxItems {
+			n = maxItems
+		}
+		result := make([]any, 0, n+1)
+		for _, e := range t[:n] {
+			result = append(result, prune(e, maxItems, maxString))
+		}
+		if len(t) > n {
+			result = append(result, omittedItems(t[n:]))
+		}
+		return result
+	case string:
+		if len(t) > maxString {
+			p := prefix(t, maxString)
+			return fmt.Sprintf("%s... (%d more characters)", p, len(t)-len(p))
+		}
+		return t
+	default:
+		return v
+	}
+}
+
+// omittedItems describes array items that were pruned. If they are objects the union of their keys is listed so
+// the model still knows the schema.
+func omittedItems(items []any) string {
+	keys := map[string]bool{}
+	for _, item := range items {
+		if m, ok := item.(map[string]any); ok {
+			for k := range m {
+				keys[k] = true
+			}
+		}
+	}
+	if len(keys) == 0 {
+		return fmt.Sprintf("... %d more items omitted", len(items))
+	}
+	names := make([]string, 0, len(keys))
+	for k := range keys {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return fmt.Sprintf("... %d more items omitted with keys: %s", len(items), strings.Join(names, ", "))
+}
@@ -0,0 +1,77 @@
+package compact
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// headerFieldRegex matches a column header in the output of CLIs like kubectl e.g. NAME, READY, NOMINATED NODE.
+var headerFieldRegex = regexp.MustCompile(`^[A-Z][A-Z0-9_()/%-]*$`)
+
+// minRunLength is the shortest run of similar rows that is collapsed.
+const minRunLength = 3
+
+func looksLikeTable(trimmed string) bool {
+	lines := strings.Split(trimmed, "\n")
+	if len(lines) < 3 {
+		return false
+	}
+	fields := strings.Fields(lines[0])
+	if len(fields) < 2 {
+		return false
+	}
+	for _, f := range fields {
+		if !headerFieldRegex.MatchString(f) {
+			return false
+		}
+	}
+	return true
+}
+
+// compactTable collapses runs of rows that only differ by their name and numbers (e.g. pods of the same
+// deployment that are all Running) into the first row and a count.
+func compactTable(text string, maxChars int) (string, bool) {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	header := lines[0]
+	rows := lines[1:]
+
+	nameColumn := -1
+	for i, f := range strings.Fields(header) {
+		if f == "NAME" {
+			nameColumn = i
+			break
+		}
+	}
+
+	result := make([]string, 0, len(rows))
+	for i := 0; i < len(rows); {
+		key := rowKey(rows[i], nameColumn)
+		j := i + 1
+		for j < len(rows) && rowKey(rows[j], nameColumn) == key {
+			j++
+		}
+		if j-i >= minRunLength {
+			result = append(result, rows[i], fmt.Sprintf("... %d more rows like the above", j-i-1))
+		} else {
+			result = append(result, rows[i:j]...)
+		}
+		i = j
+	}
+
+	out := header + "\n" + strings.Join(result, "\n")
+	if len(out) <= maxChars {
+		return out, true
+	}
+	// Keep the header so the remaining rows can still be read.
+	return header + "\n" + headAndTail(result, maxChars-len(header)-1), true
+}
+
+// rowKey is the row without the name column and with numbers normalized.
+func rowKey(row string, nameColumn int) string {
+	fields := strings.Fields(row)
+	if nameColumn >= 0 && nameColumn < len(fields) {
+		fields = append(fields[:nameColumn:nameColumn], fields[nameColumn+1:]...)
+	}
+	return normalize(strings.Join(fields, " "))
+}
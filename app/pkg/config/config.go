@@ -4,13 +4,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/fs"
+	"mime"
 	"os"
 	"os/user"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 
 	"github.com/jlewi/cloud-assistant/app/api"
+	"github.com/jlewi/cloud-assistant/app/pkg/redact"
+	"github.com/jlewi/cloud-assistant/app/pkg/risk"
+	"github.com/jlewi/cloud-assistant/app/pkg/usage"
 	pbcfg "github.com/jlewi/cloud-assistant/protos/gen/cassie/config"
 
 	"github.com/go-logr/zapr"
@@ -56,6 +61,10 @@ type Config struct {
 
 	OpenAI *OpenAIConfig `json:"openai,omitempty" yaml:"openai,omitempty"`
 
+	// ChatCompletions configures an OpenAI compatible Chat Completions endpoint (e.g. vLLM, Ollama).
+	// It is only used when CloudAssistant.Provider is ProviderChatCompletions.
+	ChatCompletions *ChatCompletionsConfig `json:"chatCompletions,omitempty" yaml:"chatCompletions,omitempty"`
+
 	CloudAssistant  *CloudAssistantConfig  `json:"cloudAssistant,omitempty" yaml:"cloudAssistant,omitempty"`
 	AssistantServer *AssistantServerConfig `json:"assistantServer,omitempty" yaml:"assistantServer,omitempty"`
 
@@ -65,20 +74,320 @@ type Config struct {
 	// IAMPolicy is the IAM policy for the service. It only matters if OIDC is enabled in the AssistantServerConfig.
 	IAMPolicy *api.IAMPolicy `json:"iamPolicy,omitempty" yaml:"iamPolicy,omitempty"`
 
+	// QuotaPolicy limits the number of tokens principals can use. Principals come from the ID token so it only
+	// matters if OIDC is enabled in the AssistantServerConfig.
+	QuotaPolicy *api.QuotaPolicy `json:"quotaPolicy,omitempty" yaml:"quotaPolicy,omitempty"`
+
 	// configFile is the configuration file used
 	configFile string
 }
 
+const (
+	// ProviderOpenAI uses the OpenAI Responses API.
+	ProviderOpenAI = "openai"
+	// ProviderChatCompletions uses an OpenAI compatible Chat Completions API.
+	ProviderChatCompletions = "chatCompletions"
+)
+
 type CloudAssistantConfig struct {
 	// VectorStores is the list of vector stores to use
 	VectorStores []string `json:"vectorStores,omitempty" yaml:"vectorStores,omitempty"`
 	CassieCookie string   `json:"cassieCookie,omitempty" yaml:"cassieCookie,omitempty"`
 	TargetURL    string   `json:"targetUrl,omitempty" yaml:"targetUrl,omitempty"`
+
+	// Provider is the LLM backend to use; either "openai" (default) or "chatCompletions".
+	Provider string `json:"provider,omitempty" yaml:"provider,omitempty"`
+
+	// Model is the default model to use when the request doesn't specify one.
+	Model string `json:"model,omitempty" yaml:"model,omitempty"`
+
+	// Models is the allow-list of models that requests can select along with the parameters to use for each model.
+	// The default model is always allowed.
+	Models []ModelConfig `json:"models,omitempty" yaml:"models,omitempty"`
+
+	// InstructionsFile is an optional path to a file containing the system instructions.
+	// The file is a Go text/template; see ai.PromptData for the available variables. The file is reloaded when it
+	// changes.
+	InstructionsFile string `json:"instructionsFile,omitempty" yaml:"instructionsFile,omitempty"`
+	// ShellToolDescriptionFile is an optional path to a file containing the description of the shell tool.
+	// Like InstructionsFile it is a Go text/template.
+	ShellToolDescriptionFile string `json:"shellToolDescriptionFile,omitempty" yaml:"shellToolDescriptionFile,omitempty"`
+	// PromptValues are custom key/values available to the templates as .Values
+	PromptValues map[string]string `json:"promptValues,omitempty" yaml:"promptValues,omitempty"`
+
+	// MCPServers are Model Context Protocol servers whose tools are exposed to the model alongside the shell tool.
+	// Calls to these tools are executed by the server.
+	MCPServers []MCPServerConfig `json:"mcpServers,omitempty" yaml:"mcpServers,omitempty"`
+
+	// Autopilot configures running read-only commands on the server without asking the user.
+	Autopilot *AutopilotConfig `json:"autopilot,omitempty" yaml:"autopilot,omitempty"`
+
+	// Risk configures how shell commands are classified as read-only, mutating or destructive.
+	Risk *RiskConfig `json:"risk,omitempty" yaml:"risk,omitempty"`
+
+	// Redaction configures how secrets are redacted from the outputs of commands before they are sent to the model.
+	Redaction *RedactionConfig `json:"redaction,omitempty" yaml:"redaction,omitempty"`
+
+	// Compaction configures how large command outputs are compacted before they are sent to the model.
+	Compaction *CompactionConfig `json:"compaction,omitempty" yaml:"compaction,omitempty"`
+
+	// ConversationStore configures where the responses and tool calls of conversations are stored.
+	ConversationStore *ConversationStoreConfig `json:"conversationStore,omitempty" yaml:"conversationStore,omitempty"`
+
+	// Stateless configures stateless mode in which clients send the whole conversation on every request.
+	Stateless *StatelessConfig `json:"stateless,omitempty" yaml:"stateless,omitempty"`
+
+	// Usage configures where the token usage of each response is recorded.
+	Usage *UsageConfig `json:"usage,omitempty" yaml:"usage,omitempty"`
+
+	// Feedback configures where the feedback users submit on responses is stored.
+	Feedback *FeedbackConfig `json:"feedback,omitempty" yaml:"feedback,omitempty"`
+
+	// LocalDocs configures searching a local directory of markdown documents as an alternative to VectorStores.
+	LocalDocs *LocalDocsConfig `json:"localDocs,omitempty" yaml:"localDocs,omitempty"`
+
+	// Links configures how the files returned by file search are converted to links displayed in the UI.
+	Links *LinksConfig `json:"links,omitempty" yaml:"links,omitempty"`
+
+	// Resilience configures retrying failed generations and falling back to other models or providers.
+	Resilience *ResilienceConfig `json:"resilience,omitempty" yaml:"resilience,omitempty"`
+
+	// Media configures the images and files in blocks (e.g. screenshots attached by the user or images output by
+	// commands) that are sent to the model.
+	Media *MediaConfig `json:"media,omitempty" yaml:"media,omitempty"`
+}
+
+// MediaConfig configures which images and files are sent to the model. Images are sent as image inputs and other
+// files (e.g. PDFs) as file inputs. Items that are too large or whose MIME type isn't allowed are replaced with a
+// note telling the model they were omitted.
+type MediaConfig struct {
+	// Disabled turns off sending images and files; they are always replaced with a note.
+	Disabled bool `json:"disabled,omitempty" yaml:"disabled,omitempty"`
+	// MaxBytes is the maximum size of a single image or file. If zero a default is used.
+	MaxBytes int `json:"maxBytes,omitempty" yaml:"maxBytes,omitempty"`
+	// AllowedMimeTypes are the MIME types that are sent to the model e.g. "image/png". A type ending in "/*"
+	// matches all subtypes e.g. "image/*". If empty a default list of image types and PDFs is used.
+	AllowedMimeTypes []string `json:"allowedMimeTypes,omitempty" yaml:"allowedMimeTypes,omitempty"`
+}
+
+// ResilienceConfig configures how failed generations are handled. A generation that fails with a transient error
+// (e.g. a 5xx or the stream being dropped) is restarted on the same model up to MaxAttempts times. If it still fails,
+// or the model is rate limited, the fallbacks are tried in order.
+type ResilienceConfig struct {
+	// MaxAttempts is the maximum number of attempts on each model. If zero a default is used.
+	MaxAttempts int `json:"maxAttempts,omitempty" yaml:"maxAttempts,omitempty"`
+	// Backoff is the delay before the first retry; it doubles with each retry. If zero a default is used.
+	Backoff time.Duration `json:"backoff,omitempty" yaml:"backoff,omitempty"`
+	// Fallbacks are the models to use when the model of a request is rate limited or unavailable.
+	Fallbacks []FallbackConfig `json:"fallbacks,omitempty" yaml:"fallbacks,omitempty"`
+}
+
+// FallbackConfig is a model to fall back to.
+type FallbackConfig struct {
+	// Model is the name of the model. If the model is in the models allow-list its parameters are used.
+	Model string `json:"model" yaml:"model"`
+	// Provider is the provider serving the model; either "openai" or "chatCompletions". If empty the primary
+	// provider is used. Providers don't share stored responses so a fallback on a different provider is only used
+	// for requests that don't continue a previous response, e.g. in stateless mode.
+	Provider string `json:"provider,omitempty" yaml:"provider,omitempty"`
+}
+
+// LinksConfig configures how files returned by file search are resolved to links. A file is looked up in the
+// manifest first, then the rules are tried in order and finally the fallback is used. If nothing applies the link
+// is the filename.
+//
+// Templates are Go text/templates; see links.LinkData for the available fields.
+type LinksConfig struct {
+	// ManifestFile is an optional YAML file mapping file IDs (e.g. vector store file IDs) or filenames to links.
+	// It is reloaded when it changes.
+	ManifestFile string `json:"manifestFile,omitempty" yaml:"manifestFile,omitempty"`
+	// Rules map filenames to links.
+	Rules []LinkRule `json:"rules,omitempty" yaml:"rules,omitempty"`
+	// Fallback is the template used for files that aren't in the manifest and don't match any rule.
+	Fallback string `json:"fallback,omitempty" yaml:"fallback,omitempty"`
+}
+
+// LinkRule maps the filenames that match the rule to links. Exactly one of Prefix and Regex must be set.
+type LinkRule struct {
+	// Prefix matches filenames that start with it.
+	Prefix string `json:"prefix,omitempty" yaml:"prefix,omitempty"`
+	// Regex matches filenames that match the regular expression.
+	Regex string `json:"regex,omitempty" yaml:"regex,omitempty"`
+	// Template is the template for the link.
+	Template string `json:"template" yaml:"template"`
+}
+
+// LocalDocsConfig configures the local documentation search tool. The markdown files in Dir are split into sections
+// and indexed with BM25 so the model can search them without the documents leaving the network.
+type LocalDocsConfig struct {
+	// Dir is the directory containing the markdown documents to index.
+	Dir string `json:"dir,omitempty" yaml:"dir,omitempty"`
+	// IndexPath is where the index is stored. If the file exists the index is loaded from it rather than rebuilt;
+	// run "cas index" to rebuild it. If empty the index is built in memory at startup.
+	IndexPath string `json:"indexPath,omitempty" yaml:"indexPath,omitempty"`
+	// MaxResults is the maximum number of sections returned by a search. If zero a default is used.
+	MaxResults int `json:"maxResults,omitempty" yaml:"maxResults,omitempty"`
+}
+
+// UsageConfig configures where token usage is recorded. Usage is attributed to the principal from the ID token.
+type UsageConfig struct {
+	// Path is the path of a bbolt database to record usage in. If empty usage is only logged, or kept in memory
+	// if there is a QuotaPolicy.
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+	// Retention is how long usage records are kept. If zero a default is used. It must be longer than the
+	// longest quota period so quotas aren't reset early.
+	Retention time.Duration `json:"retention,omitempty" yaml:"retention,omitempty"`
+}
+
+// FeedbackConfig configures where feedback is stored. Feedback is stored with a snapshot of the conversation and
+// the principal that submitted it; "cas feedback export" turns negative feedback into eval samples.
+type FeedbackConfig struct {
+	// Path is the path of a bbolt database to store feedback in. If empty feedback is only logged.
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+}
+
+// StatelessConfig configures stateless mode. In stateless mode the agent doesn't rely on the provider storing
+// previous responses (previous_response_id); instead the client sends all the blocks in the notebook and the agent
+// rebuilds the history from them. This is required for zero data retention and for providers that don't store
+// responses.
+type StatelessConfig struct {
+	// Enabled turns on stateless mode.
+	Enabled bool `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	// MaxInputTokens is the token budget for the history. Older blocks are dropped and large outputs truncated to
+	// fit. If zero a default is used.
+	MaxInputTokens int `json:"maxInputTokens,omitempty" yaml:"maxInputTokens,omitempty"`
+}
+
+// ConversationStoreConfig configures the conversation store. By default conversations are kept in memory which means
+// they are lost on restart and aren't shared between replicas.
+type ConversationStoreConfig struct {
+	// Path is the path of a bbolt database to store conversations in. It must be on a local disk; the database can't
+	// be shared between replicas.
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+	// TTL is how long conversations are kept. If zero a default is used.
+	TTL time.Duration `json:"ttl,omitempty" yaml:"ttl,omitempty"`
+}
+
+// AutopilotConfig configures autopilot. When enabled, shell commands the model proposes that are in Commands and
+// read-only (e.g. kubectl get) are run on the server and their output is sent back to the model. The agent stops and
+// returns to the user when the model proposes any other command or the step budget is exhausted. Commands are
+// classified using the Risk configuration.
+type AutopilotConfig struct {
+	// Enabled turns on autopilot.
+	Enabled bool `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	// Commands are the commands autopilot may run e.g. "kubectl get". They are matched like the commands of risk
+	// rules. Every command a program invokes must be in the list. Required if Enabled is true.
+	Commands []string `json:"commands,omitempty" yaml:"commands,omitempty"`
+	// MaxSteps is the maximum number of requests to the model per user request. If zero a default is used.
+	MaxSteps int `json:"maxSteps,omitempty" yaml:"maxSteps,omitempty"`
+	// CommandTimeout is how long a command can run before it is cancelled and its partial output is sent to the
+	// model. If zero a default is used.
+	CommandTimeout time.Duration `json:"commandTimeout,omitempty" yaml:"commandTimeout,omitempty"`
+}
+
+// RiskConfig configures how the shell commands proposed by the model are classified.
+type RiskConfig struct {
+	// Rules are added to risk.DefaultRules. A rule for the same command as a default rule overrides it.
+	Rules []risk.Rule `json:"rules,omitempty" yaml:"rules,omitempty"`
+	// DefaultLevel is the level of commands that don't match any rule. Defaults to mutating.
+	DefaultLevel risk.Level `json:"defaultLevel,omitempty" yaml:"defaultLevel,omitempty"`
+}
+
+// RedactionConfig configures redaction. Secrets are redacted using redact.DefaultRules (JWTs, AWS and Azure keys,
+// private keys, Kubernetes secret data, etc.) plus Rules.
+type RedactionConfig struct {
+	// Disabled turns off redaction.
+	Disabled bool `json:"disabled,omitempty" yaml:"disabled,omitempty"`
+	// Rules are added to redact.DefaultRules. A rule with the same name as a default rule overrides it.
+	Rules []redact.Rule `json:"rules,omitempty" yaml:"rules,omitempty"`
+}
+
+// CompactionConfig configures compaction of command outputs. Outputs larger than the budget are compacted based on
+// their format (JSON, YAML, tables and logs) rather than simply truncated.
+type CompactionConfig struct {
+	// Disabled turns off compaction.
+	Disabled bool `json:"disabled,omitempty" yaml:"disabled,omitempty"`
+	// MaxBlockTokens is the budget for the outputs of a single block. If zero a default is used.
+	MaxBlockTokens int `json:"maxBlockTokens,omitempty" yaml:"maxBlockTokens,omitempty"`
+}
+
+// MCPServerConfig configures a connection to an MCP server. Exactly one of Command or URL must be set.
+type MCPServerConfig struct {
+	// Name is a unique name for the server. It is used to prefix the names of the server's tools.
+	Name string `json:"name" yaml:"name"`
+	// Command is the command to launch a server that communicates over stdio.
+	Command string `json:"command,omitempty" yaml:"command,omitempty"`
+	// Args are the arguments for Command.
+	Args []string `json:"args,omitempty" yaml:"args,omitempty"`
+	// Env are additional environment variables for Command.
+	Env map[string]string `json:"env,omitempty" yaml:"env,omitempty"`
+	// URL is the endpoint of a server that uses the streamable HTTP transport.
+	URL string `json:"url,omitempty" yaml:"url,omitempty"`
+	// Headers are additional HTTP headers (e.g. Authorization) to send to URL.
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+}
+
+// ModelConfig configures a model that the assistant is allowed to use.
+type ModelConfig struct {
+	// Name is the name of the model e.g. gpt-4.1
+	Name string `json:"name" yaml:"name"`
+	// Temperature is the sampling temperature. If nil the API default is used.
+	Temperature *float64 `json:"temperature,omitempty" yaml:"temperature,omitempty"`
+	// ReasoningEffort is the reasoning effort for reasoning models; one of minimal, low, medium, high.
+	ReasoningEffort string `json:"reasoningEffort,omitempty" yaml:"reasoningEffort,omitempty"`
+	// ReasoningSummary is the detail of the reasoning summaries streamed to the client; one of auto, concise,
+	// detailed. If empty reasoning models don't stream summaries.
+	ReasoningSummary string `json:"reasoningSummary,omitempty" yaml:"reasoningSummary,omitempty"`
+	// MaxOutputTokens is the maximum number of output tokens. If zero the API default is used.
+	MaxOutputTokens int64 `json:"maxOutputTokens,omitempty" yaml:"maxOutputTokens,omitempty"`
 }
 
 type OpenAIConfig struct {
 	// APIKeyFile is the file containing the OpenAI API key
 	APIKeyFile string `json:"apiKeyFile,omitempty" yaml:"apiKeyFile,omitempty"`
+	// BaseURL overrides the URL of the OpenAI API e.g. https://proxy.acme.com/v1/. It is mostly useful for pointing
+	// the agent at a fake server in tests.
+	BaseURL string `json:"baseURL,omitempty" yaml:"baseURL,omitempty"`
+}
+
+// ChatCompletionsConfig is the configuration for an OpenAI compatible Chat Completions endpoint.
+type ChatCompletionsConfig struct {
+	// BaseURL is the base URL of the API e.g. http://localhost:8000/v1
+	BaseURL string `json:"baseURL,omitempty" yaml:"baseURL,omitempty"`
+	// APIKeyFile is an optional file containing the API key
+	APIKeyFile string `json:"apiKeyFile,omitempty" yaml:"apiKeyFile,omitempty"`
+	// Model is the model sent to the endpoint when the request doesn't select one. Self-hosted servers typically
+	// serve models under names that differ from the OpenAI model names. If cloudAssistant.model isn't set it is the
+	// default model.
+	Model string `json:"model,omitempty" yaml:"model,omitempty"`
+}
+
+// DefaultModel is the model used when none is configured.
+const DefaultModel = "gpt-4.1"
+
+// GetModel returns the default model.
+func (c *CloudAssistantConfig) GetModel() string {
+	if c == nil || c.Model == "" {
+		return DefaultModel
+	}
+	return c.Model
+}
+
+// GetModel returns the default model. If cloudAssistant.model isn't set and the provider is chatCompletions, the
+// model of the Chat Completions endpoint is the default.
+func (c *Config) GetModel() string {
+	if c.CloudAssistant.GetProvider() == ProviderChatCompletions && (c.CloudAssistant == nil || c.CloudAssistant.Model == "") && c.ChatCompletions != nil && c.ChatCompletions.Model != "" {
+		return c.ChatCompletions.Model
+	}
+	return c.CloudAssistant.GetModel()
+}
+
+// GetProvider returns the LLM provider to use.
+func (c *CloudAssistantConfig) GetProvider() string {
+	if c == nil || c.Provider == "" {
+		return ProviderOpenAI
+	}
+	return c.Provider
 }
 
 type Logging struct {
@@ -151,6 +460,152 @@ func (c *Config) GetConfigDir() string {
 func (c *Config) IsValid() []string {
 	problems := make([]string, 0, 1)
 
+	switch c.CloudAssistant.GetProvider() {
+	case ProviderOpenAI:
+	case ProviderChatCompletions:
+		if c.ChatCompletions == nil || c.ChatCompletions.BaseURL == "" {
+			problems = append(problems, "chatCompletions.baseURL must be set when using the chatCompletions provider")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("cloudAssistant.provider %q is not supported", c.CloudAssistant.GetProvider()))
+	}
+
+	if c.CloudAssistant != nil {
+		for i, m := range c.CloudAssistant.Models {
+			if m.Name == "" {
+				problems = append(problems, fmt.Sprintf("cloudAssistant.models[%d].name must be set", i))
+			}
+			switch m.ReasoningEffort {
+			case "", "minimal", "low", "medium", "high":
+			default:
+				problems = append(problems, fmt.Sprintf("cloudAssistant.models[%d].reasoningEffort %q must be one of minimal, low, medium, high", i, m.ReasoningEffort))
+			}
+			switch m.ReasoningSummary {
+			case "", "auto", "concise", "detailed":
+			default:
+				problems = append(problems, fmt.Sprintf("cloudAssistant.models[%d].reasoningSummary %q must be one of auto, concise, detailed", i, m.ReasoningSummary))
+			}
+		}
+
+		if c.CloudAssistant.Autopilot != nil && c.CloudAssistant.Autopilot.Enabled && len(c.CloudAssistant.Autopilot.Commands) == 0 {
+			problems = append(problems, "cloudAssistant.autopilot.commands must list the commands autopilot may run")
+		}
+
+		if c.CloudAssistant.Autopilot != nil && c.CloudAssistant.Autopilot.MaxSteps < 0 {
+			problems = append(problems, "cloudAssistant.autopilot.maxSteps must not be negative")
+		}
+
+		if c.CloudAssistant.Autopilot != nil && c.CloudAssistant.Autopilot.CommandTimeout < 0 {
+			problems = append(problems, "cloudAssistant.autopilot.commandTimeout must not be negative")
+		}
+
+		if c.CloudAssistant.Stateless != nil && c.CloudAssistant.Stateless.MaxInputTokens < 0 {
+			problems = append(problems, "cloudAssistant.stateless.maxInputTokens must not be negative")
+		}
+
+		if c.CloudAssistant.ConversationStore != nil && c.CloudAssistant.ConversationStore.TTL < 0 {
+			problems = append(problems, "cloudAssistant.conversationStore.ttl must not be negative")
+		}
+
+		if u := c.CloudAssistant.Usage; u != nil && u.Retention != 0 && u.Retention < 31*24*time.Hour {
+			problems = append(problems, "cloudAssistant.usage.retention must be at least 31 days (744h) so monthly quotas are enforced")
+		}
+
+		if r := c.CloudAssistant.Resilience; r != nil {
+			if r.MaxAttempts < 0 {
+				problems = append(problems, "cloudAssistant.resilience.maxAttempts must not be negative")
+			}
+			if r.Backoff < 0 {
+				problems = append(problems, "cloudAssistant.resilience.backoff must not be negative")
+			}
+			for i, f := range r.Fallbacks {
+				if f.Model == "" {
+					problems = append(problems, fmt.Sprintf("cloudAssistant.resilience.fallbacks[%d].model must be set", i))
+				}
+				switch f.Provider {
+				case "", ProviderOpenAI:
+				case ProviderChatCompletions:
+					if c.ChatCompletions == nil || c.ChatCompletions.BaseURL == "" {
+						problems = append(problems, fmt.Sprintf("cloudAssistant.resilience.fallbacks[%d] uses the chatCompletions provider but chatCompletions.baseURL isn't set", i))
+					}
+				default:
+					problems = append(problems, fmt.Sprintf("cloudAssistant.resilience.fallbacks[%d].provider %q is not supported", i, f.Provider))
+				}
+			}
+		}
+
+		if m := c.CloudAssistant.Media; m != nil {
+			if m.MaxBytes < 0 {
+				problems = append(problems, "cloudAssistant.media.maxBytes must not be negative")
+			}
+			for i, t := range m.AllowedMimeTypes {
+				if _, _, err := mime.ParseMediaType(t); err != nil {
+					problems = append(problems, fmt.Sprintf("cloudAssistant.media.allowedMimeTypes[%d] %q is invalid: %v", i, t, err))
+				}
+			}
+		}
+
+		if c.CloudAssistant.Compaction != nil && c.CloudAssistant.Compaction.MaxBlockTokens < 0 {
+			problems = append(problems, "cloudAssistant.compaction.maxBlockTokens must not be negative")
+		}
+
+		if c.CloudAssistant.Redaction != nil {
+			if _, err := redact.NewRedactor(c.CloudAssistant.Redaction.Rules); err != nil {
+				problems = append(problems, fmt.Sprintf("cloudAssistant.redaction is invalid: %v", err))
+			}
+		}
+
+		if l := c.CloudAssistant.Links; l != nil {
+			for i, r := range l.Rules {
+				if (r.Prefix == "") == (r.Regex == "") {
+					problems = append(problems, fmt.Sprintf("cloudAssistant.links.rules[%d] must set exactly one of prefix or regex", i))
+				}
+				if r.Regex != "" {
+					if _, err := regexp.Compile(r.Regex); err != nil {
+						problems = append(problems, fmt.Sprintf("cloudAssistant.links.rules[%d].regex is invalid: %v", i, err))
+					}
+				}
+				if r.Template == "" {
+					problems = append(problems, fmt.Sprintf("cloudAssistant.links.rules[%d].template must be set", i))
+				}
+			}
+		}
+
+		if docs := c.CloudAssistant.LocalDocs; docs != nil {
+			if docs.Dir == "" && docs.IndexPath == "" {
+				problems = append(problems, "cloudAssistant.localDocs.dir or cloudAssistant.localDocs.indexPath must be set")
+			}
+			if docs.MaxResults < 0 {
+				problems = append(problems, "cloudAssistant.localDocs.maxResults must not be negative")
+			}
+		}
+
+		if c.CloudAssistant.Risk != nil {
+			if _, err := risk.NewClassifier(c.CloudAssistant.Risk.Rules, c.CloudAssistant.Risk.DefaultLevel); err != nil {
+				problems = append(problems, fmt.Sprintf("cloudAssistant.risk is invalid: %v", err))
+			}
+		}
+
+		names := make(map[string]bool)
+		for i, s := range c.CloudAssistant.MCPServers {
+			if s.Name == "" {
+				problems = append(problems, fmt.Sprintf("cloudAssistant.mcpServers[%d].name must be set", i))
+			} else if names[s.Name] {
+				problems = append(problems, fmt.Sprintf("cloudAssistant.mcpServers[%d].name %q is not unique", i, s.Name))
+			}
+			names[s.Name] = true
+			if (s.Command == "") == (s.URL == "") {
+				problems = append(problems, fmt.Sprintf("cloudAssistant.mcpServers[%d] must set exactly one of command or url", i))
+			}
+		}
+	}
+
+	if c.QuotaPolicy != nil {
+		if isValid, msg := usage.IsValidPolicy(*c.QuotaPolicy); !isValid {
+			problems = append(problems, "quotaPolicy: "+msg)
+		}
+	}
+
 	return problems
 }
 
@@ -47,3 +47,47 @@ func Test_ConfigDefaultConfig(t *testing.T) {
 		})
 	}
 }
+
+func Test_ConfigGetModel(t *testing.T) {
+	cases := []struct {
+		name     string
+		config   Config
+		expected string
+	}{
+		{
+			name:     "default",
+			config:   Config{},
+			expected: DefaultModel,
+		},
+		{
+			name: "chat-completions",
+			config: Config{
+				CloudAssistant:  &CloudAssistantConfig{Provider: ProviderChatCompletions},
+				ChatCompletions: &ChatCompletionsConfig{Model: "qwen"},
+			},
+			expected: "qwen",
+		},
+		{
+			name: "configured",
+			config: Config{
+				CloudAssistant:  &CloudAssistantConfig{Provider: ProviderChatCompletions, Model: "llama"},
+				ChatCompletions: &ChatCompletionsConfig{Model: "qwen"},
+			},
+			expected: "llama",
+		},
+		{
+			name: "other-provider",
+			config: Config{
+				ChatCompletions: &ChatCompletionsConfig{Model: "qwen"},
+			},
+			expected: DefaultModel,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if actual := c.config.GetModel(); actual != c.expected {
+				t.Errorf("Want %s; got %s", c.expected, actual)
+			}
+		})
+	}
+}
@@ -121,8 +121,12 @@ func writeBlockMarkdown(sb *strings.Builder, block *cassie.Block, maxLength int)
 
 	switch block.GetKind() {
 	case cassie.BlockKind_CODE:
-		// Code just gets written as a code block
-		sb.WriteString("```" + BASHLANG + "\n")
+		// Code just gets written as a code block labeled with its language so the model can tell e.g. python from bash
+		language := block.GetLanguage()
+		if language == "" {
+			language = BASHLANG
+		}
+		sb.WriteString("```" + language + "\n")
 
 		data := block.GetContents()
 		if len(data) > maxInputLength && maxInputLength > 0 {
@@ -167,6 +171,10 @@ func writeBlockMarkdown(sb *strings.Builder, block *cassie.Block, maxLength int)
 				//
 				continue
 			}
+			if len(oi.GetBinaryData()) > 0 {
+				// Images and files can't be rendered as markdown; the agent sends them to the model separately.
+				continue
+			}
 
 			sb.WriteString("```" + OUTPUTLANG + "\n")
 			textData := oi.GetTextData()
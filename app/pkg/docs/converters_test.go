@@ -199,6 +199,15 @@ func Test_BlockToMarkdown(t *testing.T) {
 			},
 			expected: "```bash\necho \"something something\"\n```\n```output\nsomething something\n```\n",
 		},
+		{
+			name: "python",
+			block: &cassie.Block{
+				Kind:     cassie.BlockKind_CODE,
+				Language: "python",
+				Contents: "print(\"hello\")",
+			},
+			expected: "```python\nprint(\"hello\")\n```\n",
+		},
 		{
 			name: "filter-by-mime-type",
 			block: &cassie.Block{
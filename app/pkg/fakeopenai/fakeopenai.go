@@ -0,0 +1,412 @@
+// Package fakeopenai is an in-process fake of the streaming endpoint of the OpenAI Responses API. Tests script the
+// turns the fake streams e.g. "text, then two parallel shell calls, then an error" and point the agent at it using
+// OpenAIConfig.BaseURL so the agent and server can be tested end to end without network access.
+//
+// Like the real API the fake rejects requests that continue an unknown response or that don't send the outputs of
+// the function calls in the previous response.
+package fakeopenai
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// ShellToolName is the name of the shell tool the agent gives the model.
+	ShellToolName = "shell"
+)
+
+// Turn is the scripted response to a request. Build it by chaining the methods e.g.
+//
+//	fakeopenai.NewTurn().Text("Let me check.").ShellCall("kubectl get pods").ShellCall("kubectl get nodes")
+type Turn struct {
+	steps []step
+	// status is the HTTP status to reject the request with. If zero the request succeeds.
+	status  int
+	code    string
+	message string
+}
+
+// step streams one output item or error of a turn.
+type step struct {
+	kind string
+	text string
+	// name and arguments of a function call.
+	name      string
+	arguments string
+	results   []FileSearchResult
+	code      string
+	// summary are the parts of the summary of a reasoning item.
+	summary []string
+}
+
+// FileSearchResult is a result of a file_search call.
+type FileSearchResult struct {
+	FileID   string  `json:"file_id"`
+	Filename string  `json:"filename"`
+	Score    float64 `json:"score"`
+	Text     string  `json:"text,omitempty"`
+}
+
+// NewTurn returns an empty turn.
+func NewTurn() *Turn {
+	return &Turn{}
+}
+
+// Text streams an assistant message.
+func (t *Turn) Text(text string) *Turn {
+	t.steps = append(t.steps, step{kind: "text", text: text})
+	return t
+}
+
+// ShellCall streams a call to the shell tool.
+func (t *Turn) ShellCall(command string) *Turn {
+	args, err := json.Marshal(map[string]string{"shell": command})
+	if err != nil {
+		panic(err)
+	}
+	return t.FunctionCall(ShellToolName, string(args))
+}
+
+// Reasoning streams a reasoning item whose summary has the given parts.
+func (t *Turn) Reasoning(summary ...string) *Turn {
+	t.steps = append(t.steps, step{kind: "reasoning", summary: summary})
+	return t
+}
+
+// FunctionCall streams a call to the function name with the JSON encoded arguments.
+func (t *Turn) FunctionCall(name string, arguments string) *Turn {
+	t.steps = append(t.steps, step{kind: "function_call", name: name, arguments: arguments})
+	return t
+}
+
+// FileSearch streams a file_search call with the results.
+func (t *Turn) FileSearch(results ...FileSearchResult) *Turn {
+	t.steps = append(t.steps, step{kind: "file_search_call", results: results})
+	return t
+}
+
+// Error streams an error event and ends the stream. code is e.g. "server_error" or "rate_limit_exceeded". The
+// response isn't stored so it can't be continued.
+func (t *Turn) Error(code string, message string) *Turn {
+	t.steps = append(t.steps, step{kind: "error", code: code, text: message})
+	return t
+}
+
+// Reject rejects the request with the HTTP status instead of streaming the turn.
+func (t *Turn) Reject(status int, code string, message string) *Turn {
+	t.status = status
+	t.code = code
+	t.message = message
+	return t
+}
+
+// Request is a request the fake received.
+type Request struct {
+	Model              string `json:"model"`
+	PreviousResponseID string `json:"previous_response_id"`
+	Instructions       string `json:"instructions"`
+	Stream             bool   `json:"stream"`
+	// Input are the input items. It is empty if the input was a string.
+	Input []InputItem `json:"-"`
+	// Body is the raw body of the request.
+	Body string `json:"-"`
+}
+
+// InputItem is an input item of a request. Only the fields the fake uses are decoded.
+type InputItem struct {
+	Type   string `json:"type"`
+	Role   string `json:"role"`
+	CallID string `json:"call_id"`
+	Output string `json:"output"`
+	// Raw is the JSON of the item.
+	Raw json.RawMessage `json:"-"`
+}
+
+// Server is a fake Responses API server.
+type Server struct {
+	server *httptest.Server
+
+	mu       sync.Mutex
+	turns    []*Turn
+	requests []*Request
+	// pendingCalls are the call IDs of the function calls in each stored response.
+	pendingCalls map[string][]string
+	nextID       int
+}
+
+// NewServer starts a fake that streams the turns in order; one per request. Close it when done.
+func NewServer(turns ...*Turn) *Server {
+	s := &Server{
+		turns:        turns,
+		pendingCalls: make(map[string][]string),
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// BaseURL is the URL to set as OpenAIConfig.BaseURL.
+func (s *Server) BaseURL() string {
+	return s.server.URL + "/v1/"
+}
+
+// Close shuts the server down.
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// AddTurns scripts more turns.
+func (s *Server) AddTurns(turns ...*Turn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.turns = append(s.turns, turns...)
+}
+
+// Requests returns the requests received so far.
+func (s *Server) Requests() []*Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Request{}, s.requests...)
+}
+
+// Remaining returns the number of scripted turns that haven't been streamed.
+func (s *Server) Remaining() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.turns)
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != "/v1/responses" {
+		writeError(w, http.StatusNotFound, "not_found", fmt.Sprintf("The fake doesn't implement %s %s", r.Method, r.URL.Path))
+		return
+	}
+	req, err := parseRequest(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	if !req.Stream {
+		s.mu.Unlock()
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "The fake only supports streaming requests")
+		return
+	}
+	if req.PreviousResponseID != "" {
+		calls, ok := s.pendingCalls[req.PreviousResponseID]
+		if !ok {
+			s.mu.Unlock()
+			writeError(w, http.StatusBadRequest, "previous_response_not_found", fmt.Sprintf("Previous response with id '%s' not found.", req.PreviousResponseID))
+			return
+		}
+		outputs := make(map[string]bool)
+		for _, item := range req.Input {
+			if item.Type == "function_call_output" {
+				outputs[item.CallID] = true
+			}
+		}
+		for _, id := range calls {
+			if !outputs[id] {
+				s.mu.Unlock()
+				writeError(w, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("No tool output found for function call %s.", id))
+				return
+			}
+		}
+	}
+	if len(s.turns) == 0 {
+		s.mu.Unlock()
+		writeError(w, http.StatusInternalServerError, "server_error", "The fake has no more turns scripted")
+		return
+	}
+	turn := s.turns[0]
+	s.turns = s.turns[1:]
+	s.nextID++
+	responseID := fmt.Sprintf("resp_%d", s.nextID)
+	s.mu.Unlock()
+
+	if turn.status != 0 {
+		writeError(w, turn.status, turn.code, turn.message)
+		return
+	}
+
+	s.stream(w, responseID, req.Model, turn)
+}
+
+// stream streams the turn as server-sent events. The response is stored once it completes so it can be continued.
+func (s *Server) stream(w http.ResponseWriter, responseID string, model string, turn *Turn) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+	e := &encoder{w: w}
+
+	response := map[string]any{
+		"id":     responseID,
+		"object": "response",
+		"status": "in_progress",
+		"model":  model,
+		"output": []any{},
+	}
+	e.send("response.created", map[string]any{"response": response})
+
+	output := make([]any, 0, len(turn.steps))
+	calls := make([]string, 0, len(turn.steps))
+	for i, st := range turn.steps {
+		itemID := fmt.Sprintf("%s_%d", responseID, i)
+		switch st.kind {
+		case "text":
+			itemID = "msg_" + itemID
+			e.send("response.output_item.added", map[string]any{
+				"output_index": i,
+				"item":         map[string]any{"type": "message", "id": itemID, "role": "assistant", "status": "in_progress", "content": []any{}},
+			})
+			for _, delta := range strings.SplitAfter(st.text, " ") {
+				e.send("response.output_text.delta", map[string]any{"item_id": itemID, "output_index": i, "content_index": 0, "delta": delta})
+			}
+			e.send("response.output_text.done", map[string]any{"item_id": itemID, "output_index": i, "content_index": 0, "text": st.text})
+			item := map[string]any{
+				"type":    "message",
+				"id":      itemID,
+				"role":    "assistant",
+				"status":  "completed",
+				"content": []any{map[string]any{"type": "output_text", "text": st.text, "annotations": []any{}}},
+			}
+			e.send("response.output_item.done", map[string]any{"output_index": i, "item": item})
+			output = append(output, item)
+		case "function_call":
+			callID := "call_" + itemID
+			itemID = "fc_" + itemID
+			item := map[string]any{"type": "function_call", "id": itemID, "call_id": callID, "name": st.name, "arguments": "", "status": "in_progress"}
+			e.send("response.output_item.added", map[string]any{"output_index": i, "item": item})
+			e.send("response.function_call_arguments.delta", map[string]any{"item_id": itemID, "output_index": i, "delta": st.arguments})
+			e.send("response.function_call_arguments.done", map[string]any{"item_id": itemID, "output_index": i, "arguments": st.arguments})
+			item = map[string]any{"type": "function_call", "id": itemID, "call_id": callID, "name": st.name, "arguments": st.arguments, "status": "completed"}
+			e.send("response.output_item.done", map[string]any{"output_index": i, "item": item})
+			output = append(output, item)
+			calls = append(calls, callID)
+		case "reasoning":
+			itemID = "rs_" + itemID
+			e.send("response.output_item.added", map[string]any{
+				"output_index": i,
+				"item":         map[string]any{"type": "reasoning", "id": itemID, "summary": []any{}},
+			})
+			summary := make([]any, 0, len(st.summary))
+			for j, text := range st.summary {
+				part := map[string]any{"type": "summary_text", "text": text}
+				e.send("response.reasoning_summary_part.added", map[string]any{"item_id": itemID, "output_index": i, "summary_index": j, "part": map[string]any{"type": "summary_text", "text": ""}})
+				for _, delta := range strings.SplitAfter(text, " ") {
+					e.send("response.reasoning_summary_text.delta", map[string]any{"item_id": itemID, "output_index": i, "summary_index": j, "delta": delta})
+				}
+				e.send("response.reasoning_summary_text.done", map[string]any{"item_id": itemID, "output_index": i, "summary_index": j, "text": text})
+				e.send("response.reasoning_summary_part.done", map[string]any{"item_id": itemID, "output_index": i, "summary_index": j, "part": part})
+				summary = append(summary, part)
+			}
+			item := map[string]any{"type": "reasoning", "id": itemID, "summary": summary}
+			e.send("response.output_item.done", map[string]any{"output_index": i, "item": item})
+			output = append(output, item)
+		case "file_search_call":
+			itemID = "fs_" + itemID
+			e.send("response.output_item.added", map[string]any{
+				"output_index": i,
+				"item":         map[string]any{"type": "file_search_call", "id": itemID, "status": "in_progress", "queries": []string{}},
+			})
+			item := map[string]any{"type": "file_search_call", "id": itemID, "status": "completed", "queries": []string{}, "results": st.results}
+			e.send("response.output_item.done", map[string]any{"output_index": i, "item": item})
+			output = append(output, item)
+		case "error":
+			// The SDK reports events with an error field as an error and stops reading the stream.
+			e.send("error", map[string]any{"error": map[string]any{"type": st.code, "code": st.code, "message": st.text}})
+			return
+		}
+	}
+
+	response["status"] = "completed"
+	response["output"] = output
+	response["usage"] = map[string]any{
+		"input_tokens":          100,
+		"input_tokens_details":  map[string]any{"cached_tokens": 0},
+		"output_tokens":         10 * len(turn.steps),
+		"output_tokens_details": map[string]any{"reasoning_tokens": 0},
+		"total_tokens":          100 + 10*len(turn.steps),
+	}
+	// Store the response before it completes since the client can continue it as soon as it sees the event.
+	s.mu.Lock()
+	s.pendingCalls[responseID] = calls
+	s.mu.Unlock()
+	e.send("response.completed", map[string]any{"response": response})
+}
+
+// encoder writes server-sent events.
+type encoder struct {
+	w        http.ResponseWriter
+	sequence int
+}
+
+func (e *encoder) send(eventType string, data map[string]any) {
+	data["type"] = eventType
+	data["sequence_number"] = e.sequence
+	e.sequence++
+	b, err := json.Marshal(data)
+	if err != nil {
+		panic(err)
+	}
+	// Errors are ignored since the client hung up.
+	_, _ = fmt.Fprintf(e.w, "event: %s\ndata: %s\n\n", eventType, b)
+	if f, ok := e.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// parseRequest parses the body of a request.
+func parseRequest(r *http.Request) (*Request, error) {
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read the request body")
+	}
+	req := &Request{Body: string(b)}
+	if err := json.Unmarshal(b, req); err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse the request body")
+	}
+	input := struct {
+		Input json.RawMessage `json:"input"`
+	}{}
+	if err := json.Unmarshal(b, &input); err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse the request input")
+	}
+	if len(input.Input) == 0 || input.Input[0] != '[' {
+		return req, nil
+	}
+	raw := []json.RawMessage{}
+	if err := json.Unmarshal(input.Input, &raw); err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse the input items")
+	}
+	for _, r := range raw {
+		item := InputItem{Raw: r}
+		if err := json.Unmarshal(r, &item); err != nil {
+			return nil, errors.Wrapf(err, "Failed to parse input item")
+		}
+		req.Input = append(req.Input, item)
+	}
+	return req, nil
+}
+
+// writeError writes an error the way the OpenAI API does.
+func writeError(w http.ResponseWriter, status int, code string, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"error": map[string]any{
+			"message": message,
+			"type":    code,
+			"code":    code,
+			"param":   nil,
+		},
+	})
+}
@@ -0,0 +1,93 @@
+package fakeopenai
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"github.com/openai/openai-go/responses"
+	"github.com/pkg/errors"
+)
+
+func Test_Server(t *testing.T) {
+	s := NewServer(
+		NewTurn().Text("Let me check.").ShellCall("kubectl get pods"),
+		NewTurn().Text("pod-1 is running."),
+		NewTurn().Text("Hello").Error("server_error", "The server had an error"),
+	)
+	defer s.Close()
+	client := openai.NewClient(option.WithBaseURL(s.BaseURL()), option.WithAPIKey("fake"), option.WithMaxRetries(0))
+	ctx := context.Background()
+
+	// stream sends the request and returns the events it streamed.
+	stream := func(params responses.ResponseNewParams) ([]responses.ResponseStreamEventUnion, error) {
+		t.Helper()
+		params.Model = openai.ChatModelGPT4_1
+		events := client.Responses.NewStreaming(ctx, params)
+		defer events.Close()
+		var got []responses.ResponseStreamEventUnion
+		for events.Next() {
+			got = append(got, events.Current())
+		}
+		return got, events.Err()
+	}
+
+	events, err := stream(responses.ResponseNewParams{Input: responses.ResponseNewParamsInputUnion{OfString: openai.String("What's running?")}})
+	if err != nil {
+		t.Fatalf("Streaming failed: %+v", err)
+	}
+	text := ""
+	callID := ""
+	responseID := ""
+	for _, e := range events {
+		switch e.Type {
+		case "response.output_text.delta":
+			text += e.Delta
+		case "response.function_call_arguments.done":
+			if e.Arguments != `{"shell":"kubectl get pods"}` {
+				t.Errorf("Unexpected arguments: %s", e.Arguments)
+			}
+		case "response.output_item.added":
+			if e.Item.Type == "function_call" {
+				callID = e.Item.CallID
+			}
+		case "response.completed":
+			responseID = e.Response.ID
+		}
+	}
+	if text != "Let me check." || callID == "" || responseID == "" {
+		t.Fatalf("Unexpected stream: text %q, call %q, response %q", text, callID, responseID)
+	}
+
+	// Continuing the response without the output of the call fails like it does with the real API.
+	_, err = stream(responses.ResponseNewParams{
+		PreviousResponseID: openai.String(responseID),
+		Input:              responses.ResponseNewParamsInputUnion{OfString: openai.String("Well?")},
+	})
+	var apiErr *openai.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected a 400 for a missing tool output; got %v", err)
+	}
+
+	if _, err := stream(responses.ResponseNewParams{
+		PreviousResponseID: openai.String(responseID),
+		Input: responses.ResponseNewParamsInputUnion{OfInputItemList: responses.ResponseInputParam{
+			responses.ResponseInputItemParamOfFunctionCallOutput(callID, "pod-1 Running"),
+		}},
+	}); err != nil {
+		t.Fatalf("Streaming failed: %+v", err)
+	}
+	requests := s.Requests()
+	if len(requests) != 3 || len(requests[2].Input) != 1 || requests[2].Input[0].Output != "pod-1 Running" {
+		t.Errorf("Unexpected requests: %+v", requests)
+	}
+
+	if _, err := stream(responses.ResponseNewParams{Input: responses.ResponseNewParamsInputUnion{OfString: openai.String("Hi")}}); err == nil {
+		t.Errorf("Expected the stream to fail")
+	}
+	if s.Remaining() != 0 {
+		t.Errorf("Expected all turns to be streamed")
+	}
+}
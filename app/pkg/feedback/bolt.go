@@ -0,0 +1,62 @@
+package feedback
+
+import (
+	"context"
+	"time"
+
+	"github.com/jlewi/cloud-assistant/app/pkg/boltdb"
+	"github.com/jlewi/cloud-assistant/protos/gen/cassie"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+var feedbackBucket = []byte("feedback")
+
+// BoltStore is a Store backed by a bbolt database on a local disk. Feedback is keyed by time so listing recent
+// feedback doesn't scan older feedback.
+type BoltStore struct {
+	db *boltdb.DB
+}
+
+// NewBoltStore creates a store using the database at path.
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := boltdb.New(path, "feedback store", feedbackBucket)
+	if err != nil {
+		return nil, err
+	}
+	return &BoltStore{db: db}, nil
+}
+
+// Close closes the database.
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *BoltStore) Add(ctx context.Context, f *cassie.Feedback) error {
+	value, err := protojson.Marshal(f)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to marshal feedback %s", f.GetId())
+	}
+	// The ID makes the key unique if two users submit feedback at the same time.
+	key := append(boltdb.TimeKey(f.GetCreateTime().AsTime()), []byte(f.GetId())...)
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return errors.Wrapf(tx.Bucket(feedbackBucket).Put(key, value), "Failed to store feedback %s", f.GetId())
+	})
+}
+
+func (s *BoltStore) List(ctx context.Context, since time.Time) ([]*cassie.Feedback, error) {
+	result := make([]*cassie.Feedback, 0, 10)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(feedbackBucket).Cursor()
+		for k, v := c.Seek(boltdb.TimeKey(since)); k != nil; k, v = c.Next() {
+			f := &cassie.Feedback{}
+			if err := protojson.Unmarshal(v, f); err != nil {
+				return errors.Wrapf(err, "Failed to unmarshal feedback %s", k)
+			}
+			result = append(result, f)
+		}
+		return nil
+	})
+	return result, err
+}
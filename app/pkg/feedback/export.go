@@ -0,0 +1,136 @@
+package feedback
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jlewi/cloud-assistant/protos/gen/cassie"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/encoding/protojson"
+	"gopkg.in/yaml.v3"
+)
+
+// missingInput is the input of samples whose conversation snapshot doesn't contain the user's question.
+const missingInput = "TODO: the question the user asked"
+
+// EvalSample returns a skeleton of an eval sample for the feedback. The input is the last question the user asked
+// before the rated block. The assertions are derived from the corrected command and the comment; they are a
+// starting point and should be reviewed before the sample is added to a dataset.
+func EvalSample(f *cassie.Feedback) *cassie.EvalSample {
+	sample := &cassie.EvalSample{
+		Kind:      "EvalSample",
+		Metadata:  &cassie.ObjectMeta{Name: "feedback-" + f.GetId()},
+		InputText: question(f),
+	}
+
+	if command := strings.TrimSpace(f.GetCorrectedCommand()); command != "" {
+		sample.Assertions = append(sample.Assertions, &cassie.Assertion{
+			Name: "suggests-corrected-command",
+			Type: cassie.Assertion_TYPE_CODEBLOCK_REGEX,
+			Payload: &cassie.Assertion_CodeblockRegex_{CodeblockRegex: &cassie.Assertion_CodeblockRegex{
+				Regex: regexp.QuoteMeta(command),
+			}},
+		})
+		if program, flags := commandFlags(command); len(flags) > 0 {
+			sample.Assertions = append(sample.Assertions, &cassie.Assertion{
+				Name: "required-flags",
+				Type: cassie.Assertion_TYPE_SHELL_REQUIRED_FLAG,
+				Payload: &cassie.Assertion_ShellRequiredFlag_{ShellRequiredFlag: &cassie.Assertion_ShellRequiredFlag{
+					Command: program,
+					Flags:   flags,
+				}},
+			})
+		}
+	}
+
+	prompt := "A user said a previous answer to this question was wrong."
+	if c := strings.TrimSpace(f.GetComment()); c != "" {
+		prompt += fmt.Sprintf(" Their feedback was: %q.", c)
+	}
+	if c := strings.TrimSpace(f.GetCorrectedCommand()); c != "" {
+		prompt += fmt.Sprintf(" The command they expected was `%s`.", c)
+	}
+	prompt += " Does the answer avoid the mistake?"
+	sample.Assertions = append(sample.Assertions, &cassie.Assertion{
+		Name:    "addresses-feedback",
+		Type:    cassie.Assertion_TYPE_LLM_JUDGE,
+		Payload: &cassie.Assertion_LlmJudge{LlmJudge: &cassie.Assertion_LLMJudge{Prompt: prompt}},
+	})
+	return sample
+}
+
+// MarshalEvalSample returns the sample for the feedback as YAML in the format of the files in an eval dataset. A
+// comment at the top describes the feedback it was generated from.
+func MarshalEvalSample(f *cassie.Feedback) ([]byte, error) {
+	b, err := protojson.Marshal(EvalSample(f))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to marshal eval sample for feedback %s", f.GetId())
+	}
+	// JSON is YAML so decoding it into a node keeps the order of the fields.
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal(b, doc); err != nil {
+		return nil, errors.Wrapf(err, "Failed to convert eval sample for feedback %s to YAML", f.GetId())
+	}
+	clearStyle(doc)
+
+	principal := f.GetPrincipal()
+	if principal == "" {
+		principal = "an unauthenticated user"
+	}
+	doc.HeadComment = fmt.Sprintf("Generated from feedback %s submitted by %s on %s.\nReview the input and assertions before adding the sample to a dataset.", f.GetId(), principal, f.GetCreateTime().AsTime().Format("2006-01-02"))
+	if c := strings.TrimSpace(f.GetComment()); c != "" {
+		doc.HeadComment += "\nComment: " + strings.ReplaceAll(c, "\n", " ")
+	}
+	return yaml.Marshal(doc)
+}
+
+// question returns the last question the user asked before the rated block. If the block isn't in the snapshot the
+// last question in the snapshot is used.
+func question(f *cassie.Feedback) string {
+	blocks := f.GetBlocks()
+	end := len(blocks)
+	for i, b := range blocks {
+		if f.GetBlockId() != "" && b.GetId() == f.GetBlockId() {
+			end = i
+			break
+		}
+	}
+	for i := end - 1; i >= 0; i-- {
+		b := blocks[i]
+		if b.GetKind() == cassie.BlockKind_MARKUP && b.GetRole() == cassie.BlockRole_BLOCK_ROLE_USER && strings.TrimSpace(b.GetContents()) != "" {
+			return b.GetContents()
+		}
+	}
+	return missingInput
+}
+
+// commandFlags returns the program and the flags of a command e.g. "kubectl" and ["--context", "-n"] for
+// "kubectl --context=prod -n web get pods". Values given with "=" are dropped.
+func commandFlags(command string) (string, []string) {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return "", nil
+	}
+	flags := make([]string, 0, len(fields))
+	seen := make(map[string]bool)
+	for _, field := range fields[1:] {
+		if !strings.HasPrefix(field, "-") || field == "-" || field == "--" {
+			continue
+		}
+		flag, _, _ := strings.Cut(field, "=")
+		if !seen[flag] {
+			seen[flag] = true
+			flags = append(flags, flag)
+		}
+	}
+	return fields[0], flags
+}
+
+// clearStyle resets the style of the node and its children so that it is written as block YAML rather than JSON.
+func clearStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, c := range n.Content {
+		clearStyle(c)
+	}
+}
@@ -0,0 +1,55 @@
+// Package feedback stores the ratings users give responses and turns them into eval samples.
+package feedback
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jlewi/cloud-assistant/protos/gen/cassie"
+	"google.golang.org/protobuf/proto"
+)
+
+// Store stores feedback.
+type Store interface {
+	// Add adds feedback.
+	Add(ctx context.Context, f *cassie.Feedback) error
+	// List returns the feedback submitted at or after since ordered by time.
+	List(ctx context.Context, since time.Time) ([]*cassie.Feedback, error)
+}
+
+// MemoryStore is a Store that keeps feedback in memory. Feedback is lost when the server restarts.
+type MemoryStore struct {
+	mu       sync.Mutex
+	feedback []*cassie.Feedback
+}
+
+// NewMemoryStore creates a new MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		feedback: make([]*cassie.Feedback, 0, 10),
+	}
+}
+
+func (s *MemoryStore) Add(ctx context.Context, f *cassie.Feedback) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.feedback = append(s.feedback, proto.Clone(f).(*cassie.Feedback))
+	return nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, since time.Time) ([]*cassie.Feedback, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]*cassie.Feedback, 0, len(s.feedback))
+	for _, f := range s.feedback {
+		if !f.GetCreateTime().AsTime().Before(since) {
+			result = append(result, proto.Clone(f).(*cassie.Feedback))
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].GetCreateTime().AsTime().Before(result[j].GetCreateTime().AsTime())
+	})
+	return result, nil
+}
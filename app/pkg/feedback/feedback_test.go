@@ -0,0 +1,136 @@
+package feedback
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"buf.build/go/protovalidate"
+	"github.com/google/go-cmp/cmp"
+	"github.com/jlewi/cloud-assistant/protos/gen/cassie"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gopkg.in/yaml.v3"
+)
+
+func Test_BoltStore(t *testing.T) {
+	store, err := NewBoltStore(filepath.Join(t.TempDir(), "feedback.db"))
+	if err != nil {
+		t.Fatalf("Failed to create store: %+v", err)
+	}
+	ctx := context.Background()
+	start := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	for i, id := range []string{"fb_1", "fb_2", "fb_3"} {
+		if err := store.Add(ctx, &cassie.Feedback{
+			Id:         id,
+			CreateTime: timestamppb.New(start.Add(time.Duration(i) * time.Hour)),
+			Rating:     cassie.Rating_RATING_THUMBS_DOWN,
+			Blocks:     []*cassie.Block{{Id: "user_1", Contents: "What's running?"}},
+		}); err != nil {
+			t.Fatalf("Failed to add feedback: %+v", err)
+		}
+	}
+
+	got, err := store.List(ctx, start.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Failed to list feedback: %+v", err)
+	}
+	ids := make([]string, 0, len(got))
+	for _, f := range got {
+		ids = append(ids, f.GetId())
+	}
+	if d := cmp.Diff([]string{"fb_2", "fb_3"}, ids); d != "" {
+		t.Errorf("Unexpected feedback (-want +got):\n%s", d)
+	}
+	if got[0].GetBlocks()[0].GetContents() != "What's running?" {
+		t.Errorf("Expected the snapshot to be stored; got %v", got[0])
+	}
+
+	// Exporting without --since lists all the feedback.
+	all, err := store.List(ctx, time.Time{})
+	if err != nil {
+		t.Fatalf("Failed to list feedback: %+v", err)
+	}
+	if len(all) != 3 {
+		t.Errorf("Expected all 3 feedback; got %d", len(all))
+	}
+}
+
+func Test_MarshalEvalSample(t *testing.T) {
+	f := &cassie.Feedback{
+		Id:               "fb_1",
+		CreateTime:       timestamppb.New(time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)),
+		Principal:        "alice@acme.com",
+		BlockId:          "fc_1",
+		Rating:           cassie.Rating_RATING_THUMBS_DOWN,
+		Comment:          "It forgot the context",
+		CorrectedCommand: "kubectl --context=prod -n web get pods",
+		Blocks: []*cassie.Block{
+			{Id: "user_1", Kind: cassie.BlockKind_MARKUP, Role: cassie.BlockRole_BLOCK_ROLE_USER, Contents: "What's running in web?"},
+			{Id: "fc_1", Kind: cassie.BlockKind_CODE, Role: cassie.BlockRole_BLOCK_ROLE_ASSISTANT, Contents: "kubectl get pods"},
+			{Id: "user_2", Kind: cassie.BlockKind_MARKUP, Role: cassie.BlockRole_BLOCK_ROLE_USER, Contents: "Thanks"},
+		},
+	}
+
+	b, err := MarshalEvalSample(f)
+	if err != nil {
+		t.Fatalf("Failed to marshal sample: %+v", err)
+	}
+	if !strings.HasPrefix(string(b), "# Generated from feedback fb_1 submitted by alice@acme.com on 2025-06-01.") {
+		t.Errorf("Expected a comment describing the feedback; got\n%s", b)
+	}
+
+	// Load the sample the same way the eval command loads a dataset.
+	var obj any
+	if err := yaml.Unmarshal(b, &obj); err != nil {
+		t.Fatalf("Failed to parse sample: %+v", err)
+	}
+	jsonData, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatalf("Failed to convert sample to JSON: %+v", err)
+	}
+	sample := &cassie.EvalSample{}
+	if err := protojson.Unmarshal(jsonData, sample); err != nil {
+		t.Fatalf("Failed to unmarshal sample: %+v", err)
+	}
+	if err := protovalidate.Validate(sample); err != nil {
+		t.Errorf("Sample is invalid: %+v", err)
+	}
+
+	expected := &cassie.EvalSample{
+		Kind:      "EvalSample",
+		Metadata:  &cassie.ObjectMeta{Name: "feedback-fb_1"},
+		InputText: "What's running in web?",
+		Assertions: []*cassie.Assertion{
+			{
+				Name: "suggests-corrected-command",
+				Type: cassie.Assertion_TYPE_CODEBLOCK_REGEX,
+				Payload: &cassie.Assertion_CodeblockRegex_{CodeblockRegex: &cassie.Assertion_CodeblockRegex{
+					Regex: `kubectl --context=prod -n web get pods`,
+				}},
+			},
+			{
+				Name: "required-flags",
+				Type: cassie.Assertion_TYPE_SHELL_REQUIRED_FLAG,
+				Payload: &cassie.Assertion_ShellRequiredFlag_{ShellRequiredFlag: &cassie.Assertion_ShellRequiredFlag{
+					Command: "kubectl",
+					Flags:   []string{"--context", "-n"},
+				}},
+			},
+			{
+				Name: "addresses-feedback",
+				Type: cassie.Assertion_TYPE_LLM_JUDGE,
+				Payload: &cassie.Assertion_LlmJudge{LlmJudge: &cassie.Assertion_LLMJudge{
+					Prompt: "A user said a previous answer to this question was wrong. Their feedback was: \"It forgot the context\". The command they expected was `kubectl --context=prod -n web get pods`. Does the answer avoid the mistake?",
+				}},
+			},
+		},
+	}
+	if d := cmp.Diff(expected, sample, protocmp.Transform()); d != "" {
+		t.Errorf("Unexpected sample (-want +got):\n%s", d)
+	}
+}
@@ -13,6 +13,8 @@ type IDTokenKeyType string
 
 const (
 	IDTokenKey IDTokenKeyType = "idToken"
+	// PrincipalKey is the key used to store the authorized principal in the context
+	PrincipalKey IDTokenKeyType = "principal"
 )
 
 // GetIDToken retrieves the ID token from the context if there is one or nil
@@ -32,3 +34,18 @@ func GetIDToken(ctx context.Context) (*jwt.Token, error) {
 func ContextWithIDToken(ctx context.Context, idToken *jwt.Token) context.Context {
 	return context.WithValue(ctx, IDTokenKey, idToken)
 }
+
+// ContextWithPrincipal adds the principal to the context
+func ContextWithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, PrincipalKey, principal)
+}
+
+// GetPrincipal returns the principal the request was authorized as or the empty string if there isn't one.
+// The principal is empty when OIDC isn't enabled.
+func GetPrincipal(ctx context.Context) string {
+	principal, ok := ctx.Value(PrincipalKey).(string)
+	if !ok {
+		return ""
+	}
+	return principal
+}
@@ -0,0 +1,179 @@
+// Package links resolves the files returned by file search to links the user can click on e.g. the runbook in
+// GitHub or the wiki.
+package links
+
+import (
+	"bytes"
+	"net/url"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/go-logr/zapr"
+	"github.com/jlewi/cloud-assistant/app/pkg/config"
+	"github.com/jlewi/cloud-assistant/app/pkg/reload"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// LinkData is the data available to the link templates.
+//
+// For example
+//
+//	https://github.com/acme/runbooks/blob/main/{{.Path}}
+type LinkData struct {
+	// FileID is the ID of the file e.g. the ID of the file in the vector store.
+	FileID string
+	// Filename is the name of the file.
+	Filename string
+	// Path is the filename with the rule's prefix removed. For regex rules and the fallback it is the filename.
+	Path string
+	// Matches are the submatches of the rule's regex; Matches[0] is the whole match.
+	Matches []string
+}
+
+var templateFuncs = template.FuncMap{
+	"pathEscape":  url.PathEscape,
+	"queryEscape": url.QueryEscape,
+}
+
+type rule struct {
+	prefix string
+	regex  *regexp.Regexp
+	tmpl   *template.Template
+}
+
+// Resolver resolves files to links. Files are resolved by checking, in order,
+//  1. the manifest for the file ID and then the filename
+//  2. the rules; the first rule whose prefix or regex matches the filename is used
+//  3. the fallback template
+//
+// If none of them apply the filename is used.
+type Resolver struct {
+	rules    []rule
+	fallback *template.Template
+
+	// manifest maps file IDs or filenames to links. It is loaded from a YAML file and reloaded when the file
+	// changes. Nil if there is no manifest.
+	manifest *reload.File[map[string]string]
+}
+
+// NewResolver creates a resolver from the configuration.
+func NewResolver(cfg config.LinksConfig) (*Resolver, error) {
+	r := &Resolver{
+		rules: make([]rule, 0, len(cfg.Rules)),
+	}
+
+	for i, c := range cfg.Rules {
+		if (c.Prefix == "") == (c.Regex == "") {
+			return nil, errors.Errorf("Link rule %d must set exactly one of prefix or regex", i)
+		}
+		tmpl, err := parseTemplate(c.Template)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Link rule %d has an invalid template", i)
+		}
+		ru := rule{prefix: c.Prefix, tmpl: tmpl}
+		if c.Regex != "" {
+			ru.regex, err = regexp.Compile(c.Regex)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Link rule %d has an invalid regex", i)
+			}
+		}
+		r.rules = append(r.rules, ru)
+	}
+
+	if cfg.Fallback != "" {
+		tmpl, err := parseTemplate(cfg.Fallback)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Fallback link has an invalid template")
+		}
+		r.fallback = tmpl
+	}
+
+	if cfg.ManifestFile != "" {
+		manifest, err := reload.NewFile(cfg.ManifestFile, parseManifest)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to load link manifest")
+		}
+		r.manifest = manifest
+	}
+	return r, nil
+}
+
+func parseTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, errors.New("template must not be empty")
+	}
+	return template.New("link").Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+}
+
+func parseManifest(data []byte) (map[string]string, error) {
+	manifest := make(map[string]string)
+	if err := yaml.Unmarshal(data, &manifest); err != nil {
+		return nil, errors.Wrapf(err, "Failed to unmarshal link manifest")
+	}
+	return manifest, nil
+}
+
+// Link returns the link for a file.
+func (r *Resolver) Link(fileID string, filename string) string {
+	log := zapr.NewLogger(zap.L())
+	if link, ok := r.lookup(fileID, filename); ok {
+		return link
+	}
+
+	for _, ru := range r.rules {
+		data := LinkData{FileID: fileID, Filename: filename, Path: filename}
+		if ru.regex != nil {
+			data.Matches = ru.regex.FindStringSubmatch(filename)
+			if data.Matches == nil {
+				continue
+			}
+		} else {
+			if !strings.HasPrefix(filename, ru.prefix) {
+				continue
+			}
+			data.Path = strings.TrimPrefix(filename, ru.prefix)
+		}
+		link, err := render(ru.tmpl, data)
+		if err != nil {
+			log.Error(err, "Failed to render link", "fileID", fileID, "filename", filename)
+			return filename
+		}
+		return link
+	}
+
+	if r.fallback != nil {
+		link, err := render(r.fallback, LinkData{FileID: fileID, Filename: filename, Path: filename})
+		if err != nil {
+			log.Error(err, "Failed to render fallback link", "fileID", fileID, "filename", filename)
+			return filename
+		}
+		return link
+	}
+	return filename
+}
+
+// lookup looks up the file in the manifest.
+func (r *Resolver) lookup(fileID string, filename string) (string, bool) {
+	if r.manifest == nil {
+		return "", false
+	}
+	manifest := r.manifest.Get()
+	if link, ok := manifest[fileID]; ok && fileID != "" {
+		return link, true
+	}
+	if link, ok := manifest[filename]; ok && filename != "" {
+		return link, true
+	}
+	return "", false
+}
+
+func render(tmpl *template.Template, data LinkData) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", errors.Wrapf(err, "Failed to render link template")
+	}
+	return buf.String(), nil
+}
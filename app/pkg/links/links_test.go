@@ -0,0 +1,106 @@
+package links
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jlewi/cloud-assistant/app/pkg/config"
+)
+
+func TestResolver(t *testing.T) {
+	manifest := filepath.Join(t.TempDir(), "manifest.yaml")
+	if err := os.WriteFile(manifest, []byte("file-abc: https://wiki.acme.com/pages/123\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write manifest: %+v", err)
+	}
+
+	r, err := NewResolver(config.LinksConfig{
+		ManifestFile: manifest,
+		Rules: []config.LinkRule{
+			{
+				Prefix:   "runbooks/",
+				Template: "https://github.com/acme/runbooks/blob/main/{{.Path}}",
+			},
+			{
+				Regex:    `^wiki-(\d+)\.md$`,
+				Template: "https://wiki.acme.com/pages/{{index .Matches 1}}",
+			},
+		},
+		Fallback: "https://docs.acme.com/search?q={{queryEscape .Filename}}",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create resolver: %+v", err)
+	}
+
+	cases := []struct {
+		name     string
+		fileID   string
+		filename string
+		expected string
+	}{
+		{
+			name:     "manifest",
+			fileID:   "file-abc",
+			filename: "runbooks/ingress.md",
+			expected: "https://wiki.acme.com/pages/123",
+		},
+		{
+			name:     "prefix",
+			fileID:   "file-def",
+			filename: "runbooks/ingress.md",
+			expected: "https://github.com/acme/runbooks/blob/main/ingress.md",
+		},
+		{
+			name:     "regex",
+			fileID:   "file-ghi",
+			filename: "wiki-456.md",
+			expected: "https://wiki.acme.com/pages/456",
+		},
+		{
+			name:     "fallback",
+			fileID:   "file-jkl",
+			filename: "on call.md",
+			expected: "https://docs.acme.com/search?q=on+call.md",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if actual := r.Link(c.fileID, c.filename); actual != c.expected {
+				t.Errorf("Expected %s; got %s", c.expected, actual)
+			}
+		})
+	}
+
+	// Changes to the manifest are picked up without restarting.
+	if err := os.WriteFile(manifest, []byte("file-def: https://wiki.acme.com/pages/789\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write manifest: %+v", err)
+	}
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(manifest, future, future); err != nil {
+		t.Fatalf("Failed to update the modification time: %+v", err)
+	}
+	if actual := r.Link("file-def", "runbooks/ingress.md"); actual != "https://wiki.acme.com/pages/789" {
+		t.Errorf("Expected the updated manifest to be used; got %s", actual)
+	}
+}
+
+func TestResolverNoConfig(t *testing.T) {
+	r, err := NewResolver(config.LinksConfig{})
+	if err != nil {
+		t.Fatalf("Failed to create resolver: %+v", err)
+	}
+	if actual := r.Link("file-abc", "foo.md"); actual != "foo.md" {
+		t.Errorf("Expected the filename; got %s", actual)
+	}
+}
+
+func TestNewResolverInvalidRule(t *testing.T) {
+	_, err := NewResolver(config.LinksConfig{
+		Rules: []config.LinkRule{{Prefix: "a/", Regex: "b", Template: "x"}},
+	})
+	if err == nil {
+		t.Errorf("Expected an error for a rule with both prefix and regex")
+	}
+}
@@ -0,0 +1,263 @@
+// Package redact removes secrets (e.g. tokens, keys and the data of Kubernetes secrets) from blocks, i.e. from
+// commands, messages and the outputs of commands, before they are sent to the model or logged.
+//
+// Secrets are found by a set of built in detectors plus configurable regex rules. Each secret is replaced with
+// [REDACTED:<rule>] so the model can still tell that there was a value and what kind of value it was.
+package redact
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jlewi/cloud-assistant/protos/gen/cassie"
+	"github.com/pkg/errors"
+)
+
+const (
+	// MetadataKey is the key in Block.Metadata containing a JSON object mapping the name of each rule that matched
+	// the block's contents or outputs to the number of values it redacted.
+	MetadataKey = "cloudassistant.io/redacted"
+
+	// KubernetesSecretRule is the name of the detector for the data of Kubernetes secrets.
+	KubernetesSecretRule = "kubernetes-secret"
+)
+
+// Rule detects secrets with a regular expression. If the regex has capture groups only the text matched by the
+// first group is redacted; this allows matching on context such as the name of a key without redacting it.
+type Rule struct {
+	Name  string `json:"name" yaml:"name"`
+	Regex string `json:"regex" yaml:"regex"`
+}
+
+// DefaultRules are the rules used by every redactor. Configured rules are added to them and override rules with
+// the same name.
+var DefaultRules = []Rule{
+	{Name: "private-key", Regex: `(?s)-----BEGIN [A-Z0-9 ]*PRIVATE KEY-----.*?-----END [A-Z0-9 ]*PRIVATE KEY-----`},
+	{Name: "jwt", Regex: `\beyJ[A-Za-z0-9_-]{5,}\.eyJ[A-Za-z0-9_-]{5,}\.[A-Za-z0-9_-]{10,}`},
+	{Name: "aws-access-key-id", Regex: `\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`},
+	{Name: "aws-secret-access-key", Regex: `(?i)aws_?secret_?access_?key["']?\s*[:=]\s*["']?([A-Za-z0-9/+=]{40})`},
+	{Name: "aws-session-token", Regex: `(?i)aws_?session_?token["']?\s*[:=]\s*["']?([A-Za-z0-9/+=]{40,})`},
+	{Name: "azure-storage-key", Regex: `(?i)AccountKey=([A-Za-z0-9+/=]{40,})`},
+	{Name: "azure-sas-signature", Regex: `\bsig=([A-Za-z0-9%+/=]{30,})`},
+	{Name: "azure-client-secret", Regex: `\b[A-Za-z0-9_~.]{3}\dQ~[A-Za-z0-9_~.-]{31,34}`},
+	{Name: "github-token", Regex: `\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{40,})`},
+	{Name: "oauth-token", Regex: `(?i)"(?:access_?token|refresh_?token|id_?token|client_?secret)"\s*:\s*"([^"]{8,})"`},
+}
+
+type compiledRule struct {
+	name  string
+	regex *regexp.Regexp
+}
+
+// Redactor redacts secrets from text.
+type Redactor struct {
+	rules []compiledRule
+}
+
+// Counts maps the name of a rule to the number of values it redacted.
+type Counts map[string]int
+
+// NewRedactor creates a redactor using DefaultRules and the given rules.
+func NewRedactor(rules []Rule) (*Redactor, error) {
+	byName := make(map[string]string)
+	order := make([]string, 0, len(DefaultRules)+len(rules))
+	for _, r := range append(append([]Rule{}, DefaultRules...), rules...) {
+		if r.Name == "" {
+			return nil, errors.New("Redaction rules must have a name")
+		}
+		if _, ok := byName[r.Name]; !ok {
+			order = append(order, r.Name)
+		}
+		byName[r.Name] = r.Regex
+	}
+
+	rd := &Redactor{rules: make([]compiledRule, 0, len(order))}
+	for _, name := range order {
+		regex, err := regexp.Compile(byName[name])
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid regex for redaction rule %q", name)
+		}
+		rd.rules = append(rd.rules, compiledRule{name: name, regex: regex})
+	}
+	return rd, nil
+}
+
+const placeholderPrefix = "[REDACTED:"
+
+func placeholder(name string) string {
+	return fmt.Sprintf("%s%s]", placeholderPrefix, name)
+}
+
+// Redact returns the text with secrets replaced and the number of values redacted by each rule.
+func (rd *Redactor) Redact(text string) (string, Counts) {
+	counts := Counts{}
+	text = redactKubernetesSecrets(text, counts)
+	for _, r := range rd.rules {
+		text = redactRegex(r, text, counts)
+	}
+	return text, counts
+}
+
+func redactRegex(r compiledRule, text string, counts Counts) string {
+	matches := r.regex.FindAllStringSubmatchIndex(text, -1)
+	if len(matches) == 0 {
+		return text
+	}
+	sb := strings.Builder{}
+	last := 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		// Only redact the first group if there is one.
+		if len(m) >= 4 && m[2] >= 0 {
+			start, end = m[2], m[3]
+		}
+		sb.WriteString(text[last:start])
+		if strings.HasPrefix(text[start:end], placeholderPrefix) {
+			// Already redacted.
+			sb.WriteString(text[start:end])
+			last = end
+			continue
+		}
+		sb.WriteString(placeholder(r.name))
+		last = end
+		counts[r.name]++
+	}
+	sb.WriteString(text[last:])
+	return sb.String()
+}
+
+var (
+	secretKindRegex = regexp.MustCompile(`(?m)(^\s*kind:\s*Secret\s*$|"kind":\s*"Secret")`)
+	// yamlDataRegex matches the start of the data or stringData field of a secret in YAML.
+	yamlDataRegex = regexp.MustCompile(`^(\s*)(data|stringData):\s*$`)
+	// yamlValueRegex matches a key value pair in YAML.
+	yamlValueRegex = regexp.MustCompile(`^(\s*[^:\s][^:]*:\s*)(\S.*)$`)
+	// jsonDataRegex matches the start of the data or stringData field of a secret in pretty printed JSON.
+	jsonDataRegex = regexp.MustCompile(`^\s*"(data|stringData)":\s*\{\s*$`)
+	// jsonValueRegex matches a string field in JSON.
+	jsonValueRegex = regexp.MustCompile(`("[^"]*"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+	// inlineDataRegex matches the data or stringData of a secret on a single line of JSON e.g. in the
+	// kubectl.kubernetes.io/last-applied-configuration annotation.
+	inlineDataRegex = regexp.MustCompile(`\\?"(?:data|stringData)\\?":\s*\{[^{}]*\}`)
+	// escapedValueRegex matches a string field in JSON that is itself in a JSON string.
+	escapedValueRegex = regexp.MustCompile(`(\\"[^"\\]*\\"\s*:\s*)\\"(?:[^"\\]|\\[^"])*\\"`)
+)
+
+// redactKubernetesSecrets redacts the values in the data and stringData fields of Kubernetes secrets
+// e.g. the output of kubectl get secret -o yaml.
+func redactKubernetesSecrets(text string, counts Counts) string {
+	if !secretKindRegex.MatchString(text) {
+		return text
+	}
+	p := placeholder(KubernetesSecretRule)
+
+	lines := strings.Split(text, "\n")
+	dataIndent := -1
+	inJSONData := false
+	for i, line := range lines {
+		switch {
+		case inJSONData:
+			if strings.HasPrefix(strings.TrimSpace(line), "}") {
+				inJSONData = false
+				continue
+			}
+			lines[i] = jsonValueRegex.ReplaceAllStringFunc(line, func(m string) string {
+				if strings.Contains(m, placeholderPrefix) {
+					return m
+				}
+				counts[KubernetesSecretRule]++
+				return jsonValueRegex.ReplaceAllString(m, `${1}"`+p+`"`)
+			})
+		case dataIndent >= 0:
+			indent := len(line) - len(strings.TrimLeft(line, " \t"))
+			if strings.TrimSpace(line) != "" && indent <= dataIndent {
+				dataIndent = -1
+				break
+			}
+			if m := yamlValueRegex.FindStringSubmatch(line); m != nil && !strings.HasPrefix(m[2], placeholderPrefix) {
+				lines[i] = m[1] + p
+				counts[KubernetesSecretRule]++
+			}
+		}
+		if dataIndent < 0 && !inJSONData {
+			if m := yamlDataRegex.FindStringSubmatch(line); m != nil {
+				dataIndent = len(m[1])
+			} else if jsonDataRegex.MatchString(line) {
+				inJSONData = true
+			}
+		}
+	}
+	text = strings.Join(lines, "\n")
+
+	return inlineDataRegex.ReplaceAllStringFunc(text, func(data string) string {
+		data = escapedValueRegex.ReplaceAllStringFunc(data, func(m string) string {
+			if strings.Contains(m, placeholderPrefix) {
+				return m
+			}
+			counts[KubernetesSecretRule]++
+			return escapedValueRegex.ReplaceAllString(m, `${1}\"`+p+`\"`)
+		})
+		return jsonValueRegex.ReplaceAllStringFunc(data, func(m string) string {
+			if strings.Contains(m, placeholderPrefix) {
+				return m
+			}
+			counts[KubernetesSecretRule]++
+			return jsonValueRegex.ReplaceAllString(m, `${1}"`+p+`"`)
+		})
+	})
+}
+
+// RedactBlock redacts the contents and the text outputs of the block. Contents are redacted too since commands and
+// the user's messages can contain secrets e.g. curl -H "Authorization: Bearer ...". If anything was redacted the
+// counts are added to the block's metadata under MetadataKey. It returns the number of values redacted.
+func (rd *Redactor) RedactBlock(block *cassie.Block) (int, error) {
+	counts := Counts{}
+	if block.GetContents() != "" {
+		text, c := rd.Redact(block.Contents)
+		block.Contents = text
+		for name, n := range c {
+			counts[name] += n
+		}
+	}
+	for _, o := range block.GetOutputs() {
+		for _, item := range o.GetItems() {
+			if item.TextData == "" {
+				continue
+			}
+			text, c := rd.Redact(item.TextData)
+			item.TextData = text
+			for name, n := range c {
+				counts[name] += n
+			}
+		}
+	}
+
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	if total == 0 {
+		return 0, nil
+	}
+
+	// Merge with the counts from previous redactions of the block.
+	if existing, ok := block.GetMetadata()[MetadataKey]; ok {
+		previous := Counts{}
+		if err := json.Unmarshal([]byte(existing), &previous); err == nil {
+			for name, n := range previous {
+				counts[name] += n
+			}
+		}
+	}
+	b, err := json.Marshal(counts)
+	if err != nil {
+		return total, errors.Wrapf(err, "Failed to marshal redaction counts")
+	}
+	if block.Metadata == nil {
+		block.Metadata = make(map[string]string)
+	}
+	block.Metadata[MetadataKey] = string(b)
+	return total, nil
+}
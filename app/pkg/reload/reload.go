@@ -0,0 +1,75 @@
+// Package reload keeps configuration loaded from files, e.g. prompts and link manifests, up to date as the files
+// are edited without restarting the server.
+package reload
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-logr/zapr"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// File is the value parsed from a file. The file is parsed again whenever its modification time or size changes.
+type File[T any] struct {
+	path string
+	// parse parses the contents of the file.
+	parse func(data []byte) (T, error)
+
+	mu      sync.Mutex
+	loaded  bool
+	value   T
+	modTime time.Time
+	size    int64
+}
+
+// NewFile loads the file at path using parse. It returns an error if the file can't be read or parsed.
+func NewFile[T any](path string, parse func(data []byte) (T, error)) (*File[T], error) {
+	f := &File[T]{path: path, parse: parse}
+	if err := f.reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Get returns the value parsed from the file, reloading it if the file changed. If the file is broken the last
+// good version is kept so a bad edit doesn't take down the service.
+func (f *File[T]) Get() T {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.reload(); err != nil {
+		log := zapr.NewLogger(zap.L())
+		log.Error(err, "Failed to reload file; using the previous version", "path", f.path)
+	}
+	return f.value
+}
+
+// reload rereads the file if it changed on disk. The caller must hold the lock or have exclusive access.
+func (f *File[T]) reload() error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to stat file %s", f.path)
+	}
+
+	if f.loaded && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return nil
+	}
+
+	b, err := os.ReadFile(f.path)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to read file %s", f.path)
+	}
+
+	value, err := f.parse(b)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to parse file %s", f.path)
+	}
+
+	f.loaded = true
+	f.value = value
+	f.modTime = info.ModTime()
+	f.size = info.Size()
+	return nil
+}
@@ -0,0 +1,51 @@
+package reload
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "value.txt")
+	write := func(contents string, modTime time.Time) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+			t.Fatalf("Failed to write file: %+v", err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("Failed to set modification time: %+v", err)
+		}
+	}
+	parse := func(data []byte) (int, error) {
+		return strconv.Atoi(strings.TrimSpace(string(data)))
+	}
+
+	start := time.Now()
+	write("1", start)
+	f, err := NewFile(path, parse)
+	if err != nil {
+		t.Fatalf("Failed to load file: %+v", err)
+	}
+	if v := f.Get(); v != 1 {
+		t.Errorf("Expected 1; got %d", v)
+	}
+
+	write("2", start.Add(time.Minute))
+	if v := f.Get(); v != 2 {
+		t.Errorf("Expected the edit to be picked up; got %d", v)
+	}
+
+	// A bad edit keeps the last good value.
+	write("two", start.Add(2*time.Minute))
+	if v := f.Get(); v != 2 {
+		t.Errorf("Expected the last good value; got %d", v)
+	}
+
+	if _, err := NewFile(filepath.Join(t.TempDir(), "missing.txt"), parse); err == nil {
+		t.Errorf("Expected an error for a missing file")
+	}
+}
@@ -0,0 +1,1018 @@
+// Package risk classifies shell programs by how much they can change the state of the systems they run against.
+//
+// Programs are parsed into a bash AST and every command that would be invoked (including commands in pipelines,
+// subshells, command substitutions and commands run by xargs, sudo, bash -c, etc.) is matched against a table of
+// rules. The level of the program is the highest level of any of its commands.
+package risk
+
+import (
+	"encoding/json"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/jlewi/cloud-assistant/protos/gen/cassie"
+	"github.com/pkg/errors"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// Level is how much a command can change state.
+type Level string
+
+const (
+	// LevelReadOnly commands only observe state e.g. kubectl get.
+	LevelReadOnly Level = "read-only"
+	// LevelMutating commands change state in a way that can usually be undone e.g. kubectl apply.
+	LevelMutating Level = "mutating"
+	// LevelDestructive commands delete resources or data e.g. kubectl delete.
+	LevelDestructive Level = "destructive"
+)
+
+const (
+	// LevelMetadataKey is the key in Block.Metadata containing the Level of the block's program.
+	LevelMetadataKey = "cloudassistant.io/risk"
+	// CommandsMetadataKey is the key in Block.Metadata containing the JSON encoded Result.
+	CommandsMetadataKey = "cloudassistant.io/risk-commands"
+)
+
+// ParseLevel parses a level. It returns an error if the level isn't one of the known levels.
+func ParseLevel(s string) (Level, error) {
+	switch l := Level(s); l {
+	case LevelReadOnly, LevelMutating, LevelDestructive:
+		return l, nil
+	default:
+		return "", errors.Errorf("Unknown risk level %q; must be one of %s, %s, %s", s, LevelReadOnly, LevelMutating, LevelDestructive)
+	}
+}
+
+// Rank orders the levels from least to most risky.
+func (l Level) Rank() int {
+	switch l {
+	case LevelReadOnly:
+		return 0
+	case LevelMutating:
+		return 1
+	default:
+		// Treat unknown levels as the most risky.
+		return 2
+	}
+}
+
+// Rule assigns a level to a command.
+//
+// Command is a list of words. The first word must be the name of the program. Words starting with "-" are flags that
+// must appear somewhere among the arguments; a short flag also matches when it is combined with other flags or its
+// value (e.g. "sed -i" matches "sed -i.bak") and a long flag also matches when it is abbreviated or given a value
+// with "=". The remaining words are subcommands. For programs with subcommands (e.g. kubectl, gh, git) they must be
+// the leading positional arguments, so "kubectl delete" matches "kubectl -n prod delete pod foo" but "kubectl get"
+// doesn't match "kubectl annotate pod get a=b". For az they must end the command path, so "az list" matches
+// "az vm list". For other programs they must appear in order among the arguments. When multiple rules match a
+// command, the rule with the most words wins; ties go to the higher level.
+type Rule struct {
+	Command string `json:"command" yaml:"command"`
+	Level   Level  `json:"level" yaml:"level"`
+}
+
+var (
+	// DefaultRules are the rules used by every classifier. Configured rules are added to them and override rules
+	// for the same command.
+	DefaultRules = []Rule{
+		// Shell utilities
+		{Command: "ls", Level: LevelReadOnly},
+		{Command: "cat", Level: LevelReadOnly},
+		{Command: "head", Level: LevelReadOnly},
+		{Command: "tail", Level: LevelReadOnly},
+		{Command: "less", Level: LevelReadOnly},
+		{Command: "grep", Level: LevelReadOnly},
+		{Command: "egrep", Level: LevelReadOnly},
+		{Command: "rg", Level: LevelReadOnly},
+		{Command: "jq", Level: LevelReadOnly},
+		{Command: "yq", Level: LevelReadOnly},
+		{Command: "yq -i", Level: LevelMutating},
+		{Command: "yq --inplace", Level: LevelMutating},
+		{Command: "sed", Level: LevelReadOnly},
+		{Command: "sed -i", Level: LevelMutating},
+		{Command: "sed --in-place", Level: LevelMutating},
+		{Command: "awk", Level: LevelReadOnly},
+		{Command: "sort", Level: LevelReadOnly},
+		{Command: "uniq", Level: LevelReadOnly},
+		{Command: "cut", Level: LevelReadOnly},
+		{Command: "tr", Level: LevelReadOnly},
+		{Command: "wc", Level: LevelReadOnly},
+		{Command: "find", Level: LevelReadOnly},
+		{Command: "find -exec", Level: LevelMutating},
+		{Command: "find -execdir", Level: LevelMutating},
+		{Command: "find -ok", Level: LevelMutating},
+		{Command: "find -okdir", Level: LevelMutating},
+		{Command: "find -fprint", Level: LevelMutating},
+		{Command: "find -fprint0", Level: LevelMutating},
+		{Command: "find -fprintf", Level: LevelMutating},
+		{Command: "find -fls", Level: LevelMutating},
+		{Command: "find -delete", Level: LevelDestructive},
+		{Command: "echo", Level: LevelReadOnly},
+		{Command: "printf", Level: LevelReadOnly},
+		{Command: "pwd", Level: LevelReadOnly},
+		{Command: "whoami", Level: LevelReadOnly},
+		{Command: "id", Level: LevelReadOnly},
+		{Command: "date", Level: LevelReadOnly},
+		{Command: "hostname", Level: LevelReadOnly},
+		{Command: "uname", Level: LevelReadOnly},
+		{Command: "which", Level: LevelReadOnly},
+		{Command: "stat", Level: LevelReadOnly},
+		{Command: "du", Level: LevelReadOnly},
+		{Command: "df", Level: LevelReadOnly},
+		{Command: "ps", Level: LevelReadOnly},
+		{Command: "dig", Level: LevelReadOnly},
+		{Command: "nslookup", Level: LevelReadOnly},
+		{Command: "true", Level: LevelReadOnly},
+		{Command: "test", Level: LevelReadOnly},
+		{Command: "rm", Level: LevelDestructive},
+		{Command: "rmdir", Level: LevelDestructive},
+		{Command: "shred", Level: LevelDestructive},
+		{Command: "dd", Level: LevelDestructive},
+		{Command: "mkfs", Level: LevelDestructive},
+		{Command: "kill", Level: LevelDestructive},
+		{Command: "pkill", Level: LevelDestructive},
+
+		// Kubernetes
+		{Command: "kubectl get", Level: LevelReadOnly},
+		{Command: "kubectl describe", Level: LevelReadOnly},
+		{Command: "kubectl logs", Level: LevelReadOnly},
+		{Command: "kubectl top", Level: LevelReadOnly},
+		{Command: "kubectl explain", Level: LevelReadOnly},
+		{Command: "kubectl api-resources", Level: LevelReadOnly},
+		{Command: "kubectl version", Level: LevelReadOnly},
+		{Command: "kubectl diff", Level: LevelReadOnly},
+		{Command: "kubectl auth can-i", Level: LevelReadOnly},
+		{Command: "kubectl config view", Level: LevelReadOnly},
+		{Command: "kubectl config get-contexts", Level: LevelReadOnly},
+		{Command: "kubectl config current-context", Level: LevelReadOnly},
+		{Command: "kubectl rollout status", Level: LevelReadOnly},
+		{Command: "kubectl rollout history", Level: LevelReadOnly},
+		{Command: "kubectl apply", Level: LevelMutating},
+		{Command: "kubectl create", Level: LevelMutating},
+		{Command: "kubectl patch", Level: LevelMutating},
+		{Command: "kubectl edit", Level: LevelMutating},
+		{Command: "kubectl scale", Level: LevelMutating},
+		{Command: "kubectl rollout", Level: LevelMutating},
+		{Command: "kubectl exec", Level: LevelMutating},
+		{Command: "kubectl cp", Level: LevelMutating},
+		{Command: "kubectl debug", Level: LevelMutating},
+		{Command: "kubectl annotate", Level: LevelMutating},
+		{Command: "kubectl label", Level: LevelMutating},
+		{Command: "kubectl delete", Level: LevelDestructive},
+		{Command: "kubectl drain", Level: LevelDestructive},
+		{Command: "helm list", Level: LevelReadOnly},
+		{Command: "helm status", Level: LevelReadOnly},
+		{Command: "helm get", Level: LevelReadOnly},
+		{Command: "helm history", Level: LevelReadOnly},
+		{Command: "helm template", Level: LevelReadOnly},
+		{Command: "helm install", Level: LevelMutating},
+		{Command: "helm upgrade", Level: LevelMutating},
+		{Command: "helm rollback", Level: LevelMutating},
+		{Command: "helm uninstall", Level: LevelDestructive},
+		{Command: "helm delete", Level: LevelDestructive},
+
+		// GitHub
+		{Command: "gh pr view", Level: LevelReadOnly},
+		{Command: "gh pr list", Level: LevelReadOnly},
+		{Command: "gh pr diff", Level: LevelReadOnly},
+		{Command: "gh pr checks", Level: LevelReadOnly},
+		{Command: "gh pr status", Level: LevelReadOnly},
+		{Command: "gh issue view", Level: LevelReadOnly},
+		{Command: "gh issue list", Level: LevelReadOnly},
+		{Command: "gh run view", Level: LevelReadOnly},
+		{Command: "gh run list", Level: LevelReadOnly},
+		{Command: "gh repo view", Level: LevelReadOnly},
+		{Command: "gh search", Level: LevelReadOnly},
+		{Command: "gh repo delete", Level: LevelDestructive},
+		{Command: "git status", Level: LevelReadOnly},
+		{Command: "git log", Level: LevelReadOnly},
+		{Command: "git diff", Level: LevelReadOnly},
+		{Command: "git show", Level: LevelReadOnly},
+		{Command: "git blame", Level: LevelReadOnly},
+		{Command: "git push --force", Level: LevelDestructive},
+		{Command: "git push -f", Level: LevelDestructive},
+		{Command: "git reset --hard", Level: LevelDestructive},
+		{Command: "git clean", Level: LevelDestructive},
+
+		// Azure
+		{Command: "az list", Level: LevelReadOnly},
+		{Command: "az show", Level: LevelReadOnly},
+		{Command: "az account show", Level: LevelReadOnly},
+		{Command: "az create", Level: LevelMutating},
+		{Command: "az update", Level: LevelMutating},
+		{Command: "az delete", Level: LevelDestructive},
+		{Command: "az group delete", Level: LevelDestructive},
+
+		// Terraform
+		{Command: "terraform plan", Level: LevelReadOnly},
+		{Command: "terraform show", Level: LevelReadOnly},
+		{Command: "terraform apply", Level: LevelMutating},
+		{Command: "terraform destroy", Level: LevelDestructive},
+	}
+
+	// StreamingCommands are commands that run until they are interrupted e.g. because they follow logs or watch
+	// resources. They are matched like rules.
+	StreamingCommands = []string{
+		"watch",
+		"top",
+		"tail -f",
+		"tail -F",
+		"tail --follow",
+		"journalctl -f",
+		"journalctl --follow",
+		"kubectl -w",
+		"kubectl --watch",
+		"kubectl --watch-only",
+		"kubectl logs -f",
+		"kubectl logs --follow",
+		"kubectl port-forward",
+		"kubectl proxy",
+		"kubectl attach",
+		"docker logs -f",
+		"docker logs --follow",
+		"gh run watch",
+		"az webapp log tail",
+	}
+
+	// wrapperFlagsWithValues are the flags of wrapper commands that take a value as a separate argument.
+	wrapperFlagsWithValues = map[string]map[string]bool{
+		"xargs":   {"-I": true, "-n": true, "-P": true, "-L": true, "-d": true, "-E": true, "-s": true, "-a": true},
+		"sudo":    {"-u": true, "-g": true},
+		"env":     {"-u": true},
+		"nice":    {"-n": true},
+		"timeout": {"-s": true, "-k": true},
+		"watch":   {"-n": true},
+		"nohup":   {},
+		"time":    {},
+		"command": {},
+		"exec":    {},
+	}
+
+	// subcommandFlagsWithValues are the programs whose leading positional arguments are subcommands, along with the
+	// flags that take a value as a separate argument. The values aren't positional arguments so
+	// "kubectl -n get delete pod foo" runs delete.
+	subcommandFlagsWithValues = map[string]map[string]bool{
+		"kubectl": {
+			"-n": true, "--namespace": true, "--context": true, "--cluster": true, "--user": true, "--kubeconfig": true,
+			"-s": true, "--server": true, "--token": true, "--as": true, "--as-group": true, "--as-uid": true,
+			"--request-timeout": true, "-v": true, "--v": true, "-l": true, "--selector": true, "-o": true,
+			"--output": true, "-f": true, "--filename": true, "-c": true, "--container": true, "-L": true,
+			"--label-columns": true,
+		},
+		"helm": {"-n": true, "--namespace": true, "--kube-context": true, "--kubeconfig": true, "-o": true, "--output": true},
+		"gh":   {"-R": true, "--repo": true},
+		"git":  {"-C": true, "-c": true, "--git-dir": true, "--work-tree": true, "--namespace": true},
+		// Terraform's global flags always use "=" e.g. -chdir=dir.
+		"terraform": {},
+	}
+
+	// safeArgs are the arguments with which programs that can change state only read it. Invocations with any other
+	// argument are mutating even if a rule says the program is read-only e.g. "date" and "date +%s" are read-only
+	// but "date -s 2020-01-01" sets the clock.
+	safeArgs = map[string]argPolicy{
+		"date": {
+			flags:           map[string]bool{"-u": true, "--utc": true, "--universal": true, "-R": true, "--rfc-email": true, "--rfc-3339": true, "--debug": true},
+			flagsWithValues: map[string]bool{"-d": true, "--date": true, "-r": true, "--reference": true, "-f": true, "--file": true},
+			optionalValues:  map[string]bool{"-I": true, "--iso-8601": true},
+			positional:      func(_ int, arg string) bool { return strings.HasPrefix(arg, "+") },
+		},
+		"hostname": {
+			flags: map[string]bool{
+				"-f": true, "--fqdn": true, "--long": true, "-s": true, "--short": true, "-i": true, "--ip-address": true,
+				"-I": true, "--all-ip-addresses": true, "-d": true, "--domain": true, "-A": true, "--all-fqdns": true,
+				"-a": true, "--alias": true, "-y": true, "--yp": true, "--nis": true,
+			},
+		},
+		"awk": {
+			flagsWithValues: map[string]bool{"-F": true, "--field-separator": true, "-v": true, "--assign": true},
+			// The first positional argument is the program; the rest are input files.
+			positional: func(i int, arg string) bool { return i > 0 || !awkSideEffects.MatchString(arg) },
+		},
+		"sed": {
+			flags: map[string]bool{
+				"-n": true, "--quiet": true, "--silent": true, "-E": true, "-r": true, "--regexp-extended": true,
+				"-u": true, "--unbuffered": true, "-z": true, "--null-data": true, "--posix": true, "--sandbox": true,
+				"--debug": true,
+			},
+			flagsWithValues: map[string]bool{"-e": true, "--expression": true, "-l": true, "--line-length": true},
+			values: func(flag string, value string) bool {
+				return (flag != "-e" && flag != "--expression") || sedScriptIsSafe(value)
+			},
+			programFlags: map[string]bool{"-e": true, "--expression": true},
+			// Unless the script is given with -e, the first positional argument is the script; the rest are input files.
+			positional: func(i int, arg string) bool { return i > 0 || sedScriptIsSafe(arg) },
+		},
+		"sort": {
+			flags: map[string]bool{
+				"-b": true, "--ignore-leading-blanks": true, "-d": true, "--dictionary-order": true, "-f": true,
+				"--ignore-case": true, "-g": true, "--general-numeric-sort": true, "-i": true, "--ignore-nonprinting": true,
+				"-M": true, "--month-sort": true, "-h": true, "--human-numeric-sort": true, "-n": true,
+				"--numeric-sort": true, "-R": true, "--random-sort": true, "-r": true, "--reverse": true, "-V": true,
+				"--version-sort": true, "-c": true, "-C": true, "--check": true, "-m": true, "--merge": true, "-s": true,
+				"--stable": true, "-u": true, "--unique": true, "-z": true, "--zero-terminated": true, "--debug": true,
+			},
+			flagsWithValues: map[string]bool{
+				"-k": true, "--key": true, "-t": true, "--field-separator": true, "-S": true, "--buffer-size": true,
+				"--parallel": true, "--sort": true,
+			},
+			positional: func(_ int, _ string) bool { return true },
+		},
+		"uniq": {
+			flags: map[string]bool{
+				"-c": true, "--count": true, "-d": true, "--repeated": true, "-D": true, "--all-repeated": true,
+				"--group": true, "-i": true, "--ignore-case": true, "-u": true, "--unique": true, "-z": true,
+				"--zero-terminated": true,
+			},
+			flagsWithValues: map[string]bool{
+				"-f": true, "--skip-fields": true, "-s": true, "--skip-chars": true, "-w": true, "--check-chars": true,
+			},
+			// The second positional argument is the file to write to.
+			positional: func(i int, _ string) bool { return i == 0 },
+		},
+		// rg --pre runs a program on every file it searches.
+		"rg": {denied: []string{"--pre"}},
+		// git -c and --config-env can set options that run programs e.g. core.fsmonitor.
+		"git": {denied: []string{"-c", "--config-env", "--exec-path", "--output", "--ext-diff"}},
+		// These flags send the user's credentials to another server or use another user's.
+		"kubectl": {denied: []string{"--kubeconfig", "--token", "-s", "--server"}},
+	}
+
+	// awkSideEffects matches awk programs that run commands or write files.
+	awkSideEffects = regexp.MustCompile(`system\s*\(|\||\bprintf?\b[^;}]*>`)
+
+	// shells are the shells whose -c argument is classified as a program.
+	shells = map[string]bool{"bash": true, "sh": true, "zsh": true}
+
+	// safeEnvVars are the environment variables that can be set without changing what programs do beyond how they
+	// format their output.
+	safeEnvVars = map[string]bool{
+		"LANG": true, "LANGUAGE": true, "LC_ALL": true, "LC_COLLATE": true, "LC_CTYPE": true, "LC_MESSAGES": true,
+		"LC_NUMERIC": true, "LC_TIME": true, "TZ": true, "NO_COLOR": true,
+	}
+
+	// safeRedirectTargets are the files that can be written to without changing state.
+	safeRedirectTargets = map[string]bool{"/dev/null": true, "/dev/stdout": true, "/dev/stderr": true}
+)
+
+// Command is a command invoked by a program.
+type Command struct {
+	// Args are the words of the command. Words that can't be determined statically (e.g. "$NAME") are left as is.
+	Args  []string `json:"args"`
+	Level Level    `json:"level"`
+	// Rule is the command of the rule that matched. Empty if no rule matched and the default level was used.
+	Rule string `json:"rule,omitempty"`
+	// Streaming is true if the command runs until it is interrupted e.g. kubectl logs -f.
+	Streaming bool `json:"streaming,omitempty"`
+}
+
+// Result is the classification of a program.
+type Result struct {
+	// Level is the highest level of any command in the program.
+	Level    Level     `json:"level"`
+	Commands []Command `json:"commands"`
+	// Writes are the files written by redirections. Redirecting to a file makes a program mutating.
+	Writes []string `json:"writes,omitempty"`
+	// Env are the environment variables set by the program. Variables such as PAGER or GIT_EXTERNAL_DIFF change what
+	// programs run so setting any variable other than those for the locale and time zone makes a program mutating.
+	Env []string `json:"env,omitempty"`
+	// Streaming is true if any command in the program is streaming.
+	Streaming bool `json:"streaming,omitempty"`
+}
+
+// Classifier classifies shell programs.
+type Classifier struct {
+	rules        []parsedRule
+	streaming    []parsedRule
+	defaultLevel Level
+}
+
+type parsedRule struct {
+	words       []string
+	subcommands []string
+	flags       []string
+	level       Level
+}
+
+// argPolicy is the arguments with which a program only reads state. A policy either lists the safe arguments or
+// the flags that aren't safe.
+type argPolicy struct {
+	// flags don't take values.
+	flags map[string]bool
+	// flagsWithValues take a value as the next argument or after "=".
+	flagsWithValues map[string]bool
+	// optionalValues take a value only if it is attached to the flag e.g. date -Ihours or date --iso-8601=hours.
+	optionalValues map[string]bool
+	// values returns true if the value of a flag in flagsWithValues is safe. If nil every value is safe.
+	values func(flag string, value string) bool
+	// programFlags are flags whose value is the program the command runs e.g. sed -e. When one is given, the
+	// positional arguments are all inputs so the index passed to positional starts at 1.
+	programFlags map[string]bool
+	// positional returns true if the i'th positional argument is safe. If nil positional arguments aren't allowed.
+	positional func(i int, arg string) bool
+	// denied are the flags that aren't safe. They are matched like the flags of rules. If set, every other argument
+	// is safe.
+	denied []string
+}
+
+// NewClassifier creates a classifier. rules are added to DefaultRules. Commands that don't match any rule are
+// assigned defaultLevel; if it is empty LevelMutating is used.
+func NewClassifier(rules []Rule, defaultLevel Level) (*Classifier, error) {
+	if defaultLevel == "" {
+		defaultLevel = LevelMutating
+	}
+	if _, err := ParseLevel(string(defaultLevel)); err != nil {
+		return nil, err
+	}
+
+	byCommand := make(map[string]Level)
+	order := make([]string, 0, len(DefaultRules)+len(rules))
+	for _, r := range append(append([]Rule{}, DefaultRules...), rules...) {
+		if _, err := ParseLevel(string(r.Level)); err != nil {
+			return nil, errors.Wrapf(err, "Invalid rule for command %q", r.Command)
+		}
+		key := strings.Join(strings.Fields(r.Command), " ")
+		if key == "" {
+			return nil, errors.New("Rules must have a command")
+		}
+		if _, ok := byCommand[key]; !ok {
+			order = append(order, key)
+		}
+		byCommand[key] = r.Level
+	}
+
+	c := &Classifier{
+		rules:        make([]parsedRule, 0, len(order)),
+		defaultLevel: defaultLevel,
+	}
+	for _, key := range order {
+		c.rules = append(c.rules, parseRule(key, byCommand[key]))
+	}
+	for _, command := range StreamingCommands {
+		c.streaming = append(c.streaming, parseRule(command, ""))
+	}
+	return c, nil
+}
+
+func parseRule(command string, level Level) parsedRule {
+	words := strings.Fields(command)
+	r := parsedRule{words: words, level: level}
+	for _, w := range words[1:] {
+		if strings.HasPrefix(w, "-") {
+			r.flags = append(r.flags, w)
+		} else {
+			r.subcommands = append(r.subcommands, w)
+		}
+	}
+	return r
+}
+
+// AllowList is a list of commands e.g. the commands autopilot may run without asking the user.
+type AllowList struct {
+	commands []parsedRule
+}
+
+// NewAllowList creates an allow-list. Commands are matched like the commands of rules so "kubectl get" allows
+// "kubectl -n prod get pods".
+func NewAllowList(commands []string) (*AllowList, error) {
+	l := &AllowList{commands: make([]parsedRule, 0, len(commands))}
+	for _, command := range commands {
+		if len(strings.Fields(command)) == 0 {
+			return nil, errors.New("Allowed commands must not be empty")
+		}
+		l.commands = append(l.commands, parseRule(command, ""))
+	}
+	return l, nil
+}
+
+// Allows returns true if the program invokes at least one command and every command it invokes is in the list.
+func (l *AllowList) Allows(r *Result) bool {
+	if l == nil || len(r.Commands) == 0 {
+		return false
+	}
+	for _, c := range r.Commands {
+		allowed := false
+		for _, command := range l.commands {
+			if command.matches(c.Args) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	return true
+}
+
+// Classify parses the program and classifies every command it invokes.
+func (c *Classifier) Classify(program string) (*Result, error) {
+	f, err := syntax.NewParser(syntax.Variant(syntax.LangBash)).Parse(strings.NewReader(program), "")
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse shell program")
+	}
+
+	result := &Result{
+		Level:    LevelReadOnly,
+		Commands: make([]Command, 0, 5),
+	}
+
+	var walkErr error
+	syntax.Walk(f, func(node syntax.Node) bool {
+		switch n := node.(type) {
+		case *syntax.Redirect:
+			if target, ok := writtenFile(n); ok {
+				result.Writes = append(result.Writes, target)
+				result.raise(LevelMutating)
+			}
+		case *syntax.DeclClause:
+			// e.g. export PAGER=less
+			result.setEnv(assignedNames(n.Args))
+		case *syntax.CallExpr:
+			if len(n.Args) == 0 {
+				// Assignments only e.g. FOO=bar. They change the environment of later commands if FOO is exported.
+				result.setEnv(assignedNames(n.Assigns))
+				return true
+			}
+			args := make([]string, 0, len(n.Args))
+			literal := make([]bool, 0, len(n.Args))
+			for _, w := range n.Args {
+				s, ok := wordValue(w)
+				args = append(args, s)
+				literal = append(literal, ok)
+			}
+			if err := c.classifyArgs(args, literal, assignedNames(n.Assigns), result); err != nil {
+				walkErr = err
+				return false
+			}
+		}
+		return true
+	})
+	if walkErr != nil {
+		return nil, walkErr
+	}
+	return result, nil
+}
+
+// classifyArgs classifies a single command run with the environment variables in env set and adds it to the result.
+func (c *Classifier) classifyArgs(args []string, literal []bool, env []string, result *Result) error {
+	// Check for streaming before unwrapping since some wrappers e.g. watch are streaming themselves.
+	streaming := c.isStreaming(args, literal)
+	args, literal, wrapperEnv := unwrap(args, literal)
+	if len(args) == 0 {
+		return nil
+	}
+	first := len(result.Commands)
+	if result.setEnv(append(env, wrapperEnv...)) {
+		// The variables apply to every command the program runs.
+		defer func() {
+			for i := first; i < len(result.Commands); i++ {
+				if result.Commands[i].Level.Rank() < LevelMutating.Rank() {
+					result.Commands[i].Level = LevelMutating
+				}
+			}
+		}()
+	}
+
+	// Classify the program passed to a shell with -c.
+	if literal[0] && shells[args[0]] {
+		for i := 1; i < len(args)-1; i++ {
+			if args[i] == "-c" && literal[i+1] {
+				inner, err := c.Classify(args[i+1])
+				if err != nil {
+					return err
+				}
+				result.Commands = append(result.Commands, inner.Commands...)
+				result.Writes = append(result.Writes, inner.Writes...)
+				result.Env = append(result.Env, inner.Env...)
+				result.Streaming = result.Streaming || inner.Streaming
+				result.raise(inner.Level)
+				return nil
+			}
+		}
+	}
+
+	cmd := Command{Args: args, Level: c.defaultLevel, Streaming: streaming || c.isStreaming(args, literal)}
+	// If we can't determine the name of the program we can't match any rules.
+	if literal[0] {
+		if rule, ok := c.match(args); ok {
+			cmd.Level = rule.level
+			cmd.Rule = strings.Join(rule.words, " ")
+		}
+		if p, ok := safeArgs[args[0]]; ok && cmd.Level == LevelReadOnly && !p.allows(args[0], args[1:], literal[1:]) {
+			cmd.Level = LevelMutating
+		}
+	}
+	result.Commands = append(result.Commands, cmd)
+	result.raise(cmd.Level)
+	result.Streaming = result.Streaming || cmd.Streaming
+	return nil
+}
+
+// isStreaming returns true if the command matches any of the StreamingCommands.
+func (c *Classifier) isStreaming(args []string, literal []bool) bool {
+	if len(args) == 0 || !literal[0] {
+		return false
+	}
+	for _, r := range c.streaming {
+		if r.matches(args) {
+			return true
+		}
+	}
+	return false
+}
+
+// match returns the best matching rule for the command.
+func (c *Classifier) match(args []string) (parsedRule, bool) {
+	var best parsedRule
+	found := false
+	for _, r := range c.rules {
+		if !r.matches(args) {
+			continue
+		}
+		if !found || len(r.words) > len(best.words) || (len(r.words) == len(best.words) && r.level.Rank() > best.level.Rank()) {
+			best = r
+			found = true
+		}
+	}
+	return best, found
+}
+
+// matches returns true if the command is the rule's program, every flag of the rule is among the arguments and the
+// subcommands of the rule match the arguments.
+func (r parsedRule) matches(args []string) bool {
+	if len(args) == 0 || r.words[0] != args[0] {
+		return false
+	}
+	for _, f := range r.flags {
+		if !hasFlag(args[1:], f, valueFlags(args[0])) {
+			return false
+		}
+	}
+	if flagsWithValues, ok := subcommandFlagsWithValues[args[0]]; ok {
+		positional := positionalArgs(args[1:], flagsWithValues)
+		return len(positional) >= len(r.subcommands) && slices.Equal(positional[:len(r.subcommands)], r.subcommands)
+	}
+	if args[0] == "az" {
+		// az commands are a path of groups ending in a verb followed by flags e.g. "az vm list -g rg".
+		path := args[1:]
+		for i, a := range path {
+			if strings.HasPrefix(a, "-") {
+				path = path[:i]
+				break
+			}
+		}
+		return len(path) >= len(r.subcommands) && slices.Equal(path[len(path)-len(r.subcommands):], r.subcommands)
+	}
+	next := 0
+	for _, a := range args[1:] {
+		if next == len(r.subcommands) {
+			break
+		}
+		if a == r.subcommands[next] {
+			next++
+		}
+	}
+	return next == len(r.subcommands)
+}
+
+// hasFlag returns true if the flag is among the arguments. flagsWithValues are the flags of the program that take a
+// value.
+func hasFlag(args []string, flag string, flagsWithValues map[string]bool) bool {
+	for _, a := range args {
+		if a == "--" {
+			return false
+		}
+		if flagMatches(a, flag, flagsWithValues) {
+			return true
+		}
+	}
+	return false
+}
+
+// flagMatches returns true if the argument sets the flag.
+func flagMatches(arg string, flag string, flagsWithValues map[string]bool) bool {
+	if arg == flag {
+		return true
+	}
+	if strings.HasPrefix(flag, "--") {
+		// Long flags can be abbreviated and given a value with "=" e.g. --in-pl=.bak.
+		name, _, _ := strings.Cut(arg, "=")
+		return len(name) > 2 && strings.HasPrefix(name, "--") && strings.HasPrefix(flag, name)
+	}
+	if len(flag) != 2 {
+		// Single dash long flags e.g. find -exec.
+		return strings.HasPrefix(arg, flag+"=")
+	}
+	if len(arg) < 2 || arg[0] != '-' || arg[1] == '-' {
+		return false
+	}
+	// Short flags can be followed by their value (e.g. -i.bak) or combined with other flags (e.g. -ni).
+	if arg[1] == flag[1] {
+		return true
+	}
+	for _, c := range arg[1:] {
+		if !unicode.IsLetter(c) {
+			return false
+		}
+	}
+	// The rest of the argument after a flag that takes a value is its value e.g. -owide isn't -o -w -i -d -e.
+	for _, c := range arg[1:] {
+		if c == rune(flag[1]) {
+			return true
+		}
+		if flagsWithValues["-"+string(c)] {
+			return false
+		}
+	}
+	return false
+}
+
+// valueFlags returns the known flags of the program that take a value.
+func valueFlags(program string) map[string]bool {
+	if flags, ok := subcommandFlagsWithValues[program]; ok {
+		return flags
+	}
+	if flags, ok := wrapperFlagsWithValues[program]; ok {
+		return flags
+	}
+	return safeArgs[program].flagsWithValues
+}
+
+// positionalArgs returns the arguments that aren't flags or the values of flags.
+func positionalArgs(args []string, flagsWithValues map[string]bool) []string {
+	positional := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "--" {
+			return append(positional, args[i+1:]...)
+		}
+		if len(a) > 1 && strings.HasPrefix(a, "-") {
+			if flagsWithValues[a] {
+				i++
+			}
+			continue
+		}
+		positional = append(positional, a)
+	}
+	return positional
+}
+
+// allows returns true if every argument of the program is safe. Arguments whose value can't be determined statically
+// aren't safe.
+func (p argPolicy) allows(program string, args []string, literal []bool) bool {
+	if slices.Contains(literal, false) {
+		return false
+	}
+	if p.denied != nil {
+		for _, f := range p.denied {
+			if hasFlag(args, f, valueFlags(program)) {
+				return false
+			}
+		}
+		return true
+	}
+
+	positional := make([]string, 0, len(args))
+	programGiven := false
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "--" {
+			positional = append(positional, args[i+1:]...)
+			break
+		}
+		if len(a) < 2 || a[0] != '-' {
+			positional = append(positional, a)
+			continue
+		}
+		if strings.HasPrefix(a, "--") {
+			name, value, hasValue := strings.Cut(a, "=")
+			switch {
+			case p.flags[name] || p.optionalValues[name]:
+			case p.flagsWithValues[name]:
+				if !hasValue && i+1 < len(args) {
+					i++
+					value = args[i]
+				}
+				if !p.allowsValue(name, value) {
+					return false
+				}
+				programGiven = programGiven || p.programFlags[name]
+			default:
+				return false
+			}
+			continue
+		}
+		// Short flags can be combined (e.g. -rn) and the last one can be followed by its value (e.g. -k2 or -F:).
+		for j := 1; j < len(a); j++ {
+			name := "-" + a[j:j+1]
+			if p.flags[name] {
+				continue
+			}
+			if p.optionalValues[name] {
+				break
+			}
+			if !p.flagsWithValues[name] {
+				return false
+			}
+			value := a[j+1:]
+			if value == "" && i+1 < len(args) {
+				i++
+				value = args[i]
+			}
+			if !p.allowsValue(name, value) {
+				return false
+			}
+			programGiven = programGiven || p.programFlags[name]
+			break
+		}
+	}
+
+	start := 0
+	if programGiven {
+		start = 1
+	}
+	for i, a := range positional {
+		if p.positional == nil || !p.positional(start+i, a) {
+			return false
+		}
+	}
+	return true
+}
+
+// allowsValue returns true if the value of the flag is safe.
+func (p argPolicy) allowsValue(flag string, value string) bool {
+	return p.values == nil || p.values(flag, value)
+}
+
+// setEnv records the environment variables set by the program and makes it mutating if any of them isn't one of
+// the safeEnvVars. It returns true if any of them isn't.
+func (r *Result) setEnv(names []string) bool {
+	unsafe := false
+	for _, name := range names {
+		r.Env = append(r.Env, name)
+		if !safeEnvVars[name] {
+			unsafe = true
+		}
+	}
+	if unsafe {
+		r.raise(LevelMutating)
+	}
+	return unsafe
+}
+
+func (r *Result) raise(l Level) {
+	if l.Rank() > r.Level.Rank() {
+		r.Level = l
+	}
+}
+
+// unwrap strips wrapper commands (e.g. sudo, xargs, env) and returns the command they run along with the
+// environment variables env sets.
+func unwrap(args []string, literal []bool) ([]string, []bool, []string) {
+	var env []string
+	for len(args) > 0 && literal[0] {
+		flagsWithValues, ok := wrapperFlagsWithValues[args[0]]
+		if !ok {
+			return args, literal, env
+		}
+		wrapper := args[0]
+		i := 1
+		for i < len(args) {
+			a := args[i]
+			if strings.HasPrefix(a, "-") {
+				if flagsWithValues[a] {
+					i++
+				}
+				i++
+				continue
+			}
+			// env accepts assignments before the command.
+			if name, _, ok := strings.Cut(a, "="); wrapper == "env" && ok {
+				env = append(env, name)
+				i++
+				continue
+			}
+			break
+		}
+		// timeout takes the duration before the command.
+		if wrapper == "timeout" && i < len(args) {
+			i++
+		}
+
+		if i >= len(args) {
+			if wrapper == "xargs" {
+				// xargs runs echo if no command is given.
+				return []string{"echo"}, []bool{true}, env
+			}
+			return args[:1], literal[:1], env
+		}
+		args, literal = args[i:], literal[i:]
+	}
+	return args, literal, env
+}
+
+// assignedNames returns the names of the variables the assignments set.
+func assignedNames(assigns []*syntax.Assign) []string {
+	names := make([]string, 0, len(assigns))
+	for _, a := range assigns {
+		if a.Name != nil {
+			names = append(names, a.Name.Value)
+		}
+	}
+	return names
+}
+
+// wordValue returns the value of the word and true if it can be determined statically. Otherwise it returns the
+// source of the word and false.
+func wordValue(w *syntax.Word) (string, bool) {
+	var sb strings.Builder
+	literal := true
+	for _, part := range w.Parts {
+		switch p := part.(type) {
+		case *syntax.Lit:
+			sb.WriteString(p.Value)
+		case *syntax.SglQuoted:
+			sb.WriteString(p.Value)
+		case *syntax.DblQuoted:
+			for _, dp := range p.Parts {
+				if lit, ok := dp.(*syntax.Lit); ok {
+					sb.WriteString(lit.Value)
+				} else {
+					literal = false
+				}
+			}
+		default:
+			literal = false
+		}
+	}
+	if literal {
+		return sb.String(), true
+	}
+
+	var src strings.Builder
+	if err := syntax.NewPrinter().Print(&src, w); err != nil {
+		return sb.String(), false
+	}
+	return src.String(), false
+}
+
+// writtenFile returns the file written to by the redirect if any.
+func writtenFile(r *syntax.Redirect) (string, bool) {
+	switch r.Op {
+	case syntax.RdrOut, syntax.AppOut, syntax.ClbOut, syntax.RdrAll, syntax.AppAll, syntax.RdrInOut:
+	case syntax.DplOut:
+		// >&2 duplicates a file descriptor.
+		if target, ok := wordValue(r.Word); ok && (target == "-" || isNumber(target)) {
+			return "", false
+		}
+	default:
+		return "", false
+	}
+	target, _ := wordValue(r.Word)
+	if safeRedirectTargets[target] {
+		return "", false
+	}
+	return target, true
+}
+
+func isNumber(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Annotate records the result in the block's metadata.
+func (r *Result) Annotate(block *cassie.Block) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to marshal risk classification")
+	}
+	if block.Metadata == nil {
+		block.Metadata = make(map[string]string)
+	}
+	block.Metadata[LevelMetadataKey] = string(r.Level)
+	block.Metadata[CommandsMetadataKey] = string(b)
+	return nil
+}
+
+// FromBlock returns the level recorded in the block's metadata.
+func FromBlock(block *cassie.Block) (Level, bool) {
+	l, ok := block.GetMetadata()[LevelMetadataKey]
+	if !ok {
+		return "", false
+	}
+	level, err := ParseLevel(l)
+	if err != nil {
+		return "", false
+	}
+	return level, true
+}
@@ -0,0 +1,539 @@
+package risk
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jlewi/cloud-assistant/protos/gen/cassie"
+)
+
+func TestClassify(t *testing.T) {
+	classifier, err := NewClassifier([]Rule{
+		{Command: "mytool status", Level: LevelReadOnly},
+		// Override a default rule.
+		{Command: "kubectl drain", Level: LevelMutating},
+	}, "")
+	if err != nil {
+		t.Fatalf("Failed to create classifier: %+v", err)
+	}
+
+	tests := []struct {
+		name     string
+		program  string
+		expected Level
+		commands [][]string
+	}{
+		{
+			name:     "read-only",
+			program:  "kubectl -n kube-system get pods",
+			expected: LevelReadOnly,
+			commands: [][]string{{"kubectl", "-n", "kube-system", "get", "pods"}},
+		},
+		{
+			name:     "pipe",
+			program:  "kubectl get pods -o json | jq '.items[].metadata.name' | sort",
+			expected: LevelReadOnly,
+			commands: [][]string{
+				{"kubectl", "get", "pods", "-o", "json"},
+				{"jq", ".items[].metadata.name"},
+				{"sort"},
+			},
+		},
+		{
+			name:     "xargs",
+			program:  "kubectl get pods -o name | xargs -n 1 kubectl delete",
+			expected: LevelDestructive,
+			commands: [][]string{
+				{"kubectl", "get", "pods", "-o", "name"},
+				{"kubectl", "delete"},
+			},
+		},
+		{
+			name:     "subshell",
+			program:  "(cd /tmp && rm -rf foo)",
+			expected: LevelDestructive,
+			commands: [][]string{{"cd", "/tmp"}, {"rm", "-rf", "foo"}},
+		},
+		{
+			name:     "command-substitution",
+			program:  "echo $(az group delete --name rg --yes)",
+			expected: LevelDestructive,
+			commands: [][]string{
+				{"echo", "$(az group delete --name rg --yes)"},
+				{"az", "group", "delete", "--name", "rg", "--yes"},
+			},
+		},
+		{
+			name:     "bash-c",
+			program:  `sudo bash -c "kubectl apply -f deploy.yaml"`,
+			expected: LevelMutating,
+			commands: [][]string{{"kubectl", "apply", "-f", "deploy.yaml"}},
+		},
+		{
+			name:     "redirect",
+			program:  "kubectl get pods > pods.txt 2>/dev/null",
+			expected: LevelMutating,
+			commands: [][]string{{"kubectl", "get", "pods"}},
+		},
+		{
+			name:     "unknown",
+			program:  "./deploy.sh",
+			expected: LevelMutating,
+			commands: [][]string{{"./deploy.sh"}},
+		},
+		{
+			name:     "dynamic-command",
+			program:  "$CMD get pods",
+			expected: LevelMutating,
+			commands: [][]string{{"$CMD", "get", "pods"}},
+		},
+		{
+			name:     "custom-rule",
+			program:  "mytool --verbose status",
+			expected: LevelReadOnly,
+			commands: [][]string{{"mytool", "--verbose", "status"}},
+		},
+		{
+			name:     "override",
+			program:  "kubectl drain node-1",
+			expected: LevelMutating,
+			commands: [][]string{{"kubectl", "drain", "node-1"}},
+		},
+		{
+			name:     "more-specific-rule",
+			program:  "kubectl rollout status deploy/foo",
+			expected: LevelReadOnly,
+			commands: [][]string{{"kubectl", "rollout", "status", "deploy/foo"}},
+		},
+		{
+			name:     "sed-in-place-suffix",
+			program:  "sed -i.bak 's/a/b/' app.conf",
+			expected: LevelMutating,
+			commands: [][]string{{"sed", "-i.bak", "s/a/b/", "app.conf"}},
+		},
+		{
+			name:     "sed-in-place-long",
+			program:  "sed --in-place 's/a/b/' app.conf",
+			expected: LevelMutating,
+			commands: [][]string{{"sed", "--in-place", "s/a/b/", "app.conf"}},
+		},
+		{
+			name:     "sed-combined-flags",
+			program:  "sed -ni 's/a/b/p' app.conf",
+			expected: LevelMutating,
+			commands: [][]string{{"sed", "-ni", "s/a/b/p", "app.conf"}},
+		},
+		{
+			name:     "yq-in-place-long",
+			program:  "yq --inplace '.a = 1' app.yaml",
+			expected: LevelMutating,
+			commands: [][]string{{"yq", "--inplace", ".a = 1", "app.yaml"}},
+		},
+		{
+			name:     "awk-read-only",
+			program:  "awk -F: '$3 > 100 {print $1}' /etc/passwd",
+			expected: LevelReadOnly,
+			commands: [][]string{{"awk", "-F:", "$3 > 100 {print $1}", "/etc/passwd"}},
+		},
+		{
+			name:     "awk-system",
+			program:  `awk 'BEGIN{system("rm -rf /tmp/x")}'`,
+			expected: LevelMutating,
+			commands: [][]string{{"awk", `BEGIN{system("rm -rf /tmp/x")}`}},
+		},
+		{
+			name:     "awk-write",
+			program:  `awk '{print $1 > "names.txt"}' pods.txt`,
+			expected: LevelMutating,
+			commands: [][]string{{"awk", `{print $1 > "names.txt"}`, "pods.txt"}},
+		},
+		{
+			name:     "date-read-only",
+			program:  "date -u -Ihours +%s",
+			expected: LevelReadOnly,
+			commands: [][]string{{"date", "-u", "-Ihours", "+%s"}},
+		},
+		{
+			name:     "date-set",
+			program:  "date -s 2020-01-01",
+			expected: LevelMutating,
+			commands: [][]string{{"date", "-s", "2020-01-01"}},
+		},
+		{
+			name:     "hostname-read-only",
+			program:  "hostname -f",
+			expected: LevelReadOnly,
+			commands: [][]string{{"hostname", "-f"}},
+		},
+		{
+			name:     "hostname-set",
+			program:  "hostname evil",
+			expected: LevelMutating,
+			commands: [][]string{{"hostname", "evil"}},
+		},
+		{
+			name:     "find-fprint",
+			program:  "find . -fprint out",
+			expected: LevelMutating,
+			commands: [][]string{{"find", ".", "-fprint", "out"}},
+		},
+		{
+			name:     "find-ok",
+			program:  "find . -name '*.log' -ok rm {} +",
+			expected: LevelMutating,
+			commands: [][]string{{"find", ".", "-name", "*.log", "-ok", "rm", "{}", "+"}},
+		},
+		{
+			name:     "kubectl-flag-value",
+			program:  "kubectl --context prod -n get get pods",
+			expected: LevelReadOnly,
+			commands: [][]string{{"kubectl", "--context", "prod", "-n", "get", "get", "pods"}},
+		},
+		{
+			name:     "kubectl-annotate",
+			program:  "kubectl annotate pod get a=b",
+			expected: LevelMutating,
+			commands: [][]string{{"kubectl", "annotate", "pod", "get", "a=b"}},
+		},
+		{
+			name:     "kubectl-cp",
+			program:  "kubectl cp get pod:/x /tmp/x",
+			expected: LevelMutating,
+			commands: [][]string{{"kubectl", "cp", "get", "pod:/x", "/tmp/x"}},
+		},
+		{
+			name:     "kubectl-debug",
+			program:  "kubectl debug get -it --image=busybox",
+			expected: LevelMutating,
+			commands: [][]string{{"kubectl", "debug", "get", "-it", "--image=busybox"}},
+		},
+		{
+			name:     "git-subcommand",
+			program:  "git commit -m status",
+			expected: LevelMutating,
+			commands: [][]string{{"git", "commit", "-m", "status"}},
+		},
+		{
+			name:     "az-command-path",
+			program:  "az vm list -g rg",
+			expected: LevelReadOnly,
+			commands: [][]string{{"az", "vm", "list", "-g", "rg"}},
+		},
+		{
+			name:     "sed-print",
+			program:  "sed -n '/error/p;/warn/{s/warn/WARN/g;p}' app.log",
+			expected: LevelReadOnly,
+			commands: [][]string{{"sed", "-n", "/error/p;/warn/{s/warn/WARN/g;p}", "app.log"}},
+		},
+		{
+			name:     "sed-expression",
+			program:  "sed -e 's/a/b/' -e '$d' www.log",
+			expected: LevelReadOnly,
+			commands: [][]string{{"sed", "-e", "s/a/b/", "-e", "$d", "www.log"}},
+		},
+		{
+			name:     "sed-execute-command",
+			program:  "sed -n '1e touch /tmp/pwned' /etc/hosts",
+			expected: LevelMutating,
+			commands: [][]string{{"sed", "-n", "1e touch /tmp/pwned", "/etc/hosts"}},
+		},
+		{
+			name:     "sed-write-command",
+			program:  "sed -n 'w /tmp/out' f",
+			expected: LevelMutating,
+			commands: [][]string{{"sed", "-n", "w /tmp/out", "f"}},
+		},
+		{
+			name:     "sed-write-flag",
+			program:  "sed 's/a/b/w /tmp/out' f",
+			expected: LevelMutating,
+			commands: [][]string{{"sed", "s/a/b/w /tmp/out", "f"}},
+		},
+		{
+			name:     "sed-execute-flag",
+			program:  "sed -e 's/.*/date/e' f",
+			expected: LevelMutating,
+			commands: [][]string{{"sed", "-e", "s/.*/date/e", "f"}},
+		},
+		{
+			name:     "sed-script-file",
+			program:  "sed -f script.sed f",
+			expected: LevelMutating,
+			commands: [][]string{{"sed", "-f", "script.sed", "f"}},
+		},
+		{
+			name:     "sed-separate",
+			program:  "sed -s 's/a/b/' f g",
+			expected: LevelMutating,
+			commands: [][]string{{"sed", "-s", "s/a/b/", "f", "g"}},
+		},
+		{
+			name:     "sort-read-only",
+			program:  "sort -rn -k2 -t: pods.txt",
+			expected: LevelReadOnly,
+			commands: [][]string{{"sort", "-rn", "-k2", "-t:", "pods.txt"}},
+		},
+		{
+			name:     "sort-output",
+			program:  "sort -o /etc/important in",
+			expected: LevelMutating,
+			commands: [][]string{{"sort", "-o", "/etc/important", "in"}},
+		},
+		{
+			name:     "sort-output-combined",
+			program:  "sort -ro/etc/important in",
+			expected: LevelMutating,
+			commands: [][]string{{"sort", "-ro/etc/important", "in"}},
+		},
+		{
+			name:     "sort-output-long",
+			program:  "sort --output=/etc/important in",
+			expected: LevelMutating,
+			commands: [][]string{{"sort", "--output=/etc/important", "in"}},
+		},
+		{
+			name:     "uniq-read-only",
+			program:  "uniq -c in",
+			expected: LevelReadOnly,
+			commands: [][]string{{"uniq", "-c", "in"}},
+		},
+		{
+			name:     "uniq-output",
+			program:  "uniq in /etc/important",
+			expected: LevelMutating,
+			commands: [][]string{{"uniq", "in", "/etc/important"}},
+		},
+		{
+			name:     "rg-read-only",
+			program:  "rg -n foo .",
+			expected: LevelReadOnly,
+			commands: [][]string{{"rg", "-n", "foo", "."}},
+		},
+		{
+			name:     "rg-pre",
+			program:  "rg --pre ./evil.sh foo .",
+			expected: LevelMutating,
+			commands: [][]string{{"rg", "--pre", "./evil.sh", "foo", "."}},
+		},
+		{
+			name:     "git-config",
+			program:  "git -c core.fsmonitor='touch /tmp/x' status",
+			expected: LevelMutating,
+			commands: [][]string{{"git", "-c", "core.fsmonitor=touch /tmp/x", "status"}},
+		},
+		{
+			name:     "git-output",
+			program:  "git log --output=/etc/x",
+			expected: LevelMutating,
+			commands: [][]string{{"git", "log", "--output=/etc/x"}},
+		},
+		{
+			name:     "git-ext-diff",
+			program:  "git diff --ext-diff",
+			expected: LevelMutating,
+			commands: [][]string{{"git", "diff", "--ext-diff"}},
+		},
+		{
+			name:     "git-exec-path",
+			program:  "git --exec-path=/tmp/evil log",
+			expected: LevelMutating,
+			commands: [][]string{{"git", "--exec-path=/tmp/evil", "log"}},
+		},
+		{
+			name:     "kubectl-kubeconfig",
+			program:  "kubectl get pods --kubeconfig=/tmp/evil",
+			expected: LevelMutating,
+			commands: [][]string{{"kubectl", "get", "pods", "--kubeconfig=/tmp/evil"}},
+		},
+		{
+			name:     "kubectl-token",
+			program:  "kubectl get pods --token abc",
+			expected: LevelMutating,
+			commands: [][]string{{"kubectl", "get", "pods", "--token", "abc"}},
+		},
+		{
+			name:     "env-prefix",
+			program:  "GIT_EXTERNAL_DIFF=./evil git diff",
+			expected: LevelMutating,
+			commands: [][]string{{"git", "diff"}},
+		},
+		{
+			name:     "env-prefix-less",
+			program:  "LESSOPEN='|touch /tmp/x %s' less f",
+			expected: LevelMutating,
+			commands: [][]string{{"less", "f"}},
+		},
+		{
+			name:     "env-wrapper",
+			program:  "env PAGER=./evil git log",
+			expected: LevelMutating,
+			commands: [][]string{{"git", "log"}},
+		},
+		{
+			name:     "env-export",
+			program:  "export PAGER=./evil; git log",
+			expected: LevelMutating,
+			commands: [][]string{{"git", "log"}},
+		},
+		{
+			name:     "env-locale",
+			program:  "LC_ALL=C TZ=UTC date",
+			expected: LevelReadOnly,
+			commands: [][]string{{"date"}},
+		},
+		{
+			name:     "comments",
+			program:  "# Check the nodes\nkubectl get nodes",
+			expected: LevelReadOnly,
+			commands: [][]string{{"kubectl", "get", "nodes"}},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := classifier.Classify(tc.program)
+			if err != nil {
+				t.Fatalf("Failed to classify program: %+v", err)
+			}
+			if result.Level != tc.expected {
+				t.Errorf("Want level %s; got %s", tc.expected, result.Level)
+			}
+			commands := make([][]string, 0, len(result.Commands))
+			for _, c := range result.Commands {
+				commands = append(commands, c.Args)
+			}
+			if d := cmp.Diff(tc.commands, commands); d != "" {
+				t.Errorf("Unexpected commands (-want +got):\n%s", d)
+			}
+		})
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	classifier, err := NewClassifier(nil, "")
+	if err != nil {
+		t.Fatalf("Failed to create classifier: %+v", err)
+	}
+
+	result, err := classifier.Classify("kubectl delete pod foo")
+	if err != nil {
+		t.Fatalf("Failed to classify program: %+v", err)
+	}
+
+	block := &cassie.Block{}
+	if err := result.Annotate(block); err != nil {
+		t.Fatalf("Failed to annotate block: %+v", err)
+	}
+
+	level, ok := FromBlock(block)
+	if !ok || level != LevelDestructive {
+		t.Errorf("Want %s; got %s", LevelDestructive, level)
+	}
+
+	actual := &Result{}
+	if err := json.Unmarshal([]byte(block.Metadata[CommandsMetadataKey]), actual); err != nil {
+		t.Fatalf("Failed to unmarshal commands: %+v", err)
+	}
+	if d := cmp.Diff(result, actual); d != "" {
+		t.Errorf("Unexpected commands (-want +got):\n%s", d)
+	}
+}
+
+func TestNewClassifier_InvalidLevel(t *testing.T) {
+	if _, err := NewClassifier([]Rule{{Command: "foo", Level: "safe"}}, ""); err == nil {
+		t.Errorf("Expected an error for an invalid level")
+	}
+}
+
+func TestClassify_Env(t *testing.T) {
+	classifier, err := NewClassifier(nil, "")
+	if err != nil {
+		t.Fatalf("Failed to create classifier: %+v", err)
+	}
+
+	result, err := classifier.Classify("LANG=C PAGER='sh -c id' git log | head")
+	if err != nil {
+		t.Fatalf("Failed to classify program: %+v", err)
+	}
+	if d := cmp.Diff([]string{"LANG", "PAGER"}, result.Env); d != "" {
+		t.Errorf("Unexpected env (-want +got):\n%s", d)
+	}
+	levels := make([]Level, 0, len(result.Commands))
+	for _, c := range result.Commands {
+		levels = append(levels, c.Level)
+	}
+	// Only the command the variables are set for is mutating.
+	if d := cmp.Diff([]Level{LevelMutating, LevelReadOnly}, levels); d != "" {
+		t.Errorf("Unexpected levels (-want +got):\n%s", d)
+	}
+}
+
+func TestClassify_Streaming(t *testing.T) {
+	classifier, err := NewClassifier(nil, "")
+	if err != nil {
+		t.Fatalf("Failed to create classifier: %+v", err)
+	}
+
+	tests := []struct {
+		program  string
+		expected bool
+	}{
+		{program: "kubectl get pods -w", expected: true},
+		{program: "kubectl get pods -Aw", expected: true},
+		{program: "kubectl logs -f deploy/web", expected: true},
+		{program: "watch kubectl get pods", expected: true},
+		// The value of -o isn't a list of flags.
+		{program: "kubectl get pods -owide", expected: false},
+		{program: "kubectl get pods -ojson", expected: false},
+		{program: "kubectl get pods -lapp=web", expected: false},
+		{program: "tail -n 5 app.log", expected: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.program, func(t *testing.T) {
+			result, err := classifier.Classify(tc.program)
+			if err != nil {
+				t.Fatalf("Failed to classify program: %+v", err)
+			}
+			if result.Streaming != tc.expected {
+				t.Errorf("Want streaming %v; got %v", tc.expected, result.Streaming)
+			}
+		})
+	}
+}
+
+func TestAllowList(t *testing.T) {
+	classifier, err := NewClassifier(nil, "")
+	if err != nil {
+		t.Fatalf("Failed to create classifier: %+v", err)
+	}
+	allowed, err := NewAllowList([]string{"kubectl get", "kubectl describe", "grep"})
+	if err != nil {
+		t.Fatalf("Failed to create allow-list: %+v", err)
+	}
+
+	tests := []struct {
+		program  string
+		expected bool
+	}{
+		{program: "kubectl -n prod get pods", expected: true},
+		{program: "kubectl get pods | grep Crash", expected: true},
+		{program: "kubectl get pods | sort", expected: false},
+		{program: "kubectl logs pod-1", expected: false},
+		{program: "cat /etc/hosts", expected: false},
+		{program: "# nothing to run", expected: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.program, func(t *testing.T) {
+			result, err := classifier.Classify(tc.program)
+			if err != nil {
+				t.Fatalf("Failed to classify program: %+v", err)
+			}
+			if actual := allowed.Allows(result); actual != tc.expected {
+				t.Errorf("Want %v; got %v", tc.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package risk
+
+import "strings"
+
+// sedScriptIsSafe returns true if the sed script only reads its input. Scripts that run commands (the e command and
+// the e flag of s) or write files (the w and W commands and the w flag of s) aren't safe. Neither are scripts that
+// can't be parsed.
+func sedScriptIsSafe(script string) bool {
+	s := &sedScanner{src: script}
+	for {
+		s.skip(" \t\n;")
+		if s.done() {
+			return true
+		}
+		if !s.address() {
+			return false
+		}
+		s.skip(" \t")
+		if s.peek() == ',' {
+			s.pos++
+			s.skip(" \t")
+			if !s.address() {
+				return false
+			}
+			s.skip(" \t")
+		}
+		for s.peek() == '!' {
+			s.pos++
+			s.skip(" \t")
+		}
+		if s.done() {
+			return false
+		}
+
+		switch s.next() {
+		case '{', '}', '=', 'd', 'D', 'g', 'G', 'h', 'H', 'n', 'N', 'p', 'P', 'x', 'z', 'F':
+		case 'q', 'Q', 'l', 'L':
+			// An optional exit code or line length.
+			s.skip(" \t")
+			s.skip("0123456789")
+		case ':', 'b', 't', 'T', 'v':
+			// A label. Ending it early is safe since the rest is then parsed as commands.
+			s.skip(" \t")
+			s.until(" \t\n;}")
+		case '#', 'r', 'R':
+			// A comment or the file to read.
+			s.until("\n")
+		case 'a', 'i', 'c':
+			// Text to output up to the first unescaped newline.
+			for !s.done() {
+				c := s.next()
+				if c == '\\' {
+					s.pos++
+				} else if c == '\n' {
+					break
+				}
+			}
+		case 's':
+			if !s.delimitedArgs(2) {
+				return false
+			}
+			for !s.done() && !strings.ContainsRune(" \t\n;}", rune(s.peek())) {
+				if !strings.ContainsRune("gpiImM0123456789", rune(s.next())) {
+					return false
+				}
+			}
+		case 'y':
+			if !s.delimitedArgs(2) {
+				return false
+			}
+		default:
+			// Includes e, w and W.
+			return false
+		}
+	}
+}
+
+// sedScanner scans a sed script.
+type sedScanner struct {
+	src string
+	pos int
+}
+
+func (s *sedScanner) done() bool {
+	return s.pos >= len(s.src)
+}
+
+func (s *sedScanner) peek() byte {
+	if s.done() {
+		return 0
+	}
+	return s.src[s.pos]
+}
+
+func (s *sedScanner) next() byte {
+	c := s.peek()
+	s.pos++
+	return c
+}
+
+// skip skips the characters in chars.
+func (s *sedScanner) skip(chars string) {
+	for !s.done() && strings.IndexByte(chars, s.peek()) >= 0 {
+		s.pos++
+	}
+}
+
+// until skips up to the first character in chars.
+func (s *sedScanner) until(chars string) {
+	for !s.done() && strings.IndexByte(chars, s.peek()) < 0 {
+		s.pos++
+	}
+}
+
+// address skips an address if there is one. It returns false if the address can't be parsed.
+func (s *sedScanner) address() bool {
+	switch c := s.peek(); {
+	case c == '/' || c == '\\':
+		s.pos++
+		delimiter := byte('/')
+		if c == '\\' {
+			delimiter = s.next()
+		}
+		if !s.delimited(delimiter) {
+			return false
+		}
+		// Modifiers for case insensitive and multiline matching.
+		s.skip("IM")
+	case c == '$':
+		s.pos++
+	case c == '+' || c == '~' || (c >= '0' && c <= '9'):
+		s.pos++
+		s.skip("0123456789~")
+	}
+	return true
+}
+
+// delimitedArgs skips n arguments separated by the delimiter following the command e.g. the pattern and replacement
+// of s/a/b/.
+func (s *sedScanner) delimitedArgs(n int) bool {
+	delimiter := s.next()
+	if delimiter == 0 || delimiter == '\\' || delimiter == '\n' {
+		return false
+	}
+	for i := 0; i < n; i++ {
+		if !s.delimited(delimiter) {
+			return false
+		}
+	}
+	return true
+}
+
+// delimited skips up to and including the first unescaped delimiter. It returns false if there isn't one.
+func (s *sedScanner) delimited(delimiter byte) bool {
+	for !s.done() {
+		c := s.next()
+		if c == '\\' {
+			s.pos++
+		} else if c == delimiter {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package runme
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	runnerv2 "github.com/runmedev/runme/v3/api/gen/proto/go/runme/runner/v2"
+)
+
+const (
+	// LanguageBash is the language of shell cells. Blocks without a language are treated as bash.
+	LanguageBash = "bash"
+	// LanguagePython cells are Python 3 scripts.
+	LanguagePython = "python"
+	// LanguageJQ cells are jq programs evaluated with null input.
+	LanguageJQ = "jq"
+	// LanguageKubectlApply cells are Kubernetes manifests applied with kubectl apply.
+	LanguageKubectlApply = "kubectl-apply"
+)
+
+// Language describes how runme runs the cells of a language.
+type Language struct {
+	// ID is the language of the cell e.g. Block.Language.
+	ID string
+	// ProgramName is the program the cell is passed to as a file. It is empty for shell cells which are run
+	// inline.
+	ProgramName string
+	// Arguments are passed to the program before the file containing the cell.
+	Arguments []string
+}
+
+var (
+	languages = map[string]Language{
+		LanguageBash:         {ID: LanguageBash},
+		LanguagePython:       {ID: LanguagePython, ProgramName: "python3"},
+		LanguageJQ:           {ID: LanguageJQ, ProgramName: "jq", Arguments: []string{"-n", "-f"}},
+		LanguageKubectlApply: {ID: LanguageKubectlApply, ProgramName: "kubectl", Arguments: []string{"apply", "-f"}},
+	}
+
+	// languageAliases maps other names for a language (e.g. the language IDs used by VS Code) to its ID.
+	languageAliases = map[string]string{
+		"":        LanguageBash,
+		"sh":      LanguageBash,
+		"shell":   LanguageBash,
+		"py":      LanguagePython,
+		"python3": LanguagePython,
+	}
+)
+
+// Languages returns the IDs of the supported languages.
+func Languages() []string {
+	ids := make([]string, 0, len(languages))
+	for id := range languages {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// LookupLanguage returns the language with the given ID or alias.
+func LookupLanguage(id string) (Language, bool) {
+	id = strings.ToLower(strings.TrimSpace(id))
+	if alias, ok := languageAliases[id]; ok {
+		id = alias
+	}
+	l, ok := languages[id]
+	return l, ok
+}
+
+// IsShell returns true if cells of the language are shell programs.
+func (l Language) IsShell() bool {
+	return l.ProgramName == ""
+}
+
+// CommandLine returns the shell command equivalent to running a cell of the language stored in file. It lets
+// cells of other languages be classified like shell programs.
+func (l Language) CommandLine(file string) string {
+	return strings.Join(append(append([]string{l.ProgramName}, l.Arguments...), file), " ")
+}
+
+// ProgramConfig returns the runme configuration for running contents as a program of the given language.
+// id is used as the known ID of the program e.g. the ID of the block containing the contents.
+func ProgramConfig(id string, language string, contents string) (*runnerv2.ProgramConfig, error) {
+	l, ok := LookupLanguage(language)
+	if !ok {
+		return nil, errors.Errorf("Unsupported language %q; must be one of %s", language, strings.Join(Languages(), ", "))
+	}
+
+	config := &runnerv2.ProgramConfig{
+		Env:         []string{"RUNME_ID=" + id, "RUNME_RUNNER=v2"},
+		Interactive: false,
+		KnownId:     id,
+	}
+	if l.IsShell() {
+		config.LanguageId = "sh"
+		config.Mode = runnerv2.CommandMode_COMMAND_MODE_INLINE
+		config.Source = &runnerv2.ProgramConfig_Commands{
+			Commands: &runnerv2.ProgramConfig_CommandList{
+				Items: strings.Split(contents, "\n"),
+			},
+		}
+		return config, nil
+	}
+
+	// Other languages are written to a temporary file which is passed to the program.
+	config.LanguageId = l.ID
+	config.ProgramName = l.ProgramName
+	config.Arguments = l.Arguments
+	config.Mode = runnerv2.CommandMode_COMMAND_MODE_FILE
+	config.Source = &runnerv2.ProgramConfig_Script{
+		Script: contents,
+	}
+	return config, nil
+}
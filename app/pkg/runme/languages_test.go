@@ -0,0 +1,89 @@
+package runme
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	runnerv2 "github.com/runmedev/runme/v3/api/gen/proto/go/runme/runner/v2"
+	"google.golang.org/protobuf/testing/protocmp"
+)
+
+func TestProgramConfig(t *testing.T) {
+	type testCase struct {
+		name     string
+		language string
+		contents string
+		expected *runnerv2.ProgramConfig
+	}
+
+	env := []string{"RUNME_ID=block-1", "RUNME_RUNNER=v2"}
+	cases := []testCase{
+		{
+			name:     "default-is-bash",
+			language: "",
+			contents: "kubectl get pods\nkubectl get nodes",
+			expected: &runnerv2.ProgramConfig{
+				LanguageId: "sh",
+				Env:        env,
+				Source: &runnerv2.ProgramConfig_Commands{
+					Commands: &runnerv2.ProgramConfig_CommandList{Items: []string{"kubectl get pods", "kubectl get nodes"}},
+				},
+				Mode:    runnerv2.CommandMode_COMMAND_MODE_INLINE,
+				KnownId: "block-1",
+			},
+		},
+		{
+			name:     "python",
+			language: "py",
+			contents: "print('hello')",
+			expected: &runnerv2.ProgramConfig{
+				ProgramName: "python3",
+				LanguageId:  LanguagePython,
+				Env:         env,
+				Source:      &runnerv2.ProgramConfig_Script{Script: "print('hello')"},
+				Mode:        runnerv2.CommandMode_COMMAND_MODE_FILE,
+				KnownId:     "block-1",
+			},
+		},
+		{
+			name:     "kubectl-apply",
+			language: LanguageKubectlApply,
+			contents: "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: test\n",
+			expected: &runnerv2.ProgramConfig{
+				ProgramName: "kubectl",
+				Arguments:   []string{"apply", "-f"},
+				LanguageId:  LanguageKubectlApply,
+				Env:         env,
+				Source:      &runnerv2.ProgramConfig_Script{Script: "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: test\n"},
+				Mode:        runnerv2.CommandMode_COMMAND_MODE_FILE,
+				KnownId:     "block-1",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual, err := ProgramConfig("block-1", c.language, c.contents)
+			if err != nil {
+				t.Fatalf("ProgramConfig failed: %+v", err)
+			}
+			if d := cmp.Diff(c.expected, actual, protocmp.Transform()); d != "" {
+				t.Errorf("Unexpected config (-want +got):\n%s", d)
+			}
+		})
+	}
+
+	if _, err := ProgramConfig("block-1", "cobol", "DISPLAY 'HELLO'."); err == nil {
+		t.Errorf("Expected an error for an unsupported language")
+	}
+}
+
+func TestLanguageCommandLine(t *testing.T) {
+	l, ok := LookupLanguage(LanguageKubectlApply)
+	if !ok {
+		t.Fatalf("Language %s not found", LanguageKubectlApply)
+	}
+	if actual := l.CommandLine("cell"); actual != "kubectl apply -f cell" {
+		t.Errorf("Unexpected command line: %s", actual)
+	}
+}
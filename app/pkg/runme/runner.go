@@ -1,11 +1,17 @@
 package runme
 
 import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
 	"github.com/pkg/errors"
 	runnerv2 "github.com/runmedev/runme/v3/api/gen/proto/go/runme/runner/v2"
 	"github.com/runmedev/runme/v3/command"
 	"github.com/runmedev/runme/v3/runnerv2service"
 	"go.uber.org/zap"
+	"google.golang.org/grpc/metadata"
 )
 
 // Runner lets you run commands using Runme.
@@ -24,3 +30,101 @@ func NewRunner(logger *zap.Logger) (*Runner, error) {
 		Server: server,
 	}, nil
 }
+
+// RunResult is the result of running a program with Runner.Run.
+type RunResult struct {
+	Stdout []byte
+	Stderr []byte
+	// ExitCode is -1 if the program didn't report one e.g. because it was cancelled.
+	ExitCode  int
+	StartTime time.Time
+	EndTime   time.Time
+	// Cancelled is true if the context was cancelled before the program finished.
+	Cancelled bool
+}
+
+// Run executes the contents as a program in the given language (see LookupLanguage) non-interactively and waits
+// for it to finish. id is used as the known ID of the program e.g. the ID of the block containing the program.
+func (r *Runner) Run(ctx context.Context, id string, language string, contents string) (*RunResult, error) {
+	config, err := ProgramConfig(id, language, contents)
+	if err != nil {
+		return nil, err
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream := &runStream{
+		ctx:    runCtx,
+		req:    &runnerv2.ExecuteRequest{Config: config},
+		result: &RunResult{ExitCode: -1, StartTime: time.Now()},
+	}
+
+	err = r.Server.Execute(stream)
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+	stream.result.EndTime = time.Now()
+	stream.result.Cancelled = ctx.Err() != nil
+	if err != nil && !stream.result.Cancelled {
+		return nil, errors.Wrapf(err, "Failed to execute program %s", id)
+	}
+	return stream.result, nil
+}
+
+// runStream is an in-memory runnerv2.RunnerService_ExecuteServer that sends a single request and collects the
+// responses.
+type runStream struct {
+	ctx context.Context
+	// req is the request to send. It is set to nil once it has been sent.
+	req *runnerv2.ExecuteRequest
+
+	mu     sync.Mutex
+	result *RunResult
+}
+
+// Recv returns the request the first time it is called. Subsequent calls block until the run finishes because
+// closing the stream would stop the program.
+func (s *runStream) Recv() (*runnerv2.ExecuteRequest, error) {
+	s.mu.Lock()
+	req := s.req
+	s.req = nil
+	s.mu.Unlock()
+	if req != nil {
+		return req, nil
+	}
+	<-s.ctx.Done()
+	return nil, io.EOF
+}
+
+func (s *runStream) Send(res *runnerv2.ExecuteResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.result.Stdout = append(s.result.Stdout, res.GetStdoutData()...)
+	s.result.Stderr = append(s.result.Stderr, res.GetStderrData()...)
+	if res.GetExitCode() != nil {
+		s.result.ExitCode = int(res.GetExitCode().GetValue())
+	}
+	return nil
+}
+
+func (s *runStream) SetHeader(md metadata.MD) error {
+	return nil
+}
+
+func (s *runStream) SendHeader(md metadata.MD) error {
+	return nil
+}
+
+func (s *runStream) SetTrailer(md metadata.MD) {}
+
+func (s *runStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *runStream) SendMsg(m any) error {
+	return errors.New("SendMsg is not implemented")
+}
+
+func (s *runStream) RecvMsg(m any) error {
+	return errors.New("RecvMsg is not implemented")
+}
@@ -0,0 +1,253 @@
+// Package search implements a local search index over a directory of markdown documents. It lets the assistant
+// search documents that can't be uploaded to OpenAI vector stores.
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/jlewi/cloud-assistant/app/pkg/docs"
+	"github.com/jlewi/cloud-assistant/protos/gen/cassie"
+	"github.com/pkg/errors"
+)
+
+const (
+	// maxChunkLength is the maximum length in characters of a chunk. Sections longer than this are split.
+	maxChunkLength = 2000
+
+	// BM25 parameters. These are the values commonly used in practice.
+	k1 = 1.2
+	b  = 0.75
+)
+
+// Chunk is a section of a document that is indexed and returned as a search result.
+type Chunk struct {
+	// ID uniquely identifies the chunk. It is the file followed by the index of the chunk in the file.
+	ID string `json:"id"`
+	// File is the path of the document relative to the indexed directory.
+	File string `json:"file"`
+	// Title is the heading of the section the chunk belongs to.
+	Title string `json:"title,omitempty"`
+	// Text is the markdown of the chunk.
+	Text string `json:"text"`
+	// Length is the number of terms in the chunk.
+	Length int `json:"length"`
+}
+
+// Result is a chunk that matched a query.
+type Result struct {
+	Chunk Chunk
+	Score float64
+}
+
+// Index is a BM25 index over chunks of markdown documents.
+type Index struct {
+	Chunks []Chunk `json:"chunks"`
+	// Postings maps each term to the number of times it occurs in each chunk, keyed by the chunk's position in Chunks.
+	Postings map[string]map[int]int `json:"postings"`
+	// AvgLength is the average number of terms in a chunk.
+	AvgLength float64 `json:"avgLength"`
+}
+
+// BuildIndex indexes the markdown files in dir and its subdirectories.
+func BuildIndex(dir string) (*Index, error) {
+	idx := &Index{
+		Chunks:   make([]Chunk, 0, 100),
+		Postings: make(map[string]map[int]int),
+	}
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".md", ".markdown":
+		default:
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to read %s", path)
+		}
+		blocks, err := docs.MarkdownToBlocks(string(data))
+		if err != nil {
+			return errors.Wrapf(err, "Failed to parse %s", path)
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to get relative path of %s", path)
+		}
+		for _, c := range chunkBlocks(filepath.ToSlash(rel), blocks) {
+			idx.add(c)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to index %s", dir)
+	}
+
+	total := 0
+	for _, c := range idx.Chunks {
+		total += c.Length
+	}
+	if len(idx.Chunks) > 0 {
+		idx.AvgLength = float64(total) / float64(len(idx.Chunks))
+	}
+	return idx, nil
+}
+
+// chunkBlocks splits the blocks of a document into chunks. A new chunk is started at every heading and when a chunk
+// would exceed maxChunkLength.
+func chunkBlocks(file string, blocks []*cassie.Block) []Chunk {
+	chunks := make([]Chunk, 0, 10)
+	title := ""
+	current := strings.Builder{}
+	// hasBody is true once the current chunk contains more than headings. Headings directly followed by a
+	// subheading (e.g. the title of the document) are kept with the next section rather than becoming a chunk.
+	hasBody := false
+	flush := func() {
+		hasBody = false
+		text := strings.TrimSpace(current.String())
+		current.Reset()
+		if text == "" {
+			return
+		}
+		chunks = append(chunks, Chunk{
+			ID:    fmt.Sprintf("%s#%d", file, len(chunks)),
+			File:  file,
+			Title: title,
+			Text:  text,
+		})
+	}
+
+	for _, block := range blocks {
+		switch block.GetKind() {
+		case cassie.BlockKind_MARKUP:
+			// Depending on the parser a markup block can contain several sections so look for headings line by line.
+			for _, line := range strings.Split(block.GetContents(), "\n") {
+				if strings.HasPrefix(line, "#") {
+					if hasBody {
+						flush()
+					}
+					title = strings.TrimSpace(strings.TrimLeft(line, "#"))
+				} else if strings.TrimSpace(line) != "" {
+					hasBody = true
+				}
+				if current.Len()+len(line) > maxChunkLength {
+					flush()
+				}
+				current.WriteString(line + "\n")
+			}
+			current.WriteString("\n")
+		case cassie.BlockKind_CODE:
+			text := docs.BlockToMarkdown(block, maxChunkLength)
+			if current.Len()+len(text) > maxChunkLength {
+				flush()
+			}
+			current.WriteString(text + "\n")
+			hasBody = true
+		}
+	}
+	flush()
+	return chunks
+}
+
+func (idx *Index) add(c Chunk) {
+	position := len(idx.Chunks)
+	terms := tokenize(c.Title + "\n" + c.Text)
+	c.Length = len(terms)
+	idx.Chunks = append(idx.Chunks, c)
+	for _, t := range terms {
+		postings, ok := idx.Postings[t]
+		if !ok {
+			postings = make(map[int]int)
+			idx.Postings[t] = postings
+		}
+		postings[position]++
+	}
+}
+
+// Search returns up to maxResults chunks ranked by their BM25 score for the query.
+func (idx *Index) Search(query string, maxResults int) []Result {
+	n := float64(len(idx.Chunks))
+	scores := make(map[int]float64)
+	seen := make(map[string]bool)
+	for _, t := range tokenize(query) {
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+		postings := idx.Postings[t]
+		df := float64(len(postings))
+		if df == 0 {
+			continue
+		}
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for position, tf := range postings {
+			length := float64(idx.Chunks[position].Length)
+			f := float64(tf)
+			scores[position] += idf * f * (k1 + 1) / (f + k1*(1-b+b*length/idx.AvgLength))
+		}
+	}
+
+	results := make([]Result, 0, len(scores))
+	for position, score := range scores {
+		results = append(results, Result{Chunk: idx.Chunks[position], Score: score})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Chunk.ID < results[j].Chunk.ID
+	})
+	if maxResults > 0 && len(results) > maxResults {
+		results = results[:maxResults]
+	}
+	return results
+}
+
+// Save writes the index to a file.
+func (idx *Index) Save(path string) error {
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to marshal index")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return errors.Wrapf(err, "Failed to create directory for index %s", path)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return errors.Wrapf(err, "Failed to write index %s", path)
+	}
+	return nil
+}
+
+// LoadIndex reads an index written by Save.
+func LoadIndex(path string) (*Index, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read index %s", path)
+	}
+	idx := &Index{}
+	if err := json.Unmarshal(data, idx); err != nil {
+		return nil, errors.Wrapf(err, "Failed to unmarshal index %s", path)
+	}
+	return idx, nil
+}
+
+// tokenize splits text into lower case terms made of letters and digits.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
@@ -0,0 +1,93 @@
+package search
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func writeDocs(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("Failed to create directory: %+v", err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %+v", name, err)
+		}
+	}
+	return dir
+}
+
+func TestIndex(t *testing.T) {
+	dir := writeDocs(t, map[string]string{
+		"runbooks/ingress.md": `# Ingress
+
+## Restarting the ingress controller
+
+If the ingress controller is unhealthy restart it.
+
+` + "```bash\nkubectl -n ingress rollout restart deployment/ingress-nginx\n```" + `
+
+## Certificates
+
+Certificates are issued by cert-manager.
+`,
+		"runbooks/database.md": `# Database
+
+## Failover
+
+Promote the replica to primary when the primary database is down.
+`,
+		"notes.txt": "The ingress controller is not indexed because this isn't markdown.",
+	})
+
+	idx, err := BuildIndex(dir)
+	if err != nil {
+		t.Fatalf("Failed to build index: %+v", err)
+	}
+
+	ids := make([]string, 0, len(idx.Chunks))
+	for _, c := range idx.Chunks {
+		ids = append(ids, c.ID)
+	}
+	expectedIDs := []string{
+		"runbooks/database.md#0",
+		"runbooks/ingress.md#0",
+		"runbooks/ingress.md#1",
+	}
+	if d := cmp.Diff(expectedIDs, ids); d != "" {
+		t.Errorf("Unexpected chunks (-want +got):\n%s", d)
+	}
+
+	// Round trip the index through a file.
+	path := filepath.Join(t.TempDir(), "index.json")
+	if err := idx.Save(path); err != nil {
+		t.Fatalf("Failed to save index: %+v", err)
+	}
+	idx, err = LoadIndex(path)
+	if err != nil {
+		t.Fatalf("Failed to load index: %+v", err)
+	}
+
+	results := idx.Search("How do I restart the ingress controller?", 2)
+	if len(results) == 0 {
+		t.Fatalf("Expected results")
+	}
+	top := results[0].Chunk
+	if top.ID != "runbooks/ingress.md#0" || top.Title != "Restarting the ingress controller" {
+		t.Errorf("Unexpected top result: %+v", top)
+	}
+
+	if results := idx.Search("primary replica", 5); len(results) != 1 || results[0].Chunk.File != "runbooks/database.md" {
+		t.Errorf("Unexpected results for database query: %+v", results)
+	}
+
+	if results := idx.Search("zebra", 5); len(results) != 0 {
+		t.Errorf("Expected no results; got %+v", results)
+	}
+}
@@ -84,8 +84,8 @@ func (p *AuthMux) HandleProtected(pattern string, handler http.Handler, checker
 				return
 			}
 
-			// Get the IDToken from the context
-			next.ServeHTTP(w, r)
+			// Make the principal available to the handler
+			next.ServeHTTP(w, r.WithContext(iam.ContextWithPrincipal(r.Context(), principal)))
 		})
 	}
 	log := logs.NewLogger()
@@ -6,19 +6,24 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"sort"
 	"testing"
 	"time"
 
 	"connectrpc.com/connect"
 	"github.com/go-logr/zapr"
+	"github.com/google/go-cmp/cmp"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"github.com/jlewi/cloud-assistant/app/pkg/ai"
 	"github.com/jlewi/cloud-assistant/app/pkg/application"
 	"github.com/jlewi/cloud-assistant/app/pkg/config"
+	"github.com/jlewi/cloud-assistant/app/pkg/fakeopenai"
 	"github.com/jlewi/cloud-assistant/app/pkg/logs"
 	"github.com/jlewi/cloud-assistant/protos/gen/cassie"
 	"github.com/jlewi/cloud-assistant/protos/gen/cassie/cassieconnect"
@@ -642,3 +647,141 @@ func SkipIfMissing(t *testing.T, env string) string {
 	t.Skipf("missing %s", env)
 	return ""
 }
+
+// Test_GenerateWithFakeResponses runs the server and agent end to end against a fake of the Responses API.
+func Test_GenerateWithFakeResponses(t *testing.T) {
+	fake := fakeopenai.NewServer(
+		fakeopenai.NewTurn().
+			Reasoning("The user wants to know if the cluster is healthy.", "I should check the pods and nodes.").
+			FileSearch(fakeopenai.FileSearchResult{FileID: "file_1", Filename: "runbook.md", Score: 0.9}).
+			Text("Let me check the cluster.").
+			ShellCall("kubectl get pods").
+			ShellCall("kubectl get nodes"),
+		// The stream fails part way through so the agent retries.
+		fakeopenai.NewTurn().Text("The pods").Error("server_error", "The server had an error"),
+		fakeopenai.NewTurn().Text("All pods and nodes are healthy."),
+	)
+	defer fake.Close()
+
+	keyFile := filepath.Join(t.TempDir(), "openai.key")
+	if err := os.WriteFile(keyFile, []byte("fake"), 0o600); err != nil {
+		t.Fatalf("Failed to write key file: %+v", err)
+	}
+	client, err := ai.NewClient(config.OpenAIConfig{APIKeyFile: keyFile, BaseURL: fake.BaseURL()})
+	if err != nil {
+		t.Fatalf("Failed to create client: %+v", err)
+	}
+	agent, err := ai.NewAgent(ai.AgentOptions{Client: client, RetryBackoff: time.Millisecond})
+	if err != nil {
+		t.Fatalf("Failed to create agent: %+v", err)
+	}
+	// The static assets aren't built in tests so serve an empty directory.
+	srv, err := NewServer(Options{Server: &config.AssistantServerConfig{StaticAssets: t.TempDir()}}, agent)
+	if err != nil {
+		t.Fatalf("Failed to create server: %+v", err)
+	}
+	if err := srv.registerServices(); err != nil {
+		t.Fatalf("Failed to register services: %+v", err)
+	}
+	ts := httptest.NewServer(srv.engine)
+	defer ts.Close()
+	blocksClient := cassieconnect.NewBlocksServiceClient(ts.Client(), ts.URL)
+
+	blocks := make(map[string]*cassie.Block)
+	// generate sends the request and returns the ID of the last response.
+	generate := func(req *cassie.GenerateRequest) string {
+		t.Helper()
+		stream, err := blocksClient.Generate(context.Background(), connect.NewRequest(req))
+		if err != nil {
+			t.Fatalf("Generate failed: %+v", err)
+		}
+		responseID := ""
+		for stream.Receive() {
+			responseID = stream.Msg().GetResponseId()
+			for _, b := range stream.Msg().GetBlocks() {
+				if b.GetMetadata()[ai.RetractedMetadataKey] == "true" {
+					delete(blocks, b.GetId())
+					continue
+				}
+				blocks[b.GetId()] = b
+			}
+		}
+		if err := stream.Err(); err != nil {
+			t.Fatalf("Generate stream failed: %+v", err)
+		}
+		return responseID
+	}
+
+	responseID := generate(&cassie.GenerateRequest{
+		Blocks: []*cassie.Block{
+			{Id: "user_1", Kind: cassie.BlockKind_MARKUP, Role: cassie.BlockRole_BLOCK_ROLE_USER, Contents: "Is the cluster healthy?"},
+		},
+	})
+	if responseID != "resp_1" {
+		t.Fatalf("Expected response resp_1; got %q", responseID)
+	}
+
+	calls := make([]*cassie.Block, 0, 2)
+	hasSearch := false
+	reasoning := ""
+	for _, b := range blocks {
+		switch {
+		case b.GetKind() == cassie.BlockKind_REASONING:
+			reasoning = b.GetContents()
+		case b.GetKind() == cassie.BlockKind_FILE_SEARCH_RESULTS:
+			hasSearch = len(b.GetFileSearchResults()) == 1 && b.GetFileSearchResults()[0].GetFileName() == "runbook.md"
+		case b.GetCallId() != "":
+			calls = append(calls, b)
+		}
+	}
+	if !hasSearch {
+		t.Errorf("Expected a file search results block for runbook.md; got %v", blocks)
+	}
+	if len(calls) != 2 {
+		t.Fatalf("Expected 2 shell calls; got %d", len(calls))
+	}
+	if reasoning != "The user wants to know if the cluster is healthy.\n\nI should check the pods and nodes." {
+		t.Errorf("Unexpected reasoning summary: %q", reasoning)
+	}
+
+	// The client runs the commands and sends their outputs with the next turn.
+	for _, c := range calls {
+		c.Outputs = []*cassie.BlockOutput{
+			{
+				Kind:  cassie.BlockOutputKind_STDOUT,
+				Items: []*cassie.BlockOutputItem{{Mime: "text/plain", TextData: "ok"}},
+			},
+		}
+	}
+	if got := generate(&cassie.GenerateRequest{PreviousResponseId: responseID, Blocks: calls}); got != "resp_3" {
+		t.Errorf("Expected the retry to produce resp_3; got %q", got)
+	}
+
+	texts := make([]string, 0, len(blocks))
+	for _, b := range blocks {
+		if b.GetKind() == cassie.BlockKind_MARKUP && b.GetRole() == cassie.BlockRole_BLOCK_ROLE_ASSISTANT {
+			texts = append(texts, b.GetContents())
+		}
+	}
+	sort.Strings(texts)
+	if d := cmp.Diff([]string{"All pods and nodes are healthy.", "Let me check the cluster."}, texts); d != "" {
+		t.Errorf("Unexpected assistant messages; the failed attempt should be retracted (-want +got):\n%s", d)
+	}
+
+	requests := fake.Requests()
+	if len(requests) != 3 {
+		t.Fatalf("Expected 3 requests; got %d", len(requests))
+	}
+	// Both the failed attempt and the retry continue the first response with the outputs of the calls.
+	for _, r := range requests[1:] {
+		outputs := 0
+		for _, item := range r.Input {
+			if item.Type == "function_call_output" {
+				outputs++
+			}
+		}
+		if r.PreviousResponseID != "resp_1" || outputs != 2 {
+			t.Errorf("Expected the request to continue resp_1 with 2 outputs; got %q with %d outputs", r.PreviousResponseID, outputs)
+		}
+	}
+}
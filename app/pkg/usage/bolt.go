@@ -0,0 +1,155 @@
+package usage
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	"github.com/jlewi/cloud-assistant/app/api"
+	"github.com/jlewi/cloud-assistant/app/pkg/boltdb"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// DefaultRetention is how long usage records are kept if no retention is configured. It's longer than the
+	// longest quota period.
+	DefaultRetention = 90 * 24 * time.Hour
+)
+
+var (
+	recordsBucket = []byte("usage")
+	// totalsBucket maps the keys returned by totalKey to the total tokens used.
+	totalsBucket = []byte("usageTotals")
+)
+
+// BoltStore is a Store backed by a bbolt database on a local disk. Records are keyed by time so listing the records
+// since the start of a period doesn't scan older records. The totals for quotas are
+// updated in the same transaction as the records are added. Records and totals older than the retention are
+// deleted.
+type BoltStore struct {
+	db        *boltdb.DB
+	retention time.Duration
+	// now returns the current time. It can be overridden in tests.
+	now func() time.Time
+	// lastSweep is when old records were last deleted. It is only accessed in read-write transactions.
+	lastSweep time.Time
+}
+
+// NewBoltStore creates a store using the database at path. Records are kept for retention.
+func NewBoltStore(path string, retention time.Duration) (*BoltStore, error) {
+	if retention <= 0 {
+		retention = DefaultRetention
+	}
+	db, err := boltdb.New(path, "usage store", recordsBucket)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Update(createTotals); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &BoltStore{db: db, retention: retention, now: time.Now}, nil
+}
+
+// Close closes the database.
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+// createTotals creates the totals bucket if it doesn't exist. Databases written before totals were kept already
+// have records so the totals are computed from them.
+func createTotals(tx *bolt.Tx) error {
+	if tx.Bucket(totalsBucket) != nil {
+		return nil
+	}
+	if _, err := tx.CreateBucket(totalsBucket); err != nil {
+		return errors.Wrapf(err, "Failed to create bucket %s", totalsBucket)
+	}
+	return tx.Bucket(recordsBucket).ForEach(func(k, v []byte) error {
+		r := Record{}
+		if err := json.Unmarshal(v, &r); err != nil {
+			return errors.Wrapf(err, "Failed to unmarshal usage record %s", k)
+		}
+		return addTotals(tx, r)
+	})
+}
+
+// addTotals adds the tokens used by the record to its totals.
+func addTotals(tx *bolt.Tx, r Record) error {
+	bucket := tx.Bucket(totalsBucket)
+	for _, k := range totalKeys(r) {
+		total := int64(0)
+		if v := bucket.Get([]byte(k)); len(v) == 8 {
+			total = int64(binary.BigEndian.Uint64(v))
+		}
+		v := make([]byte, 8)
+		binary.BigEndian.PutUint64(v, uint64(total+r.TotalTokens))
+		if err := bucket.Put([]byte(k), v); err != nil {
+			return errors.Wrapf(err, "Failed to update usage total %s", k)
+		}
+	}
+	return nil
+}
+
+func (s *BoltStore) Add(ctx context.Context, r Record) error {
+	value, err := json.Marshal(r)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to marshal usage for response %s", r.ResponseID)
+	}
+	// The response ID makes the key unique if two responses finish at the same time.
+	key := append(boltdb.TimeKey(r.Time), []byte(r.ResponseID)...)
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(recordsBucket).Put(key, value); err != nil {
+			return errors.Wrapf(err, "Failed to store usage for response %s", r.ResponseID)
+		}
+		if err := addTotals(tx, r); err != nil {
+			return err
+		}
+		return s.sweep(tx)
+	})
+}
+
+func (s *BoltStore) List(ctx context.Context, since time.Time) ([]Record, error) {
+	records := make([]Record, 0, 100)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(recordsBucket).Cursor()
+		for k, v := c.Seek(boltdb.TimeKey(since)); k != nil; k, v = c.Next() {
+			r := Record{}
+			if err := json.Unmarshal(v, &r); err != nil {
+				return errors.Wrapf(err, "Failed to unmarshal usage record %s", k)
+			}
+			records = append(records, r)
+		}
+		return nil
+	})
+	return records, err
+}
+
+func (s *BoltStore) Total(ctx context.Context, m api.Member, period api.QuotaPeriod, t time.Time) (int64, error) {
+	total := int64(0)
+	key := totalKey(m, period, t)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(totalsBucket).Get([]byte(key)); len(v) == 8 {
+			total = int64(binary.BigEndian.Uint64(v))
+		}
+		return nil
+	})
+	return total, err
+}
+
+// sweep deletes the records and totals older than the retention if it hasn't done so recently.
+func (s *BoltStore) sweep(tx *bolt.Tx) error {
+	now := s.now()
+	if now.Sub(s.lastSweep) < boltdb.SweepInterval {
+		return nil
+	}
+	s.lastSweep = now
+	cutoff := now.Add(-s.retention)
+	if err := boltdb.DeleteBefore(tx, recordsBucket, boltdb.TimeKey(cutoff)); err != nil {
+		return err
+	}
+	// Totals are keyed by the start of their period so the keys before the cutoff's date are for older periods.
+	return boltdb.DeleteBefore(tx, totalsBucket, []byte(cutoff.UTC().Format("2006-01-02")))
+}
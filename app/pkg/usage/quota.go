@@ -0,0 +1,110 @@
+package usage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jlewi/cloud-assistant/app/api"
+	"github.com/pkg/errors"
+)
+
+// QuotaChecker enforces a QuotaPolicy using the records in a Store.
+type QuotaChecker struct {
+	quotas []api.Quota
+	store  Store
+	// now returns the current time. It can be overridden in tests.
+	now func() time.Time
+}
+
+// NewQuotaChecker creates a new QuotaChecker.
+func NewQuotaChecker(policy api.QuotaPolicy, store Store) (*QuotaChecker, error) {
+	if store == nil {
+		return nil, errors.New("Store must be set to enforce quotas")
+	}
+	if isValid, msg := IsValidPolicy(policy); !isValid {
+		return nil, errors.New(msg)
+	}
+	return &QuotaChecker{
+		quotas: policy.Quotas,
+		store:  store,
+		now:    time.Now,
+	}, nil
+}
+
+// IsValidPolicy checks if the quota policy is valid. If it's not it returns a string with a human readable
+// message about the violations.
+func IsValidPolicy(policy api.QuotaPolicy) (bool, string) {
+	problems := make([]string, 0, 5)
+	for i, q := range policy.Quotas {
+		switch q.Period {
+		case api.DailyPeriod, api.MonthlyPeriod:
+		default:
+			problems = append(problems, fmt.Sprintf("quotas[%d].period %q must be one of daily, monthly", i, q.Period))
+		}
+		if q.MaxTokens <= 0 {
+			problems = append(problems, fmt.Sprintf("quotas[%d].maxTokens must be positive", i))
+		}
+		if len(q.Members) == 0 {
+			problems = append(problems, fmt.Sprintf("quotas[%d].members must not be empty", i))
+		}
+		for j, m := range q.Members {
+			if m.Kind != api.UserKind && m.Kind != api.DomainKind {
+				problems = append(problems, fmt.Sprintf("quotas[%d].members[%d] %s: kind must be one of: user, domain", i, j, m.Name))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return false, fmt.Sprintf("Quota policy is invalid: %v", problems)
+	}
+	return true, ""
+}
+
+// Check returns an error if the principal has exceeded any of the quotas that apply to it.
+func (c *QuotaChecker) Check(ctx context.Context, principal string) error {
+	if principal == "" {
+		// Quotas are only enforced on authenticated principals.
+		return nil
+	}
+
+	now := c.now().UTC()
+	for _, q := range c.quotas {
+		for _, m := range q.Members {
+			if !matches(m, principal) {
+				continue
+			}
+
+			used, err := c.store.Total(ctx, m, q.Period, now)
+			if err != nil {
+				return errors.Wrapf(err, "Failed to get the %s usage of %s %s", q.Period, m.Kind, m.Name)
+			}
+
+			if used >= q.MaxTokens {
+				return errors.Errorf("The %s quota of %d tokens for %s %s has been exceeded (%d tokens used)", q.Period, q.MaxTokens, m.Kind, m.Name, used)
+			}
+		}
+	}
+	return nil
+}
+
+// matches returns true if the member includes the principal.
+func matches(m api.Member, principal string) bool {
+	switch m.Kind {
+	case api.UserKind:
+		return m.Name == principal
+	case api.DomainKind:
+		return Domain(principal) == m.Name
+	}
+	return false
+}
+
+func periodStart(period api.QuotaPeriod, now time.Time) time.Time {
+	if period == api.DailyPeriod {
+		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	return monthStart(now)
+}
+
+func monthStart(now time.Time) time.Time {
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
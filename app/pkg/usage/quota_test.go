@@ -0,0 +1,266 @@
+package usage
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jlewi/cloud-assistant/app/api"
+	"github.com/jlewi/cloud-assistant/app/pkg/boltdb"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestQuotaChecker(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+
+	boltStore, err := NewBoltStore(filepath.Join(t.TempDir(), "usage.db"), 0)
+	if err != nil {
+		t.Fatalf("Failed to create store: %+v", err)
+	}
+	boltStore.now = func() time.Time { return now }
+	memoryStore := NewMemoryStore()
+	memoryStore.now = func() time.Time { return now }
+	stores := map[string]Store{
+		"memory": memoryStore,
+		"bolt":   boltStore,
+	}
+	records := []Record{
+		// Last month; doesn't count.
+		{Time: now.AddDate(0, -1, 0), ResponseID: "resp_0", Principal: "alice@acme.com", TotalTokens: 1000},
+		// Earlier this month; only counts towards monthly quotas.
+		{Time: now.AddDate(0, 0, -3), ResponseID: "resp_1", Principal: "alice@acme.com", TotalTokens: 60},
+		{Time: now.Add(-time.Hour), ResponseID: "resp_2", Principal: "alice@acme.com", TotalTokens: 30},
+		{Time: now.Add(-time.Hour), ResponseID: "resp_3", Principal: "bob@acme.com", TotalTokens: 20},
+	}
+	for _, store := range stores {
+		for _, r := range records {
+			if err := store.Add(ctx, r); err != nil {
+				t.Fatalf("Failed to add record: %+v", err)
+			}
+		}
+	}
+
+	type testCase struct {
+		name      string
+		quotas    []api.Quota
+		principal string
+		exceeded  bool
+	}
+
+	cases := []testCase{
+		{
+			name:      "daily-user-ok",
+			quotas:    []api.Quota{{Members: []api.Member{{Name: "alice@acme.com", Kind: api.UserKind}}, Period: api.DailyPeriod, MaxTokens: 50}},
+			principal: "alice@acme.com",
+			exceeded:  false,
+		},
+		{
+			name:      "monthly-user-exceeded",
+			quotas:    []api.Quota{{Members: []api.Member{{Name: "alice@acme.com", Kind: api.UserKind}}, Period: api.MonthlyPeriod, MaxTokens: 90}},
+			principal: "alice@acme.com",
+			exceeded:  true,
+		},
+		{
+			name:      "domain-is-shared",
+			quotas:    []api.Quota{{Members: []api.Member{{Name: "acme.com", Kind: api.DomainKind}}, Period: api.DailyPeriod, MaxTokens: 50}},
+			principal: "bob@acme.com",
+			exceeded:  true,
+		},
+		{
+			name:      "other-user",
+			quotas:    []api.Quota{{Members: []api.Member{{Name: "alice@acme.com", Kind: api.UserKind}}, Period: api.MonthlyPeriod, MaxTokens: 10}},
+			principal: "bob@acme.com",
+			exceeded:  false,
+		},
+		{
+			name:      "no-principal",
+			quotas:    []api.Quota{{Members: []api.Member{{Name: "acme.com", Kind: api.DomainKind}}, Period: api.DailyPeriod, MaxTokens: 1}},
+			principal: "",
+			exceeded:  false,
+		},
+	}
+
+	for name, store := range stores {
+		for _, c := range cases {
+			t.Run(name+"/"+c.name, func(t *testing.T) {
+				checker, err := NewQuotaChecker(api.QuotaPolicy{Quotas: c.quotas}, store)
+				if err != nil {
+					t.Fatalf("Failed to create checker: %+v", err)
+				}
+				checker.now = func() time.Time { return now }
+
+				err = checker.Check(ctx, c.principal)
+				if exceeded := err != nil; exceeded != c.exceeded {
+					t.Errorf("Want exceeded %v; got error %v", c.exceeded, err)
+				}
+			})
+		}
+	}
+}
+
+func TestIsValidPolicy(t *testing.T) {
+	policy := api.QuotaPolicy{
+		Quotas: []api.Quota{
+			{Members: []api.Member{{Name: "acme.com", Kind: "group"}}, Period: "weekly", MaxTokens: 0},
+		},
+	}
+	if ok, _ := IsValidPolicy(policy); ok {
+		t.Errorf("Expected the policy to be invalid")
+	}
+}
+
+func TestBoltStore(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewBoltStore(filepath.Join(t.TempDir(), "usage.db"), 0)
+	if err != nil {
+		t.Fatalf("Failed to create store: %+v", err)
+	}
+
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	records := []Record{
+		{Time: now, ResponseID: "resp_2", Principal: "bob@acme.com", InputTokens: 5, OutputTokens: 5, TotalTokens: 10},
+		{Time: now.Add(-time.Hour), ResponseID: "resp_1", Principal: "alice@acme.com", Model: "gpt-4.1", TotalTokens: 20},
+		{Time: now.AddDate(0, -1, 0), ResponseID: "resp_0", Principal: "alice@acme.com", TotalTokens: 30},
+	}
+	for _, r := range records {
+		if err := store.Add(ctx, r); err != nil {
+			t.Fatalf("Failed to add record: %+v", err)
+		}
+	}
+
+	actual, err := store.List(ctx, now.AddDate(0, 0, -1))
+	if err != nil {
+		t.Fatalf("Failed to list records: %+v", err)
+	}
+	if d := cmp.Diff([]Record{records[1], records[0]}, actual); d != "" {
+		t.Errorf("Unexpected records (-want +got):\n%s", d)
+	}
+}
+
+func TestBoltStoreRetention(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewBoltStore(filepath.Join(t.TempDir(), "usage.db"), 24*time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create store: %+v", err)
+	}
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+
+	// The first record is swept when the second is added since it's older than the retention.
+	records := []Record{
+		{Time: now.Add(-49 * time.Hour), ResponseID: "resp_1", Principal: "alice@acme.com", TotalTokens: 10},
+		{Time: now, ResponseID: "resp_2", Principal: "alice@acme.com", TotalTokens: 20},
+	}
+	for _, r := range records {
+		if err := store.Add(ctx, r); err != nil {
+			t.Fatalf("Failed to add record: %+v", err)
+		}
+		// Make sure every Add sweeps.
+		store.lastSweep = time.Time{}
+	}
+
+	actual, err := store.List(ctx, now.AddDate(0, 0, -7))
+	if err != nil {
+		t.Fatalf("Failed to list records: %+v", err)
+	}
+	if d := cmp.Diff(records[1:], actual); d != "" {
+		t.Errorf("Unexpected records (-want +got):\n%s", d)
+	}
+	alice := api.Member{Name: "alice@acme.com", Kind: api.UserKind}
+	if total, err := store.Total(ctx, alice, api.DailyPeriod, now.Add(-49*time.Hour)); err != nil || total != 0 {
+		t.Errorf("Expected the total for two days ago to be deleted; got %d, %v", total, err)
+	}
+	if total, err := store.Total(ctx, alice, api.DailyPeriod, now); err != nil || total != 20 {
+		t.Errorf("Expected the total for today to be kept; got %d, %v", total, err)
+	}
+}
+
+func TestMemoryStoreRetention(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+
+	// The first record is deleted since it's from before the last quota period.
+	records := []Record{
+		{Time: now.AddDate(0, -2, 0), ResponseID: "resp_1", Principal: "alice@acme.com", TotalTokens: 10},
+		{Time: now, ResponseID: "resp_2", Principal: "alice@acme.com", TotalTokens: 20},
+	}
+	for _, r := range records {
+		if err := store.Add(ctx, r); err != nil {
+			t.Fatalf("Failed to add record: %+v", err)
+		}
+	}
+
+	actual, err := store.List(ctx, time.Time{})
+	if err != nil {
+		t.Fatalf("Failed to list records: %+v", err)
+	}
+	if d := cmp.Diff(records[1:], actual); d != "" {
+		t.Errorf("Unexpected records (-want +got):\n%s", d)
+	}
+	alice := api.Member{Name: "alice@acme.com", Kind: api.UserKind}
+	if total, err := store.Total(ctx, alice, api.MonthlyPeriod, records[0].Time); err != nil || total != 0 {
+		t.Errorf("Expected the total for two months ago to be deleted; got %d, %v", total, err)
+	}
+	if total, err := store.Total(ctx, alice, api.MonthlyPeriod, now); err != nil || total != 20 {
+		t.Errorf("Expected the total for this month to be kept; got %d, %v", total, err)
+	}
+}
+
+func TestBoltStoreComputesTotals(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "usage.db")
+	now := time.Now().UTC()
+
+	// Write a record the way stores did before totals were kept.
+	db, err := boltdb.New(path, "usage store", recordsBucket)
+	if err != nil {
+		t.Fatalf("Failed to create database: %+v", err)
+	}
+	value, err := json.Marshal(Record{Time: now, ResponseID: "resp_1", Principal: "alice@acme.com", TotalTokens: 40})
+	if err != nil {
+		t.Fatalf("Failed to marshal record: %+v", err)
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(recordsBucket).Put(boltdb.TimeKey(now), value)
+	}); err != nil {
+		t.Fatalf("Failed to add record: %+v", err)
+	}
+
+	store, err := NewBoltStore(path, 0)
+	if err != nil {
+		t.Fatalf("Failed to create store: %+v", err)
+	}
+	if err := store.Add(ctx, Record{Time: now, ResponseID: "resp_2", Principal: "bob@acme.com", TotalTokens: 2}); err != nil {
+		t.Fatalf("Failed to add record: %+v", err)
+	}
+	total, err := store.Total(ctx, api.Member{Name: "acme.com", Kind: api.DomainKind}, api.MonthlyPeriod, now)
+	if err != nil {
+		t.Fatalf("Failed to get total: %+v", err)
+	}
+	if total != 42 {
+		t.Errorf("Expected the total to include the existing record; got %d", total)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	records := []Record{
+		{Principal: "alice@acme.com", InputTokens: 10, OutputTokens: 5, TotalTokens: 15},
+		{Principal: "bob@acme.com", InputTokens: 20, CachedInputTokens: 10, OutputTokens: 5, TotalTokens: 25},
+		{Principal: "carol@example.com", TotalTokens: 30},
+	}
+
+	expected := []Summary{
+		{Key: "acme.com", Responses: 2, InputTokens: 30, CachedInputTokens: 10, OutputTokens: 10, TotalTokens: 40},
+		{Key: "example.com", Responses: 1, TotalTokens: 30},
+	}
+	if d := cmp.Diff(expected, Summarize(records, true)); d != "" {
+		t.Errorf("Unexpected summary (-want +got):\n%s", d)
+	}
+}
@@ -0,0 +1,206 @@
+// Package usage records the tokens used to generate responses and enforces quotas on them.
+package usage
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jlewi/cloud-assistant/app/api"
+	"github.com/jlewi/cloud-assistant/app/pkg/boltdb"
+)
+
+// Record is the token usage of a single response.
+type Record struct {
+	// Time is when the response was generated.
+	Time time.Time `json:"time"`
+	// ResponseID is the ID of the response.
+	ResponseID string `json:"responseId"`
+	// Principal is the user the response was generated for. It is empty if OIDC isn't enabled.
+	Principal string `json:"principal,omitempty"`
+	// Model is the model that generated the response.
+	Model string `json:"model,omitempty"`
+
+	InputTokens       int64 `json:"inputTokens"`
+	CachedInputTokens int64 `json:"cachedInputTokens"`
+	OutputTokens      int64 `json:"outputTokens"`
+	TotalTokens       int64 `json:"totalTokens"`
+}
+
+// Domain returns the domain of the principal or the empty string if the principal isn't an email address.
+func (r Record) Domain() string {
+	return Domain(r.Principal)
+}
+
+// Domain returns the domain of an email address or the empty string if it isn't an email address.
+func Domain(principal string) string {
+	pieces := strings.Split(principal, "@")
+	if len(pieces) != 2 {
+		return ""
+	}
+	return pieces[1]
+}
+
+// Store stores usage records.
+type Store interface {
+	// Add adds a record.
+	Add(ctx context.Context, r Record) error
+	// List returns the records for responses generated at or after since ordered by time.
+	List(ctx context.Context, since time.Time) ([]Record, error)
+	// Total returns the tokens used by the member in the quota period containing t. Totals are kept as records are
+	// added so checking quotas doesn't have to list the records.
+	Total(ctx context.Context, m api.Member, period api.QuotaPeriod, t time.Time) (int64, error)
+}
+
+// totalKeys returns the keys of the totals the record counts towards; those of its principal and of their domain
+// for each quota period. Records without a principal don't count towards any quota.
+func totalKeys(r Record) []string {
+	if r.Principal == "" {
+		return nil
+	}
+	members := []api.Member{{Name: r.Principal, Kind: api.UserKind}}
+	if d := r.Domain(); d != "" {
+		members = append(members, api.Member{Name: d, Kind: api.DomainKind})
+	}
+	keys := make([]string, 0, 2*len(members))
+	for _, period := range []api.QuotaPeriod{api.DailyPeriod, api.MonthlyPeriod} {
+		for _, m := range members {
+			keys = append(keys, totalKey(m, period, r.Time))
+		}
+	}
+	return keys
+}
+
+// totalKey returns the key of the total of the member in the quota period containing t. Keys start with the start
+// of the period so they sort in time order.
+func totalKey(m api.Member, period api.QuotaPeriod, t time.Time) string {
+	return periodStart(period, t.UTC()).Format("2006-01-02") + "/" + string(period) + "/" + string(m.Kind) + "/" + m.Name
+}
+
+// memoryRetention is how long a MemoryStore keeps records and totals. It's longer than the longest quota period.
+const memoryRetention = 32 * 24 * time.Hour
+
+// MemoryStore is a Store that keeps records in memory. Records are lost when the server restarts. Records and totals
+// older than the longest quota period are deleted so the store doesn't grow without bound.
+type MemoryStore struct {
+	mu      sync.Mutex
+	records []Record
+	totals  map[string]int64
+	// now returns the current time. It can be overridden in tests.
+	now func() time.Time
+	// lastSweep is when old records were last deleted.
+	lastSweep time.Time
+}
+
+// NewMemoryStore creates a new MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		records: make([]Record, 0, 100),
+		totals:  make(map[string]int64),
+		now:     time.Now,
+	}
+}
+
+func (s *MemoryStore) Add(ctx context.Context, r Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, r)
+	for _, k := range totalKeys(r) {
+		s.totals[k] += r.TotalTokens
+	}
+	s.sweep()
+	return nil
+}
+
+// sweep deletes the records and totals older than memoryRetention if it hasn't done so recently. The caller must
+// hold the lock.
+func (s *MemoryStore) sweep() {
+	now := s.now()
+	if now.Sub(s.lastSweep) < boltdb.SweepInterval {
+		return
+	}
+	s.lastSweep = now
+	cutoff := now.Add(-memoryRetention)
+	kept := s.records[:0]
+	for _, r := range s.records {
+		if !r.Time.Before(cutoff) {
+			kept = append(kept, r)
+		}
+	}
+	s.records = kept
+	// Totals are keyed by the start of their period so the keys before the cutoff's date are for older periods.
+	before := cutoff.UTC().Format("2006-01-02")
+	for k := range s.totals {
+		if k < before {
+			delete(s.totals, k)
+		}
+	}
+}
+
+func (s *MemoryStore) Total(ctx context.Context, m api.Member, period api.QuotaPeriod, t time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.totals[totalKey(m, period, t)], nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, since time.Time) ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]Record, 0, len(s.records))
+	for _, r := range s.records {
+		if !r.Time.Before(since) {
+			result = append(result, r)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Time.Before(result[j].Time)
+	})
+	return result, nil
+}
+
+// Summary is the total usage of a principal or domain.
+type Summary struct {
+	// Key is the principal or domain.
+	Key               string `json:"key"`
+	Responses         int    `json:"responses"`
+	InputTokens       int64  `json:"inputTokens"`
+	CachedInputTokens int64  `json:"cachedInputTokens"`
+	OutputTokens      int64  `json:"outputTokens"`
+	TotalTokens       int64  `json:"totalTokens"`
+}
+
+// Summarize totals the records by principal or, if byDomain is true, by the domain of the principal.
+// The summaries are ordered by total tokens, largest first.
+func Summarize(records []Record, byDomain bool) []Summary {
+	totals := make(map[string]*Summary)
+	for _, r := range records {
+		key := r.Principal
+		if byDomain {
+			key = r.Domain()
+		}
+		s, ok := totals[key]
+		if !ok {
+			s = &Summary{Key: key}
+			totals[key] = s
+		}
+		s.Responses++
+		s.InputTokens += r.InputTokens
+		s.CachedInputTokens += r.CachedInputTokens
+		s.OutputTokens += r.OutputTokens
+		s.TotalTokens += r.TotalTokens
+	}
+
+	result := make([]Summary, 0, len(totals))
+	for _, s := range totals {
+		result = append(result, *s)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].TotalTokens != result[j].TotalTokens {
+			return result[i].TotalTokens > result[j].TotalTokens
+		}
+		return result[i].Key < result[j].Key
+	})
+	return result
+}
@@ -9,6 +9,7 @@ package cassie
 import (
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
 	reflect "reflect"
 	sync "sync"
 	unsafe "unsafe"
@@ -28,6 +29,13 @@ const (
 	BlockKind_MARKUP              BlockKind = 1
 	BlockKind_CODE                BlockKind = 2
 	BlockKind_FILE_SEARCH_RESULTS BlockKind = 3
+	// TOOL_CALL is a call to a tool that is executed by the server (e.g. a tool provided by an MCP server).
+	// contents holds the JSON arguments of the call and outputs holds the result.
+	BlockKind_TOOL_CALL BlockKind = 4
+	// REASONING is a summary of the reasoning of a reasoning model. It is streamed while the model thinks so users can
+	// see why it picked a command. The model keeps its reasoning with the response so these blocks are never sent
+	// back as input.
+	BlockKind_REASONING BlockKind = 5
 )
 
 // Enum value maps for BlockKind.
@@ -37,12 +45,16 @@ var (
 		1: "MARKUP",
 		2: "CODE",
 		3: "FILE_SEARCH_RESULTS",
+		4: "TOOL_CALL",
+		5: "REASONING",
 	}
 	BlockKind_value = map[string]int32{
 		"UNKNOWN_BLOCK_KIND":  0,
 		"MARKUP":              1,
 		"CODE":                2,
 		"FILE_SEARCH_RESULTS": 3,
+		"TOOL_CALL":           4,
+		"REASONING":           5,
 	}
 )
 
@@ -171,6 +183,55 @@ func (BlockOutputKind) EnumDescriptor() ([]byte, []int) {
 	return file_cassie_blocks_proto_rawDescGZIP(), []int{2}
 }
 
+type Rating int32
+
+const (
+	Rating_RATING_UNSPECIFIED Rating = 0
+	Rating_RATING_THUMBS_UP   Rating = 1
+	Rating_RATING_THUMBS_DOWN Rating = 2
+)
+
+// Enum value maps for Rating.
+var (
+	Rating_name = map[int32]string{
+		0: "RATING_UNSPECIFIED",
+		1: "RATING_THUMBS_UP",
+		2: "RATING_THUMBS_DOWN",
+	}
+	Rating_value = map[string]int32{
+		"RATING_UNSPECIFIED": 0,
+		"RATING_THUMBS_UP":   1,
+		"RATING_THUMBS_DOWN": 2,
+	}
+)
+
+func (x Rating) Enum() *Rating {
+	p := new(Rating)
+	*p = x
+	return p
+}
+
+func (x Rating) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Rating) Descriptor() protoreflect.EnumDescriptor {
+	return file_cassie_blocks_proto_enumTypes[3].Descriptor()
+}
+
+func (Rating) Type() protoreflect.EnumType {
+	return &file_cassie_blocks_proto_enumTypes[3]
+}
+
+func (x Rating) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Rating.Descriptor instead.
+func (Rating) EnumDescriptor() ([]byte, []int) {
+	return file_cassie_blocks_proto_rawDescGZIP(), []int{3}
+}
+
 // Block represents the data in an element in the UI.
 type Block struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
@@ -189,7 +250,15 @@ type Block struct {
 	FileSearchResults []*FileSearchResult `protobuf:"bytes,10,rep,name=file_search_results,json=fileSearchResults,proto3" json:"file_search_results,omitempty"`
 	Outputs           []*BlockOutput      `protobuf:"bytes,11,rep,name=outputs,proto3" json:"outputs,omitempty"`
 	// Call ID is the id of this function call as set by OpenAI
-	CallId        string `protobuf:"bytes,12,opt,name=call_id,json=callId,proto3" json:"call_id,omitempty"`
+	CallId string `protobuf:"bytes,12,opt,name=call_id,json=callId,proto3" json:"call_id,omitempty"`
+	// execution_info describes the last run of the block. It is unset if the block hasn't been run.
+	ExecutionInfo *ExecutionInfo `protobuf:"bytes,13,opt,name=execution_info,json=executionInfo,proto3" json:"execution_info,omitempty"`
+	// citations tie the contents of a MARKUP block to the sources they came from e.g. the documents found by file
+	// search.
+	Citations []*Citation `protobuf:"bytes,14,rep,name=citations,proto3" json:"citations,omitempty"`
+	// attachments are files the user attached to a MARKUP block e.g. a pasted screenshot. They are sent to the
+	// model along with the contents of the block.
+	Attachments   []*BlockOutputItem `protobuf:"bytes,15,rep,name=attachments,proto3" json:"attachments,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -287,6 +356,208 @@ func (x *Block) GetCallId() string {
 	return ""
 }
 
+func (x *Block) GetExecutionInfo() *ExecutionInfo {
+	if x != nil {
+		return x.ExecutionInfo
+	}
+	return nil
+}
+
+func (x *Block) GetCitations() []*Citation {
+	if x != nil {
+		return x.Citations
+	}
+	return nil
+}
+
+func (x *Block) GetAttachments() []*BlockOutputItem {
+	if x != nil {
+		return x.Attachments
+	}
+	return nil
+}
+
+// Citation is a source cited by part of a block's contents.
+type Citation struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// start_index and end_index are the range of characters in the contents the citation applies to. File citations
+	// only mark the position after the cited text so both are set to that position.
+	StartIndex int32 `protobuf:"varint,1,opt,name=start_index,json=startIndex,proto3" json:"start_index,omitempty"`
+	EndIndex   int32 `protobuf:"varint,2,opt,name=end_index,json=endIndex,proto3" json:"end_index,omitempty"`
+	// file_id is the ID of the cited file. It is empty for web citations.
+	FileId string `protobuf:"bytes,3,opt,name=file_id,json=fileId,proto3" json:"file_id,omitempty"`
+	// filename is the name of the cited file.
+	Filename string `protobuf:"bytes,4,opt,name=filename,proto3" json:"filename,omitempty"`
+	// link is the link to display for the source e.g. the link of the file or the URL of a web page.
+	Link string `protobuf:"bytes,5,opt,name=link,proto3" json:"link,omitempty"`
+	// title is the title of a cited web page.
+	Title         string `protobuf:"bytes,6,opt,name=title,proto3" json:"title,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Citation) Reset() {
+	*x = Citation{}
+	mi := &file_cassie_blocks_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Citation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Citation) ProtoMessage() {}
+
+func (x *Citation) ProtoReflect() protoreflect.Message {
+	mi := &file_cassie_blocks_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Citation.ProtoReflect.Descriptor instead.
+func (*Citation) Descriptor() ([]byte, []int) {
+	return file_cassie_blocks_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Citation) GetStartIndex() int32 {
+	if x != nil {
+		return x.StartIndex
+	}
+	return 0
+}
+
+func (x *Citation) GetEndIndex() int32 {
+	if x != nil {
+		return x.EndIndex
+	}
+	return 0
+}
+
+func (x *Citation) GetFileId() string {
+	if x != nil {
+		return x.FileId
+	}
+	return ""
+}
+
+func (x *Citation) GetFilename() string {
+	if x != nil {
+		return x.Filename
+	}
+	return ""
+}
+
+func (x *Citation) GetLink() string {
+	if x != nil {
+		return x.Link
+	}
+	return ""
+}
+
+func (x *Citation) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
+// ExecutionInfo describes a run of the program in a block.
+type ExecutionInfo struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// exit_code is the exit code of the program. It is unset if the program didn't exit e.g. because the run was
+	// cancelled.
+	ExitCode  *int32                 `protobuf:"varint,1,opt,name=exit_code,json=exitCode,proto3,oneof" json:"exit_code,omitempty"`
+	StartTime *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=start_time,json=startTime,proto3" json:"start_time,omitempty"`
+	EndTime   *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=end_time,json=endTime,proto3" json:"end_time,omitempty"`
+	// truncated is true if the outputs are incomplete e.g. because they were too large to keep in full.
+	Truncated bool `protobuf:"varint,4,opt,name=truncated,proto3" json:"truncated,omitempty"`
+	// cancelled is true if the run was cancelled or timed out before the program exited.
+	Cancelled bool `protobuf:"varint,5,opt,name=cancelled,proto3" json:"cancelled,omitempty"`
+	// runner_id identifies the runner that executed the program e.g. the runner endpoint used by the web app.
+	RunnerId      string `protobuf:"bytes,6,opt,name=runner_id,json=runnerId,proto3" json:"runner_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExecutionInfo) Reset() {
+	*x = ExecutionInfo{}
+	mi := &file_cassie_blocks_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExecutionInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExecutionInfo) ProtoMessage() {}
+
+func (x *ExecutionInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_cassie_blocks_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExecutionInfo.ProtoReflect.Descriptor instead.
+func (*ExecutionInfo) Descriptor() ([]byte, []int) {
+	return file_cassie_blocks_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ExecutionInfo) GetExitCode() int32 {
+	if x != nil && x.ExitCode != nil {
+		return *x.ExitCode
+	}
+	return 0
+}
+
+func (x *ExecutionInfo) GetStartTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.StartTime
+	}
+	return nil
+}
+
+func (x *ExecutionInfo) GetEndTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.EndTime
+	}
+	return nil
+}
+
+func (x *ExecutionInfo) GetTruncated() bool {
+	if x != nil {
+		return x.Truncated
+	}
+	return false
+}
+
+func (x *ExecutionInfo) GetCancelled() bool {
+	if x != nil {
+		return x.Cancelled
+	}
+	return false
+}
+
+func (x *ExecutionInfo) GetRunnerId() string {
+	if x != nil {
+		return x.RunnerId
+	}
+	return ""
+}
+
 // BlockOutput represents the output of a block.
 // It corresponds to a VSCode NotebookCellOutput
 // https://github.com/microsoft/vscode/blob/98332892fd2cb3c948ced33f542698e20c6279b9/src/vscode-dts/vscode.d.ts#L14835
@@ -301,7 +572,7 @@ type BlockOutput struct {
 
 func (x *BlockOutput) Reset() {
 	*x = BlockOutput{}
-	mi := &file_cassie_blocks_proto_msgTypes[1]
+	mi := &file_cassie_blocks_proto_msgTypes[3]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -313,7 +584,7 @@ func (x *BlockOutput) String() string {
 func (*BlockOutput) ProtoMessage() {}
 
 func (x *BlockOutput) ProtoReflect() protoreflect.Message {
-	mi := &file_cassie_blocks_proto_msgTypes[1]
+	mi := &file_cassie_blocks_proto_msgTypes[3]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -326,7 +597,7 @@ func (x *BlockOutput) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use BlockOutput.ProtoReflect.Descriptor instead.
 func (*BlockOutput) Descriptor() ([]byte, []int) {
-	return file_cassie_blocks_proto_rawDescGZIP(), []int{1}
+	return file_cassie_blocks_proto_rawDescGZIP(), []int{3}
 }
 
 func (x *BlockOutput) GetItems() []*BlockOutputItem {
@@ -352,16 +623,20 @@ type BlockOutputItem struct {
 	Mime string `protobuf:"bytes,1,opt,name=mime,proto3" json:"mime,omitempty"`
 	// value of the output item.
 	// We use string data type and not bytes because the JSON representation of bytes is a base64
-	// string. vscode data uses a byte. We may need to add support for bytes to support non text data
-	// data in the future.
-	TextData      string `protobuf:"bytes,2,opt,name=text_data,json=textData,proto3" json:"text_data,omitempty"`
+	// string. vscode data uses a byte. Items that aren't text use binary_data instead.
+	TextData string `protobuf:"bytes,2,opt,name=text_data,json=textData,proto3" json:"text_data,omitempty"`
+	// binary_data is the value of items that aren't text e.g. an image/png captured by a command or a file the
+	// user attached. At most one of text_data and binary_data is set.
+	BinaryData []byte `protobuf:"bytes,3,opt,name=binary_data,json=binaryData,proto3" json:"binary_data,omitempty"`
+	// name is an optional file name for the item e.g. the name of the file the user attached.
+	Name          string `protobuf:"bytes,4,opt,name=name,proto3" json:"name,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *BlockOutputItem) Reset() {
 	*x = BlockOutputItem{}
-	mi := &file_cassie_blocks_proto_msgTypes[2]
+	mi := &file_cassie_blocks_proto_msgTypes[4]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -373,7 +648,7 @@ func (x *BlockOutputItem) String() string {
 func (*BlockOutputItem) ProtoMessage() {}
 
 func (x *BlockOutputItem) ProtoReflect() protoreflect.Message {
-	mi := &file_cassie_blocks_proto_msgTypes[2]
+	mi := &file_cassie_blocks_proto_msgTypes[4]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -386,7 +661,7 @@ func (x *BlockOutputItem) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use BlockOutputItem.ProtoReflect.Descriptor instead.
 func (*BlockOutputItem) Descriptor() ([]byte, []int) {
-	return file_cassie_blocks_proto_rawDescGZIP(), []int{2}
+	return file_cassie_blocks_proto_rawDescGZIP(), []int{4}
 }
 
 func (x *BlockOutputItem) GetMime() string {
@@ -403,19 +678,42 @@ func (x *BlockOutputItem) GetTextData() string {
 	return ""
 }
 
+func (x *BlockOutputItem) GetBinaryData() []byte {
+	if x != nil {
+		return x.BinaryData
+	}
+	return nil
+}
+
+func (x *BlockOutputItem) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
 type GenerateRequest struct {
 	state              protoimpl.MessageState `protogen:"open.v1"`
 	Blocks             []*Block               `protobuf:"bytes,1,rep,name=blocks,proto3" json:"blocks,omitempty"`
 	PreviousResponseId string                 `protobuf:"bytes,2,opt,name=previous_response_id,json=previousResponseId,proto3" json:"previous_response_id,omitempty"`
 	// openai_access_token is the OpenAI access token to use when contacting the OpenAI API.
 	OpenaiAccessToken string `protobuf:"bytes,3,opt,name=openai_access_token,json=openaiAccessToken,proto3" json:"openai_access_token,omitempty"`
-	unknownFields     protoimpl.UnknownFields
-	sizeCache         protoimpl.SizeCache
+	// model is the model to use. If empty the server's default model is used.
+	// The model must be in the server's allow-list.
+	Model string `protobuf:"bytes,4,opt,name=model,proto3" json:"model,omitempty"`
+	// request_id is an optional ID chosen by the client. It lets the client cancel the request with CancelGenerate
+	// before it knows the ID of the response.
+	RequestId string `protobuf:"bytes,5,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	// branch_id is the ID of the branch of the conversation to continue. If previous_response_id is empty the request
+	// continues from the latest response on the branch.
+	BranchId      string `protobuf:"bytes,6,opt,name=branch_id,json=branchId,proto3" json:"branch_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
 }
 
 func (x *GenerateRequest) Reset() {
 	*x = GenerateRequest{}
-	mi := &file_cassie_blocks_proto_msgTypes[3]
+	mi := &file_cassie_blocks_proto_msgTypes[5]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -427,7 +725,7 @@ func (x *GenerateRequest) String() string {
 func (*GenerateRequest) ProtoMessage() {}
 
 func (x *GenerateRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_cassie_blocks_proto_msgTypes[3]
+	mi := &file_cassie_blocks_proto_msgTypes[5]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -440,7 +738,7 @@ func (x *GenerateRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use GenerateRequest.ProtoReflect.Descriptor instead.
 func (*GenerateRequest) Descriptor() ([]byte, []int) {
-	return file_cassie_blocks_proto_rawDescGZIP(), []int{3}
+	return file_cassie_blocks_proto_rawDescGZIP(), []int{5}
 }
 
 func (x *GenerateRequest) GetBlocks() []*Block {
@@ -464,17 +762,52 @@ func (x *GenerateRequest) GetOpenaiAccessToken() string {
 	return ""
 }
 
+func (x *GenerateRequest) GetModel() string {
+	if x != nil {
+		return x.Model
+	}
+	return ""
+}
+
+func (x *GenerateRequest) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *GenerateRequest) GetBranchId() string {
+	if x != nil {
+		return x.BranchId
+	}
+	return ""
+}
+
 type GenerateResponse struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Blocks        []*Block               `protobuf:"bytes,1,rep,name=blocks,proto3" json:"blocks,omitempty"`
-	ResponseId    string                 `protobuf:"bytes,2,opt,name=response_id,json=responseId,proto3" json:"response_id,omitempty"`
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	Blocks     []*Block               `protobuf:"bytes,1,rep,name=blocks,proto3" json:"blocks,omitempty"`
+	ResponseId string                 `protobuf:"bytes,2,opt,name=response_id,json=responseId,proto3" json:"response_id,omitempty"`
+	// model is the model that generated the response.
+	Model string `protobuf:"bytes,3,opt,name=model,proto3" json:"model,omitempty"`
+	// usage is the number of tokens used to generate the response. It is only set on the message sent once the model
+	// has finished generating the response.
+	Usage *Usage `protobuf:"bytes,4,opt,name=usage,proto3" json:"usage,omitempty"`
+	// branch_id is the ID of the branch of the conversation the response was generated on. Clients send it back in
+	// GenerateRequest.branch_id to continue the branch.
+	BranchId string `protobuf:"bytes,5,opt,name=branch_id,json=branchId,proto3" json:"branch_id,omitempty"`
+	// attempt is the attempt that generated the response. Generations that fail are retried or fall back to other
+	// models so it isn't necessarily the first attempt or the requested model.
+	Attempt *Attempt `protobuf:"bytes,6,opt,name=attempt,proto3" json:"attempt,omitempty"`
+	// stateless is true if the server is in stateless mode. Clients must then send all the blocks in the conversation
+	// in every GenerateRequest and must not set previous_response_id.
+	Stateless     bool `protobuf:"varint,7,opt,name=stateless,proto3" json:"stateless,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *GenerateResponse) Reset() {
 	*x = GenerateResponse{}
-	mi := &file_cassie_blocks_proto_msgTypes[4]
+	mi := &file_cassie_blocks_proto_msgTypes[6]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -486,7 +819,7 @@ func (x *GenerateResponse) String() string {
 func (*GenerateResponse) ProtoMessage() {}
 
 func (x *GenerateResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_cassie_blocks_proto_msgTypes[4]
+	mi := &file_cassie_blocks_proto_msgTypes[6]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -499,7 +832,7 @@ func (x *GenerateResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use GenerateResponse.ProtoReflect.Descriptor instead.
 func (*GenerateResponse) Descriptor() ([]byte, []int) {
-	return file_cassie_blocks_proto_rawDescGZIP(), []int{4}
+	return file_cassie_blocks_proto_rawDescGZIP(), []int{6}
 }
 
 func (x *GenerateResponse) GetBlocks() []*Block {
@@ -516,47 +849,994 @@ func (x *GenerateResponse) GetResponseId() string {
 	return ""
 }
 
-var File_cassie_blocks_proto protoreflect.FileDescriptor
+func (x *GenerateResponse) GetModel() string {
+	if x != nil {
+		return x.Model
+	}
+	return ""
+}
 
-const file_cassie_blocks_proto_rawDesc = "" +
-	"\n" +
-	"\x13cassie/blocks.proto\x1a\x17cassie/filesearch.proto\"\x82\x03\n" +
-	"\x05Block\x12\x1e\n" +
-	"\x04kind\x18\x01 \x01(\x0e2\n" +
-	".BlockKindR\x04kind\x12\x1a\n" +
-	"\blanguage\x18\x02 \x01(\tR\blanguage\x12\x1a\n" +
-	"\bcontents\x18\x03 \x01(\tR\bcontents\x12\x0e\n" +
-	"\x02id\x18\a \x01(\tR\x02id\x120\n" +
-	"\bmetadata\x18\b \x03(\v2\x14.Block.MetadataEntryR\bmetadata\x12\x1e\n" +
-	"\x04role\x18\t \x01(\x0e2\n" +
-	".BlockRoleR\x04role\x12A\n" +
-	"\x13file_search_results\x18\n" +
-	" \x03(\v2\x11.FileSearchResultR\x11fileSearchResults\x12&\n" +
-	"\aoutputs\x18\v \x03(\v2\f.BlockOutputR\aoutputs\x12\x17\n" +
-	"\acall_id\x18\f \x01(\tR\x06callId\x1a;\n" +
-	"\rMetadataEntry\x12\x10\n" +
-	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
-	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"[\n" +
-	"\vBlockOutput\x12&\n" +
-	"\x05items\x18\x01 \x03(\v2\x10.BlockOutputItemR\x05items\x12$\n" +
-	"\x04kind\x18\x02 \x01(\x0e2\x10.BlockOutputKindR\x04kind\"B\n" +
-	"\x0fBlockOutputItem\x12\x12\n" +
-	"\x04mime\x18\x01 \x01(\tR\x04mime\x12\x1b\n" +
-	"\ttext_data\x18\x02 \x01(\tR\btextData\"\x93\x01\n" +
-	"\x0fGenerateRequest\x12\x1e\n" +
-	"\x06blocks\x18\x01 \x03(\v2\x06.BlockR\x06blocks\x120\n" +
-	"\x14previous_response_id\x18\x02 \x01(\tR\x12previousResponseId\x12.\n" +
-	"\x13openai_access_token\x18\x03 \x01(\tR\x11openaiAccessToken\"S\n" +
-	"\x10GenerateResponse\x12\x1e\n" +
-	"\x06blocks\x18\x01 \x03(\v2\x06.BlockR\x06blocks\x12\x1f\n" +
+func (x *GenerateResponse) GetUsage() *Usage {
+	if x != nil {
+		return x.Usage
+	}
+	return nil
+}
+
+func (x *GenerateResponse) GetBranchId() string {
+	if x != nil {
+		return x.BranchId
+	}
+	return ""
+}
+
+func (x *GenerateResponse) GetAttempt() *Attempt {
+	if x != nil {
+		return x.Attempt
+	}
+	return nil
+}
+
+func (x *GenerateResponse) GetStateless() bool {
+	if x != nil {
+		return x.Stateless
+	}
+	return false
+}
+
+// Attempt identifies an attempt to generate a response.
+type Attempt struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// number is the number of the attempt starting at 1. It counts the attempts on all models.
+	Number   int32  `protobuf:"varint,1,opt,name=number,proto3" json:"number,omitempty"`
+	Model    string `protobuf:"bytes,2,opt,name=model,proto3" json:"model,omitempty"`
+	Provider string `protobuf:"bytes,3,opt,name=provider,proto3" json:"provider,omitempty"`
+	// fallback is true if the model is a fallback rather than the model of the request.
+	Fallback      bool `protobuf:"varint,4,opt,name=fallback,proto3" json:"fallback,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Attempt) Reset() {
+	*x = Attempt{}
+	mi := &file_cassie_blocks_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Attempt) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Attempt) ProtoMessage() {}
+
+func (x *Attempt) ProtoReflect() protoreflect.Message {
+	mi := &file_cassie_blocks_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Attempt.ProtoReflect.Descriptor instead.
+func (*Attempt) Descriptor() ([]byte, []int) {
+	return file_cassie_blocks_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Attempt) GetNumber() int32 {
+	if x != nil {
+		return x.Number
+	}
+	return 0
+}
+
+func (x *Attempt) GetModel() string {
+	if x != nil {
+		return x.Model
+	}
+	return ""
+}
+
+func (x *Attempt) GetProvider() string {
+	if x != nil {
+		return x.Provider
+	}
+	return ""
+}
+
+func (x *Attempt) GetFallback() bool {
+	if x != nil {
+		return x.Fallback
+	}
+	return false
+}
+
+// CancelGenerateRequest identifies the Generate call to cancel. Either field can be set.
+type CancelGenerateRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// response_id is the ID of a response streamed by the Generate call.
+	ResponseId string `protobuf:"bytes,1,opt,name=response_id,json=responseId,proto3" json:"response_id,omitempty"`
+	// request_id is the request_id of the GenerateRequest.
+	RequestId     string `protobuf:"bytes,2,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CancelGenerateRequest) Reset() {
+	*x = CancelGenerateRequest{}
+	mi := &file_cassie_blocks_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CancelGenerateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CancelGenerateRequest) ProtoMessage() {}
+
+func (x *CancelGenerateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_cassie_blocks_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CancelGenerateRequest.ProtoReflect.Descriptor instead.
+func (*CancelGenerateRequest) Descriptor() ([]byte, []int) {
+	return file_cassie_blocks_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *CancelGenerateRequest) GetResponseId() string {
+	if x != nil {
+		return x.ResponseId
+	}
+	return ""
+}
+
+func (x *CancelGenerateRequest) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+type CancelGenerateResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// cancelled is false if there was no matching Generate call in flight e.g. because it already finished.
+	Cancelled     bool `protobuf:"varint,1,opt,name=cancelled,proto3" json:"cancelled,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CancelGenerateResponse) Reset() {
+	*x = CancelGenerateResponse{}
+	mi := &file_cassie_blocks_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CancelGenerateResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CancelGenerateResponse) ProtoMessage() {}
+
+func (x *CancelGenerateResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_cassie_blocks_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CancelGenerateResponse.ProtoReflect.Descriptor instead.
+func (*CancelGenerateResponse) Descriptor() ([]byte, []int) {
+	return file_cassie_blocks_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *CancelGenerateResponse) GetCancelled() bool {
+	if x != nil {
+		return x.Cancelled
+	}
+	return false
+}
+
+// Branch is a line of responses in a conversation. Every conversation starts with a single branch;
+// ForkConversation adds branches that continue from an earlier response.
+type Branch struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// conversation_id is the ID of the conversation. It is the ID of the conversation's first branch.
+	ConversationId string `protobuf:"bytes,2,opt,name=conversation_id,json=conversationId,proto3" json:"conversation_id,omitempty"`
+	Name           string `protobuf:"bytes,3,opt,name=name,proto3" json:"name,omitempty"`
+	// parent_branch_id is the ID of the branch this branch was forked from. It is empty for the first branch.
+	ParentBranchId string `protobuf:"bytes,4,opt,name=parent_branch_id,json=parentBranchId,proto3" json:"parent_branch_id,omitempty"`
+	// fork_response_id is the ID of the response the branch was forked from.
+	ForkResponseId string `protobuf:"bytes,5,opt,name=fork_response_id,json=forkResponseId,proto3" json:"fork_response_id,omitempty"`
+	// head_response_id is the ID of the latest response on the branch.
+	HeadResponseId string                 `protobuf:"bytes,6,opt,name=head_response_id,json=headResponseId,proto3" json:"head_response_id,omitempty"`
+	CreateTime     *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=create_time,json=createTime,proto3" json:"create_time,omitempty"`
+	// principal is the principal that owns the conversation.
+	Principal     string `protobuf:"bytes,8,opt,name=principal,proto3" json:"principal,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Branch) Reset() {
+	*x = Branch{}
+	mi := &file_cassie_blocks_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Branch) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Branch) ProtoMessage() {}
+
+func (x *Branch) ProtoReflect() protoreflect.Message {
+	mi := &file_cassie_blocks_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Branch.ProtoReflect.Descriptor instead.
+func (*Branch) Descriptor() ([]byte, []int) {
+	return file_cassie_blocks_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *Branch) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Branch) GetConversationId() string {
+	if x != nil {
+		return x.ConversationId
+	}
+	return ""
+}
+
+func (x *Branch) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Branch) GetParentBranchId() string {
+	if x != nil {
+		return x.ParentBranchId
+	}
+	return ""
+}
+
+func (x *Branch) GetForkResponseId() string {
+	if x != nil {
+		return x.ForkResponseId
+	}
+	return ""
+}
+
+func (x *Branch) GetHeadResponseId() string {
+	if x != nil {
+		return x.HeadResponseId
+	}
+	return ""
+}
+
+func (x *Branch) GetCreateTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreateTime
+	}
+	return nil
+}
+
+func (x *Branch) GetPrincipal() string {
+	if x != nil {
+		return x.Principal
+	}
+	return ""
+}
+
+// ForkConversationRequest identifies the point to fork the conversation at. Either response_id or block_id must
+// be set.
+type ForkConversationRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// response_id is the ID of the last response to keep.
+	ResponseId string `protobuf:"bytes,1,opt,name=response_id,json=responseId,proto3" json:"response_id,omitempty"`
+	// block_id is the ID of a block generated by the model. The fork keeps the response that generated it.
+	BlockId string `protobuf:"bytes,2,opt,name=block_id,json=blockId,proto3" json:"block_id,omitempty"`
+	// name is an optional name for the branch.
+	Name          string `protobuf:"bytes,3,opt,name=name,proto3" json:"name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ForkConversationRequest) Reset() {
+	*x = ForkConversationRequest{}
+	mi := &file_cassie_blocks_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ForkConversationRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ForkConversationRequest) ProtoMessage() {}
+
+func (x *ForkConversationRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_cassie_blocks_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ForkConversationRequest.ProtoReflect.Descriptor instead.
+func (*ForkConversationRequest) Descriptor() ([]byte, []int) {
+	return file_cassie_blocks_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *ForkConversationRequest) GetResponseId() string {
+	if x != nil {
+		return x.ResponseId
+	}
+	return ""
+}
+
+func (x *ForkConversationRequest) GetBlockId() string {
+	if x != nil {
+		return x.BlockId
+	}
+	return ""
+}
+
+func (x *ForkConversationRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+type ForkConversationResponse struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Branch *Branch                `protobuf:"bytes,1,opt,name=branch,proto3" json:"branch,omitempty"`
+	// blocks are the tool calls in the response the branch was forked from along with their outputs. The outputs are
+	// sent to the model with the first request on the branch so clients don't need to send them again.
+	Blocks        []*Block `protobuf:"bytes,2,rep,name=blocks,proto3" json:"blocks,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ForkConversationResponse) Reset() {
+	*x = ForkConversationResponse{}
+	mi := &file_cassie_blocks_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ForkConversationResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ForkConversationResponse) ProtoMessage() {}
+
+func (x *ForkConversationResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_cassie_blocks_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ForkConversationResponse.ProtoReflect.Descriptor instead.
+func (*ForkConversationResponse) Descriptor() ([]byte, []int) {
+	return file_cassie_blocks_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *ForkConversationResponse) GetBranch() *Branch {
+	if x != nil {
+		return x.Branch
+	}
+	return nil
+}
+
+func (x *ForkConversationResponse) GetBlocks() []*Block {
+	if x != nil {
+		return x.Blocks
+	}
+	return nil
+}
+
+// ListBranchesRequest identifies the conversation. Either field can be set.
+type ListBranchesRequest struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	ConversationId string                 `protobuf:"bytes,1,opt,name=conversation_id,json=conversationId,proto3" json:"conversation_id,omitempty"`
+	// response_id is the ID of any response in the conversation.
+	ResponseId    string `protobuf:"bytes,2,opt,name=response_id,json=responseId,proto3" json:"response_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListBranchesRequest) Reset() {
+	*x = ListBranchesRequest{}
+	mi := &file_cassie_blocks_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListBranchesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListBranchesRequest) ProtoMessage() {}
+
+func (x *ListBranchesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_cassie_blocks_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListBranchesRequest.ProtoReflect.Descriptor instead.
+func (*ListBranchesRequest) Descriptor() ([]byte, []int) {
+	return file_cassie_blocks_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *ListBranchesRequest) GetConversationId() string {
+	if x != nil {
+		return x.ConversationId
+	}
+	return ""
+}
+
+func (x *ListBranchesRequest) GetResponseId() string {
+	if x != nil {
+		return x.ResponseId
+	}
+	return ""
+}
+
+type ListBranchesResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// branches are ordered by creation time so the conversation's first branch comes first.
+	Branches      []*Branch `protobuf:"bytes,1,rep,name=branches,proto3" json:"branches,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListBranchesResponse) Reset() {
+	*x = ListBranchesResponse{}
+	mi := &file_cassie_blocks_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListBranchesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListBranchesResponse) ProtoMessage() {}
+
+func (x *ListBranchesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_cassie_blocks_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListBranchesResponse.ProtoReflect.Descriptor instead.
+func (*ListBranchesResponse) Descriptor() ([]byte, []int) {
+	return file_cassie_blocks_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *ListBranchesResponse) GetBranches() []*Branch {
+	if x != nil {
+		return x.Branches
+	}
+	return nil
+}
+
+// SubmitFeedbackRequest rates a response or a block. At least one of response_id and block_id must be set.
+type SubmitFeedbackRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// response_id is the ID of the response being rated.
+	ResponseId string `protobuf:"bytes,1,opt,name=response_id,json=responseId,proto3" json:"response_id,omitempty"`
+	// block_id is the ID of the block being rated e.g. a suggested command.
+	BlockId string `protobuf:"bytes,2,opt,name=block_id,json=blockId,proto3" json:"block_id,omitempty"`
+	Rating  Rating `protobuf:"varint,3,opt,name=rating,proto3,enum=Rating" json:"rating,omitempty"`
+	// comment is free text explaining the rating.
+	Comment string `protobuf:"bytes,4,opt,name=comment,proto3" json:"comment,omitempty"`
+	// corrected_command is the command the assistant should have suggested.
+	CorrectedCommand string `protobuf:"bytes,5,opt,name=corrected_command,json=correctedCommand,proto3" json:"corrected_command,omitempty"`
+	// blocks are the blocks of the conversation as the client sees it in the order they happened. They are required;
+	// the snapshot needs the questions the user asked, which the server doesn't keep, to be replayed as an eval.
+	Blocks        []*Block `protobuf:"bytes,6,rep,name=blocks,proto3" json:"blocks,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubmitFeedbackRequest) Reset() {
+	*x = SubmitFeedbackRequest{}
+	mi := &file_cassie_blocks_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubmitFeedbackRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitFeedbackRequest) ProtoMessage() {}
+
+func (x *SubmitFeedbackRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_cassie_blocks_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitFeedbackRequest.ProtoReflect.Descriptor instead.
+func (*SubmitFeedbackRequest) Descriptor() ([]byte, []int) {
+	return file_cassie_blocks_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *SubmitFeedbackRequest) GetResponseId() string {
+	if x != nil {
+		return x.ResponseId
+	}
+	return ""
+}
+
+func (x *SubmitFeedbackRequest) GetBlockId() string {
+	if x != nil {
+		return x.BlockId
+	}
+	return ""
+}
+
+func (x *SubmitFeedbackRequest) GetRating() Rating {
+	if x != nil {
+		return x.Rating
+	}
+	return Rating_RATING_UNSPECIFIED
+}
+
+func (x *SubmitFeedbackRequest) GetComment() string {
+	if x != nil {
+		return x.Comment
+	}
+	return ""
+}
+
+func (x *SubmitFeedbackRequest) GetCorrectedCommand() string {
+	if x != nil {
+		return x.CorrectedCommand
+	}
+	return ""
+}
+
+func (x *SubmitFeedbackRequest) GetBlocks() []*Block {
+	if x != nil {
+		return x.Blocks
+	}
+	return nil
+}
+
+type SubmitFeedbackResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// feedback_id is the ID of the stored feedback.
+	FeedbackId    string `protobuf:"bytes,1,opt,name=feedback_id,json=feedbackId,proto3" json:"feedback_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubmitFeedbackResponse) Reset() {
+	*x = SubmitFeedbackResponse{}
+	mi := &file_cassie_blocks_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubmitFeedbackResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitFeedbackResponse) ProtoMessage() {}
+
+func (x *SubmitFeedbackResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_cassie_blocks_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitFeedbackResponse.ProtoReflect.Descriptor instead.
+func (*SubmitFeedbackResponse) Descriptor() ([]byte, []int) {
+	return file_cassie_blocks_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *SubmitFeedbackResponse) GetFeedbackId() string {
+	if x != nil {
+		return x.FeedbackId
+	}
+	return ""
+}
+
+// Feedback is a rating stored along with a snapshot of the conversation it applies to.
+type Feedback struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	Id         string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	CreateTime *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=create_time,json=createTime,proto3" json:"create_time,omitempty"`
+	// principal is the principal that submitted the feedback. It is empty if OIDC isn't enabled.
+	Principal        string `protobuf:"bytes,3,opt,name=principal,proto3" json:"principal,omitempty"`
+	ResponseId       string `protobuf:"bytes,4,opt,name=response_id,json=responseId,proto3" json:"response_id,omitempty"`
+	BlockId          string `protobuf:"bytes,5,opt,name=block_id,json=blockId,proto3" json:"block_id,omitempty"`
+	Rating           Rating `protobuf:"varint,6,opt,name=rating,proto3,enum=Rating" json:"rating,omitempty"`
+	Comment          string `protobuf:"bytes,7,opt,name=comment,proto3" json:"comment,omitempty"`
+	CorrectedCommand string `protobuf:"bytes,8,opt,name=corrected_command,json=correctedCommand,proto3" json:"corrected_command,omitempty"`
+	// blocks are the snapshot of the conversation. Their outputs are redacted.
+	Blocks        []*Block `protobuf:"bytes,9,rep,name=blocks,proto3" json:"blocks,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Feedback) Reset() {
+	*x = Feedback{}
+	mi := &file_cassie_blocks_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Feedback) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Feedback) ProtoMessage() {}
+
+func (x *Feedback) ProtoReflect() protoreflect.Message {
+	mi := &file_cassie_blocks_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Feedback.ProtoReflect.Descriptor instead.
+func (*Feedback) Descriptor() ([]byte, []int) {
+	return file_cassie_blocks_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *Feedback) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Feedback) GetCreateTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreateTime
+	}
+	return nil
+}
+
+func (x *Feedback) GetPrincipal() string {
+	if x != nil {
+		return x.Principal
+	}
+	return ""
+}
+
+func (x *Feedback) GetResponseId() string {
+	if x != nil {
+		return x.ResponseId
+	}
+	return ""
+}
+
+func (x *Feedback) GetBlockId() string {
+	if x != nil {
+		return x.BlockId
+	}
+	return ""
+}
+
+func (x *Feedback) GetRating() Rating {
+	if x != nil {
+		return x.Rating
+	}
+	return Rating_RATING_UNSPECIFIED
+}
+
+func (x *Feedback) GetComment() string {
+	if x != nil {
+		return x.Comment
+	}
+	return ""
+}
+
+func (x *Feedback) GetCorrectedCommand() string {
+	if x != nil {
+		return x.CorrectedCommand
+	}
+	return ""
+}
+
+func (x *Feedback) GetBlocks() []*Block {
+	if x != nil {
+		return x.Blocks
+	}
+	return nil
+}
+
+// Usage is the number of tokens used to generate a response.
+type Usage struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	InputTokens int64                  `protobuf:"varint,1,opt,name=input_tokens,json=inputTokens,proto3" json:"input_tokens,omitempty"`
+	// cached_input_tokens is the number of input tokens that were served from the provider's prompt cache.
+	CachedInputTokens int64 `protobuf:"varint,2,opt,name=cached_input_tokens,json=cachedInputTokens,proto3" json:"cached_input_tokens,omitempty"`
+	OutputTokens      int64 `protobuf:"varint,3,opt,name=output_tokens,json=outputTokens,proto3" json:"output_tokens,omitempty"`
+	TotalTokens       int64 `protobuf:"varint,4,opt,name=total_tokens,json=totalTokens,proto3" json:"total_tokens,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *Usage) Reset() {
+	*x = Usage{}
+	mi := &file_cassie_blocks_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Usage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Usage) ProtoMessage() {}
+
+func (x *Usage) ProtoReflect() protoreflect.Message {
+	mi := &file_cassie_blocks_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Usage.ProtoReflect.Descriptor instead.
+func (*Usage) Descriptor() ([]byte, []int) {
+	return file_cassie_blocks_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *Usage) GetInputTokens() int64 {
+	if x != nil {
+		return x.InputTokens
+	}
+	return 0
+}
+
+func (x *Usage) GetCachedInputTokens() int64 {
+	if x != nil {
+		return x.CachedInputTokens
+	}
+	return 0
+}
+
+func (x *Usage) GetOutputTokens() int64 {
+	if x != nil {
+		return x.OutputTokens
+	}
+	return 0
+}
+
+func (x *Usage) GetTotalTokens() int64 {
+	if x != nil {
+		return x.TotalTokens
+	}
+	return 0
+}
+
+var File_cassie_blocks_proto protoreflect.FileDescriptor
+
+const file_cassie_blocks_proto_rawDesc = "" +
+	"\n" +
+	"\x13cassie/blocks.proto\x1a\x17cassie/filesearch.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"\x96\x04\n" +
+	"\x05Block\x12\x1e\n" +
+	"\x04kind\x18\x01 \x01(\x0e2\n" +
+	".BlockKindR\x04kind\x12\x1a\n" +
+	"\blanguage\x18\x02 \x01(\tR\blanguage\x12\x1a\n" +
+	"\bcontents\x18\x03 \x01(\tR\bcontents\x12\x0e\n" +
+	"\x02id\x18\a \x01(\tR\x02id\x120\n" +
+	"\bmetadata\x18\b \x03(\v2\x14.Block.MetadataEntryR\bmetadata\x12\x1e\n" +
+	"\x04role\x18\t \x01(\x0e2\n" +
+	".BlockRoleR\x04role\x12A\n" +
+	"\x13file_search_results\x18\n" +
+	" \x03(\v2\x11.FileSearchResultR\x11fileSearchResults\x12&\n" +
+	"\aoutputs\x18\v \x03(\v2\f.BlockOutputR\aoutputs\x12\x17\n" +
+	"\acall_id\x18\f \x01(\tR\x06callId\x125\n" +
+	"\x0eexecution_info\x18\r \x01(\v2\x0e.ExecutionInfoR\rexecutionInfo\x12'\n" +
+	"\tcitations\x18\x0e \x03(\v2\t.CitationR\tcitations\x122\n" +
+	"\vattachments\x18\x0f \x03(\v2\x10.BlockOutputItemR\vattachments\x1a;\n" +
+	"\rMetadataEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xa7\x01\n" +
+	"\bCitation\x12\x1f\n" +
+	"\vstart_index\x18\x01 \x01(\x05R\n" +
+	"startIndex\x12\x1b\n" +
+	"\tend_index\x18\x02 \x01(\x05R\bendIndex\x12\x17\n" +
+	"\afile_id\x18\x03 \x01(\tR\x06fileId\x12\x1a\n" +
+	"\bfilename\x18\x04 \x01(\tR\bfilename\x12\x12\n" +
+	"\x04link\x18\x05 \x01(\tR\x04link\x12\x14\n" +
+	"\x05title\x18\x06 \x01(\tR\x05title\"\x8a\x02\n" +
+	"\rExecutionInfo\x12 \n" +
+	"\texit_code\x18\x01 \x01(\x05H\x00R\bexitCode\x88\x01\x01\x129\n" +
+	"\n" +
+	"start_time\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\tstartTime\x125\n" +
+	"\bend_time\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\aendTime\x12\x1c\n" +
+	"\ttruncated\x18\x04 \x01(\bR\ttruncated\x12\x1c\n" +
+	"\tcancelled\x18\x05 \x01(\bR\tcancelled\x12\x1b\n" +
+	"\trunner_id\x18\x06 \x01(\tR\brunnerIdB\f\n" +
+	"\n" +
+	"_exit_code\"[\n" +
+	"\vBlockOutput\x12&\n" +
+	"\x05items\x18\x01 \x03(\v2\x10.BlockOutputItemR\x05items\x12$\n" +
+	"\x04kind\x18\x02 \x01(\x0e2\x10.BlockOutputKindR\x04kind\"w\n" +
+	"\x0fBlockOutputItem\x12\x12\n" +
+	"\x04mime\x18\x01 \x01(\tR\x04mime\x12\x1b\n" +
+	"\ttext_data\x18\x02 \x01(\tR\btextData\x12\x1f\n" +
+	"\vbinary_data\x18\x03 \x01(\fR\n" +
+	"binaryData\x12\x12\n" +
+	"\x04name\x18\x04 \x01(\tR\x04name\"\xe5\x01\n" +
+	"\x0fGenerateRequest\x12\x1e\n" +
+	"\x06blocks\x18\x01 \x03(\v2\x06.BlockR\x06blocks\x120\n" +
+	"\x14previous_response_id\x18\x02 \x01(\tR\x12previousResponseId\x12.\n" +
+	"\x13openai_access_token\x18\x03 \x01(\tR\x11openaiAccessToken\x12\x14\n" +
+	"\x05model\x18\x04 \x01(\tR\x05model\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\x05 \x01(\tR\trequestId\x12\x1b\n" +
+	"\tbranch_id\x18\x06 \x01(\tR\bbranchId\"\xe6\x01\n" +
+	"\x10GenerateResponse\x12\x1e\n" +
+	"\x06blocks\x18\x01 \x03(\v2\x06.BlockR\x06blocks\x12\x1f\n" +
+	"\vresponse_id\x18\x02 \x01(\tR\n" +
+	"responseId\x12\x14\n" +
+	"\x05model\x18\x03 \x01(\tR\x05model\x12\x1c\n" +
+	"\x05usage\x18\x04 \x01(\v2\x06.UsageR\x05usage\x12\x1b\n" +
+	"\tbranch_id\x18\x05 \x01(\tR\bbranchId\x12\"\n" +
+	"\aattempt\x18\x06 \x01(\v2\b.AttemptR\aattempt\x12\x1c\n" +
+	"\tstateless\x18\a \x01(\bR\tstateless\"o\n" +
+	"\aAttempt\x12\x16\n" +
+	"\x06number\x18\x01 \x01(\x05R\x06number\x12\x14\n" +
+	"\x05model\x18\x02 \x01(\tR\x05model\x12\x1a\n" +
+	"\bprovider\x18\x03 \x01(\tR\bprovider\x12\x1a\n" +
+	"\bfallback\x18\x04 \x01(\bR\bfallback\"W\n" +
+	"\x15CancelGenerateRequest\x12\x1f\n" +
+	"\vresponse_id\x18\x01 \x01(\tR\n" +
+	"responseId\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\x02 \x01(\tR\trequestId\"6\n" +
+	"\x16CancelGenerateResponse\x12\x1c\n" +
+	"\tcancelled\x18\x01 \x01(\bR\tcancelled\"\xae\x02\n" +
+	"\x06Branch\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12'\n" +
+	"\x0fconversation_id\x18\x02 \x01(\tR\x0econversationId\x12\x12\n" +
+	"\x04name\x18\x03 \x01(\tR\x04name\x12(\n" +
+	"\x10parent_branch_id\x18\x04 \x01(\tR\x0eparentBranchId\x12(\n" +
+	"\x10fork_response_id\x18\x05 \x01(\tR\x0eforkResponseId\x12(\n" +
+	"\x10head_response_id\x18\x06 \x01(\tR\x0eheadResponseId\x12;\n" +
+	"\vcreate_time\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"createTime\x12\x1c\n" +
+	"\tprincipal\x18\b \x01(\tR\tprincipal\"i\n" +
+	"\x17ForkConversationRequest\x12\x1f\n" +
+	"\vresponse_id\x18\x01 \x01(\tR\n" +
+	"responseId\x12\x19\n" +
+	"\bblock_id\x18\x02 \x01(\tR\ablockId\x12\x12\n" +
+	"\x04name\x18\x03 \x01(\tR\x04name\"[\n" +
+	"\x18ForkConversationResponse\x12\x1f\n" +
+	"\x06branch\x18\x01 \x01(\v2\a.BranchR\x06branch\x12\x1e\n" +
+	"\x06blocks\x18\x02 \x03(\v2\x06.BlockR\x06blocks\"_\n" +
+	"\x13ListBranchesRequest\x12'\n" +
+	"\x0fconversation_id\x18\x01 \x01(\tR\x0econversationId\x12\x1f\n" +
 	"\vresponse_id\x18\x02 \x01(\tR\n" +
-	"responseId*R\n" +
+	"responseId\";\n" +
+	"\x14ListBranchesResponse\x12#\n" +
+	"\bbranches\x18\x01 \x03(\v2\a.BranchR\bbranches\"\xdb\x01\n" +
+	"\x15SubmitFeedbackRequest\x12\x1f\n" +
+	"\vresponse_id\x18\x01 \x01(\tR\n" +
+	"responseId\x12\x19\n" +
+	"\bblock_id\x18\x02 \x01(\tR\ablockId\x12\x1f\n" +
+	"\x06rating\x18\x03 \x01(\x0e2\a.RatingR\x06rating\x12\x18\n" +
+	"\acomment\x18\x04 \x01(\tR\acomment\x12+\n" +
+	"\x11corrected_command\x18\x05 \x01(\tR\x10correctedCommand\x12\x1e\n" +
+	"\x06blocks\x18\x06 \x03(\v2\x06.BlockR\x06blocks\"9\n" +
+	"\x16SubmitFeedbackResponse\x12\x1f\n" +
+	"\vfeedback_id\x18\x01 \x01(\tR\n" +
+	"feedbackId\"\xb9\x02\n" +
+	"\bFeedback\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12;\n" +
+	"\vcreate_time\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"createTime\x12\x1c\n" +
+	"\tprincipal\x18\x03 \x01(\tR\tprincipal\x12\x1f\n" +
+	"\vresponse_id\x18\x04 \x01(\tR\n" +
+	"responseId\x12\x19\n" +
+	"\bblock_id\x18\x05 \x01(\tR\ablockId\x12\x1f\n" +
+	"\x06rating\x18\x06 \x01(\x0e2\a.RatingR\x06rating\x12\x18\n" +
+	"\acomment\x18\a \x01(\tR\acomment\x12+\n" +
+	"\x11corrected_command\x18\b \x01(\tR\x10correctedCommand\x12\x1e\n" +
+	"\x06blocks\x18\t \x03(\v2\x06.BlockR\x06blocks\"\xa2\x01\n" +
+	"\x05Usage\x12!\n" +
+	"\finput_tokens\x18\x01 \x01(\x03R\vinputTokens\x12.\n" +
+	"\x13cached_input_tokens\x18\x02 \x01(\x03R\x11cachedInputTokens\x12#\n" +
+	"\routput_tokens\x18\x03 \x01(\x03R\foutputTokens\x12!\n" +
+	"\ftotal_tokens\x18\x04 \x01(\x03R\vtotalTokens*p\n" +
 	"\tBlockKind\x12\x16\n" +
 	"\x12UNKNOWN_BLOCK_KIND\x10\x00\x12\n" +
 	"\n" +
 	"\x06MARKUP\x10\x01\x12\b\n" +
 	"\x04CODE\x10\x02\x12\x17\n" +
-	"\x13FILE_SEARCH_RESULTS\x10\x03*R\n" +
+	"\x13FILE_SEARCH_RESULTS\x10\x03\x12\r\n" +
+	"\tTOOL_CALL\x10\x04\x12\r\n" +
+	"\tREASONING\x10\x05*R\n" +
 	"\tBlockRole\x12\x16\n" +
 	"\x12BLOCK_ROLE_UNKNOWN\x10\x00\x12\x13\n" +
 	"\x0fBLOCK_ROLE_USER\x10\x01\x12\x18\n" +
@@ -566,9 +1846,17 @@ const file_cassie_blocks_proto_rawDesc = "" +
 	"\n" +
 	"\x06STDOUT\x10\x01\x12\n" +
 	"\n" +
-	"\x06STDERR\x10\x022D\n" +
+	"\x06STDERR\x10\x02*N\n" +
+	"\x06Rating\x12\x16\n" +
+	"\x12RATING_UNSPECIFIED\x10\x00\x12\x14\n" +
+	"\x10RATING_THUMBS_UP\x10\x01\x12\x16\n" +
+	"\x12RATING_THUMBS_DOWN\x10\x022\xd8\x02\n" +
 	"\rBlocksService\x123\n" +
-	"\bGenerate\x12\x10.GenerateRequest\x1a\x11.GenerateResponse\"\x000\x01BCB\vBlocksProtoP\x01Z2github.com/jlewi/cloud-assistant/protos/gen/cassieb\x06proto3"
+	"\bGenerate\x12\x10.GenerateRequest\x1a\x11.GenerateResponse\"\x000\x01\x12C\n" +
+	"\x0eCancelGenerate\x12\x16.CancelGenerateRequest\x1a\x17.CancelGenerateResponse\"\x00\x12I\n" +
+	"\x10ForkConversation\x12\x18.ForkConversationRequest\x1a\x19.ForkConversationResponse\"\x00\x12=\n" +
+	"\fListBranches\x12\x14.ListBranchesRequest\x1a\x15.ListBranchesResponse\"\x00\x12C\n" +
+	"\x0eSubmitFeedback\x12\x16.SubmitFeedbackRequest\x1a\x17.SubmitFeedbackResponse\"\x00BCB\vBlocksProtoP\x01Z2github.com/jlewi/cloud-assistant/protos/gen/cassieb\x06proto3"
 
 var (
 	file_cassie_blocks_proto_rawDescOnce sync.Once
@@ -582,37 +1870,77 @@ func file_cassie_blocks_proto_rawDescGZIP() []byte {
 	return file_cassie_blocks_proto_rawDescData
 }
 
-var file_cassie_blocks_proto_enumTypes = make([]protoimpl.EnumInfo, 3)
-var file_cassie_blocks_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_cassie_blocks_proto_enumTypes = make([]protoimpl.EnumInfo, 4)
+var file_cassie_blocks_proto_msgTypes = make([]protoimpl.MessageInfo, 20)
 var file_cassie_blocks_proto_goTypes = []any{
-	(BlockKind)(0),           // 0: BlockKind
-	(BlockRole)(0),           // 1: BlockRole
-	(BlockOutputKind)(0),     // 2: BlockOutputKind
-	(*Block)(nil),            // 3: Block
-	(*BlockOutput)(nil),      // 4: BlockOutput
-	(*BlockOutputItem)(nil),  // 5: BlockOutputItem
-	(*GenerateRequest)(nil),  // 6: GenerateRequest
-	(*GenerateResponse)(nil), // 7: GenerateResponse
-	nil,                      // 8: Block.MetadataEntry
-	(*FileSearchResult)(nil), // 9: FileSearchResult
+	(BlockKind)(0),                   // 0: BlockKind
+	(BlockRole)(0),                   // 1: BlockRole
+	(BlockOutputKind)(0),             // 2: BlockOutputKind
+	(Rating)(0),                      // 3: Rating
+	(*Block)(nil),                    // 4: Block
+	(*Citation)(nil),                 // 5: Citation
+	(*ExecutionInfo)(nil),            // 6: ExecutionInfo
+	(*BlockOutput)(nil),              // 7: BlockOutput
+	(*BlockOutputItem)(nil),          // 8: BlockOutputItem
+	(*GenerateRequest)(nil),          // 9: GenerateRequest
+	(*GenerateResponse)(nil),         // 10: GenerateResponse
+	(*Attempt)(nil),                  // 11: Attempt
+	(*CancelGenerateRequest)(nil),    // 12: CancelGenerateRequest
+	(*CancelGenerateResponse)(nil),   // 13: CancelGenerateResponse
+	(*Branch)(nil),                   // 14: Branch
+	(*ForkConversationRequest)(nil),  // 15: ForkConversationRequest
+	(*ForkConversationResponse)(nil), // 16: ForkConversationResponse
+	(*ListBranchesRequest)(nil),      // 17: ListBranchesRequest
+	(*ListBranchesResponse)(nil),     // 18: ListBranchesResponse
+	(*SubmitFeedbackRequest)(nil),    // 19: SubmitFeedbackRequest
+	(*SubmitFeedbackResponse)(nil),   // 20: SubmitFeedbackResponse
+	(*Feedback)(nil),                 // 21: Feedback
+	(*Usage)(nil),                    // 22: Usage
+	nil,                              // 23: Block.MetadataEntry
+	(*FileSearchResult)(nil),         // 24: FileSearchResult
+	(*timestamppb.Timestamp)(nil),    // 25: google.protobuf.Timestamp
 }
 var file_cassie_blocks_proto_depIdxs = []int32{
 	0,  // 0: Block.kind:type_name -> BlockKind
-	8,  // 1: Block.metadata:type_name -> Block.MetadataEntry
+	23, // 1: Block.metadata:type_name -> Block.MetadataEntry
 	1,  // 2: Block.role:type_name -> BlockRole
-	9,  // 3: Block.file_search_results:type_name -> FileSearchResult
-	4,  // 4: Block.outputs:type_name -> BlockOutput
-	5,  // 5: BlockOutput.items:type_name -> BlockOutputItem
-	2,  // 6: BlockOutput.kind:type_name -> BlockOutputKind
-	3,  // 7: GenerateRequest.blocks:type_name -> Block
-	3,  // 8: GenerateResponse.blocks:type_name -> Block
-	6,  // 9: BlocksService.Generate:input_type -> GenerateRequest
-	7,  // 10: BlocksService.Generate:output_type -> GenerateResponse
-	10, // [10:11] is the sub-list for method output_type
-	9,  // [9:10] is the sub-list for method input_type
-	9,  // [9:9] is the sub-list for extension type_name
-	9,  // [9:9] is the sub-list for extension extendee
-	0,  // [0:9] is the sub-list for field type_name
+	24, // 3: Block.file_search_results:type_name -> FileSearchResult
+	7,  // 4: Block.outputs:type_name -> BlockOutput
+	6,  // 5: Block.execution_info:type_name -> ExecutionInfo
+	5,  // 6: Block.citations:type_name -> Citation
+	8,  // 7: Block.attachments:type_name -> BlockOutputItem
+	25, // 8: ExecutionInfo.start_time:type_name -> google.protobuf.Timestamp
+	25, // 9: ExecutionInfo.end_time:type_name -> google.protobuf.Timestamp
+	8,  // 10: BlockOutput.items:type_name -> BlockOutputItem
+	2,  // 11: BlockOutput.kind:type_name -> BlockOutputKind
+	4,  // 12: GenerateRequest.blocks:type_name -> Block
+	4,  // 13: GenerateResponse.blocks:type_name -> Block
+	22, // 14: GenerateResponse.usage:type_name -> Usage
+	11, // 15: GenerateResponse.attempt:type_name -> Attempt
+	25, // 16: Branch.create_time:type_name -> google.protobuf.Timestamp
+	14, // 17: ForkConversationResponse.branch:type_name -> Branch
+	4,  // 18: ForkConversationResponse.blocks:type_name -> Block
+	14, // 19: ListBranchesResponse.branches:type_name -> Branch
+	3,  // 20: SubmitFeedbackRequest.rating:type_name -> Rating
+	4,  // 21: SubmitFeedbackRequest.blocks:type_name -> Block
+	25, // 22: Feedback.create_time:type_name -> google.protobuf.Timestamp
+	3,  // 23: Feedback.rating:type_name -> Rating
+	4,  // 24: Feedback.blocks:type_name -> Block
+	9,  // 25: BlocksService.Generate:input_type -> GenerateRequest
+	12, // 26: BlocksService.CancelGenerate:input_type -> CancelGenerateRequest
+	15, // 27: BlocksService.ForkConversation:input_type -> ForkConversationRequest
+	17, // 28: BlocksService.ListBranches:input_type -> ListBranchesRequest
+	19, // 29: BlocksService.SubmitFeedback:input_type -> SubmitFeedbackRequest
+	10, // 30: BlocksService.Generate:output_type -> GenerateResponse
+	13, // 31: BlocksService.CancelGenerate:output_type -> CancelGenerateResponse
+	16, // 32: BlocksService.ForkConversation:output_type -> ForkConversationResponse
+	18, // 33: BlocksService.ListBranches:output_type -> ListBranchesResponse
+	20, // 34: BlocksService.SubmitFeedback:output_type -> SubmitFeedbackResponse
+	30, // [30:35] is the sub-list for method output_type
+	25, // [25:30] is the sub-list for method input_type
+	25, // [25:25] is the sub-list for extension type_name
+	25, // [25:25] is the sub-list for extension extendee
+	0,  // [0:25] is the sub-list for field type_name
 }
 
 func init() { file_cassie_blocks_proto_init() }
@@ -621,13 +1949,14 @@ func file_cassie_blocks_proto_init() {
 		return
 	}
 	file_cassie_filesearch_proto_init()
+	file_cassie_blocks_proto_msgTypes[2].OneofWrappers = []any{}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_cassie_blocks_proto_rawDesc), len(file_cassie_blocks_proto_rawDesc)),
-			NumEnums:      3,
-			NumMessages:   6,
+			NumEnums:      4,
+			NumMessages:   20,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -35,12 +35,35 @@ const (
 const (
 	// BlocksServiceGenerateProcedure is the fully-qualified name of the BlocksService's Generate RPC.
 	BlocksServiceGenerateProcedure = "/BlocksService/Generate"
+	// BlocksServiceCancelGenerateProcedure is the fully-qualified name of the BlocksService's
+	// CancelGenerate RPC.
+	BlocksServiceCancelGenerateProcedure = "/BlocksService/CancelGenerate"
+	// BlocksServiceForkConversationProcedure is the fully-qualified name of the BlocksService's
+	// ForkConversation RPC.
+	BlocksServiceForkConversationProcedure = "/BlocksService/ForkConversation"
+	// BlocksServiceListBranchesProcedure is the fully-qualified name of the BlocksService's
+	// ListBranches RPC.
+	BlocksServiceListBranchesProcedure = "/BlocksService/ListBranches"
+	// BlocksServiceSubmitFeedbackProcedure is the fully-qualified name of the BlocksService's
+	// SubmitFeedback RPC.
+	BlocksServiceSubmitFeedbackProcedure = "/BlocksService/SubmitFeedback"
 )
 
 // BlocksServiceClient is a client for the BlocksService service.
 type BlocksServiceClient interface {
 	// Generate generates blocks. Responses are streamed.
 	Generate(context.Context, *connect.Request[cassie.GenerateRequest]) (*connect.ServerStreamForClient[cassie.GenerateResponse], error)
+	// CancelGenerate stops an in-flight Generate call. The Generate stream ends with a block marking the turn as
+	// cancelled.
+	CancelGenerate(context.Context, *connect.Request[cassie.CancelGenerateRequest]) (*connect.Response[cassie.CancelGenerateResponse], error)
+	// ForkConversation creates a branch of a conversation that continues from an earlier response. Generate calls
+	// with the ID of the branch continue from that response rather than the latest one.
+	ForkConversation(context.Context, *connect.Request[cassie.ForkConversationRequest]) (*connect.Response[cassie.ForkConversationResponse], error)
+	// ListBranches lists the branches of a conversation.
+	ListBranches(context.Context, *connect.Request[cassie.ListBranchesRequest]) (*connect.Response[cassie.ListBranchesResponse], error)
+	// SubmitFeedback records a rating of a response or one of its blocks e.g. whether a suggested command was right.
+	// The feedback is stored with a snapshot of the conversation so it can be turned into eval samples.
+	SubmitFeedback(context.Context, *connect.Request[cassie.SubmitFeedbackRequest]) (*connect.Response[cassie.SubmitFeedbackResponse], error)
 }
 
 // NewBlocksServiceClient constructs a client for the BlocksService service. By default, it uses the
@@ -60,12 +83,40 @@ func NewBlocksServiceClient(httpClient connect.HTTPClient, baseURL string, opts
 			connect.WithSchema(blocksServiceMethods.ByName("Generate")),
 			connect.WithClientOptions(opts...),
 		),
+		cancelGenerate: connect.NewClient[cassie.CancelGenerateRequest, cassie.CancelGenerateResponse](
+			httpClient,
+			baseURL+BlocksServiceCancelGenerateProcedure,
+			connect.WithSchema(blocksServiceMethods.ByName("CancelGenerate")),
+			connect.WithClientOptions(opts...),
+		),
+		forkConversation: connect.NewClient[cassie.ForkConversationRequest, cassie.ForkConversationResponse](
+			httpClient,
+			baseURL+BlocksServiceForkConversationProcedure,
+			connect.WithSchema(blocksServiceMethods.ByName("ForkConversation")),
+			connect.WithClientOptions(opts...),
+		),
+		listBranches: connect.NewClient[cassie.ListBranchesRequest, cassie.ListBranchesResponse](
+			httpClient,
+			baseURL+BlocksServiceListBranchesProcedure,
+			connect.WithSchema(blocksServiceMethods.ByName("ListBranches")),
+			connect.WithClientOptions(opts...),
+		),
+		submitFeedback: connect.NewClient[cassie.SubmitFeedbackRequest, cassie.SubmitFeedbackResponse](
+			httpClient,
+			baseURL+BlocksServiceSubmitFeedbackProcedure,
+			connect.WithSchema(blocksServiceMethods.ByName("SubmitFeedback")),
+			connect.WithClientOptions(opts...),
+		),
 	}
 }
 
 // blocksServiceClient implements BlocksServiceClient.
 type blocksServiceClient struct {
-	generate *connect.Client[cassie.GenerateRequest, cassie.GenerateResponse]
+	generate         *connect.Client[cassie.GenerateRequest, cassie.GenerateResponse]
+	cancelGenerate   *connect.Client[cassie.CancelGenerateRequest, cassie.CancelGenerateResponse]
+	forkConversation *connect.Client[cassie.ForkConversationRequest, cassie.ForkConversationResponse]
+	listBranches     *connect.Client[cassie.ListBranchesRequest, cassie.ListBranchesResponse]
+	submitFeedback   *connect.Client[cassie.SubmitFeedbackRequest, cassie.SubmitFeedbackResponse]
 }
 
 // Generate calls BlocksService.Generate.
@@ -73,10 +124,41 @@ func (c *blocksServiceClient) Generate(ctx context.Context, req *connect.Request
 	return c.generate.CallServerStream(ctx, req)
 }
 
+// CancelGenerate calls BlocksService.CancelGenerate.
+func (c *blocksServiceClient) CancelGenerate(ctx context.Context, req *connect.Request[cassie.CancelGenerateRequest]) (*connect.Response[cassie.CancelGenerateResponse], error) {
+	return c.cancelGenerate.CallUnary(ctx, req)
+}
+
+// ForkConversation calls BlocksService.ForkConversation.
+func (c *blocksServiceClient) ForkConversation(ctx context.Context, req *connect.Request[cassie.ForkConversationRequest]) (*connect.Response[cassie.ForkConversationResponse], error) {
+	return c.forkConversation.CallUnary(ctx, req)
+}
+
+// ListBranches calls BlocksService.ListBranches.
+func (c *blocksServiceClient) ListBranches(ctx context.Context, req *connect.Request[cassie.ListBranchesRequest]) (*connect.Response[cassie.ListBranchesResponse], error) {
+	return c.listBranches.CallUnary(ctx, req)
+}
+
+// SubmitFeedback calls BlocksService.SubmitFeedback.
+func (c *blocksServiceClient) SubmitFeedback(ctx context.Context, req *connect.Request[cassie.SubmitFeedbackRequest]) (*connect.Response[cassie.SubmitFeedbackResponse], error) {
+	return c.submitFeedback.CallUnary(ctx, req)
+}
+
 // BlocksServiceHandler is an implementation of the BlocksService service.
 type BlocksServiceHandler interface {
 	// Generate generates blocks. Responses are streamed.
 	Generate(context.Context, *connect.Request[cassie.GenerateRequest], *connect.ServerStream[cassie.GenerateResponse]) error
+	// CancelGenerate stops an in-flight Generate call. The Generate stream ends with a block marking the turn as
+	// cancelled.
+	CancelGenerate(context.Context, *connect.Request[cassie.CancelGenerateRequest]) (*connect.Response[cassie.CancelGenerateResponse], error)
+	// ForkConversation creates a branch of a conversation that continues from an earlier response. Generate calls
+	// with the ID of the branch continue from that response rather than the latest one.
+	ForkConversation(context.Context, *connect.Request[cassie.ForkConversationRequest]) (*connect.Response[cassie.ForkConversationResponse], error)
+	// ListBranches lists the branches of a conversation.
+	ListBranches(context.Context, *connect.Request[cassie.ListBranchesRequest]) (*connect.Response[cassie.ListBranchesResponse], error)
+	// SubmitFeedback records a rating of a response or one of its blocks e.g. whether a suggested command was right.
+	// The feedback is stored with a snapshot of the conversation so it can be turned into eval samples.
+	SubmitFeedback(context.Context, *connect.Request[cassie.SubmitFeedbackRequest]) (*connect.Response[cassie.SubmitFeedbackResponse], error)
 }
 
 // NewBlocksServiceHandler builds an HTTP handler from the service implementation. It returns the
@@ -92,10 +174,42 @@ func NewBlocksServiceHandler(svc BlocksServiceHandler, opts ...connect.HandlerOp
 		connect.WithSchema(blocksServiceMethods.ByName("Generate")),
 		connect.WithHandlerOptions(opts...),
 	)
+	blocksServiceCancelGenerateHandler := connect.NewUnaryHandler(
+		BlocksServiceCancelGenerateProcedure,
+		svc.CancelGenerate,
+		connect.WithSchema(blocksServiceMethods.ByName("CancelGenerate")),
+		connect.WithHandlerOptions(opts...),
+	)
+	blocksServiceForkConversationHandler := connect.NewUnaryHandler(
+		BlocksServiceForkConversationProcedure,
+		svc.ForkConversation,
+		connect.WithSchema(blocksServiceMethods.ByName("ForkConversation")),
+		connect.WithHandlerOptions(opts...),
+	)
+	blocksServiceListBranchesHandler := connect.NewUnaryHandler(
+		BlocksServiceListBranchesProcedure,
+		svc.ListBranches,
+		connect.WithSchema(blocksServiceMethods.ByName("ListBranches")),
+		connect.WithHandlerOptions(opts...),
+	)
+	blocksServiceSubmitFeedbackHandler := connect.NewUnaryHandler(
+		BlocksServiceSubmitFeedbackProcedure,
+		svc.SubmitFeedback,
+		connect.WithSchema(blocksServiceMethods.ByName("SubmitFeedback")),
+		connect.WithHandlerOptions(opts...),
+	)
 	return "/BlocksService/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.URL.Path {
 		case BlocksServiceGenerateProcedure:
 			blocksServiceGenerateHandler.ServeHTTP(w, r)
+		case BlocksServiceCancelGenerateProcedure:
+			blocksServiceCancelGenerateHandler.ServeHTTP(w, r)
+		case BlocksServiceForkConversationProcedure:
+			blocksServiceForkConversationHandler.ServeHTTP(w, r)
+		case BlocksServiceListBranchesProcedure:
+			blocksServiceListBranchesHandler.ServeHTTP(w, r)
+		case BlocksServiceSubmitFeedbackProcedure:
+			blocksServiceSubmitFeedbackHandler.ServeHTTP(w, r)
 		default:
 			http.NotFound(w, r)
 		}
@@ -108,3 +222,19 @@ type UnimplementedBlocksServiceHandler struct{}
 func (UnimplementedBlocksServiceHandler) Generate(context.Context, *connect.Request[cassie.GenerateRequest], *connect.ServerStream[cassie.GenerateResponse]) error {
 	return connect.NewError(connect.CodeUnimplemented, errors.New("BlocksService.Generate is not implemented"))
 }
+
+func (UnimplementedBlocksServiceHandler) CancelGenerate(context.Context, *connect.Request[cassie.CancelGenerateRequest]) (*connect.Response[cassie.CancelGenerateResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("BlocksService.CancelGenerate is not implemented"))
+}
+
+func (UnimplementedBlocksServiceHandler) ForkConversation(context.Context, *connect.Request[cassie.ForkConversationRequest]) (*connect.Response[cassie.ForkConversationResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("BlocksService.ForkConversation is not implemented"))
+}
+
+func (UnimplementedBlocksServiceHandler) ListBranches(context.Context, *connect.Request[cassie.ListBranchesRequest]) (*connect.Response[cassie.ListBranchesResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("BlocksService.ListBranches is not implemented"))
+}
+
+func (UnimplementedBlocksServiceHandler) SubmitFeedback(context.Context, *connect.Request[cassie.SubmitFeedbackRequest]) (*connect.Response[cassie.SubmitFeedbackResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("BlocksService.SubmitFeedback is not implemented"))
+}
@@ -32,6 +32,7 @@ const (
 	Assertion_TYPE_FILE_RETRIEVED      Assertion_Type = 3 // Was a file retrieved (or not)?
 	Assertion_TYPE_LLM_JUDGE           Assertion_Type = 4 // Ask an LLM to grade the final answer.
 	Assertion_TYPE_CODEBLOCK_REGEX     Assertion_Type = 5 // Does at least one code block match the regex?
+	Assertion_TYPE_MAX_RISK            Assertion_Type = 6 // Are all code blocks at most the given risk level?
 )
 
 // Enum value maps for Assertion_Type.
@@ -43,6 +44,7 @@ var (
 		3: "TYPE_FILE_RETRIEVED",
 		4: "TYPE_LLM_JUDGE",
 		5: "TYPE_CODEBLOCK_REGEX",
+		6: "TYPE_MAX_RISK",
 	}
 	Assertion_Type_value = map[string]int32{
 		"TYPE_UNKNOWN":             0,
@@ -51,6 +53,7 @@ var (
 		"TYPE_FILE_RETRIEVED":      3,
 		"TYPE_LLM_JUDGE":           4,
 		"TYPE_CODEBLOCK_REGEX":     5,
+		"TYPE_MAX_RISK":            6,
 	}
 )
 
@@ -151,6 +154,7 @@ type Assertion struct {
 	//	*Assertion_FileRetrieval_
 	//	*Assertion_LlmJudge
 	//	*Assertion_CodeblockRegex_
+	//	*Assertion_MaxRisk_
 	Payload       isAssertion_Payload `protobuf_oneof:"payload"`
 	FailureReason string              `protobuf:"bytes,9,opt,name=failure_reason,json=failureReason,proto3" json:"failure_reason,omitempty"` // If the assertion failed, this will contain the reason.
 	unknownFields protoimpl.UnknownFields
@@ -260,6 +264,15 @@ func (x *Assertion) GetCodeblockRegex() *Assertion_CodeblockRegex {
 	return nil
 }
 
+func (x *Assertion) GetMaxRisk() *Assertion_MaxRisk {
+	if x != nil {
+		if x, ok := x.Payload.(*Assertion_MaxRisk_); ok {
+			return x.MaxRisk
+		}
+	}
+	return nil
+}
+
 func (x *Assertion) GetFailureReason() string {
 	if x != nil {
 		return x.FailureReason
@@ -291,6 +304,10 @@ type Assertion_CodeblockRegex_ struct {
 	CodeblockRegex *Assertion_CodeblockRegex `protobuf:"bytes,8,opt,name=codeblock_regex,json=codeblockRegex,proto3,oneof"`
 }
 
+type Assertion_MaxRisk_ struct {
+	MaxRisk *Assertion_MaxRisk `protobuf:"bytes,10,opt,name=max_risk,json=maxRisk,proto3,oneof"`
+}
+
 func (*Assertion_ShellRequiredFlag_) isAssertion_Payload() {}
 
 func (*Assertion_ToolInvocation_) isAssertion_Payload() {}
@@ -301,6 +318,8 @@ func (*Assertion_LlmJudge) isAssertion_Payload() {}
 
 func (*Assertion_CodeblockRegex_) isAssertion_Payload() {}
 
+func (*Assertion_MaxRisk_) isAssertion_Payload() {}
+
 // -------------------------------------------------------------------------
 // EvalSample – Represents a single evaluation input and its expected assertions
 // -------------------------------------------------------------------------
@@ -469,8 +488,10 @@ type ExperimentSpec struct {
 	OutputDir string `protobuf:"bytes,2,opt,name=output_dir,json=outputDir,proto3" json:"output_dir,omitempty"`
 	// URL of the backend inference service to call during evaluation.
 	InferenceEndpoint string `protobuf:"bytes,3,opt,name=inference_endpoint,json=inferenceEndpoint,proto3" json:"inference_endpoint,omitempty"`
-	unknownFields     protoimpl.UnknownFields
-	sizeCache         protoimpl.SizeCache
+	// Model to request from the inference service. If empty the server's default model is used.
+	Model         string `protobuf:"bytes,4,opt,name=model,proto3" json:"model,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
 }
 
 func (x *ExperimentSpec) Reset() {
@@ -524,6 +545,13 @@ func (x *ExperimentSpec) GetInferenceEndpoint() string {
 	return ""
 }
 
+func (x *ExperimentSpec) GetModel() string {
+	if x != nil {
+		return x.Model
+	}
+	return ""
+}
+
 type Experiment struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
 	// API version of the resource, e.g. "cloudassistant.io/v1alpha1".
@@ -837,11 +865,56 @@ func (x *Assertion_CodeblockRegex) GetRegex() string {
 	return ""
 }
 
+// Verifies that no code block is riskier than the given level.
+type Assertion_MaxRisk struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Level         string                 `protobuf:"bytes,1,opt,name=level,proto3" json:"level,omitempty"` // One of read-only, mutating or destructive
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Assertion_MaxRisk) Reset() {
+	*x = Assertion_MaxRisk{}
+	mi := &file_cassie_eval_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Assertion_MaxRisk) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Assertion_MaxRisk) ProtoMessage() {}
+
+func (x *Assertion_MaxRisk) ProtoReflect() protoreflect.Message {
+	mi := &file_cassie_eval_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Assertion_MaxRisk.ProtoReflect.Descriptor instead.
+func (*Assertion_MaxRisk) Descriptor() ([]byte, []int) {
+	return file_cassie_eval_proto_rawDescGZIP(), []int{0, 5}
+}
+
+func (x *Assertion_MaxRisk) GetLevel() string {
+	if x != nil {
+		return x.Level
+	}
+	return ""
+}
+
 var File_cassie_eval_proto protoreflect.FileDescriptor
 
 const file_cassie_eval_proto_rawDesc = "" +
 	"\n" +
-	"\x11cassie/eval.proto\x1a\x1bbuf/validate/validate.proto\"\xcb\b\n" +
+	"\x11cassie/eval.proto\x1a\x1bbuf/validate/validate.proto\"\xdc\t\n" +
 	"\tAssertion\x12\x1e\n" +
 	"\x04name\x18\x01 \x01(\tB\n" +
 	"\xbaH\a\xc8\x01\x01r\x02\x10\x01R\x04name\x12+\n" +
@@ -851,7 +924,9 @@ const file_cassie_eval_proto_rawDesc = "" +
 	"\x0ftool_invocation\x18\x05 \x01(\v2\x19.Assertion.ToolInvocationH\x00R\x0etoolInvocation\x12A\n" +
 	"\x0efile_retrieval\x18\x06 \x01(\v2\x18.Assertion.FileRetrievalH\x00R\rfileRetrieval\x122\n" +
 	"\tllm_judge\x18\a \x01(\v2\x13.Assertion.LLMJudgeH\x00R\bllmJudge\x12D\n" +
-	"\x0fcodeblock_regex\x18\b \x01(\v2\x19.Assertion.CodeblockRegexH\x00R\x0ecodeblockRegex\x12%\n" +
+	"\x0fcodeblock_regex\x18\b \x01(\v2\x19.Assertion.CodeblockRegexH\x00R\x0ecodeblockRegex\x12/\n" +
+	"\bmax_risk\x18\n" +
+	" \x01(\v2\x12.Assertion.MaxRiskH\x00R\amaxRisk\x12%\n" +
 	"\x0efailure_reason\x18\t \x01(\tR\rfailureReason\x1a\\\n" +
 	"\x11ShellRequiredFlag\x12$\n" +
 	"\acommand\x18\x01 \x01(\tB\n" +
@@ -869,14 +944,17 @@ const file_cassie_eval_proto_rawDesc = "" +
 	"\xbaH\a\xc8\x01\x01r\x02\x10\x01R\x06prompt\x1a2\n" +
 	"\x0eCodeblockRegex\x12 \n" +
 	"\x05regex\x18\x01 \x01(\tB\n" +
-	"\xbaH\a\xc8\x01\x01r\x02\x10\x01R\x05regex\"\x94\x01\n" +
+	"\xbaH\a\xc8\x01\x01r\x02\x10\x01R\x05regex\x1aK\n" +
+	"\aMaxRisk\x12@\n" +
+	"\x05level\x18\x01 \x01(\tB*\xbaH'\xc8\x01\x01r\"R\tread-onlyR\bmutatingR\vdestructiveR\x05level\"\xa7\x01\n" +
 	"\x04Type\x12\x10\n" +
 	"\fTYPE_UNKNOWN\x10\x00\x12\x1c\n" +
 	"\x18TYPE_SHELL_REQUIRED_FLAG\x10\x01\x12\x15\n" +
 	"\x11TYPE_TOOL_INVOKED\x10\x02\x12\x17\n" +
 	"\x13TYPE_FILE_RETRIEVED\x10\x03\x12\x12\n" +
 	"\x0eTYPE_LLM_JUDGE\x10\x04\x12\x18\n" +
-	"\x14TYPE_CODEBLOCK_REGEX\x10\x05\"S\n" +
+	"\x14TYPE_CODEBLOCK_REGEX\x10\x05\x12\x11\n" +
+	"\rTYPE_MAX_RISK\x10\x06\"S\n" +
 	"\x06Result\x12\x12\n" +
 	"\x0eRESULT_UNKNOWN\x10\x00\x12\x0f\n" +
 	"\vRESULT_TRUE\x10\x01\x12\x10\n" +
@@ -900,7 +978,7 @@ const file_cassie_eval_proto_rawDesc = "" +
 	"\n" +
 	"ObjectMeta\x12\x1e\n" +
 	"\x04name\x18\x01 \x01(\tB\n" +
-	"\xbaH\a\xc8\x01\x01r\x02\x10\x01R\x04name\"\xa5\x01\n" +
+	"\xbaH\a\xc8\x01\x01r\x02\x10\x01R\x04name\"\xbb\x01\n" +
 	"\x0eExperimentSpec\x12-\n" +
 	"\fdataset_path\x18\x01 \x01(\tB\n" +
 	"\xbaH\a\xc8\x01\x01r\x02\x10\x01R\vdatasetPath\x12)\n" +
@@ -908,7 +986,8 @@ const file_cassie_eval_proto_rawDesc = "" +
 	"output_dir\x18\x02 \x01(\tB\n" +
 	"\xbaH\a\xc8\x01\x01r\x02\x10\x01R\toutputDir\x129\n" +
 	"\x12inference_endpoint\x18\x03 \x01(\tB\n" +
-	"\xbaH\a\xc8\x01\x01r\x02\x10\x01R\x11inferenceEndpoint\"\xb7\x01\n" +
+	"\xbaH\a\xc8\x01\x01r\x02\x10\x01R\x11inferenceEndpoint\x12\x14\n" +
+	"\x05model\x18\x04 \x01(\tR\x05model\"\xb7\x01\n" +
 	"\n" +
 	"Experiment\x12+\n" +
 	"\vapi_version\x18\x01 \x01(\tB\n" +
@@ -932,7 +1011,7 @@ func file_cassie_eval_proto_rawDescGZIP() []byte {
 }
 
 var file_cassie_eval_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
-var file_cassie_eval_proto_msgTypes = make([]protoimpl.MessageInfo, 11)
+var file_cassie_eval_proto_msgTypes = make([]protoimpl.MessageInfo, 12)
 var file_cassie_eval_proto_goTypes = []any{
 	(Assertion_Type)(0),                 // 0: Assertion.Type
 	(Assertion_Result)(0),               // 1: Assertion.Result
@@ -947,6 +1026,7 @@ var file_cassie_eval_proto_goTypes = []any{
 	(*Assertion_FileRetrieval)(nil),     // 10: Assertion.FileRetrieval
 	(*Assertion_LLMJudge)(nil),          // 11: Assertion.LLMJudge
 	(*Assertion_CodeblockRegex)(nil),    // 12: Assertion.CodeblockRegex
+	(*Assertion_MaxRisk)(nil),           // 13: Assertion.MaxRisk
 }
 var file_cassie_eval_proto_depIdxs = []int32{
 	0,  // 0: Assertion.type:type_name -> Assertion.Type
@@ -956,16 +1036,17 @@ var file_cassie_eval_proto_depIdxs = []int32{
 	10, // 4: Assertion.file_retrieval:type_name -> Assertion.FileRetrieval
 	11, // 5: Assertion.llm_judge:type_name -> Assertion.LLMJudge
 	12, // 6: Assertion.codeblock_regex:type_name -> Assertion.CodeblockRegex
-	5,  // 7: EvalSample.metadata:type_name -> ObjectMeta
-	2,  // 8: EvalSample.assertions:type_name -> Assertion
-	3,  // 9: EvalDataset.samples:type_name -> EvalSample
-	5,  // 10: Experiment.metadata:type_name -> ObjectMeta
-	6,  // 11: Experiment.spec:type_name -> ExperimentSpec
-	12, // [12:12] is the sub-list for method output_type
-	12, // [12:12] is the sub-list for method input_type
-	12, // [12:12] is the sub-list for extension type_name
-	12, // [12:12] is the sub-list for extension extendee
-	0,  // [0:12] is the sub-list for field type_name
+	13, // 7: Assertion.max_risk:type_name -> Assertion.MaxRisk
+	5,  // 8: EvalSample.metadata:type_name -> ObjectMeta
+	2,  // 9: EvalSample.assertions:type_name -> Assertion
+	3,  // 10: EvalDataset.samples:type_name -> EvalSample
+	5,  // 11: Experiment.metadata:type_name -> ObjectMeta
+	6,  // 12: Experiment.spec:type_name -> ExperimentSpec
+	13, // [13:13] is the sub-list for method output_type
+	13, // [13:13] is the sub-list for method input_type
+	13, // [13:13] is the sub-list for extension type_name
+	13, // [13:13] is the sub-list for extension extendee
+	0,  // [0:13] is the sub-list for field type_name
 }
 
 func init() { file_cassie_eval_proto_init() }
@@ -979,6 +1060,7 @@ func file_cassie_eval_proto_init() {
 		(*Assertion_FileRetrieval_)(nil),
 		(*Assertion_LlmJudge)(nil),
 		(*Assertion_CodeblockRegex_)(nil),
+		(*Assertion_MaxRisk_)(nil),
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
@@ -986,7 +1068,7 @@ func file_cassie_eval_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_cassie_eval_proto_rawDesc), len(file_cassie_eval_proto_rawDesc)),
 			NumEnums:      2,
-			NumMessages:   11,
+			NumMessages:   12,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
@@ -30,7 +30,10 @@ type FileSearchResult struct {
 	// The relevance score of the file.
 	Score float64 `protobuf:"fixed64,3,opt,name=Score,proto3" json:"Score,omitempty"`
 	// Link to display for this file
-	Link          string `protobuf:"bytes,4,opt,name=Link,proto3" json:"Link,omitempty"` // TOO(jlewi): Should we include the file contents?
+	Link string `protobuf:"bytes,4,opt,name=Link,proto3" json:"Link,omitempty"`
+	// The ID of the matching section of the file for results from the local docs index. Several sections of the
+	// same file can match.
+	ChunkID       string `protobuf:"bytes,5,opt,name=ChunkID,proto3" json:"ChunkID,omitempty"` // TOO(jlewi): Should we include the file contents?
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -93,16 +96,24 @@ func (x *FileSearchResult) GetLink() string {
 	return ""
 }
 
+func (x *FileSearchResult) GetChunkID() string {
+	if x != nil {
+		return x.ChunkID
+	}
+	return ""
+}
+
 var File_cassie_filesearch_proto protoreflect.FileDescriptor
 
 const file_cassie_filesearch_proto_rawDesc = "" +
 	"\n" +
-	"\x17cassie/filesearch.proto\"p\n" +
+	"\x17cassie/filesearch.proto\"\x8a\x01\n" +
 	"\x10FileSearchResult\x12\x16\n" +
 	"\x06FileID\x18\x01 \x01(\tR\x06FileID\x12\x1a\n" +
 	"\bFileName\x18\x02 \x01(\tR\bFileName\x12\x14\n" +
 	"\x05Score\x18\x03 \x01(\x01R\x05Score\x12\x12\n" +
-	"\x04Link\x18\x04 \x01(\tR\x04LinkBGB\x0fFilesearchProtoP\x01Z2github.com/jlewi/cloud-assistant/protos/gen/cassieb\x06proto3"
+	"\x04Link\x18\x04 \x01(\tR\x04Link\x12\x18\n" +
+	"\aChunkID\x18\x05 \x01(\tR\aChunkIDBGB\x0fFilesearchProtoP\x01Z2github.com/jlewi/cloud-assistant/protos/gen/cassieb\x06proto3"
 
 var (
 	file_cassie_filesearch_proto_rawDescOnce sync.Once
@@ -1,10 +1,20 @@
 import { memo, useCallback, useEffect, useMemo, useRef, useState } from 'react'
 
+import { create } from '@bufbuild/protobuf'
+import { Timestamp, timestampNow } from '@bufbuild/protobuf/wkt'
 import { Box, Button, Card, ScrollArea, Text } from '@radix-ui/themes'
 
-import { Block, BlockOutputKind, useBlock } from '../../contexts/BlockContext'
+import {
+  Block,
+  BlockOutputKind,
+  BlockRole,
+  Rating,
+  useBlock,
+} from '../../contexts/BlockContext'
 import { useSettings } from '../../contexts/SettingsContext'
+import { ExecutionInfoSchema } from '../../gen/es/cassie/blocks_pb'
 import Console from '../Runme/Console'
+import { lookupLanguage } from '../Runme/languages'
 import { genRunID } from '../Runme/Streams'
 import Editor from './Editor'
 import {
@@ -13,6 +23,8 @@ import {
   PlusIcon,
   SpinnerIcon,
   SuccessIcon,
+  ThumbsDownIcon,
+  ThumbsUpIcon,
 } from './icons'
 
 const fontSize = 14
@@ -41,12 +53,60 @@ function RunActionButton({
   )
 }
 
+// FeedbackButtons rates a suggested command. If the user edited the command
+// before rating it down, the edit is sent as the corrected command.
+function FeedbackButtons({
+  block,
+  editorValue,
+}: {
+  block: Block
+  editorValue: string
+}) {
+  const { submitFeedback } = useBlock()
+  const [rating, setRating] = useState<Rating>(Rating.UNSPECIFIED)
+
+  const rate = async (r: Rating) => {
+    let comment = ''
+    let corrected = ''
+    if (r === Rating.THUMBS_DOWN) {
+      comment = window.prompt('What was wrong with this command?') ?? ''
+      if (editorValue.trim() !== block.contents.trim()) {
+        corrected = editorValue
+      }
+    }
+    await submitFeedback(block, r, comment, corrected)
+    setRating(r)
+  }
+
+  return (
+    <div className="flex gap-1 mt-1">
+      <Button
+        size="1"
+        variant={rating === Rating.THUMBS_UP ? 'solid' : 'ghost'}
+        title="Good suggestion"
+        onClick={() => rate(Rating.THUMBS_UP)}
+      >
+        <ThumbsUpIcon />
+      </Button>
+      <Button
+        size="1"
+        variant={rating === Rating.THUMBS_DOWN ? 'solid' : 'ghost'}
+        title="Bad suggestion; edit the command first to record a correction"
+        onClick={() => rate(Rating.THUMBS_DOWN)}
+      >
+        <ThumbsDownIcon />
+      </Button>
+    </div>
+  )
+}
+
 const CodeConsole = memo(
   ({
     blockID,
     runID,
     sequence,
     value,
+    languageId,
     className,
     takeFocus = false,
     scrollToFit = true,
@@ -60,6 +120,7 @@ const CodeConsole = memo(
     runID: string
     sequence: number
     value: string
+    languageId?: string
     className?: string
     takeFocus?: boolean
     scrollToFit?: boolean
@@ -79,6 +140,7 @@ const CodeConsole = memo(
           className={className}
           rows={14}
           commands={value.split('\n')}
+          languageId={languageId}
           fontSize={fontSize}
           fontFamily={fontFamily}
           takeFocus={takeFocus}
@@ -96,6 +158,7 @@ const CodeConsole = memo(
     return (
       prevProps.blockID === nextProps.blockID &&
       JSON.stringify(prevProps.value) === JSON.stringify(nextProps.value) &&
+      prevProps.languageId === nextProps.languageId &&
       prevProps.runID === nextProps.runID
     )
   }
@@ -115,6 +178,7 @@ function Action({ block }: { block: Block }) {
   })
   const [pid, setPid] = useState<number | null>(null)
   const [exitCode, setExitCode] = useState<number | null>(null)
+  const [startTime, setStartTime] = useState<Timestamp | undefined>(undefined)
   const [mimeType, setMimeType] = useState<string | null>(null)
   const [stdout, setStdout] = useState<string>('')
   const [stderr, setStderr] = useState<string>('')
@@ -127,6 +191,7 @@ function Action({ block }: { block: Block }) {
       setStderr('')
       setPid(null)
       setExitCode(null)
+      setStartTime(timestampNow())
       setTakeFocus(takeFocus)
       incrementSequence()
       setExec({ value: editorValue, runID: genRunID() })
@@ -164,6 +229,13 @@ function Action({ block }: { block: Block }) {
 
     const outputBlock = createOutputBlock({
       ...block,
+      // Tell the model how the run went and not just what it printed.
+      executionInfo: create(ExecutionInfoSchema, {
+        exitCode,
+        startTime,
+        endTime: timestampNow(),
+        runnerId: settings.webApp.runner,
+      }),
       outputs: [
         {
           $typeName: 'BlockOutput',
@@ -199,6 +271,8 @@ function Action({ block }: { block: Block }) {
     mimeType,
     pid,
     exitCode,
+    startTime,
+    settings.webApp.runner,
     exec.runID,
   ])
 
@@ -248,12 +322,16 @@ function Action({ block }: { block: Block }) {
             >
               [{sequenceLabel}]
             </Text>
+            {block.role === BlockRole.ASSISTANT && (
+              <FeedbackButtons block={block} editorValue={editorValue} />
+            )}
           </div>
           <Card className="whitespace-nowrap overflow-hidden flex-1 ml-2">
             <Editor
               key={block.id}
               id={block.id}
               value={editorValue}
+              language={lookupLanguage(block.language).editorLanguage}
               fontSize={fontSize}
               fontFamily={fontFamily}
               onChange={(v) => {
@@ -269,6 +347,7 @@ function Action({ block }: { block: Block }) {
               blockID={block.id}
               sequence={lastSequence || 0}
               value={exec.value}
+              languageId={block.language}
               takeFocus={takeFocus}
               scrollToFit={!invertedOrder}
               onStdout={(data: Uint8Array) =>
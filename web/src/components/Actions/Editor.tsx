@@ -7,6 +7,7 @@ const Editor = memo(
   ({
     id,
     value,
+    language = 'shellscript',
     fontSize = 14,
     fontFamily = 'monospace',
     onChange,
@@ -14,6 +15,7 @@ const Editor = memo(
   }: {
     id: string
     value: string
+    language?: string
     fontSize?: number
     fontFamily?: string
     onChange: (value: string) => void
@@ -105,7 +107,7 @@ const Editor = memo(
             key={id}
             height={height}
             width="100%"
-            defaultLanguage="shellscript"
+            defaultLanguage={language}
             value={value}
             options={{
               scrollbar: {
@@ -120,3 +120,50 @@ export function SubmitQuestionIcon() {
     </svg>
   )
 }
+
+export function StopIcon() {
+  return (
+    <svg
+      width="28"
+      height="28"
+      viewBox="0 0 15 15"
+      fill="none"
+      xmlns="http://www.w3.org/2000/svg"
+    >
+      <rect x="4" y="4" width="7" height="7" rx="1" fill="currentColor" />
+    </svg>
+  )
+}
+
+export const ThumbsUpIcon = () => (
+  <svg
+    width="15"
+    height="15"
+    viewBox="0 0 15 15"
+    fill="none"
+    xmlns="http://www.w3.org/2000/svg"
+  >
+    <path
+      d="M4.5 6.5V13H2V6.5H4.5ZM4.5 6.5L7 1.5C8 1.5 8.5 2.2 8.5 3V5.5H12C12.8 5.5 13.3 6.2 13.1 7L12 12C11.9 12.6 11.4 13 10.8 13H4.5"
+      stroke="currentColor"
+      strokeLinejoin="round"
+    />
+  </svg>
+)
+
+export const ThumbsDownIcon = () => (
+  <svg
+    width="15"
+    height="15"
+    viewBox="0 0 15 15"
+    fill="none"
+    xmlns="http://www.w3.org/2000/svg"
+  >
+    <path
+      d="M4.5 6.5V13H2V6.5H4.5ZM4.5 6.5L7 1.5C8 1.5 8.5 2.2 8.5 3V5.5H12C12.8 5.5 13.3 6.2 13.1 7L12 12C11.9 12.6 11.4 13 10.8 13H4.5"
+      stroke="currentColor"
+      strokeLinejoin="round"
+      transform="rotate(180 7.5 7.5)"
+    />
+  </svg>
+)
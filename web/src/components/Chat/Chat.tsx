@@ -1,10 +1,13 @@
 import { memo, useEffect, useRef, useState } from 'react'
 import Markdown from 'react-markdown'
 
+import { create } from '@bufbuild/protobuf'
+import { Cross1Icon, FilePlusIcon } from '@radix-ui/react-icons'
 import {
   Button,
   Callout,
   Flex,
+  Link,
   ScrollArea,
   Text,
   TextArea,
@@ -13,12 +16,14 @@ import {
 import {
   Block,
   BlockKind,
+  BlockOutputItem,
   BlockRole,
   TypingBlock,
   useBlock,
 } from '../../contexts/BlockContext'
 import { useSettings } from '../../contexts/SettingsContext'
-import { SubmitQuestionIcon } from '../Actions/icons'
+import { BlockOutputItemSchema } from '../../gen/es/cassie/blocks_pb'
+import { StopIcon, SubmitQuestionIcon } from '../Actions/icons'
 
 type MessageProps = {
   block: Block
@@ -47,11 +52,47 @@ const MessageContainer = ({
 
 const UserMessage = ({ block }: { block: Block }) => {
   return (
-    <MessageContainer role={BlockRole.USER}>{block.contents}</MessageContainer>
+    <MessageContainer role={BlockRole.USER}>
+      {block.contents}
+      {block.attachments.map((a, i) => (
+        <Text as="div" size="1" key={i}>
+          Attached {a.name || a.mime}
+        </Text>
+      ))}
+    </MessageContainer>
   )
 }
 
+// citationSources numbers the sources cited by a block. Citations of the same source share a number.
+const citationSources = (block: Block) => {
+  const sources: { link: string; label: string }[] = []
+  const numbers = block.citations.map((c) => {
+    let i = sources.findIndex((s) => s.link === c.link)
+    if (i < 0) {
+      sources.push({ link: c.link, label: c.filename || c.title || c.link })
+      i = sources.length - 1
+    }
+    return i + 1
+  })
+  return { sources, numbers }
+}
+
+// withCitationMarkers inserts a footnote marker after the text each citation
+// applies to. Citation indexes count Unicode code points.
+const withCitationMarkers = (block: Block, numbers: number[]) => {
+  const chars = Array.from(block.contents)
+  // Insert from the end so the indexes of earlier citations stay valid.
+  const markers = block.citations
+    .map((c, i) => ({ index: c.endIndex, label: `[${numbers[i]}]` }))
+    .sort((a, b) => b.index - a.index)
+  for (const m of markers) {
+    chars.splice(Math.min(m.index, chars.length), 0, m.label)
+  }
+  return chars.join('')
+}
+
 const AssistantMessage = ({ block }: { block: Block }) => {
+  const { sources, numbers } = citationSources(block)
   return (
     <MessageContainer role={BlockRole.ASSISTANT}>
       <Markdown
@@ -65,12 +106,40 @@ const AssistantMessage = ({ block }: { block: Block }) => {
           },
         }}
       >
-        {block.contents}
+        {withCitationMarkers(block, numbers)}
       </Markdown>
+      {sources.length > 0 && (
+        <ol className="text-xs mt-2">
+          {sources.map((s, i) => (
+            <li key={s.link}>
+              [{i + 1}]{' '}
+              <Link href={s.link} target="_blank">
+                {s.label}
+              </Link>
+            </li>
+          ))}
+        </ol>
+      )}
     </MessageContainer>
   )
 }
 
+// ReasoningMessage shows the summary of the model's reasoning. It is collapsed
+// by default so it doesn't crowd out the answer.
+const ReasoningMessage = ({ block }: { block: Block }) => {
+  // Reasoning without a summary is only kept so a stateless server can send
+  // it back to the model
+  if (!block.contents) {
+    return null
+  }
+  return (
+    <details className="self-start max-w-[80%] m-1 text-sm text-gray-500">
+      <summary className="cursor-pointer">Reasoning</summary>
+      <Markdown>{block.contents}</Markdown>
+    </details>
+  )
+}
+
 const CodeMessage = memo(
   ({
     block,
@@ -158,6 +227,10 @@ const Message = ({
   block,
   isRecentCodeBlock,
 }: MessageProps & { isRecentCodeBlock?: boolean }) => {
+  if (block.kind === BlockKind.REASONING) {
+    return <ReasoningMessage block={block} />
+  }
+
   if (block.kind === BlockKind.CODE) {
     return (
       <CodeMessage
@@ -220,9 +293,11 @@ const ChatMessages = () => {
 }
 
 const ChatInput = () => {
-  const { sendUserBlock, isInputDisabled } = useBlock()
+  const { sendUserBlock, isInputDisabled, cancelGenerate } = useBlock()
   const [userInput, setUserInput] = useState('')
+  const [attachments, setAttachments] = useState<BlockOutputItem[]>([])
   const inputRef = useRef<HTMLTextAreaElement>(null)
+  const fileInputRef = useRef<HTMLInputElement>(null)
 
   useEffect(() => {
     inputRef.current?.focus()
@@ -230,9 +305,33 @@ const ChatInput = () => {
 
   const handleSubmit = (event: React.FormEvent<HTMLFormElement>) => {
     event.preventDefault()
-    if (!userInput.trim()) return
-    sendUserBlock(userInput)
+    if (!userInput.trim() && attachments.length === 0) return
+    sendUserBlock(userInput, attachments)
     setUserInput('')
+    setAttachments([])
+  }
+
+  // attach reads the files e.g. a pasted screenshot so they are sent to the
+  // model with the question. The server decides which types and sizes it
+  // accepts.
+  const attach = async (files: File[]) => {
+    const items = await Promise.all(
+      files.map(async (f) =>
+        create(BlockOutputItemSchema, {
+          mime: f.type,
+          name: f.name,
+          binaryData: new Uint8Array(await f.arrayBuffer()),
+        })
+      )
+    )
+    setAttachments((prev) => [...prev, ...items])
+  }
+
+  const handlePaste = (event: React.ClipboardEvent<HTMLTextAreaElement>) => {
+    const files = Array.from(event.clipboardData.files)
+    if (files.length === 0) return
+    event.preventDefault()
+    attach(files)
   }
 
   const handleKeyDown = (event: React.KeyboardEvent<HTMLTextAreaElement>) => {
@@ -246,13 +345,51 @@ const ChatInput = () => {
   }
 
   return (
-    <form onSubmit={handleSubmit} className="flex w-full">
+    <form onSubmit={handleSubmit} className="flex flex-col w-full">
+      {attachments.length > 0 && (
+        <Flex className="gap-2 mx-2 flex-wrap">
+          {attachments.map((a, i) => (
+            <Button
+              key={i}
+              type="button"
+              size="1"
+              variant="soft"
+              title="Remove attachment"
+              onClick={() =>
+                setAttachments((prev) => prev.filter((_, j) => j !== i))
+              }
+            >
+              {a.name || a.mime}
+              <Cross1Icon />
+            </Button>
+          ))}
+        </Flex>
+      )}
       <Flex className="w-full flex flex-nowrap items-start gap-4 m-2">
+        <input
+          type="file"
+          multiple
+          hidden
+          ref={fileInputRef}
+          onChange={(e) => {
+            attach(Array.from(e.target.files ?? []))
+            e.target.value = ''
+          }}
+        />
+        <Button
+          type="button"
+          variant="soft"
+          title="Attach files"
+          onClick={() => fileInputRef.current?.click()}
+        >
+          <FilePlusIcon />
+        </Button>
         <TextArea
           name="userInput"
           value={userInput}
           onChange={(e) => setUserInput(e.target.value)}
           onKeyDown={handleKeyDown}
+          onPaste={handlePaste}
           placeholder="Enter your question"
           size="3"
           className="flex-grow min-w-0"
@@ -260,9 +397,20 @@ const ChatInput = () => {
           rows={2}
           style={{ resize: 'vertical' }}
         />
-        <Button type="submit" disabled={isInputDisabled}>
-          <SubmitQuestionIcon />
-        </Button>
+        {isInputDisabled ? (
+          <Button
+            type="button"
+            color="red"
+            title="Stop generating"
+            onClick={() => cancelGenerate()}
+          >
+            <StopIcon />
+          </Button>
+        ) : (
+          <Button type="submit">
+            <SubmitQuestionIcon />
+          </Button>
+        )}
       </Flex>
     </form>
   )
@@ -51,7 +51,7 @@ const FileViewer = () => {
         ) : (
           <div className="grow">
             {oneBlock.fileSearchResults.map((b) => (
-              <div key={b.FileID} className="mb-2">
+              <div key={b.ChunkID || b.FileID} className="mb-2">
                 <Box
                   p="2"
                   style={{
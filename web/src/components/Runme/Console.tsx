@@ -13,6 +13,7 @@ import { VSCodeEvent } from 'vscode-notebook-renderer/events'
 
 import { useSettings } from '../../contexts/SettingsContext'
 import Streams from './Streams'
+import { lookupLanguage } from './languages'
 // anything below is required for the webcomponents to work
 import './renderers/client'
 // @ts-expect-error because the webcomponents are not typed
@@ -24,6 +25,7 @@ function Console({
   runID,
   sequence,
   commands,
+  languageId,
   rows = 20,
   className,
   fontSize = 12,
@@ -40,6 +42,7 @@ function Console({
   runID: string
   sequence: number
   commands: string[]
+  languageId?: string
   rows?: number
   className?: string
   fontSize?: number
@@ -96,28 +99,37 @@ function Console({
   })
 
   const executeRequest = useMemo(() => {
+    const language = lookupLanguage(languageId)
+    // Shell cells run inline; other languages are written to a file which is
+    // passed to their program e.g. python3 or kubectl apply -f.
+    const program = language.programName
+      ? {
+          languageId: language.id,
+          programName: language.programName,
+          arguments: language.args ?? [],
+          source: { case: 'script' as const, value: commands.join('\n') },
+          mode: CommandMode.FILE,
+        }
+      : {
+          languageId: 'sh',
+          source: { case: 'commands' as const, value: { items: commands } },
+          mode: CommandMode.INLINE,
+        }
     return create(ExecuteRequestSchema, {
       sessionStrategy: SessionStrategy.MOST_RECENT, // without this every exec gets its own session
       storeStdoutInEnv: true,
       config: {
-        languageId: 'sh',
+        ...program,
         background: false,
         fileExtension: '',
         env: [`RUNME_ID=${blockID}`, 'RUNME_RUNNER=v2', 'TERM=xterm-256color'],
-        source: {
-          case: 'commands',
-          value: {
-            items: commands,
-          },
-        },
         interactive: true,
-        mode: CommandMode.INLINE,
         knownId: blockID,
         // knownName: "the-block-name",
       },
       winsize,
     })
-  }, [blockID, commands, winsize])
+  }, [blockID, commands, languageId, winsize])
 
   const webComponentDefaults = useMemo(
     () => ({
@@ -0,0 +1,46 @@
+// Languages the runner can execute. Keep in sync with app/pkg/runme/languages.go.
+export interface Language {
+  // id is the language of the block e.g. Block.language
+  id: string
+  // programName is the program the cell is passed to as a file; it is unset
+  // for shell cells which are run inline.
+  programName?: string
+  // args are passed to the program before the file containing the cell.
+  args?: string[]
+  // editorLanguage is the Monaco language used to highlight the cell.
+  editorLanguage: string
+}
+
+const bash: Language = { id: 'bash', editorLanguage: 'shellscript' }
+
+const languages: Record<string, Language> = {
+  bash,
+  python: { id: 'python', programName: 'python3', editorLanguage: 'python' },
+  jq: {
+    id: 'jq',
+    programName: 'jq',
+    args: ['-n', '-f'],
+    editorLanguage: 'plaintext',
+  },
+  'kubectl-apply': {
+    id: 'kubectl-apply',
+    programName: 'kubectl',
+    args: ['apply', '-f'],
+    editorLanguage: 'yaml',
+  },
+}
+
+const aliases: Record<string, string> = {
+  '': 'bash',
+  sh: 'bash',
+  shell: 'bash',
+  py: 'python',
+  python3: 'python',
+}
+
+// lookupLanguage returns the language for a block. Unknown languages are run
+// as bash like blocks without a language.
+export function lookupLanguage(id?: string): Language {
+  const key = (id ?? '').trim().toLowerCase()
+  return languages[aliases[key] ?? key] ?? bash
+}
@@ -4,6 +4,7 @@ import {
   useContext,
   useEffect,
   useMemo,
+  useRef,
   useState,
 } from 'react'
 
@@ -13,13 +14,17 @@ import { v4 as uuidv4 } from 'uuid'
 import {
   Block,
   BlockKind,
+  BlockOutputItem,
   BlockOutputItemSchema,
   BlockOutputKind,
   BlockOutputSchema,
   BlockRole,
   BlockSchema,
+  CancelGenerateRequestSchema,
   GenerateRequest,
   GenerateRequestSchema,
+  Rating,
+  SubmitFeedbackRequestSchema,
 } from '../gen/es/cassie/blocks_pb'
 import { getAccessToken } from '../token'
 import { useClient as useAgentClient } from './AgentContext'
@@ -42,11 +47,24 @@ type BlockContextType = {
   // This way they can be set in the provider and passed down to the components
   sendOutputBlock: (outputBlock: Block) => Promise<void>
   createOutputBlock: (inputBlock: Block) => Block
-  sendUserBlock: (text: string) => Promise<void>
+  // sendUserBlock sends a question along with any files the user attached
+  sendUserBlock: (
+    text: string,
+    attachments?: BlockOutputItem[]
+  ) => Promise<void>
   addCodeBlock: () => void
   // Keep track of whether the input is disabled
   isInputDisabled: boolean
   isTyping: boolean
+  // cancelGenerate stops the response that is being generated
+  cancelGenerate: () => Promise<void>
+  // submitFeedback rates a block e.g. whether a suggested command was right
+  submitFeedback: (
+    block: Block,
+    rating: Rating,
+    comment?: string,
+    correctedCommand?: string
+  ) => Promise<void>
   // Function to run a code block
   runCodeBlock: (block: Block) => void
   // Function to reset the session
@@ -69,6 +87,10 @@ interface BlockState {
   positions: string[]
 }
 
+// RETRACTED_METADATA_KEY marks blocks the client should remove. Keep in sync
+// with app/pkg/ai/resilience.go.
+const RETRACTED_METADATA_KEY = 'cloudassistant.io/retracted'
+
 export const BlockProvider = ({ children }: { children: ReactNode }) => {
   const { settings } = useSettings()
   const [sequence, setSequence] = useState(0)
@@ -77,6 +99,14 @@ export const BlockProvider = ({ children }: { children: ReactNode }) => {
   const [previousResponseId, setPreviousResponseId] = useState<
     string | undefined
   >()
+  // branchId is the branch of the conversation the server generated the
+  // latest response on
+  const [branchId, setBranchId] = useState<string | undefined>()
+  // requestIdRef is the ID of the in-flight generate request, if any
+  const requestIdRef = useRef<string | undefined>(undefined)
+  // stateless is true once the server says it doesn't keep the history of
+  // the conversation; every request then has to contain the whole conversation
+  const [stateless, setStateless] = useState(false)
 
   const incrementSequence = () => {
     setSequence((prev) => prev + 1)
@@ -108,7 +138,9 @@ export const BlockProvider = ({ children }: { children: ReactNode }) => {
       .filter(
         (block): block is Block =>
           Boolean(block) &&
-          (block.kind === BlockKind.MARKUP || block.kind === BlockKind.CODE)
+          (block.kind === BlockKind.MARKUP ||
+            block.kind === BlockKind.CODE ||
+            block.kind === BlockKind.REASONING)
       )
   }, [state.blocks, state.positions])
 
@@ -149,12 +181,32 @@ export const BlockProvider = ({ children }: { children: ReactNode }) => {
     return b
   }
 
+  // conversation returns the blocks in the order they happened. Blocks in
+  // updated replace the blocks with the same ID or are added at the end.
+  const conversation = (updated: Block[] = []) => {
+    const byId = new Map(updated.map((b) => [b.id, b]))
+    const blocks = state.positions
+      .map((id) => byId.get(id) ?? state.blocks[id])
+      .filter((b): b is Block => Boolean(b))
+    if (invertedOrder) {
+      blocks.reverse()
+    }
+    const ids = new Set(blocks.map((b) => b.id))
+    return [...blocks, ...updated.filter((b) => !ids.has(b.id))]
+  }
+
   const streamGenerateResults = async (blocks: Block[]) => {
     const accessToken = getAccessToken()
 
+    const requestId = `req_${uuidv4()}`
+    requestIdRef.current = requestId
+    // A stateless server doesn't know about previous responses so it needs
+    // the whole conversation.
     const req: GenerateRequest = create(GenerateRequestSchema, {
-      blocks,
-      previousResponseId: previousResponseId,
+      blocks: stateless ? conversation(blocks) : blocks,
+      previousResponseId: stateless ? undefined : previousResponseId,
+      branchId,
+      requestId,
     })
 
     req.openaiAccessToken = accessToken.accessToken
@@ -170,23 +222,69 @@ export const BlockProvider = ({ children }: { children: ReactNode }) => {
           updateBlock(b)
         }
         setPreviousResponseId(r.responseId)
+        setStateless(r.stateless)
+        if (r.branchId) {
+          setBranchId(r.branchId)
+        }
       }
     } catch (e) {
       console.log(e)
     } finally {
+      if (requestIdRef.current === requestId) {
+        requestIdRef.current = undefined
+      }
       setIsTyping(false)
       setIsInputDisabled(false)
     }
   }
 
-  const sendUserBlock = async (text: string) => {
-    if (!text.trim()) return
+  const cancelGenerate = async () => {
+    const requestId = requestIdRef.current
+    if (!requestId) return
+    try {
+      await client!.cancelGenerate(
+        create(CancelGenerateRequestSchema, { requestId })
+      )
+    } catch (e) {
+      console.log(e)
+    }
+  }
+
+  const submitFeedback = async (
+    block: Block,
+    rating: Rating,
+    comment = '',
+    correctedCommand = ''
+  ) => {
+    // Send the conversation in the order it happened so it can be replayed.
+    const blocks = conversation()
+    try {
+      await client!.submitFeedback(
+        create(SubmitFeedbackRequestSchema, {
+          blockId: block.id,
+          rating,
+          comment,
+          correctedCommand,
+          blocks,
+        })
+      )
+    } catch (e) {
+      console.log(e)
+    }
+  }
+
+  const sendUserBlock = async (
+    text: string,
+    attachments: BlockOutputItem[] = []
+  ) => {
+    if (!text.trim() && attachments.length === 0) return
 
     const userBlock = create(BlockSchema, {
       id: `user_${uuidv4()}`,
       role: BlockRole.USER,
       kind: BlockKind.MARKUP,
       contents: text,
+      attachments,
     })
 
     // Add the user block to the blocks map and positions
@@ -216,6 +314,20 @@ export const BlockProvider = ({ children }: { children: ReactNode }) => {
 
   const updateBlock = (block: Block) => {
     setState((prev) => {
+      // The server retracts the blocks streamed by a generation attempt that
+      // failed; the next attempt streams the response again.
+      if (block.metadata[RETRACTED_METADATA_KEY] === 'true') {
+        if (!prev.blocks[block.id]) {
+          return prev
+        }
+        const blocks = { ...prev.blocks }
+        delete blocks[block.id]
+        return {
+          blocks,
+          positions: prev.positions.filter((id) => id !== block.id),
+        }
+      }
+
       if (!prev.blocks[block.id]) {
         const newPositions = invertedOrder
           ? [block.id, ...prev.positions]
@@ -243,6 +355,7 @@ export const BlockProvider = ({ children }: { children: ReactNode }) => {
     setState({ blocks: {}, positions: [] })
     setSequence(0)
     setPreviousResponseId(undefined)
+    setBranchId(undefined)
   }
 
   const addCodeBlock = () => {
@@ -280,6 +393,8 @@ export const BlockProvider = ({ children }: { children: ReactNode }) => {
         addCodeBlock,
         isInputDisabled,
         isTyping,
+        cancelGenerate,
+        submitFeedback,
         runCodeBlock,
         resetSession,
       }}
@@ -295,4 +410,12 @@ const TypingBlock = create(BlockSchema, {
   contents: '...',
 })
 
-export { type Block, BlockRole, BlockKind, BlockOutputKind, TypingBlock }
+export {
+  type Block,
+  type BlockOutputItem,
+  BlockRole,
+  Rating,
+  BlockKind,
+  BlockOutputKind,
+  TypingBlock,
+}
@@ -5,6 +5,7 @@
 import type { GenEnum, GenFile, GenMessage, GenService } from "@bufbuild/protobuf/codegenv1";
 import type { Message } from "@bufbuild/protobuf";
 import type { FileSearchResult, FileSearchResultJson } from "./filesearch_pb";
+import type { Timestamp, TimestampJson } from "@bufbuild/protobuf/wkt";
 
 /**
  * Describes the file cassie/blocks.proto.
@@ -74,6 +75,29 @@ export declare type Block = Message<"Block"> & {
    * @generated from field: string call_id = 12;
    */
   callId: string;
+
+  /**
+   * execution_info describes the last run of the block. It is unset if the block hasn't been run.
+   *
+   * @generated from field: ExecutionInfo execution_info = 13;
+   */
+  executionInfo?: ExecutionInfo;
+
+  /**
+   * citations tie the contents of a MARKUP block to the sources they came from e.g. the documents found by file
+   * search.
+   *
+   * @generated from field: repeated Citation citations = 14;
+   */
+  citations: Citation[];
+
+  /**
+   * attachments are files the user attached to a MARKUP block e.g. a pasted screenshot. They are sent to the
+   * model along with the contents of the block.
+   *
+   * @generated from field: repeated BlockOutputItem attachments = 15;
+   */
+  attachments: BlockOutputItem[];
 };
 
 /**
@@ -139,6 +163,29 @@ export declare type BlockJson = {
    * @generated from field: string call_id = 12;
    */
   callId?: string;
+
+  /**
+   * execution_info describes the last run of the block. It is unset if the block hasn't been run.
+   *
+   * @generated from field: ExecutionInfo execution_info = 13;
+   */
+  executionInfo?: ExecutionInfoJson;
+
+  /**
+   * citations tie the contents of a MARKUP block to the sources they came from e.g. the documents found by file
+   * search.
+   *
+   * @generated from field: repeated Citation citations = 14;
+   */
+  citations?: CitationJson[];
+
+  /**
+   * attachments are files the user attached to a MARKUP block e.g. a pasted screenshot. They are sent to the
+   * model along with the contents of the block.
+   *
+   * @generated from field: repeated BlockOutputItem attachments = 15;
+   */
+  attachments?: BlockOutputItemJson[];
 };
 
 /**
@@ -147,6 +194,206 @@ export declare type BlockJson = {
  */
 export declare const BlockSchema: GenMessage<Block, BlockJson>;
 
+/**
+ * Citation is a source cited by part of a block's contents.
+ *
+ * @generated from message Citation
+ */
+export declare type Citation = Message<"Citation"> & {
+  /**
+   * start_index and end_index are the range of characters in the contents the citation applies to. File citations
+   * only mark the position after the cited text so both are set to that position.
+   *
+   * @generated from field: int32 start_index = 1;
+   */
+  startIndex: number;
+
+  /**
+   * @generated from field: int32 end_index = 2;
+   */
+  endIndex: number;
+
+  /**
+   * file_id is the ID of the cited file. It is empty for web citations.
+   *
+   * @generated from field: string file_id = 3;
+   */
+  fileId: string;
+
+  /**
+   * filename is the name of the cited file.
+   *
+   * @generated from field: string filename = 4;
+   */
+  filename: string;
+
+  /**
+   * link is the link to display for the source e.g. the link of the file or the URL of a web page.
+   *
+   * @generated from field: string link = 5;
+   */
+  link: string;
+
+  /**
+   * title is the title of a cited web page.
+   *
+   * @generated from field: string title = 6;
+   */
+  title: string;
+};
+
+/**
+ * Citation is a source cited by part of a block's contents.
+ *
+ * @generated from message Citation
+ */
+export declare type CitationJson = {
+  /**
+   * start_index and end_index are the range of characters in the contents the citation applies to. File citations
+   * only mark the position after the cited text so both are set to that position.
+   *
+   * @generated from field: int32 start_index = 1;
+   */
+  startIndex?: number;
+
+  /**
+   * @generated from field: int32 end_index = 2;
+   */
+  endIndex?: number;
+
+  /**
+   * file_id is the ID of the cited file. It is empty for web citations.
+   *
+   * @generated from field: string file_id = 3;
+   */
+  fileId?: string;
+
+  /**
+   * filename is the name of the cited file.
+   *
+   * @generated from field: string filename = 4;
+   */
+  filename?: string;
+
+  /**
+   * link is the link to display for the source e.g. the link of the file or the URL of a web page.
+   *
+   * @generated from field: string link = 5;
+   */
+  link?: string;
+
+  /**
+   * title is the title of a cited web page.
+   *
+   * @generated from field: string title = 6;
+   */
+  title?: string;
+};
+
+/**
+ * Describes the message Citation.
+ * Use `create(CitationSchema)` to create a new message.
+ */
+export declare const CitationSchema: GenMessage<Citation, CitationJson>;
+
+/**
+ * ExecutionInfo describes a run of the program in a block.
+ *
+ * @generated from message ExecutionInfo
+ */
+export declare type ExecutionInfo = Message<"ExecutionInfo"> & {
+  /**
+   * exit_code is the exit code of the program. It is unset if the program didn't exit e.g. because the run was
+   * cancelled.
+   *
+   * @generated from field: optional int32 exit_code = 1;
+   */
+  exitCode?: number;
+
+  /**
+   * @generated from field: google.protobuf.Timestamp start_time = 2;
+   */
+  startTime?: Timestamp;
+
+  /**
+   * @generated from field: google.protobuf.Timestamp end_time = 3;
+   */
+  endTime?: Timestamp;
+
+  /**
+   * truncated is true if the outputs are incomplete e.g. because they were too large to keep in full.
+   *
+   * @generated from field: bool truncated = 4;
+   */
+  truncated: boolean;
+
+  /**
+   * cancelled is true if the run was cancelled or timed out before the program exited.
+   *
+   * @generated from field: bool cancelled = 5;
+   */
+  cancelled: boolean;
+
+  /**
+   * runner_id identifies the runner that executed the program e.g. the runner endpoint used by the web app.
+   *
+   * @generated from field: string runner_id = 6;
+   */
+  runnerId: string;
+};
+
+/**
+ * ExecutionInfo describes a run of the program in a block.
+ *
+ * @generated from message ExecutionInfo
+ */
+export declare type ExecutionInfoJson = {
+  /**
+   * exit_code is the exit code of the program. It is unset if the program didn't exit e.g. because the run was
+   * cancelled.
+   *
+   * @generated from field: optional int32 exit_code = 1;
+   */
+  exitCode?: number;
+
+  /**
+   * @generated from field: google.protobuf.Timestamp start_time = 2;
+   */
+  startTime?: TimestampJson;
+
+  /**
+   * @generated from field: google.protobuf.Timestamp end_time = 3;
+   */
+  endTime?: TimestampJson;
+
+  /**
+   * truncated is true if the outputs are incomplete e.g. because they were too large to keep in full.
+   *
+   * @generated from field: bool truncated = 4;
+   */
+  truncated?: boolean;
+
+  /**
+   * cancelled is true if the run was cancelled or timed out before the program exited.
+   *
+   * @generated from field: bool cancelled = 5;
+   */
+  cancelled?: boolean;
+
+  /**
+   * runner_id identifies the runner that executed the program e.g. the runner endpoint used by the web app.
+   *
+   * @generated from field: string runner_id = 6;
+   */
+  runnerId?: string;
+};
+
+/**
+ * Describes the message ExecutionInfo.
+ * Use `create(ExecutionInfoSchema)` to create a new message.
+ */
+export declare const ExecutionInfoSchema: GenMessage<ExecutionInfo, ExecutionInfoJson>;
+
 /**
  * BlockOutput represents the output of a block.
  * It corresponds to a VSCode NotebookCellOutput
@@ -213,12 +460,26 @@ export declare type BlockOutputItem = Message<"BlockOutputItem"> & {
   /**
    * value of the output item.
    * We use string data type and not bytes because the JSON representation of bytes is a base64
-   * string. vscode data uses a byte. We may need to add support for bytes to support non text data
-   * data in the future.
+   * string. vscode data uses a byte. Items that aren't text use binary_data instead.
    *
    * @generated from field: string text_data = 2;
    */
   textData: string;
+
+  /**
+   * binary_data is the value of items that aren't text e.g. an image/png captured by a command or a file the
+   * user attached. At most one of text_data and binary_data is set.
+   *
+   * @generated from field: bytes binary_data = 3;
+   */
+  binaryData: Uint8Array;
+
+  /**
+   * name is an optional file name for the item e.g. the name of the file the user attached.
+   *
+   * @generated from field: string name = 4;
+   */
+  name: string;
 };
 
 /**
@@ -239,12 +500,26 @@ export declare type BlockOutputItemJson = {
   /**
    * value of the output item.
    * We use string data type and not bytes because the JSON representation of bytes is a base64
-   * string. vscode data uses a byte. We may need to add support for bytes to support non text data
-   * data in the future.
+   * string. vscode data uses a byte. Items that aren't text use binary_data instead.
    *
    * @generated from field: string text_data = 2;
    */
   textData?: string;
+
+  /**
+   * binary_data is the value of items that aren't text e.g. an image/png captured by a command or a file the
+   * user attached. At most one of text_data and binary_data is set.
+   *
+   * @generated from field: bytes binary_data = 3;
+   */
+  binaryData?: string;
+
+  /**
+   * name is an optional file name for the item e.g. the name of the file the user attached.
+   *
+   * @generated from field: string name = 4;
+   */
+  name?: string;
 };
 
 /**
@@ -273,6 +548,30 @@ export declare type GenerateRequest = Message<"GenerateRequest"> & {
    * @generated from field: string openai_access_token = 3;
    */
   openaiAccessToken: string;
+
+  /**
+   * model is the model to use. If empty the server's default model is used.
+   * The model must be in the server's allow-list.
+   *
+   * @generated from field: string model = 4;
+   */
+  model: string;
+
+  /**
+   * request_id is an optional ID chosen by the client. It lets the client cancel the request with CancelGenerate
+   * before it knows the ID of the response.
+   *
+   * @generated from field: string request_id = 5;
+   */
+  requestId: string;
+
+  /**
+   * branch_id is the ID of the branch of the conversation to continue. If previous_response_id is empty the request
+   * continues from the latest response on the branch.
+   *
+   * @generated from field: string branch_id = 6;
+   */
+  branchId: string;
 };
 
 /**
@@ -295,6 +594,30 @@ export declare type GenerateRequestJson = {
    * @generated from field: string openai_access_token = 3;
    */
   openaiAccessToken?: string;
+
+  /**
+   * model is the model to use. If empty the server's default model is used.
+   * The model must be in the server's allow-list.
+   *
+   * @generated from field: string model = 4;
+   */
+  model?: string;
+
+  /**
+   * request_id is an optional ID chosen by the client. It lets the client cancel the request with CancelGenerate
+   * before it knows the ID of the response.
+   *
+   * @generated from field: string request_id = 5;
+   */
+  requestId?: string;
+
+  /**
+   * branch_id is the ID of the branch of the conversation to continue. If previous_response_id is empty the request
+   * continues from the latest response on the branch.
+   *
+   * @generated from field: string branch_id = 6;
+   */
+  branchId?: string;
 };
 
 /**
@@ -316,6 +639,45 @@ export declare type GenerateResponse = Message<"GenerateResponse"> & {
    * @generated from field: string response_id = 2;
    */
   responseId: string;
+
+  /**
+   * model is the model that generated the response.
+   *
+   * @generated from field: string model = 3;
+   */
+  model: string;
+
+  /**
+   * usage is the number of tokens used to generate the response. It is only set on the message sent once the model
+   * has finished generating the response.
+   *
+   * @generated from field: Usage usage = 4;
+   */
+  usage?: Usage;
+
+  /**
+   * branch_id is the ID of the branch of the conversation the response was generated on. Clients send it back in
+   * GenerateRequest.branch_id to continue the branch.
+   *
+   * @generated from field: string branch_id = 5;
+   */
+  branchId: string;
+
+  /**
+   * attempt is the attempt that generated the response. Generations that fail are retried or fall back to other
+   * models so it isn't necessarily the first attempt or the requested model.
+   *
+   * @generated from field: Attempt attempt = 6;
+   */
+  attempt?: Attempt;
+
+  /**
+   * stateless is true if the server is in stateless mode. Clients must then send all the blocks in the conversation
+   * in every GenerateRequest and must not set previous_response_id.
+   *
+   * @generated from field: bool stateless = 7;
+   */
+  stateless: boolean;
 };
 
 /**
@@ -331,6 +693,45 @@ export declare type GenerateResponseJson = {
    * @generated from field: string response_id = 2;
    */
   responseId?: string;
+
+  /**
+   * model is the model that generated the response.
+   *
+   * @generated from field: string model = 3;
+   */
+  model?: string;
+
+  /**
+   * usage is the number of tokens used to generate the response. It is only set on the message sent once the model
+   * has finished generating the response.
+   *
+   * @generated from field: Usage usage = 4;
+   */
+  usage?: UsageJson;
+
+  /**
+   * branch_id is the ID of the branch of the conversation the response was generated on. Clients send it back in
+   * GenerateRequest.branch_id to continue the branch.
+   *
+   * @generated from field: string branch_id = 5;
+   */
+  branchId?: string;
+
+  /**
+   * attempt is the attempt that generated the response. Generations that fail are retried or fall back to other
+   * models so it isn't necessarily the first attempt or the requested model.
+   *
+   * @generated from field: Attempt attempt = 6;
+   */
+  attempt?: AttemptJson;
+
+  /**
+   * stateless is true if the server is in stateless mode. Clients must then send all the blocks in the conversation
+   * in every GenerateRequest and must not set previous_response_id.
+   *
+   * @generated from field: bool stateless = 7;
+   */
+  stateless?: boolean;
 };
 
 /**
@@ -340,64 +741,843 @@ export declare type GenerateResponseJson = {
 export declare const GenerateResponseSchema: GenMessage<GenerateResponse, GenerateResponseJson>;
 
 /**
- * @generated from enum BlockKind
+ * Attempt identifies an attempt to generate a response.
+ *
+ * @generated from message Attempt
  */
-export enum BlockKind {
+export declare type Attempt = Message<"Attempt"> & {
   /**
-   * @generated from enum value: UNKNOWN_BLOCK_KIND = 0;
+   * number is the number of the attempt starting at 1. It counts the attempts on all models.
+   *
+   * @generated from field: int32 number = 1;
    */
-  UNKNOWN_BLOCK_KIND = 0,
+  number: number;
 
   /**
-   * @generated from enum value: MARKUP = 1;
+   * @generated from field: string model = 2;
    */
-  MARKUP = 1,
+  model: string;
 
   /**
-   * @generated from enum value: CODE = 2;
+   * @generated from field: string provider = 3;
    */
-  CODE = 2,
+  provider: string;
 
   /**
-   * @generated from enum value: FILE_SEARCH_RESULTS = 3;
+   * fallback is true if the model is a fallback rather than the model of the request.
+   *
+   * @generated from field: bool fallback = 4;
    */
-  FILE_SEARCH_RESULTS = 3,
-}
-
-/**
- * @generated from enum BlockKind
- */
-export declare type BlockKindJson = "UNKNOWN_BLOCK_KIND" | "MARKUP" | "CODE" | "FILE_SEARCH_RESULTS";
+  fallback: boolean;
+};
 
 /**
- * Describes the enum BlockKind.
+ * Attempt identifies an attempt to generate a response.
+ *
+ * @generated from message Attempt
  */
-export declare const BlockKindSchema: GenEnum<BlockKind, BlockKindJson>;
+export declare type AttemptJson = {
+  /**
+   * number is the number of the attempt starting at 1. It counts the attempts on all models.
+   *
+   * @generated from field: int32 number = 1;
+   */
+  number?: number;
 
-/**
- * @generated from enum BlockRole
- */
-export enum BlockRole {
   /**
-   * @generated from enum value: BLOCK_ROLE_UNKNOWN = 0;
+   * @generated from field: string model = 2;
    */
-  UNKNOWN = 0,
+  model?: string;
 
   /**
-   * @generated from enum value: BLOCK_ROLE_USER = 1;
+   * @generated from field: string provider = 3;
    */
-  USER = 1,
+  provider?: string;
 
   /**
-   * @generated from enum value: BLOCK_ROLE_ASSISTANT = 2;
+   * fallback is true if the model is a fallback rather than the model of the request.
+   *
+   * @generated from field: bool fallback = 4;
    */
-  ASSISTANT = 2,
-}
+  fallback?: boolean;
+};
 
 /**
- * @generated from enum BlockRole
+ * Describes the message Attempt.
+ * Use `create(AttemptSchema)` to create a new message.
  */
-export declare type BlockRoleJson = "BLOCK_ROLE_UNKNOWN" | "BLOCK_ROLE_USER" | "BLOCK_ROLE_ASSISTANT";
+export declare const AttemptSchema: GenMessage<Attempt, AttemptJson>;
+
+/**
+ * CancelGenerateRequest identifies the Generate call to cancel. Either field can be set.
+ *
+ * @generated from message CancelGenerateRequest
+ */
+export declare type CancelGenerateRequest = Message<"CancelGenerateRequest"> & {
+  /**
+   * response_id is the ID of a response streamed by the Generate call.
+   *
+   * @generated from field: string response_id = 1;
+   */
+  responseId: string;
+
+  /**
+   * request_id is the request_id of the GenerateRequest.
+   *
+   * @generated from field: string request_id = 2;
+   */
+  requestId: string;
+};
+
+/**
+ * CancelGenerateRequest identifies the Generate call to cancel. Either field can be set.
+ *
+ * @generated from message CancelGenerateRequest
+ */
+export declare type CancelGenerateRequestJson = {
+  /**
+   * response_id is the ID of a response streamed by the Generate call.
+   *
+   * @generated from field: string response_id = 1;
+   */
+  responseId?: string;
+
+  /**
+   * request_id is the request_id of the GenerateRequest.
+   *
+   * @generated from field: string request_id = 2;
+   */
+  requestId?: string;
+};
+
+/**
+ * Describes the message CancelGenerateRequest.
+ * Use `create(CancelGenerateRequestSchema)` to create a new message.
+ */
+export declare const CancelGenerateRequestSchema: GenMessage<CancelGenerateRequest, CancelGenerateRequestJson>;
+
+/**
+ * @generated from message CancelGenerateResponse
+ */
+export declare type CancelGenerateResponse = Message<"CancelGenerateResponse"> & {
+  /**
+   * cancelled is false if there was no matching Generate call in flight e.g. because it already finished.
+   *
+   * @generated from field: bool cancelled = 1;
+   */
+  cancelled: boolean;
+};
+
+/**
+ * @generated from message CancelGenerateResponse
+ */
+export declare type CancelGenerateResponseJson = {
+  /**
+   * cancelled is false if there was no matching Generate call in flight e.g. because it already finished.
+   *
+   * @generated from field: bool cancelled = 1;
+   */
+  cancelled?: boolean;
+};
+
+/**
+ * Describes the message CancelGenerateResponse.
+ * Use `create(CancelGenerateResponseSchema)` to create a new message.
+ */
+export declare const CancelGenerateResponseSchema: GenMessage<CancelGenerateResponse, CancelGenerateResponseJson>;
+
+/**
+ * Branch is a line of responses in a conversation. Every conversation starts with a single branch;
+ * ForkConversation adds branches that continue from an earlier response.
+ *
+ * @generated from message Branch
+ */
+export declare type Branch = Message<"Branch"> & {
+  /**
+   * @generated from field: string id = 1;
+   */
+  id: string;
+
+  /**
+   * conversation_id is the ID of the conversation. It is the ID of the conversation's first branch.
+   *
+   * @generated from field: string conversation_id = 2;
+   */
+  conversationId: string;
+
+  /**
+   * @generated from field: string name = 3;
+   */
+  name: string;
+
+  /**
+   * parent_branch_id is the ID of the branch this branch was forked from. It is empty for the first branch.
+   *
+   * @generated from field: string parent_branch_id = 4;
+   */
+  parentBranchId: string;
+
+  /**
+   * fork_response_id is the ID of the response the branch was forked from.
+   *
+   * @generated from field: string fork_response_id = 5;
+   */
+  forkResponseId: string;
+
+  /**
+   * head_response_id is the ID of the latest response on the branch.
+   *
+   * @generated from field: string head_response_id = 6;
+   */
+  headResponseId: string;
+
+  /**
+   * @generated from field: google.protobuf.Timestamp create_time = 7;
+   */
+  createTime?: Timestamp;
+
+  /**
+   * principal is the principal that owns the conversation.
+   *
+   * @generated from field: string principal = 8;
+   */
+  principal: string;
+};
+
+/**
+ * Branch is a line of responses in a conversation. Every conversation starts with a single branch;
+ * ForkConversation adds branches that continue from an earlier response.
+ *
+ * @generated from message Branch
+ */
+export declare type BranchJson = {
+  /**
+   * @generated from field: string id = 1;
+   */
+  id?: string;
+
+  /**
+   * conversation_id is the ID of the conversation. It is the ID of the conversation's first branch.
+   *
+   * @generated from field: string conversation_id = 2;
+   */
+  conversationId?: string;
+
+  /**
+   * @generated from field: string name = 3;
+   */
+  name?: string;
+
+  /**
+   * parent_branch_id is the ID of the branch this branch was forked from. It is empty for the first branch.
+   *
+   * @generated from field: string parent_branch_id = 4;
+   */
+  parentBranchId?: string;
+
+  /**
+   * fork_response_id is the ID of the response the branch was forked from.
+   *
+   * @generated from field: string fork_response_id = 5;
+   */
+  forkResponseId?: string;
+
+  /**
+   * head_response_id is the ID of the latest response on the branch.
+   *
+   * @generated from field: string head_response_id = 6;
+   */
+  headResponseId?: string;
+
+  /**
+   * @generated from field: google.protobuf.Timestamp create_time = 7;
+   */
+  createTime?: TimestampJson;
+
+  /**
+   * principal is the principal that owns the conversation.
+   *
+   * @generated from field: string principal = 8;
+   */
+  principal?: string;
+};
+
+/**
+ * Describes the message Branch.
+ * Use `create(BranchSchema)` to create a new message.
+ */
+export declare const BranchSchema: GenMessage<Branch, BranchJson>;
+
+/**
+ * ForkConversationRequest identifies the point to fork the conversation at. Either response_id or block_id must
+ * be set.
+ *
+ * @generated from message ForkConversationRequest
+ */
+export declare type ForkConversationRequest = Message<"ForkConversationRequest"> & {
+  /**
+   * response_id is the ID of the last response to keep.
+   *
+   * @generated from field: string response_id = 1;
+   */
+  responseId: string;
+
+  /**
+   * block_id is the ID of a block generated by the model. The fork keeps the response that generated it.
+   *
+   * @generated from field: string block_id = 2;
+   */
+  blockId: string;
+
+  /**
+   * name is an optional name for the branch.
+   *
+   * @generated from field: string name = 3;
+   */
+  name: string;
+};
+
+/**
+ * ForkConversationRequest identifies the point to fork the conversation at. Either response_id or block_id must
+ * be set.
+ *
+ * @generated from message ForkConversationRequest
+ */
+export declare type ForkConversationRequestJson = {
+  /**
+   * response_id is the ID of the last response to keep.
+   *
+   * @generated from field: string response_id = 1;
+   */
+  responseId?: string;
+
+  /**
+   * block_id is the ID of a block generated by the model. The fork keeps the response that generated it.
+   *
+   * @generated from field: string block_id = 2;
+   */
+  blockId?: string;
+
+  /**
+   * name is an optional name for the branch.
+   *
+   * @generated from field: string name = 3;
+   */
+  name?: string;
+};
+
+/**
+ * Describes the message ForkConversationRequest.
+ * Use `create(ForkConversationRequestSchema)` to create a new message.
+ */
+export declare const ForkConversationRequestSchema: GenMessage<ForkConversationRequest, ForkConversationRequestJson>;
+
+/**
+ * @generated from message ForkConversationResponse
+ */
+export declare type ForkConversationResponse = Message<"ForkConversationResponse"> & {
+  /**
+   * @generated from field: Branch branch = 1;
+   */
+  branch?: Branch;
+
+  /**
+   * blocks are the tool calls in the response the branch was forked from along with their outputs. The outputs are
+   * sent to the model with the first request on the branch so clients don't need to send them again.
+   *
+   * @generated from field: repeated Block blocks = 2;
+   */
+  blocks: Block[];
+};
+
+/**
+ * @generated from message ForkConversationResponse
+ */
+export declare type ForkConversationResponseJson = {
+  /**
+   * @generated from field: Branch branch = 1;
+   */
+  branch?: BranchJson;
+
+  /**
+   * blocks are the tool calls in the response the branch was forked from along with their outputs. The outputs are
+   * sent to the model with the first request on the branch so clients don't need to send them again.
+   *
+   * @generated from field: repeated Block blocks = 2;
+   */
+  blocks?: BlockJson[];
+};
+
+/**
+ * Describes the message ForkConversationResponse.
+ * Use `create(ForkConversationResponseSchema)` to create a new message.
+ */
+export declare const ForkConversationResponseSchema: GenMessage<ForkConversationResponse, ForkConversationResponseJson>;
+
+/**
+ * ListBranchesRequest identifies the conversation. Either field can be set.
+ *
+ * @generated from message ListBranchesRequest
+ */
+export declare type ListBranchesRequest = Message<"ListBranchesRequest"> & {
+  /**
+   * @generated from field: string conversation_id = 1;
+   */
+  conversationId: string;
+
+  /**
+   * response_id is the ID of any response in the conversation.
+   *
+   * @generated from field: string response_id = 2;
+   */
+  responseId: string;
+};
+
+/**
+ * ListBranchesRequest identifies the conversation. Either field can be set.
+ *
+ * @generated from message ListBranchesRequest
+ */
+export declare type ListBranchesRequestJson = {
+  /**
+   * @generated from field: string conversation_id = 1;
+   */
+  conversationId?: string;
+
+  /**
+   * response_id is the ID of any response in the conversation.
+   *
+   * @generated from field: string response_id = 2;
+   */
+  responseId?: string;
+};
+
+/**
+ * Describes the message ListBranchesRequest.
+ * Use `create(ListBranchesRequestSchema)` to create a new message.
+ */
+export declare const ListBranchesRequestSchema: GenMessage<ListBranchesRequest, ListBranchesRequestJson>;
+
+/**
+ * @generated from message ListBranchesResponse
+ */
+export declare type ListBranchesResponse = Message<"ListBranchesResponse"> & {
+  /**
+   * branches are ordered by creation time so the conversation's first branch comes first.
+   *
+   * @generated from field: repeated Branch branches = 1;
+   */
+  branches: Branch[];
+};
+
+/**
+ * @generated from message ListBranchesResponse
+ */
+export declare type ListBranchesResponseJson = {
+  /**
+   * branches are ordered by creation time so the conversation's first branch comes first.
+   *
+   * @generated from field: repeated Branch branches = 1;
+   */
+  branches?: BranchJson[];
+};
+
+/**
+ * Describes the message ListBranchesResponse.
+ * Use `create(ListBranchesResponseSchema)` to create a new message.
+ */
+export declare const ListBranchesResponseSchema: GenMessage<ListBranchesResponse, ListBranchesResponseJson>;
+
+/**
+ * SubmitFeedbackRequest rates a response or a block. At least one of response_id and block_id must be set.
+ *
+ * @generated from message SubmitFeedbackRequest
+ */
+export declare type SubmitFeedbackRequest = Message<"SubmitFeedbackRequest"> & {
+  /**
+   * response_id is the ID of the response being rated.
+   *
+   * @generated from field: string response_id = 1;
+   */
+  responseId: string;
+
+  /**
+   * block_id is the ID of the block being rated e.g. a suggested command.
+   *
+   * @generated from field: string block_id = 2;
+   */
+  blockId: string;
+
+  /**
+   * @generated from field: Rating rating = 3;
+   */
+  rating: Rating;
+
+  /**
+   * comment is free text explaining the rating.
+   *
+   * @generated from field: string comment = 4;
+   */
+  comment: string;
+
+  /**
+   * corrected_command is the command the assistant should have suggested.
+   *
+   * @generated from field: string corrected_command = 5;
+   */
+  correctedCommand: string;
+
+  /**
+   * blocks are the blocks of the conversation as the client sees it in the order they happened. They are required;
+   * the snapshot needs the questions the user asked, which the server doesn't keep, to be replayed as an eval.
+   *
+   * @generated from field: repeated Block blocks = 6;
+   */
+  blocks: Block[];
+};
+
+/**
+ * SubmitFeedbackRequest rates a response or a block. At least one of response_id and block_id must be set.
+ *
+ * @generated from message SubmitFeedbackRequest
+ */
+export declare type SubmitFeedbackRequestJson = {
+  /**
+   * response_id is the ID of the response being rated.
+   *
+   * @generated from field: string response_id = 1;
+   */
+  responseId?: string;
+
+  /**
+   * block_id is the ID of the block being rated e.g. a suggested command.
+   *
+   * @generated from field: string block_id = 2;
+   */
+  blockId?: string;
+
+  /**
+   * @generated from field: Rating rating = 3;
+   */
+  rating?: RatingJson;
+
+  /**
+   * comment is free text explaining the rating.
+   *
+   * @generated from field: string comment = 4;
+   */
+  comment?: string;
+
+  /**
+   * corrected_command is the command the assistant should have suggested.
+   *
+   * @generated from field: string corrected_command = 5;
+   */
+  correctedCommand?: string;
+
+  /**
+   * blocks are the blocks of the conversation as the client sees it in the order they happened. They are required;
+   * the snapshot needs the questions the user asked, which the server doesn't keep, to be replayed as an eval.
+   *
+   * @generated from field: repeated Block blocks = 6;
+   */
+  blocks?: BlockJson[];
+};
+
+/**
+ * Describes the message SubmitFeedbackRequest.
+ * Use `create(SubmitFeedbackRequestSchema)` to create a new message.
+ */
+export declare const SubmitFeedbackRequestSchema: GenMessage<SubmitFeedbackRequest, SubmitFeedbackRequestJson>;
+
+/**
+ * @generated from message SubmitFeedbackResponse
+ */
+export declare type SubmitFeedbackResponse = Message<"SubmitFeedbackResponse"> & {
+  /**
+   * feedback_id is the ID of the stored feedback.
+   *
+   * @generated from field: string feedback_id = 1;
+   */
+  feedbackId: string;
+};
+
+/**
+ * @generated from message SubmitFeedbackResponse
+ */
+export declare type SubmitFeedbackResponseJson = {
+  /**
+   * feedback_id is the ID of the stored feedback.
+   *
+   * @generated from field: string feedback_id = 1;
+   */
+  feedbackId?: string;
+};
+
+/**
+ * Describes the message SubmitFeedbackResponse.
+ * Use `create(SubmitFeedbackResponseSchema)` to create a new message.
+ */
+export declare const SubmitFeedbackResponseSchema: GenMessage<SubmitFeedbackResponse, SubmitFeedbackResponseJson>;
+
+/**
+ * Feedback is a rating stored along with a snapshot of the conversation it applies to.
+ *
+ * @generated from message Feedback
+ */
+export declare type Feedback = Message<"Feedback"> & {
+  /**
+   * @generated from field: string id = 1;
+   */
+  id: string;
+
+  /**
+   * @generated from field: google.protobuf.Timestamp create_time = 2;
+   */
+  createTime?: Timestamp;
+
+  /**
+   * principal is the principal that submitted the feedback. It is empty if OIDC isn't enabled.
+   *
+   * @generated from field: string principal = 3;
+   */
+  principal: string;
+
+  /**
+   * @generated from field: string response_id = 4;
+   */
+  responseId: string;
+
+  /**
+   * @generated from field: string block_id = 5;
+   */
+  blockId: string;
+
+  /**
+   * @generated from field: Rating rating = 6;
+   */
+  rating: Rating;
+
+  /**
+   * @generated from field: string comment = 7;
+   */
+  comment: string;
+
+  /**
+   * @generated from field: string corrected_command = 8;
+   */
+  correctedCommand: string;
+
+  /**
+   * blocks are the snapshot of the conversation. Their outputs are redacted.
+   *
+   * @generated from field: repeated Block blocks = 9;
+   */
+  blocks: Block[];
+};
+
+/**
+ * Feedback is a rating stored along with a snapshot of the conversation it applies to.
+ *
+ * @generated from message Feedback
+ */
+export declare type FeedbackJson = {
+  /**
+   * @generated from field: string id = 1;
+   */
+  id?: string;
+
+  /**
+   * @generated from field: google.protobuf.Timestamp create_time = 2;
+   */
+  createTime?: TimestampJson;
+
+  /**
+   * principal is the principal that submitted the feedback. It is empty if OIDC isn't enabled.
+   *
+   * @generated from field: string principal = 3;
+   */
+  principal?: string;
+
+  /**
+   * @generated from field: string response_id = 4;
+   */
+  responseId?: string;
+
+  /**
+   * @generated from field: string block_id = 5;
+   */
+  blockId?: string;
+
+  /**
+   * @generated from field: Rating rating = 6;
+   */
+  rating?: RatingJson;
+
+  /**
+   * @generated from field: string comment = 7;
+   */
+  comment?: string;
+
+  /**
+   * @generated from field: string corrected_command = 8;
+   */
+  correctedCommand?: string;
+
+  /**
+   * blocks are the snapshot of the conversation. Their outputs are redacted.
+   *
+   * @generated from field: repeated Block blocks = 9;
+   */
+  blocks?: BlockJson[];
+};
+
+/**
+ * Describes the message Feedback.
+ * Use `create(FeedbackSchema)` to create a new message.
+ */
+export declare const FeedbackSchema: GenMessage<Feedback, FeedbackJson>;
+
+/**
+ * Usage is the number of tokens used to generate a response.
+ *
+ * @generated from message Usage
+ */
+export declare type Usage = Message<"Usage"> & {
+  /**
+   * @generated from field: int64 input_tokens = 1;
+   */
+  inputTokens: bigint;
+
+  /**
+   * cached_input_tokens is the number of input tokens that were served from the provider's prompt cache.
+   *
+   * @generated from field: int64 cached_input_tokens = 2;
+   */
+  cachedInputTokens: bigint;
+
+  /**
+   * @generated from field: int64 output_tokens = 3;
+   */
+  outputTokens: bigint;
+
+  /**
+   * @generated from field: int64 total_tokens = 4;
+   */
+  totalTokens: bigint;
+};
+
+/**
+ * Usage is the number of tokens used to generate a response.
+ *
+ * @generated from message Usage
+ */
+export declare type UsageJson = {
+  /**
+   * @generated from field: int64 input_tokens = 1;
+   */
+  inputTokens?: string;
+
+  /**
+   * cached_input_tokens is the number of input tokens that were served from the provider's prompt cache.
+   *
+   * @generated from field: int64 cached_input_tokens = 2;
+   */
+  cachedInputTokens?: string;
+
+  /**
+   * @generated from field: int64 output_tokens = 3;
+   */
+  outputTokens?: string;
+
+  /**
+   * @generated from field: int64 total_tokens = 4;
+   */
+  totalTokens?: string;
+};
+
+/**
+ * Describes the message Usage.
+ * Use `create(UsageSchema)` to create a new message.
+ */
+export declare const UsageSchema: GenMessage<Usage, UsageJson>;
+
+/**
+ * @generated from enum BlockKind
+ */
+export enum BlockKind {
+  /**
+   * @generated from enum value: UNKNOWN_BLOCK_KIND = 0;
+   */
+  UNKNOWN_BLOCK_KIND = 0,
+
+  /**
+   * @generated from enum value: MARKUP = 1;
+   */
+  MARKUP = 1,
+
+  /**
+   * @generated from enum value: CODE = 2;
+   */
+  CODE = 2,
+
+  /**
+   * @generated from enum value: FILE_SEARCH_RESULTS = 3;
+   */
+  FILE_SEARCH_RESULTS = 3,
+
+  /**
+   * TOOL_CALL is a call to a tool that is executed by the server (e.g. a tool provided by an MCP server).
+   * contents holds the JSON arguments of the call and outputs holds the result.
+   *
+   * @generated from enum value: TOOL_CALL = 4;
+   */
+  TOOL_CALL = 4,
+
+  /**
+   * REASONING is a summary of the reasoning of a reasoning model. It is streamed while the model thinks so users can
+   * see why it picked a command. The model keeps its reasoning with the response so these blocks are never sent
+   * back as input.
+   *
+   * @generated from enum value: REASONING = 5;
+   */
+  REASONING = 5,
+}
+
+/**
+ * @generated from enum BlockKind
+ */
+export declare type BlockKindJson = "UNKNOWN_BLOCK_KIND" | "MARKUP" | "CODE" | "FILE_SEARCH_RESULTS" | "TOOL_CALL" | "REASONING";
+
+/**
+ * Describes the enum BlockKind.
+ */
+export declare const BlockKindSchema: GenEnum<BlockKind, BlockKindJson>;
+
+/**
+ * @generated from enum BlockRole
+ */
+export enum BlockRole {
+  /**
+   * @generated from enum value: BLOCK_ROLE_UNKNOWN = 0;
+   */
+  UNKNOWN = 0,
+
+  /**
+   * @generated from enum value: BLOCK_ROLE_USER = 1;
+   */
+  USER = 1,
+
+  /**
+   * @generated from enum value: BLOCK_ROLE_ASSISTANT = 2;
+   */
+  ASSISTANT = 2,
+}
+
+/**
+ * @generated from enum BlockRole
+ */
+export declare type BlockRoleJson = "BLOCK_ROLE_UNKNOWN" | "BLOCK_ROLE_USER" | "BLOCK_ROLE_ASSISTANT";
 
 /**
  * Describes the enum BlockRole.
@@ -434,6 +1614,36 @@ export declare type BlockOutputKindJson = "UNKNOWN_BLOCK_OUTPUT_KIND" | "STDOUT"
  */
 export declare const BlockOutputKindSchema: GenEnum<BlockOutputKind, BlockOutputKindJson>;
 
+/**
+ * @generated from enum Rating
+ */
+export enum Rating {
+  /**
+   * @generated from enum value: RATING_UNSPECIFIED = 0;
+   */
+  UNSPECIFIED = 0,
+
+  /**
+   * @generated from enum value: RATING_THUMBS_UP = 1;
+   */
+  THUMBS_UP = 1,
+
+  /**
+   * @generated from enum value: RATING_THUMBS_DOWN = 2;
+   */
+  THUMBS_DOWN = 2,
+}
+
+/**
+ * @generated from enum Rating
+ */
+export declare type RatingJson = "RATING_UNSPECIFIED" | "RATING_THUMBS_UP" | "RATING_THUMBS_DOWN";
+
+/**
+ * Describes the enum Rating.
+ */
+export declare const RatingSchema: GenEnum<Rating, RatingJson>;
+
 /**
  * BlocksService generates blocks.
  *
@@ -450,5 +1660,48 @@ export declare const BlocksService: GenService<{
     input: typeof GenerateRequestSchema;
     output: typeof GenerateResponseSchema;
   },
+  /**
+   * CancelGenerate stops an in-flight Generate call. The Generate stream ends with a block marking the turn as
+   * cancelled.
+   *
+   * @generated from rpc BlocksService.CancelGenerate
+   */
+  cancelGenerate: {
+    methodKind: "unary";
+    input: typeof CancelGenerateRequestSchema;
+    output: typeof CancelGenerateResponseSchema;
+  },
+  /**
+   * ForkConversation creates a branch of a conversation that continues from an earlier response. Generate calls
+   * with the ID of the branch continue from that response rather than the latest one.
+   *
+   * @generated from rpc BlocksService.ForkConversation
+   */
+  forkConversation: {
+    methodKind: "unary";
+    input: typeof ForkConversationRequestSchema;
+    output: typeof ForkConversationResponseSchema;
+  },
+  /**
+   * ListBranches lists the branches of a conversation.
+   *
+   * @generated from rpc BlocksService.ListBranches
+   */
+  listBranches: {
+    methodKind: "unary";
+    input: typeof ListBranchesRequestSchema;
+    output: typeof ListBranchesResponseSchema;
+  },
+  /**
+   * SubmitFeedback records a rating of a response or one of its blocks e.g. whether a suggested command was right.
+   * The feedback is stored with a snapshot of the conversation so it can be turned into eval samples.
+   *
+   * @generated from rpc BlocksService.SubmitFeedback
+   */
+  submitFeedback: {
+    methodKind: "unary";
+    input: typeof SubmitFeedbackRequestSchema;
+    output: typeof SubmitFeedbackResponseSchema;
+  },
 }>;
 
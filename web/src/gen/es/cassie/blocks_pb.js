@@ -4,12 +4,13 @@
 
 import { enumDesc, fileDesc, messageDesc, serviceDesc, tsEnum } from "@bufbuild/protobuf/codegenv1";
 import { file_cassie_filesearch } from "./filesearch_pb";
+import { file_google_protobuf_timestamp } from "@bufbuild/protobuf/wkt";
 
 /**
  * Describes the file cassie/blocks.proto.
  */
 export const file_cassie_blocks = /*@__PURE__*/
-  fileDesc("ChNjYXNzaWUvYmxvY2tzLnByb3RvIqQCCgVCbG9jaxIYCgRraW5kGAEgASgOMgouQmxvY2tLaW5kEhAKCGxhbmd1YWdlGAIgASgJEhAKCGNvbnRlbnRzGAMgASgJEgoKAmlkGAcgASgJEiYKCG1ldGFkYXRhGAggAygLMhQuQmxvY2suTWV0YWRhdGFFbnRyeRIYCgRyb2xlGAkgASgOMgouQmxvY2tSb2xlEi4KE2ZpbGVfc2VhcmNoX3Jlc3VsdHMYCiADKAsyES5GaWxlU2VhcmNoUmVzdWx0Eh0KB291dHB1dHMYCyADKAsyDC5CbG9ja091dHB1dBIPCgdjYWxsX2lkGAwgASgJGi8KDU1ldGFkYXRhRW50cnkSCwoDa2V5GAEgASgJEg0KBXZhbHVlGAIgASgJOgI4ASJOCgtCbG9ja091dHB1dBIfCgVpdGVtcxgBIAMoCzIQLkJsb2NrT3V0cHV0SXRlbRIeCgRraW5kGAIgASgOMhAuQmxvY2tPdXRwdXRLaW5kIjIKD0Jsb2NrT3V0cHV0SXRlbRIMCgRtaW1lGAEgASgJEhEKCXRleHRfZGF0YRgCIAEoCSJkCg9HZW5lcmF0ZVJlcXVlc3QSFgoGYmxvY2tzGAEgAygLMgYuQmxvY2sSHAoUcHJldmlvdXNfcmVzcG9uc2VfaWQYAiABKAkSGwoTb3BlbmFpX2FjY2Vzc190b2tlbhgDIAEoCSI/ChBHZW5lcmF0ZVJlc3BvbnNlEhYKBmJsb2NrcxgBIAMoCzIGLkJsb2NrEhMKC3Jlc3BvbnNlX2lkGAIgASgJKlIKCUJsb2NrS2luZBIWChJVTktOT1dOX0JMT0NLX0tJTkQQABIKCgZNQVJLVVAQARIICgRDT0RFEAISFwoTRklMRV9TRUFSQ0hfUkVTVUxUUxADKlIKCUJsb2NrUm9sZRIWChJCTE9DS19ST0xFX1VOS05PV04QABITCg9CTE9DS19ST0xFX1VTRVIQARIYChRCTE9DS19ST0xFX0FTU0lTVEFOVBACKkgKD0Jsb2NrT3V0cHV0S2luZBIdChlVTktOT1dOX0JMT0NLX09VVFBVVF9LSU5EEAASCgoGU1RET1VUEAESCgoGU1RERVJSEAIyRAoNQmxvY2tzU2VydmljZRIzCghHZW5lcmF0ZRIQLkdlbmVyYXRlUmVxdWVzdBoRLkdlbmVyYXRlUmVzcG9uc2UiADABQkNCC0Jsb2Nrc1Byb3RvUAFaMmdpdGh1Yi5jb20vamxld2kvY2xvdWQtYXNzaXN0YW50L3Byb3Rvcy9nZW4vY2Fzc2llYgZwcm90bzM", [file_cassie_filesearch]);
+  fileDesc("ChNjYXNzaWUvYmxvY2tzLnByb3RvIpEDCgVCbG9jaxIYCgRraW5kGAEgASgOMgouQmxvY2tLaW5kEhAKCGxhbmd1YWdlGAIgASgJEhAKCGNvbnRlbnRzGAMgASgJEgoKAmlkGAcgASgJEiYKCG1ldGFkYXRhGAggAygLMhQuQmxvY2suTWV0YWRhdGFFbnRyeRIYCgRyb2xlGAkgASgOMgouQmxvY2tSb2xlEi4KE2ZpbGVfc2VhcmNoX3Jlc3VsdHMYCiADKAsyES5GaWxlU2VhcmNoUmVzdWx0Eh0KB291dHB1dHMYCyADKAsyDC5CbG9ja091dHB1dBIPCgdjYWxsX2lkGAwgASgJEiYKDmV4ZWN1dGlvbl9pbmZvGA0gASgLMg4uRXhlY3V0aW9uSW5mbxIcCgljaXRhdGlvbnMYDiADKAsyCS5DaXRhdGlvbhIlCgthdHRhY2htZW50cxgPIAMoCzIQLkJsb2NrT3V0cHV0SXRlbRovCg1NZXRhZGF0YUVudHJ5EgsKA2tleRgBIAEoCRINCgV2YWx1ZRgCIAEoCToCOAEicgoIQ2l0YXRpb24SEwoLc3RhcnRfaW5kZXgYASABKAUSEQoJZW5kX2luZGV4GAIgASgFEg8KB2ZpbGVfaWQYAyABKAkSEAoIZmlsZW5hbWUYBCABKAkSDAoEbGluaxgFIAEoCRINCgV0aXRsZRgGIAEoCSLMAQoNRXhlY3V0aW9uSW5mbxIWCglleGl0X2NvZGUYASABKAVIAIgBARIuCgpzdGFydF90aW1lGAIgASgLMhouZ29vZ2xlLnByb3RvYnVmLlRpbWVzdGFtcBIsCghlbmRfdGltZRgDIAEoCzIaLmdvb2dsZS5wcm90b2J1Zi5UaW1lc3RhbXASEQoJdHJ1bmNhdGVkGAQgASgIEhEKCWNhbmNlbGxlZBgFIAEoCBIRCglydW5uZXJfaWQYBiABKAlCDAoKX2V4aXRfY29kZSJOCgtCbG9ja091dHB1dBIfCgVpdGVtcxgBIAMoCzIQLkJsb2NrT3V0cHV0SXRlbRIeCgRraW5kGAIgASgOMhAuQmxvY2tPdXRwdXRLaW5kIlUKD0Jsb2NrT3V0cHV0SXRlbRIMCgRtaW1lGAEgASgJEhEKCXRleHRfZGF0YRgCIAEoCRITCgtiaW5hcnlfZGF0YRgDIAEoDBIMCgRuYW1lGAQgASgJIpoBCg9HZW5lcmF0ZVJlcXVlc3QSFgoGYmxvY2tzGAEgAygLMgYuQmxvY2sSHAoUcHJldmlvdXNfcmVzcG9uc2VfaWQYAiABKAkSGwoTb3BlbmFpX2FjY2Vzc190b2tlbhgDIAEoCRINCgVtb2RlbBgEIAEoCRISCgpyZXF1ZXN0X2lkGAUgASgJEhEKCWJyYW5jaF9pZBgGIAEoCSKmAQoQR2VuZXJhdGVSZXNwb25zZRIWCgZibG9ja3MYASADKAsyBi5CbG9jaxITCgtyZXNwb25zZV9pZBgCIAEoCRINCgVtb2RlbBgDIAEoCRIVCgV1c2FnZRgEIAEoCzIGLlVzYWdlEhEKCWJyYW5jaF9pZBgFIAEoCRIZCgdhdHRlbXB0GAYgASgLMgguQXR0ZW1wdBIRCglzdGF0ZWxlc3MYByABKAgiTAoHQXR0ZW1wdBIOCgZudW1iZXIYASABKAUSDQoFbW9kZWwYAiABKAkSEAoIcHJvdmlkZXIYAyABKAkSEAoIZmFsbGJhY2sYBCABKAgiQAoVQ2FuY2VsR2VuZXJhdGVSZXF1ZXN0EhMKC3Jlc3BvbnNlX2lkGAEgASgJEhIKCnJlcXVlc3RfaWQYAiABKAkiKwoWQ2FuY2VsR2VuZXJhdGVSZXNwb25zZRIRCgljYW5jZWxsZWQYASABKAgizQEKBkJyYW5jaBIKCgJpZBgBIAEoCRIXCg9jb252ZXJzYXRpb25faWQYAiABKAkSDAoEbmFtZRgDIAEoCRIYChBwYXJlbnRfYnJhbmNoX2lkGAQgASgJEhgKEGZvcmtfcmVzcG9uc2VfaWQYBSABKAkSGAoQaGVhZF9yZXNwb25zZV9pZBgGIAEoCRIvCgtjcmVhdGVfdGltZRgHIAEoCzIaLmdvb2dsZS5wcm90b2J1Zi5UaW1lc3RhbXASEQoJcHJpbmNpcGFsGAggASgJIk4KF0ZvcmtDb252ZXJzYXRpb25SZXF1ZXN0EhMKC3Jlc3BvbnNlX2lkGAEgASgJEhAKCGJsb2NrX2lkGAIgASgJEgwKBG5hbWUYAyABKAkiSwoYRm9ya0NvbnZlcnNhdGlvblJlc3BvbnNlEhcKBmJyYW5jaBgBIAEoCzIHLkJyYW5jaBIWCgZibG9ja3MYAiADKAsyBi5CbG9jayJDChNMaXN0QnJhbmNoZXNSZXF1ZXN0EhcKD2NvbnZlcnNhdGlvbl9pZBgBIAEoCRITCgtyZXNwb25zZV9pZBgCIAEoCSIxChRMaXN0QnJhbmNoZXNSZXNwb25zZRIZCghicmFuY2hlcxgBIAMoCzIHLkJyYW5jaCKbAQoVU3VibWl0RmVlZGJhY2tSZXF1ZXN0EhMKC3Jlc3BvbnNlX2lkGAEgASgJEhAKCGJsb2NrX2lkGAIgASgJEhcKBnJhdGluZxgDIAEoDjIHLlJhdGluZxIPCgdjb21tZW50GAQgASgJEhkKEWNvcnJlY3RlZF9jb21tYW5kGAUgASgJEhYKBmJsb2NrcxgGIAMoCzIGLkJsb2NrIi0KFlN1Ym1pdEZlZWRiYWNrUmVzcG9uc2USEwoLZmVlZGJhY2tfaWQYASABKAki3gEKCEZlZWRiYWNrEgoKAmlkGAEgASgJEi8KC2NyZWF0ZV90aW1lGAIgASgLMhouZ29vZ2xlLnByb3RvYnVmLlRpbWVzdGFtcBIRCglwcmluY2lwYWwYAyABKAkSEwoLcmVzcG9uc2VfaWQYBCABKAkSEAoIYmxvY2tfaWQYBSABKAkSFwoGcmF0aW5nGAYgASgOMgcuUmF0aW5nEg8KB2NvbW1lbnQYByABKAkSGQoRY29ycmVjdGVkX2NvbW1hbmQYCCABKAkSFgoGYmxvY2tzGAkgAygLMgYuQmxvY2siZwoFVXNhZ2USFAoMaW5wdXRfdG9rZW5zGAEgASgDEhsKE2NhY2hlZF9pbnB1dF90b2tlbnMYAiABKAMSFQoNb3V0cHV0X3Rva2VucxgDIAEoAxIUCgx0b3RhbF90b2tlbnMYBCABKAMqcAoJQmxvY2tLaW5kEhYKElVOS05PV05fQkxPQ0tfS0lORBAAEgoKBk1BUktVUBABEggKBENPREUQAhIXChNGSUxFX1NFQVJDSF9SRVNVTFRTEAMSDQoJVE9PTF9DQUxMEAQSDQoJUkVBU09OSU5HEAUqUgoJQmxvY2tSb2xlEhYKEkJMT0NLX1JPTEVfVU5LTk9XThAAEhMKD0JMT0NLX1JPTEVfVVNFUhABEhgKFEJMT0NLX1JPTEVfQVNTSVNUQU5UEAIqSAoPQmxvY2tPdXRwdXRLaW5kEh0KGVVOS05PV05fQkxPQ0tfT1VUUFVUX0tJTkQQABIKCgZTVERPVVQQARIKCgZTVERFUlIQAipOCgZSYXRpbmcSFgoSUkFUSU5HX1VOU1BFQ0lGSUVEEAASFAoQUkFUSU5HX1RIVU1CU19VUBABEhYKElJBVElOR19USFVNQlNfRE9XThACMtgCCg1CbG9ja3NTZXJ2aWNlEjMKCEdlbmVyYXRlEhAuR2VuZXJhdGVSZXF1ZXN0GhEuR2VuZXJhdGVSZXNwb25zZSIAMAESQwoOQ2FuY2VsR2VuZXJhdGUSFi5DYW5jZWxHZW5lcmF0ZVJlcXVlc3QaFy5DYW5jZWxHZW5lcmF0ZVJlc3BvbnNlIgASSQoQRm9ya0NvbnZlcnNhdGlvbhIYLkZvcmtDb252ZXJzYXRpb25SZXF1ZXN0GhkuRm9ya0NvbnZlcnNhdGlvblJlc3BvbnNlIgASPQoMTGlzdEJyYW5jaGVzEhQuTGlzdEJyYW5jaGVzUmVxdWVzdBoVLkxpc3RCcmFuY2hlc1Jlc3BvbnNlIgASQwoOU3VibWl0RmVlZGJhY2sSFi5TdWJtaXRGZWVkYmFja1JlcXVlc3QaFy5TdWJtaXRGZWVkYmFja1Jlc3BvbnNlIgBCQ0ILQmxvY2tzUHJvdG9QAVoyZ2l0aHViLmNvbS9qbGV3aS9jbG91ZC1hc3Npc3RhbnQvcHJvdG9zL2dlbi9jYXNzaWViBnByb3RvMw", [file_cassie_filesearch, file_google_protobuf_timestamp]);
 
 /**
  * Describes the message Block.
@@ -18,33 +19,131 @@ export const file_cassie_blocks = /*@__PURE__*/
 export const BlockSchema = /*@__PURE__*/
   messageDesc(file_cassie_blocks, 0);
 
+/**
+ * Describes the message Citation.
+ * Use `create(CitationSchema)` to create a new message.
+ */
+export const CitationSchema = /*@__PURE__*/
+  messageDesc(file_cassie_blocks, 1);
+
+/**
+ * Describes the message ExecutionInfo.
+ * Use `create(ExecutionInfoSchema)` to create a new message.
+ */
+export const ExecutionInfoSchema = /*@__PURE__*/
+  messageDesc(file_cassie_blocks, 2);
+
 /**
  * Describes the message BlockOutput.
  * Use `create(BlockOutputSchema)` to create a new message.
  */
 export const BlockOutputSchema = /*@__PURE__*/
-  messageDesc(file_cassie_blocks, 1);
+  messageDesc(file_cassie_blocks, 3);
 
 /**
  * Describes the message BlockOutputItem.
  * Use `create(BlockOutputItemSchema)` to create a new message.
  */
 export const BlockOutputItemSchema = /*@__PURE__*/
-  messageDesc(file_cassie_blocks, 2);
+  messageDesc(file_cassie_blocks, 4);
 
 /**
  * Describes the message GenerateRequest.
  * Use `create(GenerateRequestSchema)` to create a new message.
  */
 export const GenerateRequestSchema = /*@__PURE__*/
-  messageDesc(file_cassie_blocks, 3);
+  messageDesc(file_cassie_blocks, 5);
 
 /**
  * Describes the message GenerateResponse.
  * Use `create(GenerateResponseSchema)` to create a new message.
  */
 export const GenerateResponseSchema = /*@__PURE__*/
-  messageDesc(file_cassie_blocks, 4);
+  messageDesc(file_cassie_blocks, 6);
+
+/**
+ * Describes the message Attempt.
+ * Use `create(AttemptSchema)` to create a new message.
+ */
+export const AttemptSchema = /*@__PURE__*/
+  messageDesc(file_cassie_blocks, 7);
+
+/**
+ * Describes the message CancelGenerateRequest.
+ * Use `create(CancelGenerateRequestSchema)` to create a new message.
+ */
+export const CancelGenerateRequestSchema = /*@__PURE__*/
+  messageDesc(file_cassie_blocks, 8);
+
+/**
+ * Describes the message CancelGenerateResponse.
+ * Use `create(CancelGenerateResponseSchema)` to create a new message.
+ */
+export const CancelGenerateResponseSchema = /*@__PURE__*/
+  messageDesc(file_cassie_blocks, 9);
+
+/**
+ * Describes the message Branch.
+ * Use `create(BranchSchema)` to create a new message.
+ */
+export const BranchSchema = /*@__PURE__*/
+  messageDesc(file_cassie_blocks, 10);
+
+/**
+ * Describes the message ForkConversationRequest.
+ * Use `create(ForkConversationRequestSchema)` to create a new message.
+ */
+export const ForkConversationRequestSchema = /*@__PURE__*/
+  messageDesc(file_cassie_blocks, 11);
+
+/**
+ * Describes the message ForkConversationResponse.
+ * Use `create(ForkConversationResponseSchema)` to create a new message.
+ */
+export const ForkConversationResponseSchema = /*@__PURE__*/
+  messageDesc(file_cassie_blocks, 12);
+
+/**
+ * Describes the message ListBranchesRequest.
+ * Use `create(ListBranchesRequestSchema)` to create a new message.
+ */
+export const ListBranchesRequestSchema = /*@__PURE__*/
+  messageDesc(file_cassie_blocks, 13);
+
+/**
+ * Describes the message ListBranchesResponse.
+ * Use `create(ListBranchesResponseSchema)` to create a new message.
+ */
+export const ListBranchesResponseSchema = /*@__PURE__*/
+  messageDesc(file_cassie_blocks, 14);
+
+/**
+ * Describes the message SubmitFeedbackRequest.
+ * Use `create(SubmitFeedbackRequestSchema)` to create a new message.
+ */
+export const SubmitFeedbackRequestSchema = /*@__PURE__*/
+  messageDesc(file_cassie_blocks, 15);
+
+/**
+ * Describes the message SubmitFeedbackResponse.
+ * Use `create(SubmitFeedbackResponseSchema)` to create a new message.
+ */
+export const SubmitFeedbackResponseSchema = /*@__PURE__*/
+  messageDesc(file_cassie_blocks, 16);
+
+/**
+ * Describes the message Feedback.
+ * Use `create(FeedbackSchema)` to create a new message.
+ */
+export const FeedbackSchema = /*@__PURE__*/
+  messageDesc(file_cassie_blocks, 17);
+
+/**
+ * Describes the message Usage.
+ * Use `create(UsageSchema)` to create a new message.
+ */
+export const UsageSchema = /*@__PURE__*/
+  messageDesc(file_cassie_blocks, 18);
 
 /**
  * Describes the enum BlockKind.
@@ -82,6 +181,18 @@ export const BlockOutputKindSchema = /*@__PURE__*/
 export const BlockOutputKind = /*@__PURE__*/
   tsEnum(BlockOutputKindSchema);
 
+/**
+ * Describes the enum Rating.
+ */
+export const RatingSchema = /*@__PURE__*/
+  enumDesc(file_cassie_blocks, 3);
+
+/**
+ * @generated from enum Rating
+ */
+export const Rating = /*@__PURE__*/
+  tsEnum(RatingSchema);
+
 /**
  * BlocksService generates blocks.
  *
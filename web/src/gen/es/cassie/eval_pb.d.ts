@@ -68,6 +68,12 @@ export declare type Assertion = Message<"Assertion"> & {
      */
     value: Assertion_CodeblockRegex;
     case: "codeblockRegex";
+  } | {
+    /**
+     * @generated from field: Assertion.MaxRisk max_risk = 10;
+     */
+    value: Assertion_MaxRisk;
+    case: "maxRisk";
   } | { case: undefined; value?: undefined };
 
   /**
@@ -126,6 +132,11 @@ export declare type AssertionJson = {
    */
   codeblockRegex?: Assertion_CodeblockRegexJson;
 
+  /**
+   * @generated from field: Assertion.MaxRisk max_risk = 10;
+   */
+  maxRisk?: Assertion_MaxRiskJson;
+
   /**
    * If the assertion failed, this will contain the reason.
    *
@@ -330,6 +341,40 @@ export declare type Assertion_CodeblockRegexJson = {
  */
 export declare const Assertion_CodeblockRegexSchema: GenMessage<Assertion_CodeblockRegex, Assertion_CodeblockRegexJson>;
 
+/**
+ * Verifies that no code block is riskier than the given level.
+ *
+ * @generated from message Assertion.MaxRisk
+ */
+export declare type Assertion_MaxRisk = Message<"Assertion.MaxRisk"> & {
+  /**
+   * One of read-only, mutating or destructive
+   *
+   * @generated from field: string level = 1;
+   */
+  level: string;
+};
+
+/**
+ * Verifies that no code block is riskier than the given level.
+ *
+ * @generated from message Assertion.MaxRisk
+ */
+export declare type Assertion_MaxRiskJson = {
+  /**
+   * One of read-only, mutating or destructive
+   *
+   * @generated from field: string level = 1;
+   */
+  level?: string;
+};
+
+/**
+ * Describes the message Assertion.MaxRisk.
+ * Use `create(Assertion_MaxRiskSchema)` to create a new message.
+ */
+export declare const Assertion_MaxRiskSchema: GenMessage<Assertion_MaxRisk, Assertion_MaxRiskJson>;
+
 /**
  * What we are checking for.
  *
@@ -375,6 +420,13 @@ export enum Assertion_Type {
    * @generated from enum value: TYPE_CODEBLOCK_REGEX = 5;
    */
   CODEBLOCK_REGEX = 5,
+
+  /**
+   * Are all code blocks at most the given risk level?
+   *
+   * @generated from enum value: TYPE_MAX_RISK = 6;
+   */
+  MAX_RISK = 6,
 }
 
 /**
@@ -382,7 +434,7 @@ export enum Assertion_Type {
  *
  * @generated from enum Assertion.Type
  */
-export declare type Assertion_TypeJson = "TYPE_UNKNOWN" | "TYPE_SHELL_REQUIRED_FLAG" | "TYPE_TOOL_INVOKED" | "TYPE_FILE_RETRIEVED" | "TYPE_LLM_JUDGE" | "TYPE_CODEBLOCK_REGEX";
+export declare type Assertion_TypeJson = "TYPE_UNKNOWN" | "TYPE_SHELL_REQUIRED_FLAG" | "TYPE_TOOL_INVOKED" | "TYPE_FILE_RETRIEVED" | "TYPE_LLM_JUDGE" | "TYPE_CODEBLOCK_REGEX" | "TYPE_MAX_RISK";
 
 /**
  * Describes the enum Assertion.Type.
@@ -588,6 +640,13 @@ export declare type ExperimentSpec = Message<"ExperimentSpec"> & {
    * @generated from field: string inference_endpoint = 3;
    */
   inferenceEndpoint: string;
+
+  /**
+   * Model to request from the inference service. If empty the server's default model is used.
+   *
+   * @generated from field: string model = 4;
+   */
+  model: string;
 };
 
 /**
@@ -614,6 +673,13 @@ export declare type ExperimentSpecJson = {
    * @generated from field: string inference_endpoint = 3;
    */
   inferenceEndpoint?: string;
+
+  /**
+   * Model to request from the inference service. If empty the server's default model is used.
+   *
+   * @generated from field: string model = 4;
+   */
+  model?: string;
 };
 
 /**
@@ -9,7 +9,7 @@ import { file_buf_validate_validate } from "../buf/validate/validate_pb";
  * Describes the file cassie/eval.proto.
  */
 export const file_cassie_eval = /*@__PURE__*/
-  fileDesc("ChFjYXNzaWUvZXZhbC5wcm90byKhBwoJQXNzZXJ0aW9uEhgKBG5hbWUYASABKAlCCrpIB8gBAXICEAESJQoEdHlwZRgCIAEoDjIPLkFzc2VydGlvbi5UeXBlQga6SAPIAQESIQoGcmVzdWx0GAMgASgOMhEuQXNzZXJ0aW9uLlJlc3VsdBI7ChNzaGVsbF9yZXF1aXJlZF9mbGFnGAQgASgLMhwuQXNzZXJ0aW9uLlNoZWxsUmVxdWlyZWRGbGFnSAASNAoPdG9vbF9pbnZvY2F0aW9uGAUgASgLMhkuQXNzZXJ0aW9uLlRvb2xJbnZvY2F0aW9uSAASMgoOZmlsZV9yZXRyaWV2YWwYBiABKAsyGC5Bc3NlcnRpb24uRmlsZVJldHJpZXZhbEgAEigKCWxsbV9qdWRnZRgHIAEoCzITLkFzc2VydGlvbi5MTE1KdWRnZUgAEjQKD2NvZGVibG9ja19yZWdleBgIIAEoCzIZLkFzc2VydGlvbi5Db2RlYmxvY2tSZWdleEgAEhYKDmZhaWx1cmVfcmVhc29uGAkgASgJGkwKEVNoZWxsUmVxdWlyZWRGbGFnEhsKB2NvbW1hbmQYASABKAlCCrpIB8gBAXICEAESGgoFZmxhZ3MYAiADKAlCC7pICMgBAZIBAggBGi8KDlRvb2xJbnZvY2F0aW9uEh0KCXRvb2xfbmFtZRgBIAEoCUIKukgHyAEBcgIQARo/Cg1GaWxlUmV0cmlldmFsEhsKB2ZpbGVfaWQYASABKAlCCrpIB8gBAXICEAESEQoJZmlsZV9uYW1lGAIgASgJGiYKCExMTUp1ZGdlEhoKBnByb21wdBgBIAEoCUIKukgHyAEBcgIQARorCg5Db2RlYmxvY2tSZWdleBIZCgVyZWdleBgBIAEoCUIKukgHyAEBcgIQASKUAQoEVHlwZRIQCgxUWVBFX1VOS05PV04QABIcChhUWVBFX1NIRUxMX1JFUVVJUkVEX0ZMQUcQARIVChFUWVBFX1RPT0xfSU5WT0tFRBACEhcKE1RZUEVfRklMRV9SRVRSSUVWRUQQAxISCg5UWVBFX0xMTV9KVURHRRAEEhgKFFRZUEVfQ09ERUJMT0NLX1JFR0VYEAUiUwoGUmVzdWx0EhIKDlJFU1VMVF9VTktOT1dOEAASDwoLUkVTVUxUX1RSVUUQARIQCgxSRVNVTFRfRkFMU0UQAhISCg5SRVNVTFRfU0tJUFBFRBADQhAKB3BheWxvYWQSBbpIAggBIpoBCgpFdmFsU2FtcGxlEhgKBGtpbmQYASABKAlCCrpIB8gBAXICEAESJQoIbWV0YWRhdGEYAiABKAsyCy5PYmplY3RNZXRhQga6SAPIAQESHgoKaW5wdXRfdGV4dBgDIAEoCUIKukgHyAEBcgIQARIrCgphc3NlcnRpb25zGAQgAygLMgouQXNzZXJ0aW9uQgu6SAjIAQGSAQIIASIrCgtFdmFsRGF0YXNldBIcCgdzYW1wbGVzGAEgAygLMgsuRXZhbFNhbXBsZSImCgpPYmplY3RNZXRhEhgKBG5hbWUYASABKAlCCrpIB8gBAXICEAEiegoORXhwZXJpbWVudFNwZWMSIAoMZGF0YXNldF9wYXRoGAEgASgJQgq6SAfIAQFyAhABEh4KCm91dHB1dF9kaXIYAiABKAlCCrpIB8gBAXICEAESJgoSaW5mZXJlbmNlX2VuZHBvaW50GAMgASgJQgq6SAfIAQFyAhABIpUBCgpFeHBlcmltZW50Eh8KC2FwaV92ZXJzaW9uGAEgASgJQgq6SAfIAQFyAhABEhgKBGtpbmQYAiABKAlCCrpIB8gBAXICEAESJQoIbWV0YWRhdGEYAyABKAsyCy5PYmplY3RNZXRhQga6SAPIAQESJQoEc3BlYxgEIAEoCzIPLkV4cGVyaW1lbnRTcGVjQga6SAPIAQFCQUIJRXZhbFByb3RvUAFaMmdpdGh1Yi5jb20vamxld2kvY2xvdWQtYXNzaXN0YW50L3Byb3Rvcy9nZW4vY2Fzc2llYgZwcm90bzM", [file_buf_validate_validate]);
+  fileDesc("ChFjYXNzaWUvZXZhbC5wcm90byKiCAoJQXNzZXJ0aW9uEhgKBG5hbWUYASABKAlCCrpIB8gBAXICEAESJQoEdHlwZRgCIAEoDjIPLkFzc2VydGlvbi5UeXBlQga6SAPIAQESIQoGcmVzdWx0GAMgASgOMhEuQXNzZXJ0aW9uLlJlc3VsdBI7ChNzaGVsbF9yZXF1aXJlZF9mbGFnGAQgASgLMhwuQXNzZXJ0aW9uLlNoZWxsUmVxdWlyZWRGbGFnSAASNAoPdG9vbF9pbnZvY2F0aW9uGAUgASgLMhkuQXNzZXJ0aW9uLlRvb2xJbnZvY2F0aW9uSAASMgoOZmlsZV9yZXRyaWV2YWwYBiABKAsyGC5Bc3NlcnRpb24uRmlsZVJldHJpZXZhbEgAEigKCWxsbV9qdWRnZRgHIAEoCzITLkFzc2VydGlvbi5MTE1KdWRnZUgAEjQKD2NvZGVibG9ja19yZWdleBgIIAEoCzIZLkFzc2VydGlvbi5Db2RlYmxvY2tSZWdleEgAEiYKCG1heF9yaXNrGAogASgLMhIuQXNzZXJ0aW9uLk1heFJpc2tIABIWCg5mYWlsdXJlX3JlYXNvbhgJIAEoCRpMChFTaGVsbFJlcXVpcmVkRmxhZxIbCgdjb21tYW5kGAEgASgJQgq6SAfIAQFyAhABEhoKBWZsYWdzGAIgAygJQgu6SAjIAQGSAQIIARovCg5Ub29sSW52b2NhdGlvbhIdCgl0b29sX25hbWUYASABKAlCCrpIB8gBAXICEAEaPwoNRmlsZVJldHJpZXZhbBIbCgdmaWxlX2lkGAEgASgJQgq6SAfIAQFyAhABEhEKCWZpbGVfbmFtZRgCIAEoCRomCghMTE1KdWRnZRIaCgZwcm9tcHQYASABKAlCCrpIB8gBAXICEAEaKwoOQ29kZWJsb2NrUmVnZXgSGQoFcmVnZXgYASABKAlCCrpIB8gBAXICEAEaRAoHTWF4UmlzaxI5CgVsZXZlbBgBIAEoCUIqukgnyAEBciJSCXJlYWQtb25seVIIbXV0YXRpbmdSC2Rlc3RydWN0aXZlIqcBCgRUeXBlEhAKDFRZUEVfVU5LTk9XThAAEhwKGFRZUEVfU0hFTExfUkVRVUlSRURfRkxBRxABEhUKEVRZUEVfVE9PTF9JTlZPS0VEEAISFwoTVFlQRV9GSUxFX1JFVFJJRVZFRBADEhIKDlRZUEVfTExNX0pVREdFEAQSGAoUVFlQRV9DT0RFQkxPQ0tfUkVHRVgQBRIRCg1UWVBFX01BWF9SSVNLEAYiUwoGUmVzdWx0EhIKDlJFU1VMVF9VTktOT1dOEAASDwoLUkVTVUxUX1RSVUUQARIQCgxSRVNVTFRfRkFMU0UQAhISCg5SRVNVTFRfU0tJUFBFRBADQhAKB3BheWxvYWQSBbpIAggBIpoBCgpFdmFsU2FtcGxlEhgKBGtpbmQYASABKAlCCrpIB8gBAXICEAESJQoIbWV0YWRhdGEYAiABKAsyCy5PYmplY3RNZXRhQga6SAPIAQESHgoKaW5wdXRfdGV4dBgDIAEoCUIKukgHyAEBcgIQARIrCgphc3NlcnRpb25zGAQgAygLMgouQXNzZXJ0aW9uQgu6SAjIAQGSAQIIASIrCgtFdmFsRGF0YXNldBIcCgdzYW1wbGVzGAEgAygLMgsuRXZhbFNhbXBsZSImCgpPYmplY3RNZXRhEhgKBG5hbWUYASABKAlCCrpIB8gBAXICEAEiiQEKDkV4cGVyaW1lbnRTcGVjEiAKDGRhdGFzZXRfcGF0aBgBIAEoCUIKukgHyAEBcgIQARIeCgpvdXRwdXRfZGlyGAIgASgJQgq6SAfIAQFyAhABEiYKEmluZmVyZW5jZV9lbmRwb2ludBgDIAEoCUIKukgHyAEBcgIQARINCgVtb2RlbBgEIAEoCSKVAQoKRXhwZXJpbWVudBIfCgthcGlfdmVyc2lvbhgBIAEoCUIKukgHyAEBcgIQARIYCgRraW5kGAIgASgJQgq6SAfIAQFyAhABEiUKCG1ldGFkYXRhGAMgASgLMgsuT2JqZWN0TWV0YUIGukgDyAEBEiUKBHNwZWMYBCABKAsyDy5FeHBlcmltZW50U3BlY0IGukgDyAEBQkFCCUV2YWxQcm90b1ABWjJnaXRodWIuY29tL2psZXdpL2Nsb3VkLWFzc2lzdGFudC9wcm90b3MvZ2VuL2Nhc3NpZWIGcHJvdG8z", [file_buf_validate_validate]);
 
 /**
  * Describes the message Assertion.
@@ -53,6 +53,13 @@ export const Assertion_LLMJudgeSchema = /*@__PURE__*/
 export const Assertion_CodeblockRegexSchema = /*@__PURE__*/
   messageDesc(file_cassie_eval, 0, 4);
 
+/**
+ * Describes the message Assertion.MaxRisk.
+ * Use `create(Assertion_MaxRiskSchema)` to create a new message.
+ */
+export const Assertion_MaxRiskSchema = /*@__PURE__*/
+  messageDesc(file_cassie_eval, 0, 5);
+
 /**
  * Describes the enum Assertion.Type.
  */
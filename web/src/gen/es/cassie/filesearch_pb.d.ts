@@ -38,11 +38,19 @@ export declare type FileSearchResult = Message<"FileSearchResult"> & {
   /**
    * Link to display for this file
    *
-   * TOO(jlewi): Should we include the file contents?
-   *
    * @generated from field: string Link = 4;
    */
   Link: string;
+
+  /**
+   * The ID of the matching section of the file for results from the local docs index. Several sections of the
+   * same file can match.
+   *
+   * TOO(jlewi): Should we include the file contents?
+   *
+   * @generated from field: string ChunkID = 5;
+   */
+  ChunkID: string;
 };
 
 /**
@@ -73,11 +81,19 @@ export declare type FileSearchResultJson = {
   /**
    * Link to display for this file
    *
-   * TOO(jlewi): Should we include the file contents?
-   *
    * @generated from field: string Link = 4;
    */
   Link?: string;
+
+  /**
+   * The ID of the matching section of the file for results from the local docs index. Several sections of the
+   * same file can match.
+   *
+   * TOO(jlewi): Should we include the file contents?
+   *
+   * @generated from field: string ChunkID = 5;
+   */
+  ChunkID?: string;
 };
 
 /**
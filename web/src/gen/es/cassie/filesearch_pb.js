@@ -8,7 +8,7 @@ import { fileDesc, messageDesc } from "@bufbuild/protobuf/codegenv1";
  * Describes the file cassie/filesearch.proto.
  */
 export const file_cassie_filesearch = /*@__PURE__*/
-  fileDesc("ChdjYXNzaWUvZmlsZXNlYXJjaC5wcm90byJRChBGaWxlU2VhcmNoUmVzdWx0Eg4KBkZpbGVJRBgBIAEoCRIQCghGaWxlTmFtZRgCIAEoCRINCgVTY29yZRgDIAEoARIMCgRMaW5rGAQgASgJQkdCD0ZpbGVzZWFyY2hQcm90b1ABWjJnaXRodWIuY29tL2psZXdpL2Nsb3VkLWFzc2lzdGFudC9wcm90b3MvZ2VuL2Nhc3NpZWIGcHJvdG8z");
+  fileDesc("ChdjYXNzaWUvZmlsZXNlYXJjaC5wcm90byJiChBGaWxlU2VhcmNoUmVzdWx0Eg4KBkZpbGVJRBgBIAEoCRIQCghGaWxlTmFtZRgCIAEoCRINCgVTY29yZRgDIAEoARIMCgRMaW5rGAQgASgJEg8KB0NodW5rSUQYBSABKAlCR0IPRmlsZXNlYXJjaFByb3RvUAFaMmdpdGh1Yi5jb20vamxld2kvY2xvdWQtYXNzaXN0YW50L3Byb3Rvcy9nZW4vY2Fzc2llYgZwcm90bzM");
 
 /**
  * Describes the message FileSearchResult.